@@ -5,15 +5,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
 	"maps/api/internal/config"
 	"maps/api/internal/db"
+	"maps/api/internal/dedupe"
 	"maps/api/internal/handlers"
+	"maps/api/internal/holidays"
+	"maps/api/internal/media"
 	"maps/api/internal/middleware"
+	"maps/api/internal/offline"
+	"maps/api/internal/search"
+	"maps/api/internal/staticmap"
+	"maps/api/internal/storage"
+	"maps/api/internal/styles"
+	"maps/api/internal/tiles"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
@@ -41,6 +48,49 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to run migrations")
 	}
 
+	// Store this year's calendar holidays for special business hours
+	if err := holidays.Sync(context.Background(), database); err != nil {
+		log.Error().Err(err).Msg("Failed to sync holidays")
+	}
+
+	// Build the autocomplete index and keep it in sync with business changes
+	searchIndex := search.NewIndex(database)
+	if err := searchIndex.Load(context.Background()); err != nil {
+		log.Error().Err(err).Msg("Failed to load search index")
+	}
+
+	notifier := db.NewNotifier(cfg)
+	defer notifier.Close()
+	keySyncer := search.NewKeySyncer(database)
+	duplicates := dedupe.NewDetector(database)
+	poiTiles := tiles.NewPOISource(database)
+	tileCache := tiles.NewCache(int64(cfg.TileCacheMB)<<20, cfg.TileCacheDir, int64(cfg.TileDiskMB)<<20)
+	tileStore := tiles.NewStore(cfg.TilesDir, tileCache)
+	defer tileStore.Close()
+	mapAssets := styles.NewAssets(cfg.StylesDir, cfg.SpritesDir, cfg.FontsDir, cfg.FallbackFont)
+	staticMaps := staticmap.NewRenderer(tileStore, mapAssets)
+	offlineBuilder := offline.NewBuilder(database, tileStore, mapAssets, cfg.OfflineDir, cfg.OfflineTiles, time.Duration(cfg.OfflineTTL)*24*time.Hour)
+	objectStore, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up upload storage")
+	}
+	uploads := media.NewUploads(database, objectStore, time.Duration(cfg.UploadTTL)*time.Hour, media.VideoOptions{
+		FFmpeg:      cfg.FFmpegPath,
+		FFprobe:     cfg.FFprobePath,
+		MaxBytes:    int64(cfg.MaxVideoMB) << 20,
+		MaxDuration: time.Duration(cfg.MaxVideoSecs) * time.Second,
+	})
+	resumables, err := media.NewResumables(database, uploads, cfg.PartialDir)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up resumable uploads")
+	}
+	for _, fn := range []func(string){searchIndex.HandleNotify, keySyncer.HandleNotify, poiTiles.HandleNotify} {
+		if err := notifier.Subscribe(db.BusinessChangesChannel, fn); err != nil {
+			log.Error().Err(err).Msg("Failed to subscribe to business changes")
+		}
+	}
+	go notifier.Run()
+
 	// Initialize router
 	r := chi.NewRouter()
 
@@ -50,7 +100,10 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.CORS)
-	r.Use(chimw.Timeout(30 * time.Second))
+	// Uploads, local upload downloads and offline package downloads run
+	// past the server timeouts
+	r.Use(middleware.Timeout(30*time.Second, time.Duration(cfg.UploadTimeout)*time.Minute,
+		"/api/upload", "/uploads/", "/api/offline/packages/*/download"))
 
 	// Rate limiting
 	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit)
@@ -74,15 +127,30 @@ func main() {
 		// Public tile endpoints (no auth required)
 		r.Group(func(public chi.Router) {
 			public.Route("/tiles", func(tr chi.Router) {
-				tr.Get("/{z}/{x}/{y}.pbf", handlers.GetTile(cfg))
-				tr.Get("/json", handlers.GetTileJSON(cfg))
-				tr.Get("/list", handlers.ListTilesets(cfg))
+				tr.Get("/{z}/{x}/{y}.{ext}", handlers.GetTile(tileStore))
+				tr.Get("/pois/{z}/{x}/{y}.pbf", handlers.GetPOITile(poiTiles))
+				tr.Get("/json", handlers.GetTileJSON(tileStore))
+				tr.Get("/list", handlers.ListTilesets(tileStore))
+				tr.Get("/{tileset}/{z}/{x}/{y}", handlers.GetTilesetTile(tileStore))
 			})
 
+			// Map styles, glyphs and sprites
+			public.Get("/styles", handlers.ListStyles(mapAssets))
+			public.Get("/styles/{name}.json", handlers.GetStyle(mapAssets))
+			public.Get("/fonts/{fontstack}/{range}.pbf", handlers.GetGlyphs(mapAssets))
+			public.Get("/sprites/{file}", handlers.GetSprite(mapAssets))
+			public.Get("/staticmap", handlers.GetStaticMap(staticMaps))
+			public.Get("/offline/estimate", handlers.GetOfflineEstimate(offlineBuilder))
+
 			// Public categories and nearby business search for anonymous map usage
 			public.Get("/categories", handlers.GetCategories(database))
+			public.Get("/regions", handlers.GetRegions(database))
+			public.Get("/holidays", handlers.ListHolidays(database))
 			public.Get("/business/nearby", handlers.GetNearbyBusinesses(database))
 			public.Get("/business/search", handlers.SearchBusinesses(database, cfg))
+			public.Get("/business/in-bbox", handlers.GetBusinessesInBBox(database))
+			public.Post("/business/in-polygon", handlers.GetBusinessesInPolygon(database))
+			public.Get("/autocomplete", handlers.Autocomplete(database, searchIndex))
 			public.Get("/route", handlers.GetRoute(cfg))
 			public.Get("/distance-matrix", handlers.GetDistanceMatrix(cfg))
 		})
@@ -100,6 +168,30 @@ func main() {
 			priv.Put("/me", handlers.UpdateMe(database))
 			priv.Get("/activity", handlers.GetActivity(database))
 
+			// Service regions (admin)
+			priv.Put("/regions/{slug}", handlers.UpsertRegion(database))
+
+			// Business categories and their import/publish mappings (admin).
+			// Registered flat: GET /categories is public.
+			priv.Post("/categories", handlers.CreateCategory(database, searchIndex))
+			priv.Put("/categories/{id}", handlers.UpdateCategory(database, searchIndex))
+			priv.Delete("/categories/{id}", handlers.DeleteCategory(database, searchIndex))
+			priv.Get("/categories/mappings", handlers.ListCategoryMappings(database))
+			priv.Put("/categories/mappings", handlers.PutCategoryMapping(database))
+			priv.Delete("/categories/mappings/{mappingId}", handlers.DeleteCategoryMapping(database))
+
+			// Announced holidays (admin)
+			priv.Put("/holidays/{key}/{date}", handlers.PutHoliday(database))
+			priv.Delete("/holidays/{key}/{date}", handlers.DeleteHoliday(database))
+
+			// Offline map packages
+			priv.Route("/offline/packages", func(or chi.Router) {
+				or.Post("/", handlers.CreateOfflinePackage(offlineBuilder))
+				or.Get("/", handlers.ListOfflinePackages(database))
+				or.Get("/{id}", handlers.GetOfflinePackage(database))
+				or.Get("/{id}/download", handlers.DownloadOfflinePackage(database, offlineBuilder))
+			})
+
 			// Routing endpoints
 			priv.Post("/match", handlers.MatchGPS(cfg))
 
@@ -111,11 +203,66 @@ func main() {
 			priv.Route("/business", func(br chi.Router) {
 				br.Post("/", handlers.CreateBusiness(database))
 				br.Get("/saved", handlers.GetSavedBusinesses(database))
+				br.Get("/claims", handlers.ListMyClaims(database))
+				br.Get("/claims/pending", handlers.ListPendingClaims(database))
+				br.Get("/transfers", handlers.ListMyTransfers(database))
+				br.Get("/changes/pending", handlers.ListPendingBusinessChanges(database))
+				br.Get("/duplicates", handlers.ListDuplicateBusinesses(database))
+				br.Post("/duplicates/scan", handlers.ScanDuplicateBusinesses(database, duplicates))
+				br.Post("/duplicates/{duplicateId}/dismiss", handlers.DismissDuplicateBusiness(database))
 				br.Get("/{id}", handlers.GetBusiness(database))
 				br.Put("/{id}", handlers.UpdateBusiness(database))
 				br.Post("/{id}/save", handlers.SaveBusiness(database))
 				br.Delete("/{id}/save", handlers.UnsaveBusiness(database))
 				br.Post("/{id}/verify", handlers.VerifyBusiness(database))
+				br.Post("/{id}/merge", handlers.MergeBusiness(database))
+
+				// Opening hours
+				br.Get("/{id}/hours", handlers.GetBusinessHours(database))
+				br.Put("/{id}/hours", handlers.SetBusinessHours(database))
+				br.Put("/{id}/special-hours", handlers.SetSpecialHours(database))
+
+				// Media gallery
+				br.Get("/{id}/media", handlers.ListBusinessMedia(database))
+				br.Post("/{id}/media", handlers.AttachBusinessMedia(database, uploads))
+				br.Put("/{id}/media/order", handlers.ReorderBusinessMedia(database))
+				br.Put("/{id}/media/{mediaId}", handlers.UpdateBusinessMedia(database))
+				br.Put("/{id}/media/{mediaId}/cover", handlers.SetBusinessCover(database))
+				br.Delete("/{id}/media/{mediaId}", handlers.DeleteBusinessMedia(database))
+
+				// Ownership claims and transfers
+				br.Post("/{id}/claims", handlers.CreateBusinessClaim(database, uploads, cfg))
+				br.Post("/{id}/claims/{claimId}/verify", handlers.VerifyBusinessClaim(database))
+				br.Post("/{id}/claims/{claimId}/resend-code", handlers.ResendClaimCode(database, cfg))
+				br.Post("/{id}/claims/{claimId}/approve", handlers.ApproveBusinessClaim(database))
+				br.Post("/{id}/claims/{claimId}/reject", handlers.RejectBusinessClaim(database))
+				br.Delete("/{id}/claims/{claimId}", handlers.CancelBusinessClaim(database))
+				br.Post("/{id}/transfer", handlers.StartOwnershipTransfer(database))
+				br.Delete("/{id}/transfer", handlers.CancelOwnershipTransfer(database))
+				br.Post("/{id}/transfer/accept", handlers.AcceptOwnershipTransfer(database))
+				br.Post("/{id}/transfer/decline", handlers.DeclineOwnershipTransfer(database))
+				br.Get("/{id}/ownership-history", handlers.GetOwnershipHistory(database))
+
+				// Moderation of new businesses and edits
+				br.Get("/{id}/changes", handlers.ListBusinessChanges(database))
+				br.Get("/{id}/changes/{changeId}/diff", handlers.GetBusinessChangeDiff(database))
+				br.Post("/{id}/changes/{changeId}/approve", handlers.ApproveBusinessChange(database))
+				br.Post("/{id}/changes/{changeId}/reject", handlers.RejectBusinessChange(database))
+
+				// Edit history
+				br.Get("/{id}/revisions", handlers.ListBusinessRevisions(database))
+				br.Get("/{id}/revisions/{revision}", handlers.GetBusinessRevision(database))
+				br.Post("/{id}/revisions/{revision}/revert", handlers.RevertBusinessRevision(database))
+
+				// Reviews
+				br.Get("/{id}/reviews", handlers.ListReviews(database))
+				br.Post("/{id}/reviews", handlers.CreateReview(database))
+				br.Put("/{id}/reviews/{reviewId}", handlers.UpdateReview(database))
+				br.Delete("/{id}/reviews/{reviewId}", handlers.DeleteReview(database))
+				br.Put("/{id}/reviews/{reviewId}/reply", handlers.ReplyToReview(database))
+				br.Delete("/{id}/reviews/{reviewId}/reply", handlers.DeleteReviewReply(database))
+				br.Post("/{id}/reviews/{reviewId}/helpful", handlers.MarkReviewHelpful(database))
+				br.Delete("/{id}/reviews/{reviewId}/helpful", handlers.UnmarkReviewHelpful(database))
 			})
 
 			// Posts endpoints
@@ -129,14 +276,24 @@ func main() {
 				pr.Delete("/{id}/like", handlers.UnlikePost(database))
 			})
 			// Upload endpoint
-			priv.Post("/upload", handlers.UploadFile(cfg))
+			priv.Post("/upload", handlers.UploadFile(uploads))
+			priv.Post("/upload/presign", handlers.PresignUpload(uploads))
+			priv.Post("/upload/complete", handlers.CompleteUpload(uploads))
+			priv.Route("/upload/resumable", func(ur chi.Router) {
+				ur.Post("/", handlers.CreateResumableUpload(resumables))
+				ur.Head("/{id}", handlers.GetResumableUpload(resumables))
+				ur.Get("/{id}", handlers.GetResumableUpload(resumables))
+				ur.Patch("/{id}", handlers.PatchResumableUpload(resumables))
+				ur.Delete("/{id}", handlers.DeleteResumableUpload(resumables))
+				ur.Post("/{id}/complete", handlers.CompleteResumableUpload(resumables))
+			})
 		})
 	})
 
-	// Serve uploaded files
-	workDir, _ := os.Getwd()
-	filesDir := http.Dir(filepath.Join(workDir, "uploads"))
-	FileServer(r, "/uploads", filesDir)
+	// Serve uploaded files and presigned uploads with the local backend
+	if local, ok := objectStore.(*storage.Local); ok {
+		r.Handle("/uploads/*", local)
+	}
 
 	// Create server
 	srv := &http.Server{
@@ -171,24 +328,3 @@ func main() {
 
 	log.Info().Msg("Server exited properly")
 }
-
-// FileServer conveniently sets up a http.FileServer handler to serve
-// static files from a http.FileSystem.
-func FileServer(r chi.Router, path string, root http.FileSystem) {
-	if strings.ContainsAny(path, "{}*") {
-		panic("FileServer does not permit any URL parameters.")
-	}
-
-	if path != "/" && path[len(path)-1] != '/' {
-		r.Get(path, http.RedirectHandler(path+"/", 301).ServeHTTP)
-		path += "/"
-	}
-	path += "*"
-
-	r.Get(path, func(w http.ResponseWriter, r *http.Request) {
-		rctx := chi.RouteContext(r.Context())
-		pathPrefix := strings.TrimSuffix(rctx.RoutePattern(), "/*")
-		fs := http.StripPrefix(pathPrefix, http.FileServer(root))
-		fs.ServeHTTP(w, r)
-	})
-}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+
+	"maps/api/internal/categories"
+
+	"github.com/lib/pq"
+)
+
+// place is a Nominatim place to import
+type place struct {
+	ExternalID string // OSM type and id, e.g. N123456
+	Name       string
+	Class      string
+	Type       string
+	WKT        string
+	Street     string
+}
+
+// regionImport writes the places of one region into didi. Places are
+// upserted on (source, external_id), so re-imports keep business ids and
+// everything attached to them.
+type regionImport struct {
+	db       *sql.DB
+	region   importRegion
+	mappings categories.Mappings
+	unmapped map[string]int
+	seen     []string
+	imported int
+}
+
+func newRegionImport(db *sql.DB, region importRegion, mappings categories.Mappings, unmapped map[string]int) *regionImport {
+	// seen starts empty rather than nil, which pq would send as NULL
+	return &regionImport{db: db, region: region, mappings: mappings, unmapped: unmapped, seen: []string{}}
+}
+
+// add imports a place. A claimed or merged business keeps its details;
+// only unowned imported businesses follow OSM.
+func (ri *regionImport) add(p place) error {
+	var catID sql.NullString
+	if id, ok := ri.mappings.OSM(p.Class, p.Type); ok {
+		catID = sql.NullString{String: id, Valid: true}
+	} else {
+		ri.unmapped[categories.OSMKey(p.Class, p.Type)]++
+	}
+
+	// Businesses imported before external ids were stored are adopted by
+	// name and position instead of duplicated
+	_, err := ri.db.Exec(`
+		UPDATE businesses SET external_id = $1
+		WHERE id = (
+			SELECT id FROM businesses
+			WHERE source = 'nominatim' AND external_id IS NULL
+			AND name = $2 AND ST_Equals(geom, ST_GeomFromText($3, 4326))
+			LIMIT 1
+		)
+		AND NOT EXISTS (SELECT 1 FROM businesses WHERE source = 'nominatim' AND external_id = $1)
+	`, p.ExternalID, p.Name, p.WKT)
+	if err != nil {
+		return err
+	}
+
+	_, err = ri.db.Exec(`
+		INSERT INTO businesses (name, category_id, geom, address, city, status, source, external_id)
+		VALUES ($1, $2, ST_GeomFromText($3, 4326), $4, $5, 'verified', 'nominatim', $6)
+		ON CONFLICT (source, external_id) WHERE external_id IS NOT NULL
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			category_id = COALESCE(EXCLUDED.category_id, businesses.category_id),
+			geom = EXCLUDED.geom,
+			address = COALESCE(NULLIF(EXCLUDED.address, ''), businesses.address),
+			updated_at = NOW()
+		WHERE businesses.owner_id IS NULL AND businesses.status <> 'merged'
+		AND (businesses.name, businesses.category_id, ST_AsEWKB(businesses.geom), businesses.address)
+			IS DISTINCT FROM (EXCLUDED.name, COALESCE(EXCLUDED.category_id, businesses.category_id), ST_AsEWKB(EXCLUDED.geom), COALESCE(NULLIF(EXCLUDED.address, ''), businesses.address))
+	`, p.Name, catID, p.WKT, p.Street, ri.region.Name, p.ExternalID)
+	if err != nil {
+		return err
+	}
+	ri.seen = append(ri.seen, p.ExternalID)
+	ri.imported++
+	return nil
+}
+
+// removeStale deletes the imported businesses of the region that are no
+// longer in Nominatim. Businesses that are claimed, merged or pointed at by
+// a merge, or that have anything attached besides their revisions and
+// duplicate candidates, are kept.
+func (ri *regionImport) removeStale() (int64, error) {
+	res, err := ri.db.Exec(`
+		DELETE FROM businesses b
+		WHERE b.source = 'nominatim'
+		AND ST_Contains(ST_GeomFromText($1, 4326), b.geom)
+		AND (b.external_id IS NULL OR NOT b.external_id = ANY($2))
+		AND b.owner_id IS NULL
+		AND b.status <> 'merged'
+		AND NOT EXISTS (SELECT 1 FROM businesses m WHERE m.merged_into = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_reviews WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_media WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM user_saved_businesses WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM posts WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_hours WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_special_hours WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_claims WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_ownership_transfers WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_ownership_events WHERE business_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM business_changes WHERE business_id = b.id)
+	`, ri.region.WKT, pq.Array(ri.seen))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"maps/api/internal/categories"
+	"maps/api/internal/db"
+)
+
+// testRegion is a square around Null Island, away from any real data
+var testRegion = importRegion{
+	Slug: "test-import",
+	Name: "Test Import",
+	WKT:  "POLYGON((0 0, 0.01 0, 0.01 0.01, 0 0.01, 0 0))",
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		conn.Exec(`DELETE FROM businesses WHERE ST_Contains(ST_GeomFromText($1, 4326), geom)`, testRegion.WKT)
+		conn.Exec(`DELETE FROM users WHERE phone = '+000000000001'`)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	return conn
+}
+
+func importPlaces(t *testing.T, conn *sql.DB, places ...place) {
+	t.Helper()
+	imp := newRegionImport(conn, testRegion, categories.Mappings{}, map[string]int{})
+	for _, p := range places {
+		if err := imp.add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := imp.removeStale(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReimportKeepsClaimedBusiness(t *testing.T) {
+	conn := openTestDB(t)
+
+	cafe := place{ExternalID: "N1", Name: "Tomoca", Class: "amenity", Type: "cafe", WKT: "POINT(0.001 0.001)"}
+	bank := place{ExternalID: "N2", Name: "CBE", Class: "amenity", Type: "bank", WKT: "POINT(0.002 0.002)"}
+	importPlaces(t, conn, cafe, bank)
+
+	var cafeID, ownerID string
+	if err := conn.QueryRow(`SELECT id FROM businesses WHERE source = 'nominatim' AND external_id = 'N1'`).Scan(&cafeID); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRow(`INSERT INTO users (phone) VALUES ('+000000000001') RETURNING id`).Scan(&ownerID); err != nil {
+		t.Fatal(err)
+	}
+	// The owner claims the cafe, renames it and gets a review
+	for _, q := range []string{
+		`UPDATE businesses SET owner_id = $2, name = 'Tomoca Coffee' WHERE id = $1`,
+		`INSERT INTO business_reviews (business_id, user_id, rating) VALUES ($1, $2, 5)`,
+	} {
+		if _, err := conn.Exec(q, cafeID, ownerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Neither place changed in OSM, then both were removed from it
+	importPlaces(t, conn, cafe, bank)
+	importPlaces(t, conn)
+
+	var id, name string
+	var owner sql.NullString
+	var reviews int
+	err := conn.QueryRow(`
+		SELECT b.id, b.name, b.owner_id, (SELECT COUNT(*) FROM business_reviews WHERE business_id = b.id)
+		FROM businesses b WHERE source = 'nominatim' AND external_id = 'N1'
+	`).Scan(&id, &name, &owner, &reviews)
+	if err != nil {
+		t.Fatalf("claimed business is gone: %v", err)
+	}
+	if id != cafeID || owner.String != ownerID || name != "Tomoca Coffee" || reviews != 1 {
+		t.Errorf("claimed business changed: id=%s owner=%s name=%q reviews=%d", id, owner.String, name, reviews)
+	}
+
+	var stale int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM businesses WHERE source = 'nominatim' AND external_id = 'N2'`).Scan(&stale); err != nil {
+		t.Fatal(err)
+	}
+	if stale != 0 {
+		t.Errorf("unclaimed business removed from OSM was kept")
+	}
+}
+
+func TestReimportUpdatesUnclaimedBusiness(t *testing.T) {
+	conn := openTestDB(t)
+
+	shop := place{ExternalID: "N3", Name: "Shoa", Class: "shop", Type: "supermarket", WKT: "POINT(0.003 0.003)"}
+	importPlaces(t, conn, shop)
+	var firstID string
+	if err := conn.QueryRow(`SELECT id FROM businesses WHERE source = 'nominatim' AND external_id = 'N3'`).Scan(&firstID); err != nil {
+		t.Fatal(err)
+	}
+
+	shop.Name = "Shoa Supermarket"
+	importPlaces(t, conn, shop)
+
+	var id, name string
+	if err := conn.QueryRow(`SELECT id, name FROM businesses WHERE source = 'nominatim' AND external_id = 'N3'`).Scan(&id, &name); err != nil {
+		t.Fatal(err)
+	}
+	if id != firstID || name != "Shoa Supermarket" {
+		t.Errorf("re-import: id=%s (want %s) name=%q", id, firstID, name)
+	}
+}
@@ -0,0 +1,95 @@
+// Package categories maps the tags of imported and published places to the
+// canonical business categories, using the category_mappings table.
+package categories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+const (
+	// SourceOSM is the mapping source for OSM class=type keys
+	SourceOSM = "osm"
+	// AnySource maps a PublishPOI type for every publisher
+	AnySource = "*"
+)
+
+var keyReplacer = strings.NewReplacer(" ", "_", "-", "_")
+
+// NormalizeKey lowercases a type and turns spaces and dashes into
+// underscores, so "Fast Food" and "fast-food" map like "fast_food"
+func NormalizeKey(s string) string {
+	return keyReplacer.Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// OSMKey returns the mapping key for an OSM class and type
+func OSMKey(class, typ string) string {
+	return NormalizeKey(class) + "=" + NormalizeKey(typ)
+}
+
+type mappingKey struct {
+	source, key string
+}
+
+// Mappings resolves tags to category ids
+type Mappings map[mappingKey]string
+
+// Load reads every mapping
+func Load(ctx context.Context, db *sql.DB) (Mappings, error) {
+	return load(ctx, db, "")
+}
+
+func load(ctx context.Context, db *sql.DB, where string, args ...interface{}) (Mappings, error) {
+	rows, err := db.QueryContext(ctx, `SELECT source, key, category_id FROM category_mappings`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := Mappings{}
+	for rows.Next() {
+		var k mappingKey
+		var categoryID string
+		if err := rows.Scan(&k.source, &k.key, &categoryID); err != nil {
+			return nil, err
+		}
+		m[k] = categoryID
+	}
+	return m, rows.Err()
+}
+
+// OSM returns the category of an OSM class and type, falling back to the
+// mapping of the whole class
+func (m Mappings) OSM(class, typ string) (string, bool) {
+	if id, ok := m[mappingKey{SourceOSM, OSMKey(class, typ)}]; ok {
+		return id, true
+	}
+	id, ok := m[mappingKey{SourceOSM, NormalizeKey(class) + "=*"}]
+	return id, ok
+}
+
+// External returns the category of a type sent by a publisher, preferring
+// the publisher's own mapping over one for every publisher
+func (m Mappings) External(source, typ string) (string, bool) {
+	key := NormalizeKey(typ)
+	if id, ok := m[mappingKey{strings.ToLower(strings.TrimSpace(source)), key}]; ok {
+		return id, true
+	}
+	id, ok := m[mappingKey{AnySource, key}]
+	return id, ok
+}
+
+// LookupExternal is External for a single type, reading only the mappings
+// it needs
+func LookupExternal(ctx context.Context, db *sql.DB, source, typ string) (string, bool, error) {
+	if NormalizeKey(typ) == "" {
+		return "", false, nil
+	}
+	m, err := load(ctx, db, ` WHERE source IN ($1, $2) AND key = $3`, strings.ToLower(strings.TrimSpace(source)), AnySource, NormalizeKey(typ))
+	if err != nil {
+		return "", false, err
+	}
+	id, ok := m.External(source, typ)
+	return id, ok, nil
+}
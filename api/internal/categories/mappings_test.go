@@ -0,0 +1,76 @@
+package categories
+
+import "testing"
+
+func TestNormalizeKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"fast_food":      "fast_food",
+		"Fast Food":      "fast_food",
+		"fast-food":      "fast_food",
+		"  Coffee Shop ": "coffee_shop",
+		"":               "",
+	} {
+		if got := NormalizeKey(in); got != want {
+			t.Errorf("NormalizeKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := OSMKey("Amenity", "Fast Food"); got != "amenity=fast_food" {
+		t.Errorf("OSMKey = %q", got)
+	}
+}
+
+func TestMappingsOSM(t *testing.T) {
+	m := Mappings{
+		{SourceOSM, "amenity=cafe"}:       "cafe",
+		{SourceOSM, "shop=*"}:             "shop",
+		{SourceOSM, "shop=supermarket"}:   "market",
+		{"yango", "cafe"}:                 "not-osm",
+		{AnySource, "amenity=restaurant"}: "not-osm",
+	}
+	for _, tc := range []struct {
+		class, typ string
+		want       string
+		ok         bool
+	}{
+		{"amenity", "cafe", "cafe", true},
+		{"Amenity", "Cafe", "cafe", true},
+		{"shop", "supermarket", "market", true}, // the type wins over the class
+		{"shop", "shoes", "shop", true},         // class=* fallback
+		{"Shop", "Shoe Repair", "shop", true},
+		{"amenity", "bank", "", false}, // no amenity=* mapping
+		{"amenity", "restaurant", "", false},
+		{"tourism", "cafe", "", false},
+	} {
+		got, ok := m.OSM(tc.class, tc.typ)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("OSM(%q, %q) = %q, %v, want %q, %v", tc.class, tc.typ, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestMappingsExternal(t *testing.T) {
+	m := Mappings{
+		{AnySource, "cafe"}:         "cafe",
+		{AnySource, "restaurant"}:   "restaurant",
+		{"yango", "cafe"}:           "yango-cafe",
+		{SourceOSM, "amenity=bank"}: "bank",
+	}
+	for _, tc := range []struct {
+		source, typ string
+		want        string
+		ok          bool
+	}{
+		{"yango", "cafe", "yango-cafe", true}, // the publisher's own mapping wins
+		{" Yango ", "Cafe", "yango-cafe", true},
+		{"yango", "restaurant", "restaurant", true}, // else any publisher's
+		{"gebeya", "cafe", "cafe", true},
+		{"gebeya", "Coffee Shop", "", false},
+		{"gebeya", "amenity=bank", "", false}, // OSM mappings aren't for publishers
+		{"gebeya", "", "", false},
+	} {
+		got, ok := m.External(tc.source, tc.typ)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("External(%q, %q) = %q, %v, want %q, %v", tc.source, tc.typ, got, ok, tc.want, tc.ok)
+		}
+	}
+}
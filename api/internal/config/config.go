@@ -14,8 +14,33 @@ type Config struct {
 	ValhallaHost  string
 	RoutingEngine string // "osrm" or "valhalla"
 	GeocoderHost  string
-	TileHost      string
-	RateLimit     int // requests per minute
+	TilesDir      string // directory of .mbtiles/.pmtiles files
+	TileCacheMB   int    // in-memory tile cache size
+	TileCacheDir  string // optional disk tile cache, "" to disable
+	TileDiskMB    int    // disk tile cache size; the oldest tiles go first
+	StylesDir     string // <name>.json map styles
+	SpritesDir    string // <name>[@2x].json/.png sprite sheets
+	FontsDir      string // <fontstack>/<range>.pbf glyphs
+	FallbackFont  string // appended to every requested fontstack
+	OfflineDir    string // built offline package zips
+	OfflineTiles  int    // tile limit per offline package
+	OfflineTTL    int    // days a finished offline package is kept
+	UploadsDir    string // user uploads with the local storage backend
+	UploadTTL     int    // hours an unattached upload is kept
+	PartialDir    string // resumable upload chunks while they are received
+	FFmpegPath    string // video transcoding; video uploads are off without it
+	FFprobePath   string // probes video duration and size
+	MaxVideoMB    int    // video upload size limit
+	MaxVideoSecs  int    // video upload duration limit
+	UploadTimeout int    // minutes an upload or download request may take
+	SMSBackend    string // "log" prints codes (development); empty disables phone claim codes
+	RateLimit     int    // requests per minute
+
+	// Search ranking
+	SearchWeights SearchWeights
+
+	// Object storage for uploads
+	Storage StorageConfig
 
 	// Database
 	DBHost     string
@@ -26,6 +51,32 @@ type Config struct {
 	DBSSLMode  string
 }
 
+// StorageConfig selects where uploads are stored. The local backend keeps
+// them in UploadsDir and serves them under /uploads; the s3 backend uses an
+// S3-compatible bucket such as MinIO.
+type StorageConfig struct {
+	Backend     string // "local" or "s3"
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PublicURL string // download base URL, e.g. a CDN; defaults to the bucket URL
+	S3PathStyle bool   // endpoint/bucket addressing, needed by MinIO
+}
+
+// SearchWeights are the coefficients of the business search relevance score.
+// Every component is normalized to 0..1 before weighting.
+type SearchWeights struct {
+	Similarity       float64 `json:"similarity"`
+	Coverage         float64 `json:"coverage"`
+	Category         float64 `json:"category"`
+	Distance         float64 `json:"distance"`
+	Rating           float64 `json:"rating"`
+	Popularity       float64 `json:"popularity"`
+	DistanceHalfLife float64 `json:"distance_half_life_m"`
+}
+
 func Load() *Config {
 	return &Config{
 		Port:          getEnv("PORT", "8000"),
@@ -36,9 +87,51 @@ func Load() *Config {
 		ValhallaHost:  getEnv("VALHALLA_HOST", "http://valhalla:8002"),
 		RoutingEngine: getEnv("ROUTING_ENGINE", "osrm"), // Default to OSRM for backward compatibility
 		GeocoderHost:  getEnv("GEOCODER_HOST", "http://nominatim:8080"),
-		TileHost:      getEnv("TILE_HOST", "http://tileserver:8080"),
+		TilesDir:      getEnv("TILES_DIR", "./data/tiles"),
+		TileCacheMB:   getEnvInt("TILE_CACHE_MB", 128),
+		TileCacheDir:  getEnv("TILE_CACHE_DIR", ""),
+		TileDiskMB:    getEnvInt("TILE_CACHE_DISK_MB", 2048),
+		StylesDir:     getEnv("STYLES_DIR", "./data/styles"),
+		SpritesDir:    getEnv("SPRITES_DIR", "./data/sprites"),
+		FontsDir:      getEnv("FONTS_DIR", "./data/fonts"),
+		FallbackFont:  getEnv("FALLBACK_FONT", "Noto Sans Regular"),
+		OfflineDir:    getEnv("OFFLINE_DIR", "./data/offline"),
+		OfflineTiles:  getEnvInt("OFFLINE_MAX_TILES", 20000),
+		OfflineTTL:    getEnvInt("OFFLINE_TTL_DAYS", 30),
+		UploadsDir:    getEnv("UPLOADS_DIR", "./uploads"),
+		UploadTTL:     getEnvInt("UPLOAD_TTL_HOURS", 24),
+		PartialDir:    getEnv("PARTIAL_UPLOADS_DIR", "./partial-uploads"),
+		FFmpegPath:    getEnv("FFMPEG_PATH", "ffmpeg"),
+		FFprobePath:   getEnv("FFPROBE_PATH", "ffprobe"),
+		MaxVideoMB:    getEnvInt("MAX_VIDEO_MB", 200),
+		MaxVideoSecs:  getEnvInt("MAX_VIDEO_SECONDS", 60),
+		UploadTimeout: getEnvInt("UPLOAD_TIMEOUT_MINUTES", 30),
+		SMSBackend:    getEnv("SMS_BACKEND", ""),
 		RateLimit:     getEnvInt("RATE_LIMIT", 100),
 
+		// Search ranking
+		SearchWeights: SearchWeights{
+			Similarity:       getEnvFloat("SEARCH_W_SIMILARITY", 1.0),
+			Coverage:         getEnvFloat("SEARCH_W_COVERAGE", 0.8),
+			Category:         getEnvFloat("SEARCH_W_CATEGORY", 0.4),
+			Distance:         getEnvFloat("SEARCH_W_DISTANCE", 0.5),
+			Rating:           getEnvFloat("SEARCH_W_RATING", 0.2),
+			Popularity:       getEnvFloat("SEARCH_W_POPULARITY", 0.1),
+			DistanceHalfLife: getEnvFloat("SEARCH_DISTANCE_HALF_LIFE", 2000), // meters
+		},
+
+		// Object storage for uploads
+		Storage: StorageConfig{
+			Backend:     getEnv("STORAGE_BACKEND", "local"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PublicURL: getEnv("S3_PUBLIC_URL", ""),
+			S3PathStyle: getEnv("S3_PATH_STYLE", "false") == "true",
+		},
+
 		// Database
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
@@ -64,3 +157,12 @@ func getEnvInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
@@ -10,14 +10,17 @@ import (
 	"maps/api/internal/config"
 )
 
-// Connect opens a connection to the PostgreSQL database
-func Connect(cfg *config.Config) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
+// DSN builds the lib/pq connection string for the configured database
+func DSN(cfg *config.Config) string {
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", dsn)
+// Connect opens a connection to the PostgreSQL database
+func Connect(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
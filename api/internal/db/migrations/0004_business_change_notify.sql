@@ -0,0 +1,17 @@
+-- Notify listeners (search index, caches) whenever a business changes
+
+CREATE OR REPLACE FUNCTION notify_business_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('business_changes', COALESCE(NEW.id, OLD.id)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_business_change ON businesses;
+CREATE TRIGGER notify_business_change AFTER INSERT OR UPDATE OR DELETE ON businesses
+    FOR EACH ROW EXECUTE FUNCTION notify_business_change();
+
+-- Prefix lookups on name_am for autocomplete fallbacks
+CREATE INDEX IF NOT EXISTS idx_businesses_name_am_trgm ON businesses USING GIN(name_am gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING GIN(name gin_trgm_ops);
@@ -0,0 +1,25 @@
+-- Script-independent search keys (romanized, spelling-folded name + name_am).
+-- The key is computed by the API (search.SearchKey); the trigger clears it
+-- whenever a name changes so the API recomputes it.
+
+ALTER TABLE businesses
+ADD COLUMN IF NOT EXISTS search_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_businesses_search_key_trgm ON businesses USING GIN(search_key gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_businesses_search_key_null ON businesses(id) WHERE search_key IS NULL;
+
+CREATE OR REPLACE FUNCTION reset_business_search_key()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.name IS DISTINCT FROM OLD.name OR NEW.name_am IS DISTINCT FROM OLD.name_am THEN
+        NEW.search_key = NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS reset_business_search_key ON businesses;
+CREATE TRIGGER reset_business_search_key BEFORE UPDATE ON businesses
+    FOR EACH ROW EXECUTE FUNCTION reset_business_search_key();
+
+COMMENT ON COLUMN businesses.search_key IS 'Romanized, spelling-folded name and name_am used for cross-script search';
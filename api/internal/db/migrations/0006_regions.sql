@@ -0,0 +1,72 @@
+-- =====================
+-- SERVICE REGIONS
+-- =====================
+-- Cities/areas we operate in. Replaces the hardcoded Addis/Ethiopia boxes
+-- in business creation, search and the Nominatim importer.
+CREATE TABLE IF NOT EXISTS regions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    slug VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    name_am VARCHAR(100),
+    country_code CHAR(2) NOT NULL,
+    timezone VARCHAR(50) NOT NULL DEFAULT 'Africa/Addis_Ababa',
+    geom GEOMETRY(MultiPolygon, 4326) NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    sort_order INT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_regions_geom ON regions USING GIST(geom);
+
+CREATE TRIGGER update_regions_updated_at BEFORE UPDATE ON regions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Initial regions (approximate city extents; refine via PUT /api/regions/{slug})
+INSERT INTO regions (slug, name, name_am, country_code, timezone, geom, sort_order) VALUES
+    ('addis-ababa', 'Addis Ababa', 'አዲስ አበባ', 'ET', 'Africa/Addis_Ababa',
+        ST_Multi(ST_MakeEnvelope(38.60, 8.80, 38.95, 9.10, 4326)), 1),
+    ('dire-dawa', 'Dire Dawa', 'ድሬ ዳዋ', 'ET', 'Africa/Addis_Ababa',
+        ST_Multi(ST_MakeEnvelope(41.78, 9.54, 41.93, 9.66, 4326)), 2),
+    ('bahir-dar', 'Bahir Dar', 'ባሕር ዳር', 'ET', 'Africa/Addis_Ababa',
+        ST_Multi(ST_MakeEnvelope(37.33, 11.54, 37.44, 11.64, 4326)), 3),
+    ('uae', 'United Arab Emirates', NULL, 'AE', 'Asia/Dubai',
+        ST_Multi(ST_MakeEnvelope(51.50, 22.60, 56.40, 26.10, 4326)), 4)
+ON CONFLICT (slug) DO NOTHING;
+
+-- =====================
+-- BUSINESS REGION
+-- =====================
+ALTER TABLE businesses
+ADD COLUMN IF NOT EXISTS region_id UUID REFERENCES regions(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_businesses_region ON businesses(region_id);
+
+-- Assign the smallest containing region whenever a location is set, so every
+-- writer (API, internal publish, importers) gets it for free
+CREATE OR REPLACE FUNCTION assign_business_region()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.geom IS DISTINCT FROM OLD.geom THEN
+        NEW.region_id = (
+            SELECT id FROM regions
+            WHERE ST_Contains(geom, NEW.geom)
+            ORDER BY ST_Area(geom)
+            LIMIT 1
+        );
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS assign_business_region ON businesses;
+CREATE TRIGGER assign_business_region BEFORE INSERT OR UPDATE ON businesses
+    FOR EACH ROW EXECUTE FUNCTION assign_business_region();
+
+UPDATE businesses b SET region_id = (
+    SELECT r.id FROM regions r
+    WHERE ST_Contains(r.geom, b.geom)
+    ORDER BY ST_Area(r.geom)
+    LIMIT 1
+)
+WHERE b.region_id IS NULL;
@@ -0,0 +1,36 @@
+-- Evaluate weekly business_hours at a moment in the business's local time.
+-- Spans where close_time <= open_time run past midnight into the next day
+-- (e.g. 20:00-02:00); 00:00-00:00 means open all day.
+CREATE OR REPLACE FUNCTION business_open_at(bid UUID, at TIMESTAMPTZ)
+RETURNS BOOLEAN AS $$
+DECLARE
+    tz TEXT;
+    local_ts TIMESTAMP;
+    dow INT;
+    t TIME;
+BEGIN
+    SELECT r.timezone INTO tz
+    FROM businesses b
+    LEFT JOIN regions r ON r.id = b.region_id
+    WHERE b.id = bid;
+
+    local_ts := at AT TIME ZONE COALESCE(tz, 'Africa/Addis_Ababa');
+    dow := EXTRACT(DOW FROM local_ts);
+    t := local_ts::time;
+
+    RETURN EXISTS (
+        SELECT 1 FROM business_hours h
+        WHERE h.business_id = bid
+        AND NOT COALESCE(h.is_closed, FALSE)
+        AND h.open_time IS NOT NULL AND h.close_time IS NOT NULL
+        AND (
+            (h.day_of_week = dow AND t >= h.open_time
+                AND (t < h.close_time OR h.close_time <= h.open_time))
+            OR (h.day_of_week = (dow + 6) % 7 AND h.close_time <= h.open_time
+                AND t < h.close_time)
+        )
+    );
+END;
+$$ language 'plpgsql' STABLE;
+
+CREATE INDEX IF NOT EXISTS idx_businesses_avg_rating ON businesses(avg_rating);
@@ -0,0 +1,35 @@
+-- =====================
+-- OFFLINE MAP PACKAGES
+-- =====================
+-- Downloadable region bundles (tile subset, POIs, style) for the mobile app.
+-- Rows are queued as pending and built by the API's background worker.
+CREATE TABLE IF NOT EXISTS offline_packages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, building, ready, failed
+    tileset VARCHAR(100) NOT NULL,
+    tileset_version VARCHAR(20) NOT NULL,
+    style VARCHAR(100) NOT NULL,
+    base_url TEXT NOT NULL, -- API origin baked into the packaged style
+    min_lng DOUBLE PRECISION NOT NULL,
+    min_lat DOUBLE PRECISION NOT NULL,
+    max_lng DOUBLE PRECISION NOT NULL,
+    max_lat DOUBLE PRECISION NOT NULL,
+    min_zoom SMALLINT NOT NULL,
+    max_zoom SMALLINT NOT NULL,
+    tile_count INT NOT NULL DEFAULT 0,
+    estimated_bytes BIGINT NOT NULL DEFAULT 0,
+    size_bytes BIGINT,
+    checksum VARCHAR(64), -- sha256 of the zip
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    CHECK (status IN ('pending', 'building', 'ready', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_offline_packages_user ON offline_packages(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_offline_packages_pending ON offline_packages(created_at) WHERE status = 'pending';
+
+CREATE TRIGGER update_offline_packages_updated_at BEFORE UPDATE ON offline_packages
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
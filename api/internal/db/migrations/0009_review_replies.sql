@@ -0,0 +1,27 @@
+-- =====================
+-- REVIEW OWNER REPLIES AND HELPFUL VOTES
+-- =====================
+ALTER TABLE business_reviews
+ADD COLUMN IF NOT EXISTS owner_reply TEXT,
+ADD COLUMN IF NOT EXISTS owner_reply_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS helpful_count INT DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_business_reviews_newest ON business_reviews(business_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_business_reviews_helpful ON business_reviews(business_id, helpful_count DESC, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS review_helpful_votes (
+    review_id UUID NOT NULL REFERENCES business_reviews(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id)
+);
+
+-- updated_at marks edits by the author, and the business rating only
+-- depends on ratings; replies and helpful votes must not touch either
+DROP TRIGGER IF EXISTS update_reviews_updated_at ON business_reviews;
+CREATE TRIGGER update_reviews_updated_at BEFORE UPDATE OF rating, comment ON business_reviews
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_rating_on_review ON business_reviews;
+CREATE TRIGGER update_rating_on_review AFTER INSERT OR DELETE OR UPDATE OF rating ON business_reviews
+    FOR EACH ROW EXECUTE FUNCTION update_business_rating();
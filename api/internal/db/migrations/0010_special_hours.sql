@@ -0,0 +1,170 @@
+-- =====================
+-- PUBLIC HOLIDAYS
+-- =====================
+-- Dated occurrences of public holidays. Calendar holidays (Ethiopian
+-- calendar dates, Fasika, Genna...) are filled in by the API at startup;
+-- moon-sighted ones like Eid are added by admins as they are announced.
+CREATE TABLE IF NOT EXISTS holiday_dates (
+    key VARCHAR(50) NOT NULL,
+    date DATE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    name_am VARCHAR(100),
+    country_code CHAR(2) NOT NULL DEFAULT 'ET',
+    source VARCHAR(20) NOT NULL DEFAULT 'manual', -- calendar, manual
+    PRIMARY KEY (key, date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_holiday_dates_date ON holiday_dates(date);
+
+-- =====================
+-- BUSINESS SPECIAL HOURS
+-- =====================
+-- Overrides of the weekly business_hours, either for one date or for every
+-- occurrence of a holiday
+CREATE TABLE IF NOT EXISTS business_special_hours (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    date DATE,
+    holiday VARCHAR(50),
+    open_time TIME,
+    close_time TIME,
+    is_closed BOOLEAN NOT NULL DEFAULT FALSE,
+    note VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((date IS NULL) <> (holiday IS NULL)),
+    CHECK (is_closed OR (open_time IS NOT NULL AND close_time IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_special_hours_date
+    ON business_special_hours(business_id, date) WHERE date IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_special_hours_holiday
+    ON business_special_hours(business_id, holiday) WHERE holiday IS NOT NULL;
+
+-- The opening span of a business on a local date: special hours for the
+-- date win over special hours for a holiday on that date, which win over the
+-- weekly hours. No row means closed all day.
+CREATE OR REPLACE FUNCTION business_day_hours(bid UUID, d DATE)
+RETURNS TABLE (open_time TIME, close_time TIME) AS $$
+DECLARE
+    s RECORD;
+BEGIN
+    SELECT sh.open_time, sh.close_time, sh.is_closed INTO s
+    FROM business_special_hours sh
+    LEFT JOIN holiday_dates hd ON hd.key = sh.holiday AND hd.date = d
+    WHERE sh.business_id = bid AND (sh.date = d OR hd.date IS NOT NULL)
+    ORDER BY sh.date IS NOT NULL DESC
+    LIMIT 1;
+
+    IF FOUND THEN
+        IF NOT s.is_closed THEN
+            open_time := s.open_time;
+            close_time := s.close_time;
+            RETURN NEXT;
+        END IF;
+        RETURN;
+    END IF;
+
+    RETURN QUERY
+    SELECT h.open_time, h.close_time
+    FROM business_hours h
+    WHERE h.business_id = bid
+    AND h.day_of_week = EXTRACT(DOW FROM d)
+    AND NOT COALESCE(h.is_closed, FALSE)
+    AND h.open_time IS NOT NULL AND h.close_time IS NOT NULL;
+END;
+$$ language 'plpgsql' STABLE;
+
+-- business_open_at now honors special hours. A span from the previous day
+-- that runs past midnight still applies when today has special hours.
+CREATE OR REPLACE FUNCTION business_open_at(bid UUID, at TIMESTAMPTZ)
+RETURNS BOOLEAN AS $$
+DECLARE
+    tz TEXT;
+    local_ts TIMESTAMP;
+    d DATE;
+    t TIME;
+BEGIN
+    SELECT r.timezone INTO tz
+    FROM businesses b
+    LEFT JOIN regions r ON r.id = b.region_id
+    WHERE b.id = bid;
+
+    local_ts := at AT TIME ZONE COALESCE(tz, 'Africa/Addis_Ababa');
+    d := local_ts::date;
+    t := local_ts::time;
+
+    RETURN EXISTS (
+        SELECT 1 FROM business_day_hours(bid, d) h
+        WHERE t >= h.open_time AND (t < h.close_time OR h.close_time <= h.open_time)
+    ) OR EXISTS (
+        SELECT 1 FROM business_day_hours(bid, d - 1) h
+        WHERE h.close_time <= h.open_time AND t < h.close_time
+    );
+END;
+$$ language 'plpgsql' STABLE;
+
+-- The next time business_open_at changes value, looking a week ahead.
+-- Back-to-back spans (e.g. 08:00-00:00 then 00:00-02:00) count as one.
+-- NULL when there is no change within the week: closed for the whole week,
+-- or open around the clock.
+CREATE OR REPLACE FUNCTION business_next_change_at(bid UUID, at TIMESTAMPTZ)
+RETURNS TIMESTAMPTZ AS $$
+DECLARE
+    tz TEXT;
+    local_ts TIMESTAMP;
+    horizon TIMESTAMP;
+    d DATE;
+    h RECORD;
+    s TIMESTAMP;
+    e TIMESTAMP;
+    ms TIMESTAMP; -- current merged span
+    me TIMESTAMP;
+BEGIN
+    SELECT r.timezone INTO tz
+    FROM businesses b
+    LEFT JOIN regions r ON r.id = b.region_id
+    WHERE b.id = bid;
+    tz := COALESCE(tz, 'Africa/Addis_Ababa');
+
+    local_ts := at AT TIME ZONE tz;
+    horizon := (local_ts::date + 8)::timestamp;
+
+    FOR i IN -1..7 LOOP
+        d := local_ts::date + i;
+        FOR h IN SELECT * FROM business_day_hours(bid, d) LOOP
+            s := d + h.open_time;
+            e := d + h.close_time;
+            IF h.close_time <= h.open_time THEN
+                e := e + INTERVAL '1 day';
+            END IF;
+
+            IF ms IS NOT NULL AND s <= me THEN
+                me := GREATEST(me, e);
+                CONTINUE;
+            END IF;
+
+            -- The previous merged span is complete
+            IF ms IS NOT NULL THEN
+                IF local_ts < ms THEN
+                    RETURN ms AT TIME ZONE tz;
+                END IF;
+                IF local_ts < me THEN
+                    RETURN me AT TIME ZONE tz;
+                END IF;
+            END IF;
+            ms := s;
+            me := e;
+        END LOOP;
+    END LOOP;
+
+    IF ms IS NOT NULL THEN
+        IF local_ts < ms THEN
+            RETURN ms AT TIME ZONE tz;
+        END IF;
+        IF local_ts < me AND me < horizon THEN
+            RETURN me AT TIME ZONE tz;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql' STABLE;
@@ -0,0 +1,29 @@
+-- =====================
+-- UPLOADS
+-- =====================
+-- Every file stored by POST /api/upload. Uploads that no business media,
+-- post or profile photo refers to are removed after a grace period.
+CREATE TABLE IF NOT EXISTS uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    filename TEXT NOT NULL, -- relative to the uploads directory
+    url TEXT NOT NULL UNIQUE,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_created ON uploads(created_at);
+
+-- Lookups by URL for the cleanup's reference checks
+CREATE INDEX IF NOT EXISTS idx_business_media_url ON business_media(url);
+CREATE INDEX IF NOT EXISTS idx_posts_media_url ON posts(media_url);
+
+-- =====================
+-- BUSINESS COVER PHOTO
+-- =====================
+ALTER TABLE business_media
+ADD COLUMN IF NOT EXISTS is_cover BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_business_media_cover
+    ON business_media(business_id) WHERE is_cover;
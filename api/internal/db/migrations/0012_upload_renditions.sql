@@ -0,0 +1,51 @@
+-- =====================
+-- UPLOAD RENDITIONS
+-- =====================
+-- Images are stored under content-addressed names as full, medium and
+-- thumbnail renditions. The same file can be uploaded by several users, so
+-- URLs are unique per user only.
+ALTER TABLE uploads
+ADD COLUMN IF NOT EXISTS medium_url TEXT,
+ADD COLUMN IF NOT EXISTS thumbnail_url TEXT,
+ADD COLUMN IF NOT EXISTS width INT,
+ADD COLUMN IF NOT EXISTS height INT;
+
+ALTER TABLE uploads DROP CONSTRAINT IF EXISTS uploads_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_uploads_user_url ON uploads(user_id, url);
+CREATE INDEX IF NOT EXISTS idx_uploads_url ON uploads(url);
+
+-- Fill in thumbnail_url from the upload when media is attached without one
+CREATE OR REPLACE FUNCTION upload_thumbnail_url(file_url TEXT)
+RETURNS TEXT AS $$
+    SELECT thumbnail_url FROM uploads
+    WHERE url = file_url AND thumbnail_url IS NOT NULL
+    LIMIT 1;
+$$ language 'sql' STABLE;
+
+CREATE OR REPLACE FUNCTION fill_business_media_thumbnail()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.thumbnail_url IS NULL THEN
+        NEW.thumbnail_url := upload_thumbnail_url(NEW.url);
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION fill_post_thumbnail()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.thumbnail_url IS NULL THEN
+        NEW.thumbnail_url := upload_thumbnail_url(NEW.media_url);
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS fill_business_media_thumbnail ON business_media;
+CREATE TRIGGER fill_business_media_thumbnail BEFORE INSERT OR UPDATE OF url, thumbnail_url ON business_media
+    FOR EACH ROW EXECUTE FUNCTION fill_business_media_thumbnail();
+
+DROP TRIGGER IF EXISTS fill_posts_thumbnail ON posts;
+CREATE TRIGGER fill_posts_thumbnail BEFORE INSERT OR UPDATE OF media_url, thumbnail_url ON posts
+    FOR EACH ROW EXECUTE FUNCTION fill_post_thumbnail();
@@ -0,0 +1,15 @@
+-- =====================
+-- PENDING UPLOADS
+-- =====================
+-- Presigned direct uploads that haven't been completed yet. The raw object
+-- is processed and removed on completion; abandoned ones are removed after
+-- they expire.
+CREATE TABLE IF NOT EXISTS pending_uploads (
+    key TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content_type VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_uploads_expires ON pending_uploads(expires_at);
@@ -0,0 +1,18 @@
+-- =====================
+-- VIDEO UPLOADS
+-- =====================
+-- Videos are stored as uploaded and transcoded to H.264 HLS in the
+-- background. thumbnail_url is the poster frame; playlist_url is set once
+-- the transcode is done. Video posts stay 'processing' until their upload
+-- is transcoded, then become 'active' with media_url pointing at the
+-- playlist, or 'failed'.
+ALTER TABLE uploads
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'ready', -- processing, ready, failed
+ADD COLUMN IF NOT EXISTS playlist_url TEXT,
+ADD COLUMN IF NOT EXISTS duration_seconds REAL,
+ADD COLUMN IF NOT EXISTS transcode_attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS transcode_started_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_uploads_processing ON uploads(created_at) WHERE status = 'processing';
+CREATE INDEX IF NOT EXISTS idx_uploads_playlist_url ON uploads(playlist_url);
+
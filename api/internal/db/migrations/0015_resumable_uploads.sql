@@ -0,0 +1,16 @@
+-- =====================
+-- RESUMABLE UPLOADS
+-- =====================
+-- Uploads sent in chunks that can resume after a dropped connection. The
+-- bytes received so far are kept in a file on the API server; the current
+-- offset is its size. Finished uploads are processed like direct uploads
+-- and removed, unfinished ones after expires_at.
+CREATE TABLE IF NOT EXISTS resumable_uploads (
+    id TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    length BIGINT NOT NULL CHECK (length > 0),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_resumable_uploads_expires ON resumable_uploads(expires_at);
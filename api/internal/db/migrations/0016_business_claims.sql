@@ -0,0 +1,73 @@
+-- =====================
+-- BUSINESS CLAIMS
+-- =====================
+-- Requests by users to become the owner of an unowned business, such as
+-- one imported from OSM. A claim is approved by entering a code sent to
+-- the business phone ('phone') or by an admin ('review').
+CREATE TABLE IF NOT EXISTS business_claims (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    method VARCHAR(20) NOT NULL CHECK (method IN ('phone', 'review')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, approved, rejected, cancelled
+    evidence TEXT,
+    evidence_urls TEXT[] NOT NULL DEFAULT '{}', -- uploaded documents, e.g. a trade license
+
+    -- Phone verification
+    otp_code VARCHAR(6),
+    otp_expires_at TIMESTAMP,
+    otp_attempts INT NOT NULL DEFAULT 0,
+
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    review_note TEXT,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_business_claims_business ON business_claims(business_id);
+CREATE INDEX IF NOT EXISTS idx_business_claims_user ON business_claims(user_id);
+CREATE INDEX IF NOT EXISTS idx_business_claims_pending ON business_claims(created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_business_claims_evidence ON business_claims USING GIN(evidence_urls);
+-- One open claim per user and business
+CREATE UNIQUE INDEX IF NOT EXISTS idx_business_claims_open
+    ON business_claims(business_id, user_id) WHERE status = 'pending';
+
+-- =====================
+-- OWNERSHIP TRANSFERS
+-- =====================
+-- An owner (or an admin) hands a business to another user, who accepts it
+CREATE TABLE IF NOT EXISTS business_ownership_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    from_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, accepted, declined, cancelled, expired
+    expires_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ownership_transfers_to ON business_ownership_transfers(to_user_id) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ownership_transfers_open
+    ON business_ownership_transfers(business_id) WHERE status = 'pending';
+
+-- =====================
+-- OWNERSHIP AUDIT TRAIL
+-- =====================
+CREATE TABLE IF NOT EXISTS business_ownership_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    -- claim_submitted, claim_approved, claim_rejected, claim_cancelled,
+    -- transfer_started, transfer_accepted, transfer_declined, transfer_cancelled
+    action VARCHAR(30) NOT NULL,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    from_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    to_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    claim_id UUID REFERENCES business_claims(id) ON DELETE SET NULL,
+    transfer_id UUID REFERENCES business_ownership_transfers(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ownership_events_business ON business_ownership_events(business_id, created_at DESC);
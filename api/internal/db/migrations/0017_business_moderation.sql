@@ -0,0 +1,33 @@
+-- =====================
+-- BUSINESS MODERATION
+-- =====================
+-- Change sets waiting for an admin: new businesses ('create') and edits
+-- by owners to the name, category or location of a listed business
+-- ('update'). An update holds the proposed values in the shape of the
+-- PUT /business/{id} body; a create is the business row itself.
+CREATE TABLE IF NOT EXISTS business_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL, -- who submitted it
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('create', 'update')),
+    changes JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, approved, rejected
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT, -- why it was rejected
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_business_changes_business ON business_changes(business_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_business_changes_pending ON business_changes(created_at) WHERE status = 'pending';
+-- Further edits are merged into the open change set
+CREATE UNIQUE INDEX IF NOT EXISTS idx_business_changes_open
+    ON business_changes(business_id, kind) WHERE status = 'pending';
+
+-- Queue the businesses that are still waiting for verification
+INSERT INTO business_changes (business_id, user_id, kind, created_at, updated_at)
+SELECT id, owner_id, 'create', created_at, created_at
+FROM businesses
+WHERE status = 'pending'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,89 @@
+-- =====================
+-- BUSINESS REVISIONS
+-- =====================
+-- Every change to the listed fields of a business, written by a trigger so
+-- that no code path is missed. The API attributes the changes of a
+-- transaction with SELECT set_config('app.actor_id', ..., true) and
+-- 'app.change_source' (owner, admin, publish, import); others are 'system'.
+CREATE TABLE IF NOT EXISTS business_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    revision INT NOT NULL, -- 1, 2, ... per business
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    source VARCHAR(20) NOT NULL DEFAULT 'system',
+    note TEXT,
+    snapshot JSONB NOT NULL, -- the fields after the change
+    changes JSONB NOT NULL DEFAULT '{}', -- {"field": {"old": ..., "new": ...}}
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (business_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS idx_business_revisions_actor ON business_revisions(actor_id);
+
+-- The fields a revision covers; counters, timestamps and search keys are
+-- left out
+CREATE OR REPLACE FUNCTION business_revision_snapshot(b businesses)
+RETURNS JSONB AS $$
+    SELECT jsonb_build_object(
+        'name', b.name,
+        'name_am', b.name_am,
+        'description', b.description,
+        'description_am', b.description_am,
+        'category_id', b.category_id,
+        'phone', b.phone,
+        'email', b.email,
+        'website', b.website,
+        'lat', ST_Y(b.geom),
+        'lng', ST_X(b.geom),
+        'address', b.address,
+        'address_am', b.address_am,
+        'city', b.city,
+        'status', b.status,
+        'owner_id', b.owner_id
+    )
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION record_business_revision()
+RETURNS TRIGGER AS $$
+DECLARE
+    snap JSONB := business_revision_snapshot(NEW);
+    prev JSONB := '{}';
+    diff JSONB;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        prev := business_revision_snapshot(OLD);
+    END IF;
+
+    SELECT COALESCE(jsonb_object_agg(key, jsonb_build_object('old', prev->key, 'new', value)), '{}')
+    INTO diff
+    FROM jsonb_each(snap)
+    WHERE prev->key IS DISTINCT FROM value;
+
+    -- e.g. a view count or rating update
+    IF diff = '{}' THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO business_revisions (business_id, revision, actor_id, source, note, snapshot, changes)
+    VALUES (
+        NEW.id,
+        COALESCE((SELECT MAX(revision) FROM business_revisions WHERE business_id = NEW.id), 0) + 1,
+        NULLIF(current_setting('app.actor_id', true), '')::uuid,
+        COALESCE(NULLIF(current_setting('app.change_source', true), ''), 'system'),
+        NULLIF(current_setting('app.change_note', true), ''),
+        snap,
+        diff
+    );
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS record_business_revision ON businesses;
+CREATE TRIGGER record_business_revision AFTER INSERT OR UPDATE ON businesses
+    FOR EACH ROW EXECUTE FUNCTION record_business_revision();
+
+-- Start the history of existing businesses from their current state
+INSERT INTO business_revisions (business_id, revision, source, snapshot)
+SELECT b.id, 1, 'system', business_revision_snapshot(b)
+FROM businesses b
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,30 @@
+-- =====================
+-- DUPLICATE BUSINESSES
+-- =====================
+-- Candidate pairs found by the duplicate detector (internal/dedupe), with
+-- the signals behind the score. business_a < business_b.
+CREATE TABLE IF NOT EXISTS business_duplicates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_a UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    business_b UUID NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    score REAL NOT NULL, -- 0..1
+    name_similarity REAL NOT NULL,
+    distance_m REAL NOT NULL,
+    same_category BOOLEAN NOT NULL DEFAULT FALSE,
+    same_phone BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, merged, dismissed
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (business_a, business_b),
+    CHECK (business_a < business_b)
+);
+
+CREATE INDEX IF NOT EXISTS idx_business_duplicates_pending ON business_duplicates(score DESC) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_business_duplicates_b ON business_duplicates(business_b);
+
+-- A merged business keeps its row, with status 'merged', and points at the
+-- business that took its saves, reviews, media and posts
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS merged_into UUID REFERENCES businesses(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_businesses_merged_into ON businesses(merged_into) WHERE merged_into IS NOT NULL;
@@ -0,0 +1,82 @@
+-- =====================
+-- CATEGORY MAPPINGS
+-- =====================
+-- Canonical categories for the tags of imported and published places, so
+-- the importer and PublishPOI stop creating a category per unseen type.
+--   source 'osm':  key is 'class=type', or 'class=*' for a whole class
+--   other sources: key is the PublishPOI type; source '*' is any publisher
+-- Keys are lowercase with spaces and dashes turned into underscores.
+CREATE TABLE IF NOT EXISTS category_mappings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    source VARCHAR(50) NOT NULL,
+    key VARCHAR(100) NOT NULL,
+    category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_mappings_category ON category_mappings(category_id);
+
+-- Map the common tags to the default categories
+INSERT INTO category_mappings (source, key, category_id)
+SELECT m.source, m.key, c.id
+FROM (VALUES
+    ('osm', 'amenity=restaurant', 'Restaurant'),
+    ('osm', 'amenity=fast_food', 'Restaurant'),
+    ('osm', 'amenity=food_court', 'Restaurant'),
+    ('osm', 'amenity=cafe', 'Cafe'),
+    ('osm', 'shop=coffee', 'Cafe'),
+    ('osm', 'tourism=hotel', 'Hotel'),
+    ('osm', 'tourism=guest_house', 'Hotel'),
+    ('osm', 'tourism=hostel', 'Hotel'),
+    ('osm', 'tourism=motel', 'Hotel'),
+    ('osm', 'shop=*', 'Shop'),
+    ('osm', 'shop=hairdresser', 'Salon'),
+    ('osm', 'shop=beauty', 'Salon'),
+    ('osm', 'shop=supermarket', 'Market'),
+    ('osm', 'amenity=marketplace', 'Market'),
+    ('osm', 'amenity=bank', 'Bank'),
+    ('osm', 'amenity=atm', 'Bank'),
+    ('osm', 'amenity=bureau_de_change', 'Bank'),
+    ('osm', 'amenity=hospital', 'Hospital'),
+    ('osm', 'amenity=clinic', 'Hospital'),
+    ('osm', 'amenity=doctors', 'Hospital'),
+    ('osm', 'amenity=pharmacy', 'Pharmacy'),
+    ('osm', 'shop=chemist', 'Pharmacy'),
+    ('osm', 'amenity=fuel', 'Gas Station'),
+    ('osm', 'leisure=fitness_centre', 'Gym'),
+    ('osm', 'leisure=sports_centre', 'Gym'),
+    ('osm', 'amenity=school', 'School'),
+    ('osm', 'amenity=kindergarten', 'School'),
+    ('osm', 'amenity=college', 'School'),
+    ('osm', 'amenity=university', 'School'),
+    ('osm', 'amenity=cinema', 'Entertainment'),
+    ('osm', 'amenity=theatre', 'Entertainment'),
+    ('osm', 'amenity=nightclub', 'Entertainment'),
+    ('osm', 'amenity=bar', 'Entertainment'),
+    ('osm', 'amenity=pub', 'Entertainment'),
+    ('*', 'restaurant', 'Restaurant'),
+    ('*', 'fast_food', 'Restaurant'),
+    ('*', 'cafe', 'Cafe'),
+    ('*', 'coffee_shop', 'Cafe'),
+    ('*', 'hotel', 'Hotel'),
+    ('*', 'shop', 'Shop'),
+    ('*', 'grocery', 'Shop'),
+    ('*', 'supermarket', 'Market'),
+    ('*', 'market', 'Market'),
+    ('*', 'bank', 'Bank'),
+    ('*', 'hospital', 'Hospital'),
+    ('*', 'clinic', 'Hospital'),
+    ('*', 'pharmacy', 'Pharmacy'),
+    ('*', 'gas_station', 'Gas Station'),
+    ('*', 'gym', 'Gym'),
+    ('*', 'salon', 'Salon'),
+    ('*', 'school', 'School')
+) AS m(source, key, category)
+JOIN LATERAL (
+    SELECT id FROM categories
+    WHERE name = m.category AND parent_id IS NULL
+    ORDER BY created_at
+    LIMIT 1
+) c ON TRUE
+ON CONFLICT (source, key) DO NOTHING;
@@ -0,0 +1,15 @@
+-- Only notify business_changes listeners (search index, search keys, POI
+-- tiles) when something they show changed. GetBusiness bumps view_count on
+-- every view, which used to flush them all.
+
+CREATE OR REPLACE FUNCTION notify_business_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND to_jsonb(NEW) - ARRAY['view_count', 'updated_at'] = to_jsonb(OLD) - ARRAY['view_count', 'updated_at'] THEN
+        RETURN NULL;
+    END IF;
+    PERFORM pg_notify('business_changes', COALESCE(NEW.id, OLD.id)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
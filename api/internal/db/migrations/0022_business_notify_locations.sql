@@ -0,0 +1,20 @@
+-- Send the old and new location of a changed business with its id, so
+-- caches can drop only the affected area:
+--   {"id": "...", "old": [lng, lat], "new": [lng, lat]}
+-- "old" is null for inserts and "new" for deletes.
+
+CREATE OR REPLACE FUNCTION notify_business_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND to_jsonb(NEW) - ARRAY['view_count', 'updated_at'] = to_jsonb(OLD) - ARRAY['view_count', 'updated_at'] THEN
+        RETURN NULL;
+    END IF;
+    PERFORM pg_notify('business_changes', json_build_object(
+        'id', COALESCE(NEW.id, OLD.id),
+        'old', CASE WHEN TG_OP <> 'INSERT' THEN json_build_array(ST_X(OLD.geom), ST_Y(OLD.geom)) END,
+        'new', CASE WHEN TG_OP <> 'DELETE' THEN json_build_array(ST_X(NEW.geom), ST_Y(NEW.geom)) END
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
@@ -0,0 +1,4 @@
+-- Count the codes sent for a phone claim, so resends are capped and the
+-- wrong-code attempts of a claim are never reset
+ALTER TABLE business_claims ADD COLUMN IF NOT EXISTS otp_sends INT NOT NULL DEFAULT 0;
+UPDATE business_claims SET otp_sends = 1 WHERE otp_code IS NOT NULL AND otp_sends = 0;
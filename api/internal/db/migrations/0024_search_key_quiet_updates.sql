@@ -0,0 +1,33 @@
+-- Filling in search_key (search.KeySyncer) is bookkeeping, not a change to
+-- the business: it neither bumps updated_at nor notifies listeners, which
+-- would start another key sync and index refresh.
+
+CREATE OR REPLACE FUNCTION update_business_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF to_jsonb(NEW) - ARRAY['search_key', 'updated_at'] <> to_jsonb(OLD) - ARRAY['search_key', 'updated_at'] THEN
+        NEW.updated_at = CURRENT_TIMESTAMP;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS update_businesses_updated_at ON businesses;
+CREATE TRIGGER update_businesses_updated_at BEFORE UPDATE ON businesses
+    FOR EACH ROW EXECUTE FUNCTION update_business_updated_at();
+
+CREATE OR REPLACE FUNCTION notify_business_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND to_jsonb(NEW) - ARRAY['view_count', 'updated_at', 'search_key'] = to_jsonb(OLD) - ARRAY['view_count', 'updated_at', 'search_key'] THEN
+        RETURN NULL;
+    END IF;
+    PERFORM pg_notify('business_changes', json_build_object(
+        'id', COALESCE(NEW.id, OLD.id),
+        'old', CASE WHEN TG_OP <> 'INSERT' THEN json_build_array(ST_X(OLD.geom), ST_Y(OLD.geom)) END,
+        'new', CASE WHEN TG_OP <> 'DELETE' THEN json_build_array(ST_X(NEW.geom), ST_Y(NEW.geom)) END
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
@@ -0,0 +1,12 @@
+-- Keep the bytes of resumable uploads in the storage backend instead of a
+-- file on the API server, so any replica can take the next chunk. Each
+-- chunk is stored as an object; parts lists their keys in order and
+-- received is the current offset. finishing_at is set while an upload is
+-- being processed, so other replicas leave it alone.
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS received BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS parts TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS finishing_at TIMESTAMPTZ;
+
+-- The bytes of uploads started before this were on local disk; clients
+-- start over when they get a 404
+DELETE FROM resumable_uploads;
@@ -0,0 +1,11 @@
+-- Search only covers businesses with a region. Rows written before the
+-- assign_business_region trigger, or while their region was missing, may
+-- still have none although a region contains them.
+UPDATE businesses b SET region_id = (
+    SELECT r.id FROM regions r
+    WHERE ST_Contains(r.geom, b.geom)
+    ORDER BY ST_Area(r.geom)
+    LIMIT 1
+)
+WHERE b.region_id IS NULL
+AND EXISTS (SELECT 1 FROM regions r WHERE ST_Contains(r.geom, b.geom));
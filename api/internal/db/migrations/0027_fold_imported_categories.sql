@@ -0,0 +1,31 @@
+-- The Nominatim importer used to create a category for every OSM type it
+-- hadn't seen, named after the type ("Fast Food") with a 📍 icon. Fold
+-- each one into the category its type is mapped to when the mappings
+-- agree on one. The rest are left for an admin to review with
+-- GET /api/categories and remove with
+-- DELETE /api/categories/{id}?reassign_to=<category id>.
+CREATE TEMP TABLE imported_categories AS
+SELECT c.id, MIN(m.category_id::text)::uuid AS target
+FROM categories c
+JOIN category_mappings m
+    ON (m.source = '*' AND m.key = lower(replace(c.name, ' ', '_')))
+    OR (m.source = 'osm' AND split_part(m.key, '=', 2) = lower(replace(c.name, ' ', '_')))
+WHERE c.icon = '📍' AND c.parent_id IS NULL
+AND m.category_id <> c.id
+AND NOT EXISTS (SELECT 1 FROM categories child WHERE child.parent_id = c.id)
+GROUP BY c.id
+HAVING COUNT(DISTINCT m.category_id) = 1;
+
+UPDATE businesses b SET category_id = i.target
+FROM imported_categories i WHERE b.category_id = i.id;
+
+UPDATE category_mappings m SET category_id = i.target
+FROM imported_categories i WHERE m.category_id = i.id;
+
+UPDATE business_changes bc SET changes = jsonb_set(bc.changes, '{category_id}', to_jsonb(i.target::text))
+FROM imported_categories i
+WHERE bc.status = 'pending' AND bc.changes->>'category_id' = i.id::text;
+
+DELETE FROM categories c USING imported_categories i WHERE c.id = i.id;
+
+DROP TABLE imported_categories;
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"maps/api/internal/config"
+)
+
+// BusinessChangesChannel is the NOTIFY channel fired by the businesses trigger.
+// The payload is a BusinessChange as JSON; see ParseBusinessChange.
+const BusinessChangesChannel = "business_changes"
+
+// BusinessChange is an inserted, updated or deleted business with its
+// location before and after the change, as [lng, lat]
+type BusinessChange struct {
+	ID  string      `json:"id"`
+	Old *[2]float64 `json:"old"` // nil for inserts
+	New *[2]float64 `json:"new"` // nil for deletes
+}
+
+// ParseBusinessChange decodes a BusinessChangesChannel payload. Payloads
+// sent before the trigger carried locations are a bare id.
+func ParseBusinessChange(payload string) (BusinessChange, error) {
+	if !strings.HasPrefix(payload, "{") {
+		return BusinessChange{ID: payload}, nil
+	}
+	var c BusinessChange
+	err := json.Unmarshal([]byte(payload), &c)
+	return c, err
+}
+
+// Notifier fans out PostgreSQL NOTIFY payloads to in-process subscribers
+type Notifier struct {
+	listener *pq.Listener
+	mu       sync.RWMutex
+	subs     map[string][]func(payload string)
+}
+
+// NewNotifier creates a notifier with its own dedicated connection
+func NewNotifier(cfg *config.Config) *Notifier {
+	n := &Notifier{subs: make(map[string][]func(string))}
+	n.listener = pq.NewListener(DSN(cfg), 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Notifier connection event %d: %v", ev, err)
+		}
+	})
+	return n
+}
+
+// Subscribe registers fn for every notification on channel
+func (n *Notifier) Subscribe(channel string, fn func(payload string)) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.subs[channel]; !ok {
+		if err := n.listener.Listen(channel); err != nil {
+			return err
+		}
+	}
+	n.subs[channel] = append(n.subs[channel], fn)
+	return nil
+}
+
+// Run dispatches notifications until Close is called
+func (n *Notifier) Run() {
+	for {
+		select {
+		case ev, ok := <-n.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil event means the connection was re-established and
+			// notifications may have been missed; subscribers get "".
+			if ev == nil {
+				n.dispatchAll("")
+				continue
+			}
+			n.dispatch(ev.Channel, ev.Extra)
+		case <-time.After(90 * time.Second):
+			go n.listener.Ping()
+		}
+	}
+}
+
+// Close stops listening and releases the connection
+func (n *Notifier) Close() error {
+	return n.listener.Close()
+}
+
+func (n *Notifier) dispatch(channel, payload string) {
+	n.mu.RLock()
+	fns := n.subs[channel]
+	n.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(payload)
+	}
+}
+
+func (n *Notifier) dispatchAll(payload string) {
+	n.mu.RLock()
+	var fns []func(string)
+	for _, subs := range n.subs {
+		fns = append(fns, subs...)
+	}
+	n.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(payload)
+	}
+}
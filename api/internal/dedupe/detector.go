@@ -0,0 +1,227 @@
+// Package dedupe finds businesses that are likely the same place, such as an
+// imported "Tomoca" and a user-submitted "Tomoca Coffee" 30 m apart, for
+// admins to merge.
+package dedupe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// maxDistance is how far apart, in meters, two businesses may be
+	maxDistance = 150
+	// MinScore is the lowest score a candidate pair is kept with
+	MinScore = 0.4
+	// minNameSimilarity is the trigram similarity two names need unless
+	// the phone numbers match
+	minNameSimilarity = 0.3
+
+	// scanInterval is how often all businesses are compared
+	scanInterval = 24 * time.Hour
+)
+
+// ErrScanRunning is returned by Scan while another scan holds the lock
+var ErrScanRunning = errors.New("duplicate scan already running")
+
+// The score weights; a pair with the same name at the same spot scores
+// 0.75, and 1 with the same category and phone
+const (
+	nameWeight     = 0.55
+	distanceWeight = 0.2
+	categoryWeight = 0.1
+	phoneWeight    = 0.15
+)
+
+// Detector refreshes the business_duplicates candidates daily and when
+// triggered
+type Detector struct {
+	db      *sql.DB
+	pending chan struct{}
+}
+
+// NewDetector creates a detector and starts its background worker
+func NewDetector(db *sql.DB) *Detector {
+	d := &Detector{db: db, pending: make(chan struct{}, 1)}
+	go d.run()
+	return d
+}
+
+// Trigger schedules a scan if one isn't already queued
+func (d *Detector) Trigger() {
+	select {
+	case d.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Detector) run() {
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+	for ; ; d.wait(ticker.C) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		n, err := d.Scan(ctx)
+		cancel()
+		if err == ErrScanRunning {
+			log.Printf("Skipped duplicate business scan: another instance is scanning")
+		} else if err != nil {
+			log.Printf("Failed to scan for duplicate businesses: %v", err)
+		} else {
+			log.Printf("Found %d duplicate business candidates", n)
+		}
+	}
+}
+
+func (d *Detector) wait(tick <-chan time.Time) {
+	select {
+	case <-tick:
+	case <-d.pending:
+	}
+}
+
+// Pair is a candidate duplicate: two businesses near each other with
+// similar names or the same phone number
+type Pair struct {
+	BusinessA, BusinessB string
+	NameSimilarity       float64 // trigram similarity of the names
+	DistanceM            float64
+	SameCategory         bool
+	SamePhone            bool
+}
+
+// Score rates how likely a pair is the same place, from 0 to 1. Pairs too
+// far apart, or with dissimilar names and different phones, score 0.
+func (p Pair) Score() float64 {
+	if p.DistanceM > maxDistance || (p.NameSimilarity < minNameSimilarity && !p.SamePhone) {
+		return 0
+	}
+	score := nameWeight*p.NameSimilarity + distanceWeight*(1-p.DistanceM/maxDistance)
+	if p.SameCategory {
+		score += categoryWeight
+	}
+	if p.SamePhone {
+		score += phoneWeight
+	}
+	return score
+}
+
+// scanLock is the advisory lock key held while scanning, so API replicas
+// don't scan at the same time
+const scanLock = 0x6465647570 // "dedup"
+
+// Scan compares every listed or pending business with those nearby and
+// stores the pairs that score at least MinScore. Pending pairs that no
+// longer qualify are dropped; merged and dismissed ones are kept as they
+// are. It returns how many candidates were found, or ErrScanRunning when
+// another replica is scanning.
+func (d *Detector) Scan(ctx context.Context) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, scanLock).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, ErrScanRunning
+	}
+
+	pairs, err := candidatePairs(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	var a, b []string
+	var scores, similarities, distances []float64
+	var categories, phones []bool
+	for _, p := range pairs {
+		score := p.Score()
+		if score < MinScore {
+			continue
+		}
+		a, b = append(a, p.BusinessA), append(b, p.BusinessB)
+		scores, similarities, distances = append(scores, score), append(similarities, p.NameSimilarity), append(distances, p.DistanceM)
+		categories, phones = append(categories, p.SameCategory), append(phones, p.SamePhone)
+	}
+
+	if len(a) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO business_duplicates (business_a, business_b, score, name_similarity, distance_m, same_category, same_phone)
+			SELECT * FROM unnest($1::uuid[], $2::uuid[], $3::float8[], $4::float8[], $5::float8[], $6::bool[], $7::bool[])
+			ON CONFLICT (business_a, business_b) DO UPDATE SET
+				score = EXCLUDED.score,
+				name_similarity = EXCLUDED.name_similarity,
+				distance_m = EXCLUDED.distance_m,
+				same_category = EXCLUDED.same_category,
+				same_phone = EXCLUDED.same_phone,
+				updated_at = NOW()
+			WHERE business_duplicates.status = 'pending'
+		`, pq.Array(a), pq.Array(b), pq.Array(scores), pq.Array(similarities), pq.Array(distances),
+			pq.Array(categories), pq.Array(phones))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// NOW() is the start of the transaction, so this drops the pairs the
+	// insert didn't see again
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM business_duplicates WHERE status = 'pending' AND updated_at < NOW()
+	`); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(a), nil
+}
+
+// candidatePairs returns the pairs of businesses within maxDistance whose
+// names are similar enough or whose phones match
+func candidatePairs(ctx context.Context, tx *sql.Tx) ([]Pair, error) {
+	// ST_DWithin in degrees narrows the pairs down with the spatial index;
+	// a degree is at least 100 km in the service regions
+	rows, err := tx.QueryContext(ctx, `
+		SELECT * FROM (
+			SELECT a.id AS business_a, b.id AS business_b,
+				GREATEST(
+					similarity(lower(a.name), lower(b.name)),
+					CASE WHEN a.name_am <> '' AND b.name_am <> '' THEN similarity(a.name_am, b.name_am) ELSE 0 END
+				) AS name_similarity,
+				ST_Distance(a.geom::geography, b.geom::geography) AS distance_m,
+				COALESCE(a.category_id = b.category_id, FALSE) AS same_category,
+				COALESCE(
+					length(regexp_replace(a.phone, '\D', '', 'g')) >= 9
+					AND right(regexp_replace(a.phone, '\D', '', 'g'), 9) = right(regexp_replace(b.phone, '\D', '', 'g'), 9),
+					FALSE
+				) AS same_phone
+			FROM businesses a
+			JOIN businesses b ON a.id < b.id AND ST_DWithin(a.geom, b.geom, $1::float8 / 100000)
+			WHERE a.status IN ('verified', 'pending', 'closed')
+			AND b.status IN ('verified', 'pending', 'closed')
+		) pairs
+		WHERE distance_m <= $1::float8 AND (name_similarity >= $2::float8 OR same_phone)
+	`, float64(maxDistance), minNameSimilarity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []Pair
+	for rows.Next() {
+		var p Pair
+		if err := rows.Scan(&p.BusinessA, &p.BusinessB, &p.NameSimilarity, &p.DistanceM, &p.SameCategory, &p.SamePhone); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
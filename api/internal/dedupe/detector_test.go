@@ -0,0 +1,43 @@
+package dedupe
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPairScore(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pair Pair
+		want float64
+		keep bool
+	}{
+		// "Tomoca" and "Tomoca Coffee" share 7 of their 14 trigrams
+		{"Tomoca vs Tomoca Coffee 30 m apart",
+			Pair{NameSimilarity: 0.5, DistanceM: 30}, 0.435, true},
+		{"same name and category at the same spot",
+			Pair{NameSimilarity: 1, SameCategory: true}, 0.85, true},
+		{"same everything",
+			Pair{NameSimilarity: 1, SameCategory: true, SamePhone: true}, 1, true},
+		{"same name at the distance limit",
+			Pair{NameSimilarity: 1, DistanceM: maxDistance}, 0.55, true},
+		{"too far apart",
+			Pair{NameSimilarity: 1, SameCategory: true, SamePhone: true, DistanceM: maxDistance + 1}, 0, false},
+		{"dissimilar names",
+			Pair{NameSimilarity: 0.29, DistanceM: 0, SameCategory: true}, 0, false},
+		{"dissimilar names with the same phone",
+			Pair{NameSimilarity: 0.1, DistanceM: 0, SamePhone: true}, 0.405, true},
+		{"similar names far apart in another category",
+			Pair{NameSimilarity: 0.4, DistanceM: 120}, 0.26, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.pair.Score()
+			if math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, tc.want)
+			}
+			if keep := got >= MinScore; keep != tc.keep {
+				t.Errorf("kept = %v, want %v", keep, tc.keep)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"maps/api/internal/search"
+)
+
+// AutocompleteSuggestion is a single type-ahead suggestion
+type AutocompleteSuggestion struct {
+	Type       string   `json:"type"` // business, category
+	ID         string   `json:"id"`
+	Text       string   `json:"text"`
+	NameAm     *string  `json:"name_am,omitempty"`
+	CategoryID *string  `json:"category_id,omitempty"`
+	Category   *string  `json:"category,omitempty"`
+	Icon       *string  `json:"icon,omitempty"`
+	Lat        *float64 `json:"lat,omitempty"`
+	Lng        *float64 `json:"lng,omitempty"`
+	Distance   *float64 `json:"distance_m,omitempty"`
+	Score      float64  `json:"score"`
+}
+
+// autocompleteTrgmBudget caps how long the trigram fallback may take before
+// we answer with trie results alone
+const autocompleteTrgmBudget = 150 * time.Millisecond
+
+// Autocomplete returns type-ahead suggestions combining the in-memory prefix
+// index with pg_trgm similarity for typo tolerance, boosted by proximity
+func Autocomplete(db *sql.DB, idx *search.Index) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			jsonError(w, "search query required", http.StatusBadRequest)
+			return
+		}
+
+		limit := 10
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, _ = strconv.Atoi(limitStr)
+		}
+		if limit <= 0 || limit > 25 {
+			limit = 10
+		}
+
+		userLat, _ := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+		userLng, _ := strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+		hasLocation := userLat != 0 && userLng != 0
+
+		candidates := make(map[string]*AutocompleteSuggestion)
+
+		// 1. Prefix matches from the trie (over-fetch, proximity reorders them)
+		for _, m := range idx.Lookup(q, limit*5) {
+			s := suggestionFromDoc(m.Doc)
+			s.Score += m.Coverage
+			candidates[s.Type+":"+s.ID] = s
+		}
+
+		// 2. Trigram similarity catches typos the prefix index can't, and the
+		// folded search_key lets either script match the other
+		if len([]rune(q)) >= 3 {
+			ctx, cancel := context.WithTimeout(r.Context(), autocompleteTrgmBudget)
+			trgm, err := autocompleteTrigram(ctx, db, q, limit*2)
+			if err != nil && ctx.Err() != context.DeadlineExceeded {
+				log.Printf("Autocomplete trigram lookup failed: %v", err)
+			}
+			cancel()
+			for _, s := range trgm {
+				key := s.Type + ":" + s.ID
+				if existing, ok := candidates[key]; ok {
+					if s.Score > existing.Score {
+						existing.Score = s.Score
+					}
+					continue
+				}
+				candidates[key] = s
+			}
+		}
+
+		suggestions := make([]*AutocompleteSuggestion, 0, len(candidates))
+		for _, s := range candidates {
+			if s.Lat != nil && s.Lng != nil && hasLocation {
+				d := search.DistanceMeters(userLat, userLng, *s.Lat, *s.Lng)
+				s.Distance = &d
+				s.Score += 0.35 * search.ProximityBoost(d, 3000)
+			}
+			suggestions = append(suggestions, s)
+		}
+
+		sort.SliceStable(suggestions, func(i, j int) bool {
+			if suggestions[i].Score != suggestions[j].Score {
+				return suggestions[i].Score > suggestions[j].Score
+			}
+			return suggestions[i].Text < suggestions[j].Text
+		})
+		if len(suggestions) > limit {
+			suggestions = suggestions[:limit]
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"suggestions": suggestions,
+			"count":       len(suggestions),
+		}, http.StatusOK)
+	}
+}
+
+func suggestionFromDoc(d *search.Doc) *AutocompleteSuggestion {
+	s := &AutocompleteSuggestion{Type: d.Kind, ID: d.ID, Text: d.Name}
+	if d.NameAm != "" {
+		nameAm := d.NameAm
+		s.NameAm = &nameAm
+	}
+	if d.Icon != "" {
+		icon := d.Icon
+		s.Icon = &icon
+	}
+	if d.Kind == search.KindBusiness {
+		lat, lng := d.Lat, d.Lng
+		s.Lat, s.Lng = &lat, &lng
+		if d.CategoryID != "" {
+			catID, cat := d.CategoryID, d.Category
+			s.CategoryID, s.Category = &catID, &cat
+		}
+		// Small nudge so well-rated places win ties
+		s.Score += 0.05 * d.Rating / 5
+	}
+	return s
+}
+
+func autocompleteTrigram(ctx context.Context, db *sql.DB, q string, limit int) ([]*AutocompleteSuggestion, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			b.id, b.name, b.name_am, c.id, c.name, c.icon,
+			ST_Y(b.geom), ST_X(b.geom), COALESCE(b.avg_rating, 0),
+			GREATEST(
+				similarity(b.name, $1),
+				similarity(COALESCE(b.name_am, ''), $1),
+				similarity(COALESCE(b.search_key, ''), $2)
+			) AS sim
+		FROM businesses b
+		LEFT JOIN categories c ON b.category_id = c.id
+		WHERE b.status = 'verified'
+		AND (b.name % $1 OR b.name_am % $1 OR b.search_key % $2)
+		ORDER BY sim DESC
+		LIMIT $3
+	`, q, search.Normalize(q), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*AutocompleteSuggestion
+	for rows.Next() {
+		var s AutocompleteSuggestion
+		var nameAm, catID, catName, catIcon sql.NullString
+		var lat, lng, rating, sim float64
+		if err := rows.Scan(&s.ID, &s.Text, &nameAm, &catID, &catName, &catIcon, &lat, &lng, &rating, &sim); err != nil {
+			continue
+		}
+		s.Type = search.KindBusiness
+		s.Lat, s.Lng = &lat, &lng
+		if nameAm.Valid {
+			s.NameAm = &nameAm.String
+		}
+		if catID.Valid {
+			s.CategoryID = &catID.String
+			s.Category = &catName.String
+		}
+		if catIcon.Valid {
+			s.Icon = &catIcon.String
+		}
+		s.Score = sim + 0.05*rating/5
+		results = append(results, &s)
+	}
+	return results, rows.Err()
+}
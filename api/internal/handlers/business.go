@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,8 +12,12 @@ import (
 	"time"
 
 	"maps/api/internal/config"
+	"maps/api/internal/regions"
+	"maps/api/internal/search"
+	"maps/api/internal/translit"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
 )
 
 // CreateBusinessRequest is the request body for creating a business
@@ -78,7 +83,12 @@ type BusinessResponseFull struct {
 	ViewCount     int                `json:"view_count"`
 	Distance      *float64           `json:"distance_m,omitempty"`
 	Hours         []BusinessHourResp `json:"hours,omitempty"`
+	SpecialHours  []SpecialHourResp  `json:"special_hours,omitempty"` // from today on
+	IsOpenNow     bool               `json:"is_open_now"`
+	NextChangeAt  *string            `json:"next_change_at"` // Addis Ababa time, null if not within a week
 	Media         []MediaResp        `json:"media,omitempty"`
+	Reviews       []ReviewResp       `json:"reviews"`             // newest first, see ListReviews for more
+	MyReview      *ReviewResp        `json:"my_review,omitempty"` // the current user's review
 	IsSaved       bool               `json:"is_saved"`
 	CreatedAt     string             `json:"created_at"`
 }
@@ -103,6 +113,8 @@ type MediaResp struct {
 	URL          string  `json:"url"`
 	ThumbnailURL *string `json:"thumbnail_url,omitempty"`
 	Caption      *string `json:"caption,omitempty"`
+	SortOrder    int     `json:"sort_order"`
+	IsCover      bool    `json:"is_cover"`
 }
 
 // CreateBusiness creates a new business listing
@@ -130,27 +142,64 @@ func CreateBusiness(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Validate coordinates are within Ethiopia/Addis bounds
-		if req.Lat < 3 || req.Lat > 15 || req.Lng < 33 || req.Lng > 48 {
-			jsonError(w, "coordinates must be within Ethiopia", http.StatusBadRequest)
+		// Validate coordinates are within one of our service regions
+		region, err := regions.Locate(r.Context(), db, req.Lat, req.Lng)
+		if err == regions.ErrOutsideRegions {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to locate region: %v", err)
+			jsonError(w, "failed to create business", http.StatusInternalServerError)
 			return
 		}
 
+		// Businesses are listed once an admin approves them, except those
+		// added by admins
+		admin := isAdmin(db, userID)
 		var businessID string
-		err := db.QueryRow(`
-			INSERT INTO businesses (
-				owner_id, name, name_am, description, description_am,
-				category_id, phone, email, website,
-				geom, address, address_am, status
-			) VALUES (
-				$1, $2, $3, $4, $5,
-				$6, $7, $8, $9,
-				ST_SetSRID(ST_MakePoint($10, $11), 4326), $12, $13, 'verified'
-			) RETURNING id
-		`, userID, req.Name, req.NameAm, req.Description, req.DescriptionAm,
-			req.CategoryID, req.Phone, req.Email, req.Website,
-			req.Lng, req.Lat, req.Address, req.AddressAm).Scan(&businessID)
+		err = func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
 
+			source := "owner"
+			if admin {
+				source = "admin"
+			}
+			if err := tagRevision(tx, userID, source, ""); err != nil {
+				return err
+			}
+			err = tx.QueryRow(`
+				INSERT INTO businesses (
+					owner_id, name, name_am, description, description_am,
+					category_id, phone, email, website,
+					geom, address, address_am, city,
+					status, verified_at, verified_by
+				) VALUES (
+					$1, $2, $3, $4, $5,
+					$6, $7, $8, $9,
+					ST_SetSRID(ST_MakePoint($10, $11), 4326), $12, $13, $14,
+					CASE WHEN $15 THEN 'verified' ELSE 'pending' END,
+					CASE WHEN $15 THEN NOW() END,
+					CASE WHEN $15 THEN $1::uuid END
+				) RETURNING id
+			`, userID, req.Name, req.NameAm, req.Description, req.DescriptionAm,
+				req.CategoryID, req.Phone, req.Email, req.Website,
+				req.Lng, req.Lat, req.Address, req.AddressAm, region.Name,
+				admin).Scan(&businessID)
+			if err != nil {
+				return err
+			}
+			if !admin {
+				if _, err := submitBusinessChange(tx, businessID, &userID, "create", UpdateBusinessRequest{}); err != nil {
+					return err
+				}
+			}
+			return tx.Commit()
+		}()
 		if err != nil {
 			log.Printf("Failed to create business: %v", err)
 			jsonError(w, "failed to create business", http.StatusInternalServerError)
@@ -163,14 +212,20 @@ func CreateBusiness(db *sql.DB) http.HandlerFunc {
 		// Log activity
 		LogActivity(db, userID, "create_business", map[string]string{"business_id": businessID, "name": req.Name}, r.RemoteAddr)
 
+		message := "business created, pending verification"
+		if admin {
+			message = "business created"
+		}
 		jsonResponse(w, map[string]string{
 			"id":      businessID,
-			"message": "business created, pending verification",
+			"message": message,
 		}, http.StatusCreated)
 	}
 }
 
-// UpdateBusiness updates an existing business
+// UpdateBusiness updates an existing business. Edits by the owner to the
+// name, category or location of a listed business wait for an admin (see
+// business_changes.go); the other fields change right away.
 func UpdateBusiness(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := getUserIDFromContext(r)
@@ -185,22 +240,10 @@ func UpdateBusiness(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Check ownership
-		var ownerID string
-		err := db.QueryRow("SELECT owner_id FROM businesses WHERE id = $1", businessID).Scan(&ownerID)
-		if err == sql.ErrNoRows {
-			jsonError(w, "business not found", http.StatusNotFound)
+		status, admin, ok := businessEditor(w, db, businessID, userID)
+		if !ok {
 			return
 		}
-		if ownerID != userID {
-			// Check if admin
-			var role string
-			db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
-			if role != "admin" {
-				jsonError(w, "forbidden", http.StatusForbidden)
-				return
-			}
-		}
 
 		var req UpdateBusinessRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -208,79 +251,188 @@ func UpdateBusiness(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Build dynamic update query
-		query := "UPDATE businesses SET updated_at = NOW()"
-		args := []interface{}{}
-		argNum := 1
+		editBusiness(w, r, db, businessID, userID, status, admin, req, "")
+	}
+}
+
+// businessEditor checks that the user owns the business or is an admin, and
+// returns the business status. It writes the error response on failure.
+func businessEditor(w http.ResponseWriter, db *sql.DB, businessID, userID string) (string, bool, bool) {
+	var ownerID sql.NullString
+	var status string
+	err := db.QueryRow("SELECT owner_id, status FROM businesses WHERE id = $1", businessID).Scan(&ownerID, &status)
+	if err == sql.ErrNoRows {
+		jsonError(w, "business not found", http.StatusNotFound)
+		return "", false, false
+	}
+	if err != nil {
+		log.Printf("Failed to get business: %v", err)
+		jsonError(w, "failed to update business", http.StatusInternalServerError)
+		return "", false, false
+	}
+	admin := isAdmin(db, userID)
+	if (!ownerID.Valid || ownerID.String != userID) && !admin {
+		jsonError(w, "forbidden", http.StatusForbidden)
+		return "", false, false
+	}
+	if status == "merged" {
+		jsonError(w, "business was merged into another", http.StatusConflict)
+		return "", false, false
+	}
+	return status, admin, true
+}
 
-		if req.Name != nil {
-			query += ", name = $" + strconv.Itoa(argNum)
-			args = append(args, *req.Name)
-			argNum++
-		}
-		if req.NameAm != nil {
-			query += ", name_am = $" + strconv.Itoa(argNum)
-			args = append(args, *req.NameAm)
-			argNum++
-		}
-		if req.Description != nil {
-			query += ", description = $" + strconv.Itoa(argNum)
-			args = append(args, *req.Description)
-			argNum++
-		}
-		if req.DescriptionAm != nil {
-			query += ", description_am = $" + strconv.Itoa(argNum)
-			args = append(args, *req.DescriptionAm)
-			argNum++
-		}
-		if req.CategoryID != nil {
-			query += ", category_id = $" + strconv.Itoa(argNum)
-			args = append(args, *req.CategoryID)
-			argNum++
-		}
-		if req.Phone != nil {
-			query += ", phone = $" + strconv.Itoa(argNum)
-			args = append(args, *req.Phone)
-			argNum++
-		}
-		if req.Email != nil {
-			query += ", email = $" + strconv.Itoa(argNum)
-			args = append(args, *req.Email)
-			argNum++
+// editBusiness applies req on behalf of the business owner or an admin and
+// writes the response. note is kept with the business revision.
+func editBusiness(w http.ResponseWriter, r *http.Request, db *sql.DB, businessID, userID, status string, admin bool, req UpdateBusinessRequest, note string) {
+	region, err := locateUpdate(r.Context(), db, req)
+	if err == regions.ErrOutsideRegions {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to locate region: %v", err)
+		jsonError(w, "failed to update business", http.StatusInternalServerError)
+		return
+	}
+
+	moderated, resubmit := req.splitModerated(status, admin)
+	source := "admin"
+	if !admin {
+		source = "owner"
+	}
+
+	var changeID string
+	err = func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
 		}
-		if req.Website != nil {
-			query += ", website = $" + strconv.Itoa(argNum)
-			args = append(args, *req.Website)
-			argNum++
+		defer tx.Rollback()
+
+		if err := tagRevision(tx, userID, source, note); err != nil {
+			return err
 		}
-		if req.Lat != nil && req.Lng != nil {
-			query += ", geom = ST_SetSRID(ST_MakePoint($" + strconv.Itoa(argNum) + ", $" + strconv.Itoa(argNum+1) + "), 4326)"
-			args = append(args, *req.Lng, *req.Lat)
-			argNum += 2
+		if !req.isEmpty() {
+			query, args := businessUpdateQuery(businessID, req, region)
+			if _, err := tx.Exec(query, args...); err != nil {
+				return err
+			}
 		}
-		if req.Address != nil {
-			query += ", address = $" + strconv.Itoa(argNum)
-			args = append(args, *req.Address)
-			argNum++
+		if !moderated.isEmpty() {
+			if changeID, err = submitBusinessChange(tx, businessID, &userID, "update", moderated); err != nil {
+				return err
+			}
 		}
-		if req.AddressAm != nil {
-			query += ", address_am = $" + strconv.Itoa(argNum)
-			args = append(args, *req.AddressAm)
-			argNum++
+		if resubmit {
+			if _, err := tx.Exec(`UPDATE businesses SET status = 'pending' WHERE id = $1`, businessID); err != nil {
+				return err
+			}
+			if changeID, err = submitBusinessChange(tx, businessID, &userID, "create", UpdateBusinessRequest{}); err != nil {
+				return err
+			}
 		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		log.Printf("Failed to update business: %v", err)
+		jsonError(w, "failed to update business", http.StatusInternalServerError)
+		return
+	}
 
-		query += " WHERE id = $" + strconv.Itoa(argNum)
-		args = append(args, businessID)
+	switch {
+	case resubmit:
+		jsonResponse(w, map[string]string{
+			"message":   "business updated, pending verification",
+			"change_id": changeID,
+		}, http.StatusAccepted)
+	case changeID != "":
+		jsonResponse(w, map[string]string{
+			"message":   "business updated; name, category and location changes are pending review",
+			"change_id": changeID,
+		}, http.StatusAccepted)
+	default:
+		jsonResponse(w, map[string]string{"message": "business updated"}, http.StatusOK)
+	}
+}
 
-		_, err = db.Exec(query, args...)
-		if err != nil {
-			log.Printf("Failed to update business: %v", err)
-			jsonError(w, "failed to update business", http.StatusInternalServerError)
-			return
-		}
+// locateUpdate returns the service region of the new location in req, or
+// nil if req doesn't move the business
+func locateUpdate(ctx context.Context, db *sql.DB, req UpdateBusinessRequest) (*regions.Region, error) {
+	if req.Lat == nil || req.Lng == nil {
+		return nil, nil
+	}
+	return regions.Locate(ctx, db, *req.Lat, *req.Lng)
+}
 
-		jsonResponse(w, map[string]string{"message": "business updated"}, http.StatusOK)
+// businessUpdateQuery builds the UPDATE for the fields set in req. region
+// is the region of the new location, from locateUpdate. Optional fields set
+// to "" are cleared to NULL, as if they had never been filled in.
+func businessUpdateQuery(businessID string, req UpdateBusinessRequest, region *regions.Region) (string, []interface{}) {
+	query := "UPDATE businesses SET updated_at = NOW()"
+	args := []interface{}{}
+	argNum := 1
+
+	if req.Name != nil {
+		query += ", name = $" + strconv.Itoa(argNum)
+		args = append(args, *req.Name)
+		argNum++
+	}
+	if req.NameAm != nil {
+		query += ", name_am = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.NameAm)
+		argNum++
+	}
+	if req.Description != nil {
+		query += ", description = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.Description)
+		argNum++
+	}
+	if req.DescriptionAm != nil {
+		query += ", description_am = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.DescriptionAm)
+		argNum++
+	}
+	if req.CategoryID != nil {
+		query += ", category_id = $" + strconv.Itoa(argNum)
+		args = append(args, *req.CategoryID)
+		argNum++
 	}
+	if req.Phone != nil {
+		query += ", phone = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.Phone)
+		argNum++
+	}
+	if req.Email != nil {
+		query += ", email = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.Email)
+		argNum++
+	}
+	if req.Website != nil {
+		query += ", website = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.Website)
+		argNum++
+	}
+	if req.Lat != nil && req.Lng != nil && region != nil {
+		query += ", geom = ST_SetSRID(ST_MakePoint($" + strconv.Itoa(argNum) + ", $" + strconv.Itoa(argNum+1) + "), 4326)"
+		query += ", city = $" + strconv.Itoa(argNum+2)
+		args = append(args, *req.Lng, *req.Lat, region.Name)
+		argNum += 3
+	}
+	if req.Address != nil {
+		query += ", address = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.Address)
+		argNum++
+	}
+	if req.AddressAm != nil {
+		query += ", address_am = NULLIF($" + strconv.Itoa(argNum) + ", '')"
+		args = append(args, *req.AddressAm)
+		argNum++
+	}
+
+	query += " WHERE id = $" + strconv.Itoa(argNum)
+	args = append(args, businessID)
+	return query, args
 }
 
 // GetBusiness returns a single business by ID
@@ -297,6 +449,8 @@ func GetBusiness(db *sql.DB) http.HandlerFunc {
 		var biz BusinessResponseFull
 		var ownerID, nameAm, description, descriptionAm, categoryID, phone, email, website, address, addressAm sql.NullString
 		var createdAt time.Time
+		var nextChange sql.NullTime
+		var mergedInto sql.NullString
 
 		err := db.QueryRow(`
 			SELECT 
@@ -304,7 +458,8 @@ func GetBusiness(db *sql.DB) http.HandlerFunc {
 				b.category_id, b.phone, b.email, b.website,
 				ST_Y(b.geom) as lat, ST_X(b.geom) as lng,
 				b.address, b.address_am, b.city, b.status,
-				b.avg_rating, b.review_count, b.view_count, b.created_at
+				b.avg_rating, b.review_count, b.view_count, b.created_at, b.merged_into,
+				`+openStatusColumns("b.id")+`
 			FROM businesses b
 			WHERE b.id = $1
 		`, businessID).Scan(
@@ -312,7 +467,8 @@ func GetBusiness(db *sql.DB) http.HandlerFunc {
 			&categoryID, &phone, &email, &website,
 			&biz.Lat, &biz.Lng,
 			&address, &addressAm, &biz.City, &biz.Status,
-			&biz.AvgRating, &biz.ReviewCount, &biz.ViewCount, &createdAt,
+			&biz.AvgRating, &biz.ReviewCount, &biz.ViewCount, &createdAt, &mergedInto,
+			&biz.IsOpenNow, &nextChange,
 		)
 
 		if err == sql.ErrNoRows {
@@ -325,6 +481,25 @@ func GetBusiness(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// A merged duplicate redirects to the business it was merged into
+		if mergedInto.Valid {
+			w.Header().Set("Location", strings.Replace(r.URL.Path, businessID, mergedInto.String, 1))
+			jsonResponse(w, map[string]string{
+				"message":     "business was merged into another",
+				"merged_into": mergedInto.String,
+			}, http.StatusMovedPermanently)
+			return
+		}
+
+		// Businesses waiting for an admin, or rejected by one, are only
+		// shown to their owner
+		if biz.Status == "pending" || biz.Status == "rejected" {
+			if (!ownerID.Valid || ownerID.String != userID) && !isAdmin(db, userID) {
+				jsonError(w, "business not found", http.StatusNotFound)
+				return
+			}
+		}
+
 		// Set nullable fields
 		if ownerID.Valid {
 			biz.OwnerID = &ownerID.String
@@ -354,6 +529,7 @@ func GetBusiness(db *sql.DB) http.HandlerFunc {
 			biz.AddressAm = &addressAm.String
 		}
 		biz.CreatedAt = createdAt.Format(time.RFC3339)
+		biz.NextChangeAt = formatNextChange(nextChange)
 
 		// Get category
 		if categoryID.Valid {
@@ -373,50 +549,32 @@ func GetBusiness(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		// Get hours
-		rows, err := db.Query(`
-			SELECT day_of_week, open_time::text, close_time::text, is_closed
-			FROM business_hours WHERE business_id = $1 ORDER BY day_of_week
-		`, businessID)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var h BusinessHourResp
-				var openTime, closeTime sql.NullString
-				rows.Scan(&h.DayOfWeek, &openTime, &closeTime, &h.IsClosed)
-				if openTime.Valid {
-					h.OpenTime = &openTime.String
-				}
-				if closeTime.Valid {
-					h.CloseTime = &closeTime.String
-				}
-				biz.Hours = append(biz.Hours, h)
-			}
+		// Get weekly and special hours
+		if biz.Hours, err = loadBusinessHours(db, businessID); err != nil {
+			log.Printf("Failed to get business hours: %v", err)
+		}
+		if biz.SpecialHours, err = loadSpecialHours(db, businessID); err != nil {
+			log.Printf("Failed to get special hours: %v", err)
 		}
 
 		// Get media
-		rows, err = db.Query(`
-			SELECT id, media_type, url, thumbnail_url, caption
-			FROM business_media WHERE business_id = $1 ORDER BY sort_order
-		`, businessID)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var m MediaResp
-				var thumbURL, caption sql.NullString
-				rows.Scan(&m.ID, &m.MediaType, &m.URL, &thumbURL, &caption)
-				if thumbURL.Valid {
-					m.ThumbnailURL = &thumbURL.String
-				}
-				if caption.Valid {
-					m.Caption = &caption.String
-				}
-				biz.Media = append(biz.Media, m)
-			}
+		if biz.Media, err = loadBusinessMedia(db, businessID); err != nil {
+			log.Printf("Failed to get business media: %v", err)
+		}
+
+		// Get latest reviews
+		biz.Reviews, err = loadReviews(db, businessID, userID, "newest", businessReviewPreview, 0)
+		if err != nil {
+			log.Printf("Failed to get business reviews: %v", err)
+			biz.Reviews = []ReviewResp{}
 		}
 
-		// Check if saved by user
+		// Get the user's own review and check if saved
 		if userID != "" {
+			if biz.MyReview, err = loadUserReview(db, businessID, userID); err != nil {
+				log.Printf("Failed to get user review: %v", err)
+			}
+
 			var exists bool
 			db.QueryRow(`
 				SELECT EXISTS(SELECT 1 FROM user_saved_businesses WHERE user_id = $1 AND business_id = $2)
@@ -437,7 +595,6 @@ func GetNearbyBusinesses(db *sql.DB) http.HandlerFunc {
 		latStr := r.URL.Query().Get("lat")
 		lngStr := r.URL.Query().Get("lng")
 		radiusStr := r.URL.Query().Get("radius")
-		category := r.URL.Query().Get("category")
 		limitStr := r.URL.Query().Get("limit")
 
 		if latStr == "" || lngStr == "" {
@@ -473,32 +630,37 @@ func GetNearbyBusinesses(db *sql.DB) http.HandlerFunc {
 			limit = 100
 		}
 
+		filters, err := parseBusinessFilters(r)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var args sqlArgs
+		point := fmt.Sprintf("ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography", args.add(lng), args.add(lat))
+		where := []string{
+			"b.status = 'verified'",
+			fmt.Sprintf("ST_DWithin(b.geom::geography, %s, %s)", point, args.add(radius)),
+		}
+		where = append(where, filters.clauses(&args)...)
+		whereSQL := strings.Join(where, " AND ")
+		facetArgs := append([]interface{}{}, args...)
+
 		query := `
 			SELECT 
 				b.id, b.name, b.name_am, b.category_id,
 				ST_Y(b.geom) as lat, ST_X(b.geom) as lng,
 				b.address, b.city, b.status,
 				b.avg_rating, b.review_count,
-				ST_Distance(b.geom::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) as distance,
+				ST_Distance(b.geom::geography, ` + point + `) as distance,
 				c.name as category_name, c.icon as category_icon
 			FROM businesses b
 			LEFT JOIN categories c ON b.category_id = c.id
-			WHERE b.status = 'verified'
-			AND ST_DWithin(b.geom::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3)
-		`
-		args := []interface{}{lng, lat, radius}
-		argNum := 4
-
-		if category != "" {
-			query += " AND b.category_id = $" + strconv.Itoa(argNum)
-			args = append(args, category)
-			argNum++
-		}
+			WHERE ` + whereSQL + `
+			ORDER BY distance LIMIT ` + args.add(limit)
+		query = withOpenStatus(query, "distance")
 
-		query += " ORDER BY distance LIMIT $" + strconv.Itoa(argNum)
-		args = append(args, limit)
-
-		rows, err := db.Query(query, args...)
+		rows, err := db.QueryContext(r.Context(), query, args...)
 		if err != nil {
 			log.Printf("Failed to query nearby businesses: %v", err)
 			jsonError(w, "failed to get businesses", http.StatusInternalServerError)
@@ -512,27 +674,32 @@ func GetNearbyBusinesses(db *sql.DB) http.HandlerFunc {
 			var nameAm, categoryID, address, categoryName, categoryIcon sql.NullString
 			var bizLat, bizLng, avgRating, distance float64
 			var reviewCount int
+			var isOpen bool
+			var nextChange sql.NullTime
 
 			err := rows.Scan(
 				&id, &name, &nameAm, &categoryID,
 				&bizLat, &bizLng, &address, &city, &status,
 				&avgRating, &reviewCount, &distance,
 				&categoryName, &categoryIcon,
+				&isOpen, &nextChange,
 			)
 			if err != nil {
 				continue
 			}
 
 			biz := map[string]interface{}{
-				"id":           id,
-				"name":         name,
-				"lat":          bizLat,
-				"lng":          bizLng,
-				"city":         city,
-				"status":       status,
-				"avg_rating":   avgRating,
-				"review_count": reviewCount,
-				"distance_m":   distance,
+				"id":             id,
+				"name":           name,
+				"lat":            bizLat,
+				"lng":            bizLng,
+				"city":           city,
+				"status":         status,
+				"avg_rating":     avgRating,
+				"review_count":   reviewCount,
+				"distance_m":     distance,
+				"is_open_now":    isOpen,
+				"next_change_at": formatNextChange(nextChange),
 			}
 			if nameAm.Valid {
 				biz["name_am"] = nameAm.String
@@ -555,17 +722,40 @@ func GetNearbyBusinesses(db *sql.DB) http.HandlerFunc {
 			businesses = []map[string]interface{}{}
 		}
 
+		facets, err := queryBusinessFacets(r.Context(), db, whereSQL, facetArgs)
+		if err != nil {
+			log.Printf("Failed to count nearby facets: %v", err)
+		}
+
 		jsonResponse(w, map[string]interface{}{
 			"businesses": businesses,
 			"count":      len(businesses),
+			"facets":     facets,
 		}, http.StatusOK)
 	}
 }
 
-// SearchBusinesses searches businesses by name/description (Hybrid: Local + Nominatim)
+// searchRegionClause restricts a search to the region with slug, else to
+// the region with id locatedID, else to any active region. Businesses
+// outside every region polygon have no region_id and aren't searched; they
+// are picked up once UpsertRegion grows a region to cover them.
+func searchRegionClause(args *sqlArgs, slug, locatedID string) string {
+	switch {
+	case slug != "":
+		return "b.region_id = (SELECT id FROM regions WHERE slug = " + args.add(slug) + ")"
+	case locatedID != "":
+		return "b.region_id = " + args.add(locatedID)
+	default:
+		return "b.region_id IN (SELECT id FROM regions WHERE is_active)"
+	}
+}
+
+// SearchBusinesses searches businesses by name and ranks them by a weighted
+// relevance score (trigram similarity, token coverage, category match,
+// distance decay, rating and popularity). Pass debug=1 to see the breakdown.
 func SearchBusinesses(db *sql.DB, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query().Get("q")
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
 		if q == "" {
 			jsonError(w, "search query required", http.StatusBadRequest)
 			return
@@ -576,9 +766,10 @@ func SearchBusinesses(db *sql.DB, cfg *config.Config) http.HandlerFunc {
 		if limitStr != "" {
 			limit, _ = strconv.Atoi(limitStr)
 		}
-		if limit > 100 {
-			limit = 100
+		if limit <= 0 || limit > 100 {
+			limit = 20
 		}
+		debug := r.URL.Query().Get("debug") == "1" || r.URL.Query().Get("debug") == "true"
 
 		// Log search activity (if user is logged in)
 		userID := getUserIDFromContext(r)
@@ -586,74 +777,126 @@ func SearchBusinesses(db *sql.DB, cfg *config.Config) http.HandlerFunc {
 			LogActivity(db, userID, "search", map[string]string{"query": q}, r.RemoteAddr)
 		}
 
-		// Smart Search: Token-based matching with OR logic
-		// Split query into words to allow flexible matching
-		terms := strings.Fields(q)
-		if len(terms) == 0 {
-			jsonResponse(w, map[string]interface{}{"businesses": []map[string]interface{}{}}, http.StatusOK)
+		// Tokens are matched against search_key (folded, script-independent);
+		// raw lowercase tokens are matched against category names
+		var tokens, rawTokens []string
+		for _, term := range strings.Fields(q) {
+			if t := search.Normalize(term); t != "" {
+				tokens = append(tokens, t)
+				rawTokens = append(rawTokens, strings.ToLower(term))
+			}
+		}
+		if len(tokens) == 0 {
+			jsonResponse(w, map[string]interface{}{"businesses": []map[string]interface{}{}, "count": 0}, http.StatusOK)
 			return
 		}
 
-		var whereClauses []string
-		var args []interface{}
-
-		// Base condition
-		whereClauses = append(whereClauses, "b.status = 'verified'")
-
-		// 1. Restrict to Addis Ababa (Approximate Bounding Box)
-		// Lat: 8.80 to 9.10, Lng: 38.60 to 38.95
-		whereClauses = append(whereClauses, "ST_Y(b.geom) BETWEEN 8.80 AND 9.10 AND ST_X(b.geom) BETWEEN 38.60 AND 38.95")
-
-		// Build OR condition for all terms (any term can match)
-		// This allows "african uni" to match "African Union"
-		var termClauses []string
-		for i, term := range terms {
-			placeholder := fmt.Sprintf("$%d", i+1)
-			// Use ILIKE with % on both sides for partial matching
-			termClause := fmt.Sprintf("(b.name ILIKE '%%' || %s || '%%')", placeholder)
-			termClauses = append(termClauses, termClause)
-			args = append(args, term)
+		filters, err := parseBusinessFilters(r)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		// Join all term clauses with OR
-		if len(termClauses) > 0 {
-			whereClauses = append(whereClauses, "("+strings.Join(termClauses, " OR ")+")")
+		// Text matching: any token, the whole query fuzzily, or the category
+		var args sqlArgs
+		pQuery := args.add(q)
+		pFolded := args.add(search.Normalize(q))
+		pTokens := args.add(pq.Array(tokens))
+		pRawTokens := args.add(pq.Array(rawTokens))
+		// Ge'ez spelling catches fresh renames whose search_key isn't synced yet
+		pGeez := args.add(translit.ToGeez(q))
+
+		where := []string{
+			"b.status = 'verified'",
+			fmt.Sprintf(`(
+				b.name %% %[1]s
+				OR b.name_am %% %[1]s
+				OR b.search_key %% %[2]s
+				OR b.name_am ILIKE '%%' || %[5]s || '%%'
+				OR EXISTS (SELECT 1 FROM unnest(%[3]s::text[]) t WHERE b.search_key LIKE '%%' || t || '%%')
+				OR lower(c.name) = ANY(%[4]s::text[])
+			)`, pQuery, pFolded, pTokens, pRawTokens, pGeez),
+		}
+
+		// Get user location for the distance component and radius filter
+		userLat, _ := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+		userLng, _ := strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+		hasLocation := userLat != 0 && userLng != 0
+
+		// Restrict to a region: explicit ?region=slug, else the region the
+		// user is in, else any active region
+		slug, locatedID := r.URL.Query().Get("region"), ""
+		if slug == "" && hasLocation {
+			if region, err := regions.Locate(r.Context(), db, userLat, userLng); err == nil {
+				locatedID = region.ID
+			}
 		}
+		where = append(where, searchRegionClause(&args, slug, locatedID))
 
-		// Add limit as the last argument
-		args = append(args, limit)
-		limitPlaceholder := fmt.Sprintf("$%d", len(args))
+		if radius, _ := strconv.ParseFloat(r.URL.Query().Get("radius"), 64); radius > 0 && hasLocation {
+			where = append(where, fmt.Sprintf(
+				"ST_DWithin(b.geom::geography, ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography, %s)",
+				args.add(userLng), args.add(userLat), args.add(radius)))
+		}
 
-		// Get user location for proximity sorting
-		latStr := r.URL.Query().Get("lat")
-		lngStr := r.URL.Query().Get("lng")
-		userLat, _ := strconv.ParseFloat(latStr, 64)
-		userLng, _ := strconv.ParseFloat(lngStr, 64)
+		where = append(where, filters.clauses(&args)...)
+		whereSQL := strings.Join(where, " AND ")
+		facetArgs := append([]interface{}{}, args...)
 
-		// If user location is provided, sort by distance; otherwise sort by rating
-		var orderBy string
-		if userLat != 0 && userLng != 0 {
-			orderBy = fmt.Sprintf("ST_Distance(b.geom, ST_SetSRID(ST_MakePoint(%f, %f), 4326)) ASC", userLng, userLat)
-		} else {
-			orderBy = "b.avg_rating DESC"
+		distanceExpr := "NULL::float8"
+		if hasLocation {
+			distanceExpr = fmt.Sprintf(
+				"ST_Distance(b.geom::geography, ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography)",
+				args.add(userLng), args.add(userLat))
 		}
 
+		weights := cfg.SearchWeights
 		query := fmt.Sprintf(`
-			SELECT 
-				b.id, b.name, 
-				ST_Y(b.geom) as lat, ST_X(b.geom) as lng, b.address, b.city, b.status,
-				COALESCE(b.avg_rating, 0), COALESCE(b.review_count, 0),
-				c.name as category_name, c.icon as category_icon,
-				COALESCE(b.source, 'local') as source
-			FROM businesses b
-			LEFT JOIN categories c ON b.category_id = c.id
-			WHERE %s
-			ORDER BY %s
+			WITH candidates AS (
+				SELECT
+					b.id, b.name, b.name_am,
+					ST_Y(b.geom) AS lat, ST_X(b.geom) AS lng, b.address, b.city, b.status,
+					COALESCE(b.avg_rating, 0) AS avg_rating, COALESCE(b.review_count, 0) AS review_count,
+					c.name AS category_name, c.icon AS category_icon,
+					COALESCE(b.source, 'local') AS source,
+					%[1]s AS distance,
+					GREATEST(
+						similarity(b.name, %[3]s),
+						similarity(COALESCE(b.name_am, ''), %[3]s),
+						similarity(COALESCE(b.search_key, ''), %[4]s),
+						word_similarity(%[4]s, COALESCE(b.search_key, ''))
+					) AS s_similarity,
+					(SELECT COUNT(*) FROM unnest(%[5]s::text[]) t
+						WHERE b.search_key LIKE '%%' || t || '%%')::float8 / %[7]s AS s_coverage,
+					CASE WHEN c.name IS NOT NULL AND EXISTS (
+						SELECT 1 FROM unnest(%[6]s::text[]) t
+						WHERE lower(c.name) LIKE t || '%%' OR similarity(lower(c.name), t) > 0.5
+					) THEN 1.0 ELSE 0.0 END AS s_category,
+					LEAST(COALESCE(b.avg_rating, 0) / 5.0, 1) * (1 - exp(-LEAST(COALESCE(b.review_count, 0) / 5.0, 50))) AS s_rating,
+					LEAST(ln(1 + COALESCE(b.view_count, 0)) / 10.0, 1) AS s_popularity
+				FROM businesses b
+				LEFT JOIN categories c ON b.category_id = c.id
+				WHERE %[2]s
+			)
+			SELECT *,
+				COALESCE(exp(-LEAST(distance * ln(2) / NULLIF(%[8]s::float8, 0), 50)), 0) AS s_distance
+			FROM candidates
+		`, distanceExpr, whereSQL, pQuery, pFolded, pTokens, pRawTokens,
+			args.add(float64(len(tokens))), args.add(weights.DistanceHalfLife))
+
+		query = fmt.Sprintf(`
+			SELECT *,
+				%s * s_similarity + %s * s_coverage + %s * s_category +
+				%s * s_distance + %s * s_rating + %s * s_popularity AS score
+			FROM (%s) scored
+			ORDER BY score DESC, avg_rating DESC
 			LIMIT %s
-		`, strings.Join(whereClauses, " AND "), orderBy, limitPlaceholder)
+		`, args.add(weights.Similarity), args.add(weights.Coverage), args.add(weights.Category),
+			args.add(weights.Distance), args.add(weights.Rating), args.add(weights.Popularity),
+			query, args.add(limit))
+		query = withOpenStatus(query, "score DESC, avg_rating DESC")
 
 		rows, err := db.QueryContext(r.Context(), query, args...)
-
 		if err != nil {
 			log.Printf("Failed to search businesses: %v", err)
 			jsonError(w, "search failed", http.StatusInternalServerError)
@@ -664,41 +907,66 @@ func SearchBusinesses(db *sql.DB, cfg *config.Config) http.HandlerFunc {
 		var businesses []map[string]interface{}
 		for rows.Next() {
 			var id, name, city, status, source string
-			var address, categoryName, categoryIcon sql.NullString
+			var nameAm, address, categoryName, categoryIcon sql.NullString
 			var lat, lng, avgRating float64
 			var reviewCount int
+			var distance sql.NullFloat64
+			var sSimilarity, sCoverage, sCategory, sRating, sPopularity, sDistance, score float64
+			var isOpen bool
+			var nextChange sql.NullTime
 
 			err := rows.Scan(
-				&id, &name,
+				&id, &name, &nameAm,
 				&lat, &lng, &address, &city, &status,
 				&avgRating, &reviewCount,
 				&categoryName, &categoryIcon,
-				&source,
+				&source, &distance,
+				&sSimilarity, &sCoverage, &sCategory, &sRating, &sPopularity, &sDistance,
+				&score, &isOpen, &nextChange,
 			)
 			if err != nil {
+				log.Printf("Error scanning search result: %v", err)
 				continue
 			}
 
 			biz := map[string]interface{}{
-				"id":           id,
-				"name":         name,
-				"lat":          lat,
-				"lng":          lng,
-				"city":         city,
-				"avg_rating":   avgRating,
-				"review_count": reviewCount,
-				"source":       source,
-			}
-			// Removed nameAm usage
+				"id":             id,
+				"name":           name,
+				"lat":            lat,
+				"lng":            lng,
+				"city":           city,
+				"avg_rating":     avgRating,
+				"review_count":   reviewCount,
+				"source":         source,
+				"is_open_now":    isOpen,
+				"next_change_at": formatNextChange(nextChange),
+			}
+			if nameAm.Valid {
+				biz["name_am"] = nameAm.String
+			}
 			if address.Valid {
 				biz["address"] = address.String
 			}
+			if distance.Valid {
+				biz["distance_m"] = distance.Float64
+			}
 			if categoryName.Valid {
 				biz["category"] = map[string]interface{}{
 					"name": categoryName.String,
 					"icon": categoryIcon.String,
 				}
 			}
+			if debug {
+				biz["score"] = score
+				biz["score_breakdown"] = map[string]float64{
+					"similarity": sSimilarity,
+					"coverage":   sCoverage,
+					"category":   sCategory,
+					"distance":   sDistance,
+					"rating":     sRating,
+					"popularity": sPopularity,
+				}
+			}
 
 			businesses = append(businesses, biz)
 		}
@@ -707,12 +975,20 @@ func SearchBusinesses(db *sql.DB, cfg *config.Config) http.HandlerFunc {
 			businesses = []map[string]interface{}{}
 		}
 
-		// Nominatim fallback removed (data migrated to local DB)
+		facets, err := queryBusinessFacets(r.Context(), db, whereSQL, facetArgs)
+		if err != nil {
+			log.Printf("Failed to count search facets: %v", err)
+		}
 
-		jsonResponse(w, map[string]interface{}{
+		resp := map[string]interface{}{
 			"businesses": businesses,
 			"count":      len(businesses),
-		}, http.StatusOK)
+			"facets":     facets,
+		}
+		if debug {
+			resp["weights"] = weights
+		}
+		jsonResponse(w, resp, http.StatusOK)
 	}
 }
 
@@ -840,7 +1116,8 @@ func GetSavedBusinesses(db *sql.DB) http.HandlerFunc {
 				b.id, b.name, b.name_am,
 				ST_Y(b.geom) as lat, ST_X(b.geom) as lng,
 				b.address, b.city, b.avg_rating, b.review_count,
-				c.name as category_name, c.icon as category_icon
+				c.name as category_name, c.icon as category_icon,
+				`+openStatusColumns("b.id")+`
 			FROM user_saved_businesses usb
 			JOIN businesses b ON usb.business_id = b.id
 			LEFT JOIN categories c ON b.category_id = c.id
@@ -861,25 +1138,30 @@ func GetSavedBusinesses(db *sql.DB) http.HandlerFunc {
 			var nameAm, address, categoryName, categoryIcon sql.NullString
 			var lat, lng, avgRating float64
 			var reviewCount int
+			var isOpen bool
+			var nextChange sql.NullTime
 
 			err := rows.Scan(
 				&id, &name, &nameAm,
 				&lat, &lng, &address, &city,
 				&avgRating, &reviewCount,
 				&categoryName, &categoryIcon,
+				&isOpen, &nextChange,
 			)
 			if err != nil {
 				continue
 			}
 
 			biz := map[string]interface{}{
-				"id":           id,
-				"name":         name,
-				"lat":          lat,
-				"lng":          lng,
-				"city":         city,
-				"avg_rating":   avgRating,
-				"review_count": reviewCount,
+				"id":             id,
+				"name":           name,
+				"lat":            lat,
+				"lng":            lng,
+				"city":           city,
+				"avg_rating":     avgRating,
+				"review_count":   reviewCount,
+				"is_open_now":    isOpen,
+				"next_change_at": formatNextChange(nextChange),
 			}
 			if nameAm.Valid {
 				biz["name_am"] = nameAm.String
@@ -905,7 +1187,9 @@ func GetSavedBusinesses(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// VerifyBusiness marks a business as verified (admin only)
+// VerifyBusiness lists a business (admin only). It approves the business's
+// pending create change set, opening one first for businesses that have
+// none, such as ones rejected earlier.
 func VerifyBusiness(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := getUserIDFromContext(r)
@@ -913,11 +1197,7 @@ func VerifyBusiness(db *sql.DB) http.HandlerFunc {
 			jsonError(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-
-		// Check if admin
-		var role string
-		db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
-		if role != "admin" {
+		if !isAdmin(db, userID) {
 			jsonError(w, "forbidden", http.StatusForbidden)
 			return
 		}
@@ -928,18 +1208,49 @@ func VerifyBusiness(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err := db.Exec(`
-			UPDATE businesses 
-			SET status = 'verified', verified_at = NOW(), verified_by = $1
-			WHERE id = $2
-		`, userID, businessID)
+		var status string
+		var ownerID sql.NullString
+		err := db.QueryRow(`SELECT status, owner_id FROM businesses WHERE id = $1`, businessID).Scan(&status, &ownerID)
+		if err == sql.ErrNoRows {
+			jsonError(w, "business not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get business: %v", err)
+			jsonError(w, "failed to verify business", http.StatusInternalServerError)
+			return
+		}
+		if status != "pending" && status != "rejected" {
+			jsonErrorf(w, "business is %s", http.StatusConflict, status)
+			return
+		}
 
+		var changeID string
+		err = db.QueryRow(`
+			SELECT id FROM business_changes WHERE business_id = $1 AND kind = 'create' AND status = 'pending'
+		`, businessID).Scan(&changeID)
+		if err == sql.ErrNoRows {
+			err = func() error {
+				tx, err := db.Begin()
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+				if changeID, err = submitBusinessChange(tx, businessID, nullStringPtr(ownerID), "create", UpdateBusinessRequest{}); err != nil {
+					return err
+				}
+				return tx.Commit()
+			}()
+		}
 		if err != nil {
 			log.Printf("Failed to verify business: %v", err)
 			jsonError(w, "failed to verify business", http.StatusInternalServerError)
 			return
 		}
 
-		jsonResponse(w, map[string]string{"message": "business verified"}, http.StatusOK)
+		if !approveBusinessChange(w, r, db, changeID) {
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "business verified", "change_id": changeID}, http.StatusOK)
 	}
 }
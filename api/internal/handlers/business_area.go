@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"maps/api/internal/middleware"
+)
+
+const (
+	// clusterMaxZoom is the highest zoom at which results are clustered
+	clusterMaxZoom = 15
+	// clusterMinCount is the result size below which we skip clustering
+	clusterMinCount = 150
+	// areaMaxBusinesses caps individual results for a single viewport
+	areaMaxBusinesses = 500
+	// clusterCellPixels is the approximate on-screen size of a grid cell
+	clusterCellPixels = 64
+)
+
+// PolygonQueryRequest is the request body for polygon business queries
+type PolygonQueryRequest struct {
+	Polygon json.RawMessage `json:"polygon"` // GeoJSON Polygon or MultiPolygon
+	Zoom    *int            `json:"zoom,omitempty"`
+}
+
+// BusinessCluster is an aggregate of businesses within one grid cell
+type BusinessCluster struct {
+	Lat        float64    `json:"lat"`
+	Lng        float64    `json:"lng"`
+	Count      int        `json:"count"`
+	BBox       [4]float64 `json:"bbox"` // minLng, minLat, maxLng, maxLat
+	AvgRating  float64    `json:"avg_rating"`
+	TopID      string     `json:"top_business_id"`
+	TopName    string     `json:"top_business_name"`
+	CategoryID *string    `json:"category_id,omitempty"` // dominant category
+}
+
+// GetBusinessesInBBox returns businesses inside a bounding box, clustered
+// on a zoom-dependent grid when the viewport is zoomed out and crowded
+func GetBusinessesInBBox(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		minLat, minLng := q.Get("min_lat"), q.Get("min_lng")
+		maxLat, maxLng := q.Get("max_lat"), q.Get("max_lng")
+
+		if err := middleware.ValidateBoundingBox(minLat, minLng, maxLat, maxLng); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		zoom, err := parseZoom(q.Get("zoom"))
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var args sqlArgs
+		area := fmt.Sprintf("b.geom && ST_MakeEnvelope(%s, %s, %s, %s, 4326)",
+			args.add(minLng), args.add(minLat), args.add(maxLng), args.add(maxLat))
+
+		queryBusinessesInArea(w, r, db, area, args, zoom)
+	}
+}
+
+// GetBusinessesInPolygon returns businesses inside a GeoJSON polygon with
+// the same clustering rules as the bounding-box query
+func GetBusinessesInPolygon(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PolygonQueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Polygon) == 0 {
+			jsonError(w, "polygon is required", http.StatusBadRequest)
+			return
+		}
+
+		// Validate the polygon's extent with the same rules as a bbox
+		var bbox [4]float64
+		err := db.QueryRowContext(r.Context(), `
+			SELECT ST_YMin(g), ST_XMin(g), ST_YMax(g), ST_XMax(g)
+			FROM (SELECT ST_GeomFromGeoJSON($1) AS g) p
+			WHERE GeometryType(g) IN ('POLYGON', 'MULTIPOLYGON') AND ST_IsValid(g)
+		`, string(req.Polygon)).Scan(&bbox[0], &bbox[1], &bbox[2], &bbox[3])
+		if err != nil {
+			jsonError(w, "polygon must be a valid GeoJSON Polygon or MultiPolygon", http.StatusBadRequest)
+			return
+		}
+		if err := middleware.ValidateBoundingBox(
+			formatCoord(bbox[0]), formatCoord(bbox[1]), formatCoord(bbox[2]), formatCoord(bbox[3]),
+		); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		zoom := clusterMaxZoom + 1
+		if req.Zoom != nil {
+			zoom = *req.Zoom
+		}
+		if zoom < 0 || zoom > 22 {
+			jsonError(w, "invalid zoom level", http.StatusBadRequest)
+			return
+		}
+
+		var args sqlArgs
+		area := fmt.Sprintf("ST_Intersects(b.geom, ST_SetSRID(ST_GeomFromGeoJSON(%s), 4326))", args.add(string(req.Polygon)))
+
+		queryBusinessesInArea(w, r, db, area, args, zoom)
+	}
+}
+
+// queryBusinessesInArea answers an area query with clusters or individual
+// businesses. area is a condition on businesses b; the facet filters from
+// the query string are applied on top.
+func queryBusinessesInArea(w http.ResponseWriter, r *http.Request, db *sql.DB, area string, args sqlArgs, zoom int) {
+	filters, err := parseBusinessFilters(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	where := append([]string{"b.status = 'verified'", area}, filters.clauses(&args)...)
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	err = db.QueryRowContext(r.Context(), `
+		SELECT COUNT(*) FROM businesses b
+		LEFT JOIN categories c ON b.category_id = c.id
+		WHERE `+whereSQL, args...).Scan(&total)
+	if err != nil {
+		log.Printf("Failed to count businesses in area: %v", err)
+		jsonError(w, "failed to get businesses", http.StatusInternalServerError)
+		return
+	}
+
+	if zoom <= clusterMaxZoom && total > clusterMinCount {
+		clusters, err := queryClusters(r, db, whereSQL, args, zoom)
+		if err != nil {
+			log.Printf("Failed to cluster businesses: %v", err)
+			jsonError(w, "failed to get businesses", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, map[string]interface{}{
+			"mode":     "clusters",
+			"zoom":     zoom,
+			"total":    total,
+			"clusters": clusters,
+			"count":    len(clusters),
+		}, http.StatusOK)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), withOpenStatus(`
+		SELECT
+			b.id, b.name, b.name_am, b.category_id,
+			ST_Y(b.geom) as lat, ST_X(b.geom) as lng,
+			b.address, b.city, b.status,
+			b.avg_rating, b.review_count,
+			c.name as category_name, c.icon as category_icon
+		FROM businesses b
+		LEFT JOIN categories c ON b.category_id = c.id
+		WHERE `+whereSQL+`
+		ORDER BY b.avg_rating DESC, b.review_count DESC, b.view_count DESC
+		LIMIT `+args.add(areaMaxBusinesses), "avg_rating DESC, review_count DESC"), args...)
+	if err != nil {
+		log.Printf("Failed to query businesses in area: %v", err)
+		jsonError(w, "failed to get businesses", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var businesses []map[string]interface{}
+	for rows.Next() {
+		var id, name, city, status string
+		var nameAm, categoryID, address, categoryName, categoryIcon sql.NullString
+		var lat, lng, avgRating float64
+		var reviewCount int
+		var isOpen bool
+		var nextChange sql.NullTime
+
+		err := rows.Scan(
+			&id, &name, &nameAm, &categoryID,
+			&lat, &lng, &address, &city, &status,
+			&avgRating, &reviewCount,
+			&categoryName, &categoryIcon,
+			&isOpen, &nextChange,
+		)
+		if err != nil {
+			continue
+		}
+
+		biz := map[string]interface{}{
+			"id":             id,
+			"name":           name,
+			"lat":            lat,
+			"lng":            lng,
+			"city":           city,
+			"status":         status,
+			"avg_rating":     avgRating,
+			"review_count":   reviewCount,
+			"is_open_now":    isOpen,
+			"next_change_at": formatNextChange(nextChange),
+		}
+		if nameAm.Valid {
+			biz["name_am"] = nameAm.String
+		}
+		if address.Valid {
+			biz["address"] = address.String
+		}
+		if categoryName.Valid {
+			biz["category"] = map[string]interface{}{
+				"id":   categoryID.String,
+				"name": categoryName.String,
+				"icon": categoryIcon.String,
+			}
+		}
+
+		businesses = append(businesses, biz)
+	}
+
+	if businesses == nil {
+		businesses = []map[string]interface{}{}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"mode":       "businesses",
+		"zoom":       zoom,
+		"total":      total,
+		"truncated":  total > len(businesses),
+		"businesses": businesses,
+		"count":      len(businesses),
+	}, http.StatusOK)
+}
+
+// queryClusters groups matching businesses on a grid whose cell size is
+// about clusterCellPixels screen pixels at the given zoom
+func queryClusters(r *http.Request, db *sql.DB, whereSQL string, args sqlArgs, zoom int) ([]BusinessCluster, error) {
+	cell := clusterCellDegrees(zoom)
+
+	rows, err := db.QueryContext(r.Context(), `
+		WITH cells AS (
+			SELECT
+				ST_SnapToGrid(b.geom, `+args.add(cell)+`) AS cell,
+				b.id, b.name, b.geom, b.category_id,
+				COALESCE(b.avg_rating, 0) AS rating,
+				COALESCE(b.review_count, 0) AS reviews
+			FROM businesses b
+			LEFT JOIN categories c ON b.category_id = c.id
+			WHERE `+whereSQL+`
+		)
+		SELECT
+			ST_Y(ST_Centroid(ST_Collect(geom))), ST_X(ST_Centroid(ST_Collect(geom))),
+			COUNT(*),
+			ST_XMin(ST_Extent(geom)), ST_YMin(ST_Extent(geom)),
+			ST_XMax(ST_Extent(geom)), ST_YMax(ST_Extent(geom)),
+			AVG(rating),
+			(array_agg(id::text ORDER BY rating DESC, reviews DESC))[1],
+			(array_agg(name ORDER BY rating DESC, reviews DESC))[1],
+			mode() WITHIN GROUP (ORDER BY category_id)
+		FROM cells
+		GROUP BY cell
+		ORDER BY COUNT(*) DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clusters := []BusinessCluster{}
+	for rows.Next() {
+		var c BusinessCluster
+		var categoryID sql.NullString
+		err := rows.Scan(&c.Lat, &c.Lng, &c.Count,
+			&c.BBox[0], &c.BBox[1], &c.BBox[2], &c.BBox[3],
+			&c.AvgRating, &c.TopID, &c.TopName, &categoryID)
+		if err != nil {
+			return nil, err
+		}
+		if categoryID.Valid {
+			c.CategoryID = &categoryID.String
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, rows.Err()
+}
+
+// clusterCellDegrees converts the target cell size in pixels to degrees of
+// longitude at the given zoom (256px tiles)
+func clusterCellDegrees(zoom int) float64 {
+	return 360.0 / (256.0 * math.Pow(2, float64(zoom))) * clusterCellPixels
+}
+
+func parseZoom(v string) (int, error) {
+	if v == "" {
+		return clusterMaxZoom + 1, nil
+	}
+	zoom, err := strconv.Atoi(v)
+	if err != nil || zoom < 0 || zoom > 22 {
+		return 0, fmt.Errorf("invalid zoom level")
+	}
+	return zoom, nil
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
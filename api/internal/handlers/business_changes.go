@@ -0,0 +1,542 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"maps/api/internal/regions"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Moderation: new businesses wait for an admin before they are listed, and
+// so do their owners' edits to the name, category and location. Each is a
+// change set in business_changes; further edits before the review are
+// merged into the open one.
+
+var errChangeNotPending = errors.New("change is not pending")
+
+// RejectChangeRequest is the request body for rejecting a change set
+type RejectChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BusinessChangeResp is a change set
+type BusinessChangeResp struct {
+	ID           string          `json:"id"`
+	BusinessID   string          `json:"business_id"`
+	BusinessName string          `json:"business_name"`
+	UserID       *string         `json:"user_id,omitempty"`
+	UserName     *string         `json:"user_name,omitempty"`
+	Kind         string          `json:"kind"`    // create, update
+	Changes      json.RawMessage `json:"changes"` // proposed values of an update
+	Status       string          `json:"status"`
+	ReviewedBy   *string         `json:"reviewed_by,omitempty"`
+	Reason       *string         `json:"reason,omitempty"`
+	ResolvedAt   *string         `json:"resolved_at,omitempty"`
+	CreatedAt    string          `json:"created_at"`
+	UpdatedAt    string          `json:"updated_at"`
+}
+
+// ChangeFieldDiff is a field of a change set, next to the live value
+type ChangeFieldDiff struct {
+	Field    string      `json:"field"`
+	Current  interface{} `json:"current"`
+	Proposed interface{} `json:"proposed"`
+}
+
+const selectBusinessChanges = `
+	SELECT c.id, c.business_id, b.name, c.user_id, u.name, c.kind, c.changes, c.status,
+		c.reviewed_by, c.reason, c.resolved_at, c.created_at, c.updated_at
+	FROM business_changes c
+	JOIN businesses b ON b.id = c.business_id
+	LEFT JOIN users u ON u.id = c.user_id`
+
+func scanBusinessChange(s rowScanner) (*BusinessChangeResp, error) {
+	var c BusinessChangeResp
+	var userID, userName, reviewedBy, reason sql.NullString
+	var changes []byte
+	var resolvedAt sql.NullTime
+	var createdAt, updatedAt time.Time
+	err := s.Scan(&c.ID, &c.BusinessID, &c.BusinessName, &userID, &userName, &c.Kind, &changes, &c.Status,
+		&reviewedBy, &reason, &resolvedAt, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.UserID = nullStringPtr(userID)
+	c.UserName = nullStringPtr(userName)
+	c.Changes = json.RawMessage(changes)
+	c.ReviewedBy = nullStringPtr(reviewedBy)
+	c.Reason = nullStringPtr(reason)
+	if resolvedAt.Valid {
+		t := resolvedAt.Time.Format(time.RFC3339)
+		c.ResolvedAt = &t
+	}
+	c.CreatedAt = createdAt.Format(time.RFC3339)
+	c.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &c, nil
+}
+
+// takeModerated moves the fields that need an admin's approval out of req
+func (req *UpdateBusinessRequest) takeModerated() UpdateBusinessRequest {
+	m := UpdateBusinessRequest{
+		Name:       req.Name,
+		NameAm:     req.NameAm,
+		CategoryID: req.CategoryID,
+		Address:    req.Address,
+		AddressAm:  req.AddressAm,
+	}
+	if req.Lat != nil && req.Lng != nil {
+		m.Lat, m.Lng = req.Lat, req.Lng
+	}
+	req.Name, req.NameAm, req.CategoryID, req.Address, req.AddressAm = nil, nil, nil, nil, nil
+	req.Lat, req.Lng = nil, nil
+	return m
+}
+
+// splitModerated decides how an edit of a business with status applies.
+// Admin edits apply directly. So do an owner's edits of a business that
+// isn't listed yet, which is reviewed as a whole; a rejected one goes back
+// to the queue (resubmit). Otherwise the fields that need approval are
+// moved out of req into moderated.
+func (req *UpdateBusinessRequest) splitModerated(status string, admin bool) (moderated UpdateBusinessRequest, resubmit bool) {
+	if admin {
+		return UpdateBusinessRequest{}, false
+	}
+	switch status {
+	case "pending":
+		return UpdateBusinessRequest{}, false
+	case "rejected":
+		return UpdateBusinessRequest{}, true
+	}
+	return req.takeModerated(), false
+}
+
+func (req UpdateBusinessRequest) isEmpty() bool {
+	return req == UpdateBusinessRequest{}
+}
+
+// submitBusinessChange opens a change set, or merges changes into the open
+// one of the same kind, and returns its id
+func submitBusinessChange(tx *sql.Tx, businessID string, userID *string, kind string, changes UpdateBusinessRequest) (string, error) {
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO business_changes (business_id, user_id, kind, changes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (business_id, kind) WHERE status = 'pending'
+		DO UPDATE SET changes = business_changes.changes || EXCLUDED.changes,
+			user_id = EXCLUDED.user_id, updated_at = NOW()
+		RETURNING id
+	`, businessID, userID, kind, string(changesJSON)).Scan(&id)
+	return id, err
+}
+
+// ListPendingBusinessChanges returns the moderation queue, oldest first
+// (admin only). ?kind=create or ?kind=update narrows it down.
+func ListPendingBusinessChanges(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch kind := r.URL.Query().Get("kind"); kind {
+		case "":
+			listBusinessChanges(w, db, ` WHERE c.status = 'pending' ORDER BY c.created_at LIMIT 100`)
+		case "create", "update":
+			listBusinessChanges(w, db, ` WHERE c.status = 'pending' AND c.kind = $1 ORDER BY c.created_at LIMIT 100`, kind)
+		default:
+			jsonError(w, "kind must be create or update", http.StatusBadRequest)
+		}
+	}
+}
+
+// ListBusinessChanges returns the change sets of a business, newest first,
+// to its owner or an admin
+func ListBusinessChanges(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+		listBusinessChanges(w, db, ` WHERE c.business_id = $1 ORDER BY c.created_at DESC LIMIT 100`, businessID)
+	}
+}
+
+func listBusinessChanges(w http.ResponseWriter, db *sql.DB, where string, args ...interface{}) {
+	rows, err := db.Query(selectBusinessChanges+where, args...)
+	if err != nil {
+		log.Printf("Failed to get business changes: %v", err)
+		jsonError(w, "failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	changes := []BusinessChangeResp{}
+	for rows.Next() {
+		c, err := scanBusinessChange(rows)
+		if err != nil {
+			log.Printf("Error scanning business change: %v", err)
+			continue
+		}
+		changes = append(changes, *c)
+	}
+	jsonResponse(w, map[string]interface{}{
+		"changes": changes,
+		"count":   len(changes),
+	}, http.StatusOK)
+}
+
+// GetBusinessChangeDiff returns a change set with each field it sets next
+// to the business's current value, to its owner or an admin. A create
+// lists every field of the new business.
+func GetBusinessChangeDiff(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		c, err := scanBusinessChange(db.QueryRow(selectBusinessChanges+` WHERE c.id = $1 AND c.business_id = $2`,
+			chi.URLParam(r, "changeId"), businessID))
+		if err == sql.ErrNoRows {
+			jsonError(w, "change not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get business change: %v", err)
+			jsonError(w, "failed to get change", http.StatusInternalServerError)
+			return
+		}
+
+		current, err := loadBusinessFields(db, businessID)
+		if err != nil {
+			log.Printf("Failed to get business: %v", err)
+			jsonError(w, "failed to get change", http.StatusInternalServerError)
+			return
+		}
+		var proposed UpdateBusinessRequest
+		if c.Kind == "create" {
+			proposed, current = current, UpdateBusinessRequest{}
+		} else if err := json.Unmarshal(c.Changes, &proposed); err != nil {
+			log.Printf("Invalid business change %s: %v", c.ID, err)
+			jsonError(w, "failed to get change", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"change": c,
+			"fields": diffBusinessFields(db, current, proposed),
+		}, http.StatusOK)
+	}
+}
+
+// ApproveBusinessChange applies a change set (admin only)
+func ApproveBusinessChange(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changeID, ok := reviewChangeParams(w, r, db)
+		if !ok {
+			return
+		}
+		if !approveBusinessChange(w, r, db, changeID) {
+			return
+		}
+		respondWithBusinessChange(w, db, changeID)
+	}
+}
+
+// RejectBusinessChange rejects a change set with a reason the submitter
+// sees (admin only). A rejected create keeps the business unlisted.
+func RejectBusinessChange(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changeID, ok := reviewChangeParams(w, r, db)
+		if !ok {
+			return
+		}
+
+		var req RejectChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		reason, ok := cleanEvidence(w, &req.Reason)
+		if !ok {
+			return
+		}
+		if reason == nil {
+			jsonError(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+
+		adminID := getUserIDFromContext(r)
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			var businessID, kind string
+			err = tx.QueryRow(`
+				UPDATE business_changes
+				SET status = 'rejected', reviewed_by = $2, reason = $3, resolved_at = NOW(), updated_at = NOW()
+				WHERE id = $1 AND status = 'pending'
+				RETURNING business_id, kind
+			`, changeID, adminID, *reason).Scan(&businessID, &kind)
+			if err == sql.ErrNoRows {
+				return errChangeNotPending
+			}
+			if err != nil {
+				return err
+			}
+			if kind == "create" {
+				if err := tagRevision(tx, adminID, "admin", "rejected change "+changeID); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(`
+					UPDATE businesses SET status = 'rejected' WHERE id = $1 AND status = 'pending'
+				`, businessID); err != nil {
+					return err
+				}
+			}
+			return tx.Commit()
+		}()
+		switch err {
+		case nil:
+		case errChangeNotPending:
+			jsonError(w, "change is not pending", http.StatusConflict)
+			return
+		default:
+			log.Printf("Failed to reject business change: %v", err)
+			jsonError(w, "failed to reject change", http.StatusInternalServerError)
+			return
+		}
+
+		LogActivity(db, adminID, "reject_business_change", map[string]string{"change_id": changeID, "reason": *reason}, r.RemoteAddr)
+		respondWithBusinessChange(w, db, changeID)
+	}
+}
+
+// reviewChangeParams checks that the user is an admin and that the change
+// set belongs to the business in the URL
+func reviewChangeParams(w http.ResponseWriter, r *http.Request, db *sql.DB) (string, bool) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		jsonError(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if !isAdmin(db, userID) {
+		jsonError(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+
+	changeID := chi.URLParam(r, "changeId")
+	var exists bool
+	db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM business_changes WHERE id = $1 AND business_id = $2)
+	`, changeID, chi.URLParam(r, "id")).Scan(&exists)
+	if !exists {
+		jsonError(w, "change not found", http.StatusNotFound)
+		return "", false
+	}
+	return changeID, true
+}
+
+// approveBusinessChange lists the business of a create, or applies the
+// fields of an update. It writes the error response on failure.
+func approveBusinessChange(w http.ResponseWriter, r *http.Request, db *sql.DB, changeID string) bool {
+	adminID := getUserIDFromContext(r)
+	err := func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var businessID, kind string
+		var changesJSON []byte
+		err = tx.QueryRow(`
+			SELECT business_id, kind, changes FROM business_changes WHERE id = $1 AND status = 'pending' FOR UPDATE
+		`, changeID).Scan(&businessID, &kind, &changesJSON)
+		if err == sql.ErrNoRows {
+			return errChangeNotPending
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tagRevision(tx, adminID, "admin", "approved change "+changeID); err != nil {
+			return err
+		}
+		if kind == "create" {
+			if _, err := tx.Exec(`
+				UPDATE businesses SET status = 'verified', verified_at = NOW(), verified_by = $2 WHERE id = $1
+			`, businessID, adminID); err != nil {
+				return err
+			}
+		} else {
+			var changes UpdateBusinessRequest
+			if err := json.Unmarshal(changesJSON, &changes); err != nil {
+				return err
+			}
+			// The regions may have changed since the edit was made
+			region, err := locateUpdate(r.Context(), db, changes)
+			if err != nil {
+				return err
+			}
+			if !changes.isEmpty() {
+				query, args := businessUpdateQuery(businessID, changes, region)
+				if _, err := tx.Exec(query, args...); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE business_changes
+			SET status = 'approved', reviewed_by = $2, resolved_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+		`, changeID, adminID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+
+	switch err {
+	case nil:
+		LogActivity(db, adminID, "approve_business_change", map[string]string{"change_id": changeID}, r.RemoteAddr)
+		return true
+	case errChangeNotPending:
+		jsonError(w, "change is not pending", http.StatusConflict)
+	case regions.ErrOutsideRegions:
+		jsonError(w, "the new location is outside the service regions; reject the change instead", http.StatusConflict)
+	default:
+		log.Printf("Failed to approve business change: %v", err)
+		jsonError(w, "failed to approve change", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// respondWithBusinessChange writes a single change set
+func respondWithBusinessChange(w http.ResponseWriter, db *sql.DB, changeID string) {
+	c, err := scanBusinessChange(db.QueryRow(selectBusinessChanges+` WHERE c.id = $1`, changeID))
+	if err != nil {
+		log.Printf("Failed to get business change: %v", err)
+		jsonError(w, "failed to get change", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, c, http.StatusOK)
+}
+
+// loadBusinessFields returns the editable fields of a business
+func loadBusinessFields(db *sql.DB, businessID string) (UpdateBusinessRequest, error) {
+	var b UpdateBusinessRequest
+	var name string
+	var lat, lng float64
+	var nameAm, description, descriptionAm, categoryID, phone, email, website, address, addressAm sql.NullString
+	err := db.QueryRow(`
+		SELECT name, name_am, description, description_am, category_id, phone, email, website,
+			ST_Y(geom), ST_X(geom), address, address_am
+		FROM businesses WHERE id = $1
+	`, businessID).Scan(&name, &nameAm, &description, &descriptionAm, &categoryID, &phone, &email, &website,
+		&lat, &lng, &address, &addressAm)
+	if err != nil {
+		return b, err
+	}
+	b.Name = &name
+	b.NameAm = nullStringPtr(nameAm)
+	b.Description = nullStringPtr(description)
+	b.DescriptionAm = nullStringPtr(descriptionAm)
+	b.CategoryID = nullStringPtr(categoryID)
+	b.Phone = nullStringPtr(phone)
+	b.Email = nullStringPtr(email)
+	b.Website = nullStringPtr(website)
+	b.Lat, b.Lng = &lat, &lng
+	b.Address = nullStringPtr(address)
+	b.AddressAm = nullStringPtr(addressAm)
+	return b, nil
+}
+
+// diffBusinessFields pairs the fields set in proposed with their current
+// values. Categories are shown with their names.
+func diffBusinessFields(db *sql.DB, current, proposed UpdateBusinessRequest) []ChangeFieldDiff {
+	category := func(id *string) interface{} {
+		if id == nil {
+			return nil
+		}
+		cat := map[string]interface{}{"id": *id}
+		var name string
+		if err := db.QueryRow(`SELECT name FROM categories WHERE id = $1`, *id).Scan(&name); err == nil {
+			cat["name"] = name
+		}
+		return cat
+	}
+	location := func(lat, lng *float64) interface{} {
+		if lat == nil || lng == nil {
+			return nil
+		}
+		return map[string]float64{"lat": *lat, "lng": *lng}
+	}
+
+	diffs := []ChangeFieldDiff{}
+	add := func(field string, current, proposed interface{}) {
+		diffs = append(diffs, ChangeFieldDiff{Field: field, Current: current, Proposed: proposed})
+	}
+	if proposed.Name != nil {
+		add("name", current.Name, proposed.Name)
+	}
+	if proposed.NameAm != nil {
+		add("name_am", current.NameAm, proposed.NameAm)
+	}
+	if proposed.Description != nil {
+		add("description", current.Description, proposed.Description)
+	}
+	if proposed.DescriptionAm != nil {
+		add("description_am", current.DescriptionAm, proposed.DescriptionAm)
+	}
+	if proposed.CategoryID != nil {
+		add("category", category(current.CategoryID), category(proposed.CategoryID))
+	}
+	if proposed.Phone != nil {
+		add("phone", current.Phone, proposed.Phone)
+	}
+	if proposed.Email != nil {
+		add("email", current.Email, proposed.Email)
+	}
+	if proposed.Website != nil {
+		add("website", current.Website, proposed.Website)
+	}
+	if proposed.Lat != nil && proposed.Lng != nil {
+		add("location", location(current.Lat, current.Lng), location(proposed.Lat, proposed.Lng))
+	}
+	if proposed.Address != nil {
+		add("address", current.Address, proposed.Address)
+	}
+	if proposed.AddressAm != nil {
+		add("address_am", current.AddressAm, proposed.AddressAm)
+	}
+	return diffs
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitModerated(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(f float64) *float64 { return &f }
+
+	// edit touches every kind of field: moderated ones (name, category,
+	// address, location) and direct ones (description, contact details)
+	edit := func() UpdateBusinessRequest {
+		return UpdateBusinessRequest{
+			Name:        str("Tomoca Coffee"),
+			NameAm:      str("ቶሞካ ቡና"),
+			Description: str("Roasting since 1953"),
+			CategoryID:  str("cafe"),
+			Phone:       str("+251111111111"),
+			Website:     str("https://tomoca.example"),
+			Lat:         num(9.03),
+			Lng:         num(38.75),
+			Address:     str("Wavel St"),
+			AddressAm:   str("ዋቬል"),
+		}
+	}
+	moderatedPart := UpdateBusinessRequest{
+		Name:       str("Tomoca Coffee"),
+		NameAm:     str("ቶሞካ ቡና"),
+		CategoryID: str("cafe"),
+		Lat:        num(9.03),
+		Lng:        num(38.75),
+		Address:    str("Wavel St"),
+		AddressAm:  str("ዋቬል"),
+	}
+	directPart := UpdateBusinessRequest{
+		Description: str("Roasting since 1953"),
+		Phone:       str("+251111111111"),
+		Website:     str("https://tomoca.example"),
+	}
+
+	for _, tc := range []struct {
+		name          string
+		status        string
+		admin         bool
+		req           UpdateBusinessRequest
+		wantDirect    UpdateBusinessRequest
+		wantModerated UpdateBusinessRequest
+		wantResubmit  bool
+	}{
+		{name: "owner of a listed business", status: "verified", req: edit(),
+			wantDirect: directPart, wantModerated: moderatedPart},
+		{name: "owner of a closed business", status: "closed", req: edit(),
+			wantDirect: directPart, wantModerated: moderatedPart},
+		{name: "owner of a pending business", status: "pending", req: edit(),
+			wantDirect: edit()},
+		{name: "owner of a rejected business", status: "rejected", req: edit(),
+			wantDirect: edit(), wantResubmit: true},
+		{name: "admin of a listed business", status: "verified", admin: true, req: edit(),
+			wantDirect: edit()},
+		{name: "admin of a rejected business", status: "rejected", admin: true, req: edit(),
+			wantDirect: edit()},
+		{name: "owner with only direct fields", status: "verified", req: directPart,
+			wantDirect: directPart},
+		{name: "owner moving only one coordinate", status: "verified",
+			req:        UpdateBusinessRequest{Lat: num(9.03), Phone: str("+251111111111")},
+			wantDirect: UpdateBusinessRequest{Phone: str("+251111111111")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.req
+			moderated, resubmit := req.splitModerated(tc.status, tc.admin)
+			if !reflect.DeepEqual(req, tc.wantDirect) {
+				t.Errorf("direct = %+v, want %+v", req, tc.wantDirect)
+			}
+			if !reflect.DeepEqual(moderated, tc.wantModerated) {
+				t.Errorf("moderated = %+v, want %+v", moderated, tc.wantModerated)
+			}
+			if resubmit != tc.wantResubmit {
+				t.Errorf("resubmit = %v, want %v", resubmit, tc.wantResubmit)
+			}
+		})
+	}
+}
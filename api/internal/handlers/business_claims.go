@@ -0,0 +1,773 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"maps/api/internal/config"
+	"maps/api/internal/media"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxEvidenceLength caps the text of a claim
+	maxEvidenceLength = 2000
+	// maxEvidenceFiles caps the documents attached to a claim
+	maxEvidenceFiles = 5
+	// claimCodeTTL is how long a code sent to the business phone is valid
+	claimCodeTTL = 10 * time.Minute
+	// claimCodeResendAfter is how long to wait before sending another code
+	claimCodeResendAfter = time.Minute
+	// maxClaimCodeAttempts is how many codes a claim accepts in total,
+	// across resends
+	maxClaimCodeAttempts = 5
+	// maxClaimCodeSends is how many codes are sent for a claim
+	maxClaimCodeSends = 3
+	// maxPhoneClaimsPerDay is how many phone claims a user opens for a
+	// business a day, so failed claims can't be reopened to guess on
+	maxPhoneClaimsPerDay = 3
+)
+
+var (
+	errClaimNotPending = errors.New("claim is not pending")
+	errBusinessOwned   = errors.New("business already has an owner")
+)
+
+// CreateClaimRequest is the request body for claiming a business
+type CreateClaimRequest struct {
+	Method       string   `json:"method"` // phone, review
+	Evidence     *string  `json:"evidence,omitempty"`
+	EvidenceURLs []string `json:"evidence_urls,omitempty"`
+}
+
+// VerifyClaimRequest is the request body for the code sent to the
+// business phone
+type VerifyClaimRequest struct {
+	Code string `json:"code"`
+}
+
+// ReviewClaimRequest is the request body for approving or rejecting a
+// claim
+type ReviewClaimRequest struct {
+	Note *string `json:"note,omitempty"`
+}
+
+// ClaimResp is a business claim
+type ClaimResp struct {
+	ID           string   `json:"id"`
+	BusinessID   string   `json:"business_id"`
+	BusinessName string   `json:"business_name"`
+	UserID       string   `json:"user_id"`
+	UserName     *string  `json:"user_name,omitempty"`
+	Method       string   `json:"method"`
+	Status       string   `json:"status"`
+	Evidence     *string  `json:"evidence,omitempty"`
+	EvidenceURLs []string `json:"evidence_urls"`
+	PhoneHint    *string  `json:"phone_hint,omitempty"` // where the code was sent
+	ReviewNote   *string  `json:"review_note,omitempty"`
+	ResolvedAt   *string  `json:"resolved_at,omitempty"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+const selectClaims = `
+	SELECT c.id, c.business_id, b.name, c.user_id, u.name, c.method, c.status,
+		c.evidence, c.evidence_urls, b.phone, c.review_note, c.resolved_at, c.created_at
+	FROM business_claims c
+	JOIN businesses b ON b.id = c.business_id
+	JOIN users u ON u.id = c.user_id`
+
+func scanClaim(s rowScanner) (*ClaimResp, error) {
+	var c ClaimResp
+	var userName, evidence, phone, reviewNote sql.NullString
+	var resolvedAt sql.NullTime
+	var createdAt time.Time
+	err := s.Scan(&c.ID, &c.BusinessID, &c.BusinessName, &c.UserID, &userName, &c.Method, &c.Status,
+		&evidence, pq.Array(&c.EvidenceURLs), &phone, &reviewNote, &resolvedAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if userName.Valid {
+		c.UserName = &userName.String
+	}
+	if evidence.Valid {
+		c.Evidence = &evidence.String
+	}
+	if c.EvidenceURLs == nil {
+		c.EvidenceURLs = []string{}
+	}
+	if p, ok := businessPhone(phone); ok && c.Method == "phone" {
+		hint := maskPhone(p)
+		c.PhoneHint = &hint
+	}
+	if reviewNote.Valid {
+		c.ReviewNote = &reviewNote.String
+	}
+	if resolvedAt.Valid {
+		t := resolvedAt.Time.Format(time.RFC3339)
+		c.ResolvedAt = &t
+	}
+	c.CreatedAt = createdAt.Format(time.RFC3339)
+	return &c, nil
+}
+
+// CreateBusinessClaim asks for ownership of a business that has no owner.
+// With method "phone" a code is sent to the business phone and the claim
+// is approved once it is entered (VerifyBusinessClaim); with "review" an
+// admin looks at the evidence. Phone claims need an SMS backend.
+func CreateBusinessClaim(db *sql.DB, uploads *media.Uploads, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+
+		var req CreateClaimRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Method != "phone" && req.Method != "review" {
+			jsonError(w, "method must be 'phone' or 'review'", http.StatusBadRequest)
+			return
+		}
+		if req.Method == "phone" && !claimCodesEnabled(cfg) {
+			jsonError(w, "phone verification is not available; use method 'review'", http.StatusBadRequest)
+			return
+		}
+		evidence, ok := cleanEvidence(w, req.Evidence)
+		if !ok {
+			return
+		}
+		if len(req.EvidenceURLs) > maxEvidenceFiles {
+			jsonErrorf(w, "at most %d evidence files are allowed", http.StatusBadRequest, maxEvidenceFiles)
+			return
+		}
+		for _, url := range req.EvidenceURLs {
+			if _, err := uploads.Owned(r.Context(), url, userID); err != nil {
+				jsonError(w, "evidence_urls must be your uploads", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Method == "review" && evidence == nil && len(req.EvidenceURLs) == 0 {
+			jsonError(w, "evidence or evidence_urls is required for a review", http.StatusBadRequest)
+			return
+		}
+
+		var ownerID, phone sql.NullString
+		err := db.QueryRow(`SELECT owner_id, phone FROM businesses WHERE id = $1`, businessID).Scan(&ownerID, &phone)
+		if err == sql.ErrNoRows {
+			jsonError(w, "business not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get business: %v", err)
+			jsonError(w, "failed to claim business", http.StatusInternalServerError)
+			return
+		}
+		if ownerID.Valid {
+			jsonError(w, "business already has an owner; ask them to transfer it", http.StatusConflict)
+			return
+		}
+		businessNumber, hasPhone := businessPhone(phone)
+		if req.Method == "phone" && !hasPhone {
+			jsonError(w, "business has no usable phone number; use method 'review'", http.StatusBadRequest)
+			return
+		}
+
+		var code *string
+		var codeExpiresAt *time.Time
+		if req.Method == "phone" {
+			var recent int
+			err := db.QueryRow(`
+				SELECT COUNT(*) FROM business_claims
+				WHERE business_id = $1 AND user_id = $2 AND method = 'phone'
+				AND created_at > NOW() - INTERVAL '1 day'
+			`, businessID, userID).Scan(&recent)
+			if err != nil {
+				log.Printf("Failed to count claims: %v", err)
+				jsonError(w, "failed to claim business", http.StatusInternalServerError)
+				return
+			}
+			if recent >= maxPhoneClaimsPerDay {
+				jsonError(w, "too many phone claims for this business today; use method 'review'", http.StatusTooManyRequests)
+				return
+			}
+
+			c, err := generateOTP(6)
+			if err != nil {
+				log.Printf("Failed to generate OTP: %v", err)
+				jsonError(w, "failed to claim business", http.StatusInternalServerError)
+				return
+			}
+			t := time.Now().Add(claimCodeTTL)
+			code, codeExpiresAt = &c, &t
+		}
+
+		var claimID string
+		err = db.QueryRow(`
+			INSERT INTO business_claims (business_id, user_id, method, evidence, evidence_urls, otp_code, otp_expires_at, otp_sends)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $6::text IS NULL THEN 0 ELSE 1 END)
+			RETURNING id
+		`, businessID, userID, req.Method, evidence, pq.Array(nonNilStrings(req.EvidenceURLs)), code, codeExpiresAt).Scan(&claimID)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			jsonError(w, "you already have an open claim for this business", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to create claim: %v", err)
+			jsonError(w, "failed to claim business", http.StatusInternalServerError)
+			return
+		}
+
+		logOwnershipEvent(db, ownershipEvent{
+			businessID: businessID, action: "claim_submitted", actorID: userID,
+			toUserID: &userID, claimID: &claimID,
+		})
+		if code != nil {
+			sendClaimCode(cfg, businessNumber, *code)
+		}
+
+		respondWithClaim(w, db, claimID, http.StatusCreated)
+	}
+}
+
+// VerifyBusinessClaim approves a phone claim with the code sent to the
+// business phone
+func VerifyBusinessClaim(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID, claimID := chi.URLParam(r, "id"), chi.URLParam(r, "claimId")
+
+		var req VerifyClaimRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+			jsonError(w, "code is required", http.StatusBadRequest)
+			return
+		}
+
+		// Count the attempt and read the code in one statement, so
+		// concurrent guesses can't all get past the limit
+		var code string
+		err := db.QueryRow(`
+			UPDATE business_claims SET otp_attempts = otp_attempts + 1
+			WHERE id = $1 AND business_id = $2 AND user_id = $3 AND method = 'phone' AND status = 'pending'
+			AND otp_attempts < $4 AND otp_expires_at > NOW() AND otp_code IS NOT NULL
+			RETURNING otp_code
+		`, claimID, businessID, userID, maxClaimCodeAttempts).Scan(&code)
+		if err == sql.ErrNoRows {
+			writeClaimCodeError(w, db, claimID, businessID, userID)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to check claim code: %v", err)
+			jsonError(w, "failed to verify claim", http.StatusInternalServerError)
+			return
+		}
+		if !claimCodeMatches(req.Code, code) {
+			jsonError(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		note := "verified by a code sent to the business phone"
+		if !approveClaim(w, db, claimID, userID, &note) {
+			return
+		}
+		respondWithClaim(w, db, claimID, http.StatusOK)
+	}
+}
+
+// ResendClaimCode sends a new code for a phone claim, up to
+// maxClaimCodeSends codes. Wrong attempts carry over to the new code.
+func ResendClaimCode(db *sql.DB, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !claimCodesEnabled(cfg) {
+			jsonError(w, "phone verification is not available", http.StatusBadRequest)
+			return
+		}
+		businessID, claimID := chi.URLParam(r, "id"), chi.URLParam(r, "claimId")
+
+		code, err := generateOTP(6)
+		if err != nil {
+			log.Printf("Failed to generate OTP: %v", err)
+			jsonError(w, "failed to send code", http.StatusInternalServerError)
+			return
+		}
+
+		// Codes are resent at most once per claimCodeResendAfter
+		var phone sql.NullString
+		err = db.QueryRow(`
+			UPDATE business_claims c SET otp_code = $4, otp_sends = c.otp_sends + 1,
+				otp_expires_at = NOW() + make_interval(secs => $5)
+			FROM businesses b
+			WHERE c.id = $1 AND c.business_id = $2 AND c.user_id = $3
+			AND b.id = c.business_id AND b.phone IS NOT NULL
+			AND c.method = 'phone' AND c.status = 'pending'
+			AND c.otp_sends < $7 AND c.otp_attempts < $8
+			AND (c.otp_expires_at IS NULL OR c.otp_expires_at < NOW() + make_interval(secs => $6))
+			RETURNING b.phone
+		`, claimID, businessID, userID, code, claimCodeTTL.Seconds(),
+			(claimCodeTTL - claimCodeResendAfter).Seconds(), maxClaimCodeSends, maxClaimCodeAttempts).Scan(&phone)
+		if err == sql.ErrNoRows {
+			jsonError(w, "pending phone claim not found, a code was just sent, or no more codes can be sent for it", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to resend claim code: %v", err)
+			jsonError(w, "failed to send code", http.StatusInternalServerError)
+			return
+		}
+
+		number, _ := businessPhone(phone)
+		sendClaimCode(cfg, number, code)
+		jsonResponse(w, map[string]interface{}{
+			"message":    "verification code sent",
+			"phone_hint": maskPhone(number),
+			"expires_in": int(claimCodeTTL.Seconds()),
+		}, http.StatusOK)
+	}
+}
+
+// ApproveBusinessClaim approves a claim (admin only)
+func ApproveBusinessClaim(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claimID, note, ok := reviewClaimParams(w, r, db)
+		if !ok {
+			return
+		}
+		if !approveClaim(w, db, claimID, getUserIDFromContext(r), note) {
+			return
+		}
+		respondWithClaim(w, db, claimID, http.StatusOK)
+	}
+}
+
+// RejectBusinessClaim rejects a claim (admin only)
+func RejectBusinessClaim(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claimID, note, ok := reviewClaimParams(w, r, db)
+		if !ok {
+			return
+		}
+		adminID := getUserIDFromContext(r)
+		err := resolveClaim(db, claimID, "rejected", "claim_rejected", adminID, note, true)
+		if err == errClaimNotPending {
+			jsonError(w, "claim is not pending", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to reject claim: %v", err)
+			jsonError(w, "failed to reject claim", http.StatusInternalServerError)
+			return
+		}
+		respondWithClaim(w, db, claimID, http.StatusOK)
+	}
+}
+
+// CancelBusinessClaim withdraws the user's own pending claim
+func CancelBusinessClaim(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID, claimID := chi.URLParam(r, "id"), chi.URLParam(r, "claimId")
+
+		var exists bool
+		db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM business_claims WHERE id = $1 AND business_id = $2 AND user_id = $3)
+		`, claimID, businessID, userID).Scan(&exists)
+		if !exists {
+			jsonError(w, "claim not found", http.StatusNotFound)
+			return
+		}
+
+		err := resolveClaim(db, claimID, "cancelled", "claim_cancelled", userID, nil, false)
+		if err == errClaimNotPending {
+			jsonError(w, "claim is not pending", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to cancel claim: %v", err)
+			jsonError(w, "failed to cancel claim", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "claim cancelled"}, http.StatusOK)
+	}
+}
+
+// ListMyClaims returns the user's claims, newest first
+func ListMyClaims(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		listClaims(w, db, ` WHERE c.user_id = $1 ORDER BY c.created_at DESC LIMIT 100`, userID)
+	}
+}
+
+// ListPendingClaims returns the open claims, oldest first, for admins to
+// review
+func ListPendingClaims(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		listClaims(w, db, ` WHERE c.status = 'pending' ORDER BY c.created_at LIMIT 100`)
+	}
+}
+
+func listClaims(w http.ResponseWriter, db *sql.DB, where string, args ...interface{}) {
+	rows, err := db.Query(selectClaims+where, args...)
+	if err != nil {
+		log.Printf("Failed to get claims: %v", err)
+		jsonError(w, "failed to get claims", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	claims := []ClaimResp{}
+	for rows.Next() {
+		c, err := scanClaim(rows)
+		if err != nil {
+			log.Printf("Error scanning claim: %v", err)
+			continue
+		}
+		claims = append(claims, *c)
+	}
+	jsonResponse(w, map[string]interface{}{
+		"claims": claims,
+		"count":  len(claims),
+	}, http.StatusOK)
+}
+
+// reviewClaimParams checks that the user is an admin and reads the claim
+// id and review note
+func reviewClaimParams(w http.ResponseWriter, r *http.Request, db *sql.DB) (string, *string, bool) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		jsonError(w, "unauthorized", http.StatusUnauthorized)
+		return "", nil, false
+	}
+	if !isAdmin(db, userID) {
+		jsonError(w, "forbidden", http.StatusForbidden)
+		return "", nil, false
+	}
+
+	// The body is optional
+	var req ReviewClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return "", nil, false
+	}
+	note, ok := cleanEvidence(w, req.Note)
+	if !ok {
+		return "", nil, false
+	}
+
+	claimID := chi.URLParam(r, "claimId")
+	var exists bool
+	db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM business_claims WHERE id = $1 AND business_id = $2)
+	`, claimID, chi.URLParam(r, "id")).Scan(&exists)
+	if !exists {
+		jsonError(w, "claim not found", http.StatusNotFound)
+		return "", nil, false
+	}
+	return claimID, note, true
+}
+
+// approveClaim makes the claimant the owner and rejects the other open
+// claims of the business. It writes the error response on failure.
+func approveClaim(w http.ResponseWriter, db *sql.DB, claimID, actorID string, note *string) bool {
+	err := func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var businessID, claimantID string
+		err = tx.QueryRow(`
+			SELECT business_id, user_id FROM business_claims WHERE id = $1 AND status = 'pending' FOR UPDATE
+		`, claimID).Scan(&businessID, &claimantID)
+		if err == sql.ErrNoRows {
+			return errClaimNotPending
+		}
+		if err != nil {
+			return err
+		}
+
+		source := "admin"
+		if actorID == claimantID {
+			source = "owner"
+		}
+		if err := tagRevision(tx, actorID, source, "claim "+claimID); err != nil {
+			return err
+		}
+		changed, err := changeOwner(tx, businessID, nil, claimantID)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return errBusinessOwned
+		}
+		reviewer := &actorID
+		if actorID == claimantID {
+			reviewer = nil
+		}
+		if _, err := tx.Exec(`
+			UPDATE business_claims
+			SET status = 'approved', reviewed_by = $2, review_note = $3, resolved_at = NOW(), otp_code = NULL
+			WHERE id = $1
+		`, claimID, reviewer, note); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE business_claims
+			SET status = 'rejected', review_note = 'another claim was approved', resolved_at = NOW(), otp_code = NULL
+			WHERE business_id = $1 AND status = 'pending'
+		`, businessID); err != nil {
+			return err
+		}
+		if err := recordOwnershipEvent(tx, ownershipEvent{
+			businessID: businessID, action: "claim_approved", actorID: actorID,
+			toUserID: &claimantID, claimID: &claimID, note: note,
+		}); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+
+	switch err {
+	case nil:
+		return true
+	case errClaimNotPending:
+		jsonError(w, "claim is not pending", http.StatusConflict)
+	case errBusinessOwned:
+		jsonError(w, "business already has an owner", http.StatusConflict)
+	default:
+		log.Printf("Failed to approve claim: %v", err)
+		jsonError(w, "failed to approve claim", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// resolveClaim closes a pending claim without approving it
+func resolveClaim(db *sql.DB, claimID, status, action, actorID string, note *string, reviewed bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var reviewer *string
+	if reviewed {
+		reviewer = &actorID
+	}
+	var businessID, claimantID string
+	err = tx.QueryRow(`
+		UPDATE business_claims
+		SET status = $2, reviewed_by = $3, review_note = $4, resolved_at = NOW(), otp_code = NULL
+		WHERE id = $1 AND status = 'pending'
+		RETURNING business_id, user_id
+	`, claimID, status, reviewer, note).Scan(&businessID, &claimantID)
+	if err == sql.ErrNoRows {
+		return errClaimNotPending
+	}
+	if err != nil {
+		return err
+	}
+	if err := recordOwnershipEvent(tx, ownershipEvent{
+		businessID: businessID, action: action, actorID: actorID,
+		toUserID: &claimantID, claimID: &claimID, note: note,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// respondWithClaim writes a single claim
+func respondWithClaim(w http.ResponseWriter, db *sql.DB, claimID string, status int) {
+	c, err := scanClaim(db.QueryRow(selectClaims+` WHERE c.id = $1`, claimID))
+	if err != nil {
+		log.Printf("Failed to get claim: %v", err)
+		jsonError(w, "failed to get claim", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, c, status)
+}
+
+// businessPhone returns the normalized business phone number, if it is a
+// number a code can be sent to
+func businessPhone(phone sql.NullString) (string, bool) {
+	p := strings.NewReplacer(" ", "", "-", "").Replace(phone.String)
+	if !phone.Valid || !phoneRegex.MatchString(p) {
+		return "", false
+	}
+	return normalizePhone(p), true
+}
+
+// claimCodeMatches compares an entered code with the one sent in constant
+// time, so response timing doesn't reveal how many digits were right
+func claimCodeMatches(entered, sent string) bool {
+	return subtle.ConstantTimeCompare([]byte(entered), []byte(sent)) == 1
+}
+
+// writeClaimCodeError explains why a claim code couldn't be checked
+func writeClaimCodeError(w http.ResponseWriter, db *sql.DB, claimID, businessID, userID string) {
+	var attempts int
+	err := db.QueryRow(`
+		SELECT otp_attempts FROM business_claims
+		WHERE id = $1 AND business_id = $2 AND user_id = $3 AND method = 'phone' AND status = 'pending'
+	`, claimID, businessID, userID).Scan(&attempts)
+	switch {
+	case err == sql.ErrNoRows:
+		jsonError(w, "pending phone claim not found", http.StatusNotFound)
+	case err != nil:
+		log.Printf("Failed to get claim: %v", err)
+		jsonError(w, "failed to verify claim", http.StatusInternalServerError)
+	case attempts >= maxClaimCodeAttempts:
+		jsonError(w, "too many attempts; cancel the claim and use method 'review'", http.StatusTooManyRequests)
+	default:
+		jsonError(w, "code expired, request a new one", http.StatusUnauthorized)
+	}
+}
+
+// claimCodesEnabled reports whether claim codes can be sent
+func claimCodesEnabled(cfg *config.Config) bool {
+	return cfg.SMSBackend == "log"
+}
+
+// sendClaimCode sends a claim code to the business phone with the
+// configured SMS backend. "log" only prints it, for development.
+func sendClaimCode(cfg *config.Config, phone, code string) {
+	if cfg.SMSBackend == "log" {
+		log.Printf("[DEV] Business claim code for %s: %s", phone, code)
+	}
+}
+
+// maskPhone hides all but the country prefix and last digits of a number
+func maskPhone(phone string) string {
+	if len(phone) <= 7 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:4] + strings.Repeat("*", len(phone)-7) + phone[len(phone)-3:]
+}
+
+// cleanEvidence trims claim text and enforces maxEvidenceLength. Empty
+// text becomes nil.
+func cleanEvidence(w http.ResponseWriter, text *string) (*string, bool) {
+	if text == nil {
+		return nil, true
+	}
+	s := strings.TrimSpace(*text)
+	if len([]rune(s)) > maxEvidenceLength {
+		jsonErrorf(w, "text must be at most %d characters", http.StatusBadRequest, maxEvidenceLength)
+		return nil, false
+	}
+	if s == "" {
+		return nil, true
+	}
+	return &s, true
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// ownershipEvent is an entry of the ownership audit trail
+type ownershipEvent struct {
+	businessID string
+	action     string
+	actorID    string
+	fromUserID *string
+	toUserID   *string
+	claimID    *string
+	transferID *string
+	note       *string
+}
+
+const insertOwnershipEvent = `
+	INSERT INTO business_ownership_events
+		(business_id, action, actor_id, from_user_id, to_user_id, claim_id, transfer_id, note)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+// recordOwnershipEvent adds an event to the audit trail within a change
+func recordOwnershipEvent(tx *sql.Tx, e ownershipEvent) error {
+	_, err := tx.Exec(insertOwnershipEvent,
+		e.businessID, e.action, e.actorID, e.fromUserID, e.toUserID, e.claimID, e.transferID, e.note)
+	return err
+}
+
+// logOwnershipEvent adds an event that isn't part of a change
+func logOwnershipEvent(db *sql.DB, e ownershipEvent) {
+	_, err := db.Exec(insertOwnershipEvent,
+		e.businessID, e.action, e.actorID, e.fromUserID, e.toUserID, e.claimID, e.transferID, e.note)
+	if err != nil {
+		log.Printf("Failed to record ownership event: %v", err)
+	}
+}
+
+// changeOwner gives a business to toUserID if it still belongs to
+// fromUserID (nil: no owner) and reports whether it did. The new owner
+// gets the business_owner role; the previous one loses it once they own
+// no business.
+func changeOwner(tx *sql.Tx, businessID string, fromUserID *string, toUserID string) (bool, error) {
+	res, err := tx.Exec(`
+		UPDATE businesses SET owner_id = $3
+		WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $2::uuid
+	`, businessID, fromUserID, toUserID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE users SET role = 'business_owner' WHERE id = $1 AND role = 'user'
+	`, toUserID); err != nil {
+		return false, err
+	}
+	if fromUserID != nil {
+		if _, err := tx.Exec(`
+			UPDATE users SET role = 'user'
+			WHERE id = $1 AND role = 'business_owner'
+			AND NOT EXISTS (SELECT 1 FROM businesses WHERE owner_id = $1)
+		`, *fromUserID); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
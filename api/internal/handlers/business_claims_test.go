@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+func TestClaimCodeMatches(t *testing.T) {
+	for _, tc := range []struct {
+		entered string
+		want    bool
+	}{
+		{"482913", true},
+		{"482914", false},
+		{"48291", false},
+		{"4829130", false},
+		{"", false},
+	} {
+		if got := claimCodeMatches(tc.entered, "482913"); got != tc.want {
+			t.Errorf("claimCodeMatches(%q) = %v, want %v", tc.entered, got, tc.want)
+		}
+	}
+}
+
+func TestMaskPhone(t *testing.T) {
+	for phone, want := range map[string]string{
+		"+251911234567": "+251******567",
+		"0911234567":    "0911***567",
+		"12345":         "*****",
+	} {
+		if got := maskPhone(phone); got != want {
+			t.Errorf("maskPhone(%q) = %q, want %q", phone, got, want)
+		}
+	}
+}
+
+// insertPhoneClaim opens a phone claim of businessID by userID with code
+// valid for ten minutes
+func insertPhoneClaim(t *testing.T, conn *sql.DB, businessID, userID, code string) string {
+	t.Helper()
+	var id string
+	err := conn.QueryRow(`
+		INSERT INTO business_claims (business_id, user_id, method, otp_code, otp_expires_at, otp_sends)
+		VALUES ($1, $2, 'phone', $3, NOW() + INTERVAL '10 minutes', 1)
+		RETURNING id
+	`, businessID, userID, code).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestVerifyClaimAttemptLimit(t *testing.T) {
+	conn := openTestDB(t)
+	businessID := insertTestBusiness(t, conn, "Claimed by phone", 0.15, 0.15)
+	userID := insertTestUser(t, conn, "+00000000011")
+	claimID := insertPhoneClaim(t, conn, businessID, userID, "482913")
+	verify := VerifyBusinessClaim(conn)
+
+	for i := 1; i <= maxClaimCodeAttempts; i++ {
+		w := serveAs(verify, userID, `{"code":"000000"}`, "id", businessID, "claimId", claimID)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+	// The right code is refused once the attempts are used up
+	w := serveAs(verify, userID, `{"code":"482913"}`, "id", businessID, "claimId", claimID)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("code after %d attempts: status %d, want %d", maxClaimCodeAttempts, w.Code, http.StatusTooManyRequests)
+	}
+
+	var attempts int
+	var status string
+	var owner sql.NullString
+	err := conn.QueryRow(`
+		SELECT c.otp_attempts, c.status, b.owner_id
+		FROM business_claims c JOIN businesses b ON b.id = c.business_id
+		WHERE c.id = $1
+	`, claimID).Scan(&attempts, &status, &owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != maxClaimCodeAttempts || status != "pending" || owner.Valid {
+		t.Errorf("after the limit: attempts=%d status=%s owner=%v", attempts, status, owner)
+	}
+}
+
+func TestVerifyClaimApproves(t *testing.T) {
+	conn := openTestDB(t)
+	businessID := insertTestBusiness(t, conn, "Claimed by phone", 0.15, 0.15)
+	userID := insertTestUser(t, conn, "+00000000011")
+	otherID := insertTestUser(t, conn, "+00000000012")
+	claimID := insertPhoneClaim(t, conn, businessID, userID, "482913")
+	otherClaimID := insertPhoneClaim(t, conn, businessID, otherID, "175320")
+	verify := VerifyBusinessClaim(conn)
+
+	// Another user's code doesn't verify this claim
+	w := serveAs(verify, userID, `{"code":"175320"}`, "id", businessID, "claimId", claimID)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("other claim's code: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = serveAs(verify, userID, `{"code":"482913"}`, "id", businessID, "claimId", claimID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("right code: status %d: %s", w.Code, w.Body)
+	}
+
+	var owner, role, otherStatus string
+	err := conn.QueryRow(`
+		SELECT b.owner_id, u.role, (SELECT status FROM business_claims WHERE id = $3)
+		FROM businesses b, users u WHERE b.id = $1 AND u.id = $2
+	`, businessID, userID, otherClaimID).Scan(&owner, &role, &otherStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != userID || role != "business_owner" || otherStatus != "rejected" {
+		t.Errorf("after approval: owner=%s role=%s other claim=%s", owner, role, otherStatus)
+	}
+}
+
+func TestChangeOwner(t *testing.T) {
+	conn := openTestDB(t)
+
+	for _, tc := range []struct {
+		name            string
+		fromRole        string
+		fromOwnsAnother bool
+		toRole          string
+		staleFrom       bool
+		wantChanged     bool
+		wantFromRole    string
+		wantToRole      string
+	}{
+		{name: "from unowned", toRole: "user", wantChanged: true, wantToRole: "business_owner"},
+		{name: "owner hands over", fromRole: "business_owner", toRole: "user", wantChanged: true,
+			wantFromRole: "user", wantToRole: "business_owner"},
+		{name: "owner keeps another", fromRole: "business_owner", fromOwnsAnother: true, toRole: "user", wantChanged: true,
+			wantFromRole: "business_owner", wantToRole: "business_owner"},
+		{name: "admins keep their role", fromRole: "admin", toRole: "admin", wantChanged: true,
+			wantFromRole: "admin", wantToRole: "admin"},
+		{name: "owner changed meanwhile", fromRole: "business_owner", toRole: "user", staleFrom: true,
+			wantFromRole: "business_owner", wantToRole: "user"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn.Exec(`DELETE FROM businesses WHERE ST_Contains(ST_GeomFromText($1, 4326), geom)`, testArea)
+			conn.Exec(`DELETE FROM users WHERE phone LIKE '+0000000001%'`)
+
+			businessID := insertTestBusiness(t, conn, "Changing hands", 0.15, 0.15)
+			toID := insertTestUser(t, conn, "+00000000011")
+			if _, err := conn.Exec(`UPDATE users SET role = $2 WHERE id = $1`, toID, tc.toRole); err != nil {
+				t.Fatal(err)
+			}
+			var from *string
+			if tc.fromRole != "" {
+				fromID := insertTestUser(t, conn, "+00000000012")
+				from = &fromID
+				if _, err := conn.Exec(`UPDATE users SET role = $2 WHERE id = $1`, fromID, tc.fromRole); err != nil {
+					t.Fatal(err)
+				}
+				owned := []string{businessID}
+				if tc.fromOwnsAnother {
+					owned = append(owned, insertTestBusiness(t, conn, "Kept", 0.16, 0.16))
+				}
+				for _, id := range owned {
+					if _, err := conn.Exec(`UPDATE businesses SET owner_id = $2 WHERE id = $1`, id, fromID); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if tc.staleFrom {
+					// Someone else took over before this change ran
+					thirdID := insertTestUser(t, conn, "+00000000013")
+					if _, err := conn.Exec(`UPDATE businesses SET owner_id = $2 WHERE id = $1`, businessID, thirdID); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			tx, err := conn.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed, err := changeOwner(tx, businessID, from, toID)
+			if err != nil {
+				tx.Rollback()
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if changed != tc.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tc.wantChanged)
+			}
+
+			var toRole string
+			if err := conn.QueryRow(`SELECT role FROM users WHERE id = $1`, toID).Scan(&toRole); err != nil {
+				t.Fatal(err)
+			}
+			if toRole != tc.wantToRole {
+				t.Errorf("new owner role = %s, want %s", toRole, tc.wantToRole)
+			}
+			if from != nil {
+				var fromRole string
+				if err := conn.QueryRow(`SELECT role FROM users WHERE id = $1`, *from).Scan(&fromRole); err != nil {
+					t.Fatal(err)
+				}
+				if fromRole != tc.wantFromRole {
+					t.Errorf("previous owner role = %s, want %s", fromRole, tc.wantFromRole)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"maps/api/internal/dedupe"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errMergeNotFound = errors.New("business not found")
+	errAlreadyMerged = errors.New("business was already merged")
+)
+
+// MergeBusinessRequest is the request body for merging a business into
+// another
+type MergeBusinessRequest struct {
+	Into string `json:"into"`
+}
+
+// DuplicateBusinessResp is one side of a duplicate candidate
+type DuplicateBusinessResp struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	NameAm      *string `json:"name_am,omitempty"`
+	Category    *string `json:"category,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+	Address     *string `json:"address,omitempty"`
+	Lat         float64 `json:"lat"`
+	Lng         float64 `json:"lng"`
+	Source      string  `json:"source"`
+	Status      string  `json:"status"`
+	OwnerID     *string `json:"owner_id,omitempty"`
+	ReviewCount int     `json:"review_count"`
+}
+
+// DuplicateResp is a pair of businesses that are likely the same place
+type DuplicateResp struct {
+	ID             string                `json:"id"`
+	Score          float64               `json:"score"`
+	NameSimilarity float64               `json:"name_similarity"`
+	DistanceM      float64               `json:"distance_m"`
+	SameCategory   bool                  `json:"same_category"`
+	SamePhone      bool                  `json:"same_phone"`
+	Status         string                `json:"status"`
+	A              DuplicateBusinessResp `json:"a"`
+	B              DuplicateBusinessResp `json:"b"`
+	CreatedAt      string                `json:"created_at"`
+}
+
+const selectDuplicates = `
+	SELECT d.id, d.score, d.name_similarity, d.distance_m, d.same_category, d.same_phone, d.status, d.created_at,
+		a.id, a.name, a.name_am, ac.name, a.phone, a.address,
+		ST_Y(a.geom), ST_X(a.geom), COALESCE(a.source, 'local'), a.status, a.owner_id, a.review_count,
+		b.id, b.name, b.name_am, bc.name, b.phone, b.address,
+		ST_Y(b.geom), ST_X(b.geom), COALESCE(b.source, 'local'), b.status, b.owner_id, b.review_count
+	FROM business_duplicates d
+	JOIN businesses a ON a.id = d.business_a
+	LEFT JOIN categories ac ON ac.id = a.category_id
+	JOIN businesses b ON b.id = d.business_b
+	LEFT JOIN categories bc ON bc.id = b.category_id`
+
+func scanDuplicate(s rowScanner) (*DuplicateResp, error) {
+	var d DuplicateResp
+	var createdAt time.Time
+	var aNameAm, aCategory, aPhone, aAddress, aOwner sql.NullString
+	var bNameAm, bCategory, bPhone, bAddress, bOwner sql.NullString
+	err := s.Scan(&d.ID, &d.Score, &d.NameSimilarity, &d.DistanceM, &d.SameCategory, &d.SamePhone, &d.Status, &createdAt,
+		&d.A.ID, &d.A.Name, &aNameAm, &aCategory, &aPhone, &aAddress,
+		&d.A.Lat, &d.A.Lng, &d.A.Source, &d.A.Status, &aOwner, &d.A.ReviewCount,
+		&d.B.ID, &d.B.Name, &bNameAm, &bCategory, &bPhone, &bAddress,
+		&d.B.Lat, &d.B.Lng, &d.B.Source, &d.B.Status, &bOwner, &d.B.ReviewCount)
+	if err != nil {
+		return nil, err
+	}
+	d.A.NameAm, d.A.Category, d.A.Phone = nullStringPtr(aNameAm), nullStringPtr(aCategory), nullStringPtr(aPhone)
+	d.A.Address, d.A.OwnerID = nullStringPtr(aAddress), nullStringPtr(aOwner)
+	d.B.NameAm, d.B.Category, d.B.Phone = nullStringPtr(bNameAm), nullStringPtr(bCategory), nullStringPtr(bPhone)
+	d.B.Address, d.B.OwnerID = nullStringPtr(bAddress), nullStringPtr(bOwner)
+	d.CreatedAt = createdAt.Format(time.RFC3339)
+	return &d, nil
+}
+
+// ListDuplicateBusinesses returns the pending duplicate candidates, best
+// first (admin only). ?min_score= raises the bar above the detector's.
+func ListDuplicateBusinesses(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		minScore := dedupe.MinScore
+		if v := r.URL.Query().Get("min_score"); v != "" {
+			s, err := strconv.ParseFloat(v, 64)
+			if err != nil || s < 0 || s > 1 {
+				jsonError(w, "min_score must be between 0 and 1", http.StatusBadRequest)
+				return
+			}
+			minScore = s
+		}
+
+		rows, err := db.Query(selectDuplicates+`
+			WHERE d.status = 'pending' AND d.score >= $1
+			ORDER BY d.score DESC
+			LIMIT 100
+		`, minScore)
+		if err != nil {
+			log.Printf("Failed to get duplicates: %v", err)
+			jsonError(w, "failed to get duplicates", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		duplicates := []DuplicateResp{}
+		for rows.Next() {
+			d, err := scanDuplicate(rows)
+			if err != nil {
+				log.Printf("Error scanning duplicate: %v", err)
+				continue
+			}
+			duplicates = append(duplicates, *d)
+		}
+		jsonResponse(w, map[string]interface{}{
+			"duplicates": duplicates,
+			"count":      len(duplicates),
+		}, http.StatusOK)
+	}
+}
+
+// ScanDuplicateBusinesses queues a scan for duplicates (admin only)
+func ScanDuplicateBusinesses(db *sql.DB, detector *dedupe.Detector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		detector.Trigger()
+		jsonResponse(w, map[string]string{"message": "scan queued"}, http.StatusAccepted)
+	}
+}
+
+// DismissDuplicateBusiness marks a candidate pair as not a duplicate, so
+// later scans leave it alone (admin only)
+func DismissDuplicateBusiness(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE business_duplicates
+			SET status = 'dismissed', resolved_by = $2, resolved_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND status = 'pending'
+		`, chi.URLParam(r, "duplicateId"), userID)
+		if err != nil {
+			log.Printf("Failed to dismiss duplicate: %v", err)
+			jsonError(w, "failed to dismiss duplicate", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, "pending duplicate not found", http.StatusNotFound)
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "duplicate dismissed"}, http.StatusOK)
+	}
+}
+
+// MergeBusiness merges the business into another (admin only). Saves,
+// reviews, media, posts and missing details move to the surviving business;
+// the merged one stays as a redirect (see GetBusiness).
+func MergeBusiness(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		var req MergeBusinessRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !uuidRegex.MatchString(businessID) || !uuidRegex.MatchString(req.Into) {
+			jsonError(w, "into must be a business id", http.StatusBadRequest)
+			return
+		}
+		businessID, req.Into = strings.ToLower(businessID), strings.ToLower(req.Into)
+		if req.Into == businessID {
+			jsonError(w, "a business can't be merged into itself", http.StatusBadRequest)
+			return
+		}
+
+		err := mergeBusiness(db, businessID, req.Into, userID)
+		switch err {
+		case nil:
+		case errMergeNotFound:
+			jsonError(w, "business not found", http.StatusNotFound)
+			return
+		case errAlreadyMerged:
+			jsonError(w, "business was already merged", http.StatusConflict)
+			return
+		default:
+			log.Printf("Failed to merge business: %v", err)
+			jsonError(w, "failed to merge business", http.StatusInternalServerError)
+			return
+		}
+
+		LogActivity(db, userID, "merge_business", map[string]string{"business_id": businessID, "into": req.Into}, r.RemoteAddr)
+		jsonResponse(w, map[string]string{
+			"message": "business merged",
+			"id":      req.Into,
+		}, http.StatusOK)
+	}
+}
+
+// mergeBusiness moves everything attached to fromID onto intoID and turns
+// fromID into a redirect
+func mergeBusiness(db *sql.DB, fromID, intoID, adminID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, owner_id, status FROM businesses WHERE id IN ($1, $2) ORDER BY id FOR UPDATE
+	`, fromID, intoID)
+	if err != nil {
+		return err
+	}
+	owners := map[string]sql.NullString{}
+	for rows.Next() {
+		var id, status string
+		var ownerID sql.NullString
+		if err := rows.Scan(&id, &ownerID, &status); err != nil {
+			rows.Close()
+			return err
+		}
+		if status == "merged" {
+			rows.Close()
+			return errAlreadyMerged
+		}
+		owners[id] = ownerID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(owners) != 2 {
+		return errMergeNotFound
+	}
+
+	if err := tagRevision(tx, adminID, "admin", "merged "+fromID+" into "+intoID); err != nil {
+		return err
+	}
+
+	one := []interface{}{fromID}
+	pair := []interface{}{fromID, intoID}
+	withAdmin := []interface{}{fromID, intoID, adminID}
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		// Details the surviving business is missing
+		{`UPDATE businesses t SET
+			name_am = COALESCE(t.name_am, s.name_am),
+			description = COALESCE(t.description, s.description),
+			description_am = COALESCE(t.description_am, s.description_am),
+			category_id = COALESCE(t.category_id, s.category_id),
+			phone = COALESCE(t.phone, s.phone),
+			email = COALESCE(t.email, s.email),
+			website = COALESCE(t.website, s.website),
+			address = COALESCE(t.address, s.address),
+			address_am = COALESCE(t.address_am, s.address_am),
+			view_count = t.view_count + s.view_count
+		FROM businesses s
+		WHERE t.id = $2 AND s.id = $1`, pair},
+		{`INSERT INTO user_saved_businesses (user_id, business_id, created_at)
+		SELECT user_id, $2::uuid, created_at FROM user_saved_businesses WHERE business_id = $1
+		ON CONFLICT (user_id, business_id) DO NOTHING`, pair},
+		{`DELETE FROM user_saved_businesses WHERE business_id = $1`, one},
+
+		// One review per user, and none by the owner of the surviving
+		// business; those stay with the merged one
+		{`UPDATE business_reviews SET business_id = $2
+		WHERE business_id = $1 AND user_id NOT IN (
+			SELECT user_id FROM business_reviews WHERE business_id = $2
+			UNION ALL
+			SELECT owner_id FROM businesses WHERE id = $2 AND owner_id IS NOT NULL
+		)`, pair},
+
+		// The rating trigger doesn't follow reviews that move
+		{`UPDATE businesses b SET
+			avg_rating = (SELECT COALESCE(AVG(rating), 0) FROM business_reviews WHERE business_id = b.id),
+			review_count = (SELECT COUNT(*) FROM business_reviews WHERE business_id = b.id)
+		WHERE b.id IN ($1, $2)`, pair},
+
+		// Media goes after the surviving gallery, which keeps its cover
+		{`UPDATE business_media SET business_id = $2, is_cover = FALSE,
+			sort_order = sort_order + (SELECT COALESCE(MAX(sort_order), -1) + 1 FROM business_media WHERE business_id = $2)
+		WHERE business_id = $1`, pair},
+		{`UPDATE posts SET business_id = $2 WHERE business_id = $1`, pair},
+
+		// Hours, unless the surviving business has its own
+		{`UPDATE business_hours SET business_id = $2
+		WHERE business_id = $1 AND NOT EXISTS (SELECT 1 FROM business_hours WHERE business_id = $2)`, pair},
+		{`UPDATE business_special_hours s SET business_id = $2
+		WHERE s.business_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM business_special_hours t
+			WHERE t.business_id = $2 AND (t.date = s.date OR t.holiday = s.holiday)
+		)`, pair},
+
+		// Open requests about the merged business are closed
+		{`UPDATE business_claims
+		SET status = 'rejected', review_note = 'business was merged into another', resolved_at = NOW(), otp_code = NULL
+		WHERE business_id = $1 AND status = 'pending'`, one},
+		{`UPDATE business_ownership_transfers SET status = 'cancelled', resolved_at = NOW()
+		WHERE business_id = $1 AND status = 'pending'`, one},
+		{`UPDATE business_changes
+		SET status = 'rejected', reason = 'business was merged into another', reviewed_by = $3, resolved_at = NOW(), updated_at = NOW()
+		WHERE business_id = $1 AND status = 'pending'`, withAdmin},
+
+		// Redirects, including those that pointed at the merged business
+		{`UPDATE businesses SET status = 'merged', merged_into = $2 WHERE id = $1`, pair},
+		{`UPDATE businesses SET merged_into = $2 WHERE merged_into = $1`, pair},
+		{`UPDATE business_duplicates
+		SET status = 'merged', resolved_by = $3, resolved_at = NOW(), updated_at = NOW()
+		WHERE status = 'pending' AND business_a = LEAST($1::uuid, $2::uuid) AND business_b = GREATEST($1::uuid, $2::uuid)`, withAdmin},
+		{`DELETE FROM business_duplicates WHERE status = 'pending' AND $1 IN (business_a, business_b)`, one},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return err
+		}
+	}
+
+	// An owner of the merged business takes over a surviving business that
+	// has none
+	if from, into := owners[fromID], owners[intoID]; from.Valid && !into.Valid {
+		changed, err := changeOwner(tx, intoID, nil, from.String)
+		if err != nil {
+			return err
+		}
+		if changed {
+			note := "merged from " + fromID
+			if err := recordOwnershipEvent(tx, ownershipEvent{
+				businessID: intoID, action: "merged", actorID: adminID,
+				toUserID: &from.String, note: &note,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
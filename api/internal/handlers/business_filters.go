@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// sqlArgs collects positional query arguments
+type sqlArgs []interface{}
+
+// add appends v and returns its placeholder
+func (a *sqlArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// BusinessFilters are the facet filters shared by search and nearby
+type BusinessFilters struct {
+	CategoryIDs []string               // expanded to subcategories via parent_id
+	MinRating   *float64               // avg_rating >= value
+	OpenNow     bool                   // evaluated against business_hours
+	HasMedia    bool                   // at least one business_media row
+	Sources     []string               // businesses.source
+	Metadata    map[string]interface{} // businesses.metadata @> value
+}
+
+// parseBusinessFilters reads filters from the query string:
+//
+//	category / categories   comma separated ids (repeatable)
+//	min_rating              0-5
+//	open_now, has_media     1 or true
+//	source                  comma separated (repeatable)
+//	metadata                JSON object matched with @>
+//	meta.<key>              shorthand for metadata={"<key>": "<value>"}
+func parseBusinessFilters(r *http.Request) (*BusinessFilters, error) {
+	q := r.URL.Query()
+	f := &BusinessFilters{}
+
+	for _, key := range []string{"category", "categories"} {
+		for _, id := range splitParam(q[key]) {
+			if !uuidRegex.MatchString(id) {
+				return nil, fmt.Errorf("invalid category id %q", id)
+			}
+			f.CategoryIDs = append(f.CategoryIDs, id)
+		}
+	}
+
+	if v := q.Get("min_rating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			return nil, fmt.Errorf("min_rating must be between 0 and 5")
+		}
+		f.MinRating = &rating
+	}
+
+	f.OpenNow = isTrue(q.Get("open_now"))
+	f.HasMedia = isTrue(q.Get("has_media"))
+	f.Sources = splitParam(q["source"])
+
+	if v := q.Get("metadata"); v != "" {
+		if err := json.Unmarshal([]byte(v), &f.Metadata); err != nil {
+			return nil, fmt.Errorf("metadata must be a JSON object")
+		}
+	}
+	for key, values := range q {
+		if name := strings.TrimPrefix(key, "meta."); name != key && name != "" && len(values) > 0 {
+			if f.Metadata == nil {
+				f.Metadata = make(map[string]interface{})
+			}
+			f.Metadata[name] = values[0]
+		}
+	}
+
+	return f, nil
+}
+
+// clauses returns SQL conditions on businesses b for the filters, adding
+// their arguments to args
+func (f *BusinessFilters) clauses(args *sqlArgs) []string {
+	var where []string
+
+	if len(f.CategoryIDs) > 0 {
+		where = append(where, fmt.Sprintf(`b.category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id = ANY(%s::uuid[])
+				UNION
+				SELECT c2.id FROM categories c2 JOIN tree ON c2.parent_id = tree.id
+			)
+			SELECT id FROM tree
+		)`, args.add(pq.Array(f.CategoryIDs))))
+	}
+	if f.MinRating != nil {
+		where = append(where, "COALESCE(b.avg_rating, 0) >= "+args.add(*f.MinRating))
+	}
+	if f.OpenNow {
+		where = append(where, "business_open_at(b.id, NOW())")
+	}
+	if f.HasMedia {
+		where = append(where, "EXISTS (SELECT 1 FROM business_media m WHERE m.business_id = b.id)")
+	}
+	if len(f.Sources) > 0 {
+		where = append(where, "COALESCE(b.source, 'local') = ANY("+args.add(pq.Array(f.Sources))+"::text[])")
+	}
+	if len(f.Metadata) > 0 {
+		meta, _ := json.Marshal(f.Metadata)
+		where = append(where, "b.metadata @> "+args.add(string(meta))+"::jsonb")
+	}
+
+	return where
+}
+
+// FacetCount is a single facet bucket
+type FacetCount struct {
+	Key   string `json:"key"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// BusinessFacets summarizes a filtered result set
+type BusinessFacets struct {
+	Total      int          `json:"total"`
+	Categories []FacetCount `json:"categories"`
+	Sources    []FacetCount `json:"sources"`
+	Ratings    []FacetCount `json:"ratings"` // cumulative: "4" means rating >= 4
+	OpenNow    int          `json:"open_now"`
+	HasMedia   int          `json:"has_media"`
+}
+
+// queryBusinessFacets counts facets over every business matching where,
+// which must only reference businesses b and categories c
+func queryBusinessFacets(ctx context.Context, db *sql.DB, where string, args []interface{}) (*BusinessFacets, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH filtered AS (
+			SELECT b.id, b.category_id, COALESCE(b.avg_rating, 0) AS rating,
+				COALESCE(b.source, 'local') AS source
+			FROM businesses b
+			LEFT JOIN categories c ON b.category_id = c.id
+			WHERE `+where+`
+		)
+		SELECT 'total', '', '', COUNT(*) FROM filtered
+		UNION ALL
+		SELECT 'category', f.category_id::text, cat.name, COUNT(*)
+		FROM filtered f JOIN categories cat ON cat.id = f.category_id
+		GROUP BY f.category_id, cat.name
+		UNION ALL
+		SELECT 'source', source, '', COUNT(*) FROM filtered GROUP BY source
+		UNION ALL
+		SELECT 'rating', t::text, '', COUNT(*) FILTER (WHERE rating >= t)
+		FROM filtered, generate_series(1, 4) t GROUP BY t
+		UNION ALL
+		SELECT 'open_now', '', '', COUNT(*) FILTER (WHERE business_open_at(id, NOW())) FROM filtered
+		UNION ALL
+		SELECT 'has_media', '', '', COUNT(*) FILTER (
+			WHERE EXISTS (SELECT 1 FROM business_media m WHERE m.business_id = filtered.id)
+		) FROM filtered
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &BusinessFacets{
+		Categories: []FacetCount{},
+		Sources:    []FacetCount{},
+		Ratings:    []FacetCount{},
+	}
+	for rows.Next() {
+		var facet string
+		var fc FacetCount
+		if err := rows.Scan(&facet, &fc.Key, &fc.Label, &fc.Count); err != nil {
+			return nil, err
+		}
+		switch facet {
+		case "total":
+			facets.Total = fc.Count
+		case "category":
+			facets.Categories = append(facets.Categories, fc)
+		case "source":
+			facets.Sources = append(facets.Sources, fc)
+		case "rating":
+			facets.Ratings = append(facets.Ratings, fc)
+		case "open_now":
+			facets.OpenNow = fc.Count
+		case "has_media":
+			facets.HasMedia = fc.Count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, list := range [][]FacetCount{facets.Categories, facets.Sources} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	}
+	sort.Slice(facets.Ratings, func(i, j int) bool { return facets.Ratings[i].Key > facets.Ratings[j].Key })
+	return facets, nil
+}
+
+// splitParam flattens repeated and comma separated query values
+func splitParam(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func isTrue(v string) bool {
+	return v == "1" || v == "true"
+}
@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"maps/api/internal/holidays"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxSpecialHours caps the special hours a business can have at once
+const maxSpecialHours = 100
+
+// addisTime is the zone open status times are reported in
+var addisTime = loadAddisTime()
+
+func loadAddisTime() *time.Location {
+	loc, err := time.LoadLocation("Africa/Addis_Ababa")
+	if err != nil {
+		// Ethiopia has no daylight saving time
+		return time.FixedZone("EAT", 3*60*60)
+	}
+	return loc
+}
+
+// SpecialHourRequest overrides the weekly hours on a date, or on every
+// occurrence of a holiday (see GET /api/holidays for the keys)
+type SpecialHourRequest struct {
+	Date      *string `json:"date,omitempty"` // YYYY-MM-DD
+	Holiday   *string `json:"holiday,omitempty"`
+	OpenTime  *string `json:"open_time,omitempty"`
+	CloseTime *string `json:"close_time,omitempty"`
+	IsClosed  bool    `json:"is_closed"`
+	Note      *string `json:"note,omitempty"`
+}
+
+// SpecialHourResp is a special hours entry. NextDate is the next
+// occurrence of a holiday entry.
+type SpecialHourResp struct {
+	ID          string  `json:"id"`
+	Date        *string `json:"date,omitempty"`
+	Holiday     *string `json:"holiday,omitempty"`
+	HolidayName *string `json:"holiday_name,omitempty"`
+	NextDate    *string `json:"next_date,omitempty"`
+	OpenTime    *string `json:"open_time,omitempty"`
+	CloseTime   *string `json:"close_time,omitempty"`
+	IsClosed    bool    `json:"is_closed"`
+	Note        *string `json:"note,omitempty"`
+}
+
+// BusinessHoursResp is the full opening schedule of a business
+type BusinessHoursResp struct {
+	Hours        []BusinessHourResp `json:"hours"`
+	SpecialHours []SpecialHourResp  `json:"special_hours"`
+	IsOpenNow    bool               `json:"is_open_now"`
+	NextChangeAt *string            `json:"next_change_at"`
+}
+
+// openStatusColumns selects is_open_now and next_change_at for the business
+// whose id is in idCol
+func openStatusColumns(idCol string) string {
+	return fmt.Sprintf("business_open_at(%[1]s, NOW()) AS is_open_now, business_next_change_at(%[1]s, NOW()) AS next_change_at", idCol)
+}
+
+// withOpenStatus appends is_open_now and next_change_at to the rows of page,
+// a query already limited to the rows returned, so the hours functions only
+// run for those instead of every candidate. page must select id; rows come
+// back sorted by orderBy, which can only use page's columns.
+func withOpenStatus(page, orderBy string) string {
+	return fmt.Sprintf(`
+		SELECT page.*, hours.is_open_now, hours.next_change_at
+		FROM (%s) page
+		CROSS JOIN LATERAL (SELECT %s) hours
+		ORDER BY %s`, page, openStatusColumns("page.id"), orderBy)
+}
+
+// formatNextChange formats next_change_at in Addis Ababa time; nil when
+// the status doesn't change within a week
+func formatNextChange(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	s := t.Time.In(addisTime).Format(time.RFC3339)
+	return &s
+}
+
+// GetBusinessHours returns the weekly hours, upcoming special hours and the
+// current open status of a business
+func GetBusinessHours(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondWithHours(w, db, chi.URLParam(r, "id"))
+	}
+}
+
+// SetBusinessHours replaces the weekly hours of a business (owner or admin).
+// Days left out are closed. A close time at or before the open time runs
+// past midnight (20:00-02:00); equal times mean open around the clock.
+func SetBusinessHours(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var req []BusinessHourRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		seen := map[int]bool{}
+		for i := range req {
+			h := &req[i]
+			if h.DayOfWeek < 0 || h.DayOfWeek > 6 {
+				jsonError(w, "day_of_week must be 0 (Sunday) to 6 (Saturday)", http.StatusBadRequest)
+				return
+			}
+			if seen[h.DayOfWeek] {
+				jsonErrorf(w, "day_of_week %d is listed twice", http.StatusBadRequest, h.DayOfWeek)
+				return
+			}
+			seen[h.DayOfWeek] = true
+
+			var err error
+			if h.OpenTime, h.CloseTime, err = cleanOpeningSpan(h.OpenTime, h.CloseTime, h.IsClosed); err != nil {
+				jsonErrorf(w, "day %d: %v", http.StatusBadRequest, h.DayOfWeek, err)
+				return
+			}
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Failed to begin hours update: %v", err)
+			jsonError(w, "failed to update hours", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM business_hours WHERE business_id = $1`, businessID); err != nil {
+			log.Printf("Failed to clear business hours: %v", err)
+			jsonError(w, "failed to update hours", http.StatusInternalServerError)
+			return
+		}
+		for _, h := range req {
+			_, err := tx.Exec(`
+				INSERT INTO business_hours (business_id, day_of_week, open_time, close_time, is_closed)
+				VALUES ($1, $2, $3, $4, $5)
+			`, businessID, h.DayOfWeek, h.OpenTime, h.CloseTime, h.IsClosed)
+			if err != nil {
+				log.Printf("Failed to insert business hours: %v", err)
+				jsonError(w, "failed to update hours", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Failed to commit business hours: %v", err)
+			jsonError(w, "failed to update hours", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithHours(w, db, businessID)
+	}
+}
+
+// SetSpecialHours replaces the special hours of a business (owner or
+// admin). Each entry sets either a date or a holiday key; an entry for a
+// date wins over a holiday on the same day.
+func SetSpecialHours(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var req []SpecialHourRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req) > maxSpecialHours {
+			jsonErrorf(w, "at most %d special hours", http.StatusBadRequest, maxSpecialHours)
+			return
+		}
+
+		seen := map[string]bool{}
+		for i := range req {
+			h := &req[i]
+			var key string
+			switch {
+			case h.Date != nil && h.Holiday != nil, h.Date == nil && h.Holiday == nil:
+				jsonError(w, "each entry needs either date or holiday", http.StatusBadRequest)
+				return
+			case h.Date != nil:
+				if _, err := time.Parse("2006-01-02", *h.Date); err != nil {
+					jsonErrorf(w, "invalid date %q, use YYYY-MM-DD", http.StatusBadRequest, *h.Date)
+					return
+				}
+				key = "date:" + *h.Date
+			default:
+				exists, err := holidays.KeyExists(r.Context(), db, *h.Holiday)
+				if err != nil {
+					log.Printf("Failed to look up holiday: %v", err)
+					jsonError(w, "failed to update special hours", http.StatusInternalServerError)
+					return
+				}
+				if !exists {
+					jsonErrorf(w, "unknown holiday %q", http.StatusBadRequest, *h.Holiday)
+					return
+				}
+				key = "holiday:" + *h.Holiday
+			}
+			if seen[key] {
+				jsonErrorf(w, "%s is listed twice", http.StatusBadRequest, strings.SplitN(key, ":", 2)[1])
+				return
+			}
+			seen[key] = true
+
+			var err error
+			if h.OpenTime, h.CloseTime, err = cleanOpeningSpan(h.OpenTime, h.CloseTime, h.IsClosed); err != nil {
+				jsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if h.Note != nil {
+				note := strings.TrimSpace(*h.Note)
+				if len([]rune(note)) > 255 {
+					jsonError(w, "note must be at most 255 characters", http.StatusBadRequest)
+					return
+				}
+				h.Note = &note
+				if note == "" {
+					h.Note = nil
+				}
+			}
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Failed to begin special hours update: %v", err)
+			jsonError(w, "failed to update special hours", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM business_special_hours WHERE business_id = $1`, businessID); err != nil {
+			log.Printf("Failed to clear special hours: %v", err)
+			jsonError(w, "failed to update special hours", http.StatusInternalServerError)
+			return
+		}
+		for _, h := range req {
+			_, err := tx.Exec(`
+				INSERT INTO business_special_hours (business_id, date, holiday, open_time, close_time, is_closed, note)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, businessID, h.Date, h.Holiday, h.OpenTime, h.CloseTime, h.IsClosed, h.Note)
+			if err != nil {
+				log.Printf("Failed to insert special hours: %v", err)
+				jsonError(w, "failed to update special hours", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Failed to commit special hours: %v", err)
+			jsonError(w, "failed to update special hours", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithHours(w, db, businessID)
+	}
+}
+
+// cleanOpeningSpan validates the times of an open day as HH:MM and drops
+// them for a closed one
+func cleanOpeningSpan(openTime, closeTime *string, isClosed bool) (*string, *string, error) {
+	if isClosed {
+		return nil, nil, nil
+	}
+	if openTime == nil || closeTime == nil {
+		return nil, nil, fmt.Errorf("open_time and close_time are required unless is_closed")
+	}
+	opens, err := parseClockTime(*openTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	closes, err := parseClockTime(*closeTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &opens, &closes, nil
+}
+
+func parseClockTime(s string) (string, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t.Format("15:04"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid time %q, use HH:MM", s)
+}
+
+// respondWithHours writes the hours of a business
+func respondWithHours(w http.ResponseWriter, db *sql.DB, businessID string) {
+	var resp BusinessHoursResp
+	var nextChange sql.NullTime
+	err := db.QueryRow(`SELECT `+openStatusColumns("b.id")+` FROM businesses b WHERE b.id = $1`,
+		businessID).Scan(&resp.IsOpenNow, &nextChange)
+	if err == sql.ErrNoRows {
+		jsonError(w, "business not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get open status: %v", err)
+		jsonError(w, "failed to get hours", http.StatusInternalServerError)
+		return
+	}
+	resp.NextChangeAt = formatNextChange(nextChange)
+
+	if resp.Hours, err = loadBusinessHours(db, businessID); err != nil {
+		log.Printf("Failed to get business hours: %v", err)
+		jsonError(w, "failed to get hours", http.StatusInternalServerError)
+		return
+	}
+	if resp.SpecialHours, err = loadSpecialHours(db, businessID); err != nil {
+		log.Printf("Failed to get special hours: %v", err)
+		jsonError(w, "failed to get hours", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, resp, http.StatusOK)
+}
+
+// loadBusinessHours returns the weekly hours, Sunday first
+func loadBusinessHours(db *sql.DB, businessID string) ([]BusinessHourResp, error) {
+	rows, err := db.Query(`
+		SELECT day_of_week, to_char(open_time, 'HH24:MI'), to_char(close_time, 'HH24:MI'), COALESCE(is_closed, FALSE)
+		FROM business_hours WHERE business_id = $1 ORDER BY day_of_week
+	`, businessID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := []BusinessHourResp{}
+	for rows.Next() {
+		var h BusinessHourResp
+		var openTime, closeTime sql.NullString
+		if err := rows.Scan(&h.DayOfWeek, &openTime, &closeTime, &h.IsClosed); err != nil {
+			return nil, err
+		}
+		if openTime.Valid {
+			h.OpenTime = &openTime.String
+		}
+		if closeTime.Valid {
+			h.CloseTime = &closeTime.String
+		}
+		hours = append(hours, h)
+	}
+	return hours, rows.Err()
+}
+
+// loadSpecialHours returns the special hours from today on (Addis Ababa
+// time), by date or next holiday occurrence
+func loadSpecialHours(db *sql.DB, businessID string) ([]SpecialHourResp, error) {
+	today := time.Now().In(addisTime).Format("2006-01-02")
+	rows, err := db.Query(`
+		SELECT sh.id, sh.date::text, sh.holiday, hd.name, hd.date::text,
+			to_char(sh.open_time, 'HH24:MI'), to_char(sh.close_time, 'HH24:MI'), sh.is_closed, sh.note
+		FROM business_special_hours sh
+		LEFT JOIN LATERAL (
+			SELECT name, date FROM holiday_dates
+			WHERE key = sh.holiday AND date >= $2
+			ORDER BY date LIMIT 1
+		) hd ON TRUE
+		WHERE sh.business_id = $1 AND (sh.date IS NULL OR sh.date >= $2)
+		ORDER BY COALESCE(sh.date, hd.date) NULLS LAST, sh.holiday
+	`, businessID, today)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []SpecialHourResp{}
+	for rows.Next() {
+		var h SpecialHourResp
+		var date, holiday, holidayName, nextDate, openTime, closeTime, note sql.NullString
+		if err := rows.Scan(&h.ID, &date, &holiday, &holidayName, &nextDate,
+			&openTime, &closeTime, &h.IsClosed, &note); err != nil {
+			return nil, err
+		}
+		if date.Valid {
+			h.Date = &date.String
+		}
+		if holiday.Valid {
+			h.Holiday = &holiday.String
+		}
+		if holidayName.Valid {
+			h.HolidayName = &holidayName.String
+		}
+		if nextDate.Valid {
+			h.NextDate = &nextDate.String
+		}
+		if openTime.Valid {
+			h.OpenTime = &openTime.String
+		}
+		if closeTime.Valid {
+			h.CloseTime = &closeTime.String
+		}
+		if note.Valid {
+			h.Note = &note.String
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"maps/api/internal/media"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxBusinessMedia caps the gallery size of a business
+	maxBusinessMedia = 50
+	// maxCaptionLength caps media captions, in characters
+	maxCaptionLength = 500
+)
+
+// AttachMediaRequest attaches an upload (see POST /api/upload) to a business
+type AttachMediaRequest struct {
+	URL          string  `json:"url"`
+	ThumbnailURL *string `json:"thumbnail_url,omitempty"`
+	Caption      *string `json:"caption,omitempty"`
+	IsCover      bool    `json:"is_cover"`
+}
+
+// UpdateMediaRequest is the request body for editing a caption
+type UpdateMediaRequest struct {
+	Caption *string `json:"caption"`
+}
+
+// ReorderMediaRequest lists all media of a business in their new order
+type ReorderMediaRequest struct {
+	MediaIDs []string `json:"media_ids"`
+}
+
+const selectBusinessMedia = `
+	SELECT id, media_type, url, thumbnail_url, caption, sort_order, is_cover
+	FROM business_media`
+
+func scanMedia(s rowScanner) (*MediaResp, error) {
+	var m MediaResp
+	var thumbURL, caption sql.NullString
+	var sortOrder sql.NullInt64
+	if err := s.Scan(&m.ID, &m.MediaType, &m.URL, &thumbURL, &caption, &sortOrder, &m.IsCover); err != nil {
+		return nil, err
+	}
+	if thumbURL.Valid {
+		m.ThumbnailURL = &thumbURL.String
+	}
+	if caption.Valid {
+		m.Caption = &caption.String
+	}
+	m.SortOrder = int(sortOrder.Int64)
+	return &m, nil
+}
+
+// loadBusinessMedia returns the gallery of a business, cover first
+func loadBusinessMedia(db *sql.DB, businessID string) ([]MediaResp, error) {
+	rows, err := db.Query(selectBusinessMedia+`
+		WHERE business_id = $1
+		ORDER BY is_cover DESC, sort_order, created_at
+	`, businessID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []MediaResp{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *m)
+	}
+	return list, rows.Err()
+}
+
+// ListBusinessMedia returns the photos and videos of a business
+func ListBusinessMedia(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		businessID := chi.URLParam(r, "id")
+		list, err := loadBusinessMedia(db, businessID)
+		if err != nil {
+			log.Printf("Failed to get business media: %v", err)
+			jsonError(w, "failed to get media", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, map[string]interface{}{
+			"media": list,
+			"count": len(list),
+		}, http.StatusOK)
+	}
+}
+
+// AttachBusinessMedia adds one of the user's uploads to the gallery of a
+// business (owner or admin). New media go to the end of the gallery.
+func AttachBusinessMedia(db *sql.DB, uploads *media.Uploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var req AttachMediaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.URL == "" {
+			jsonError(w, "url is required", http.StatusBadRequest)
+			return
+		}
+		caption, ok := cleanCaption(w, req.Caption)
+		if !ok {
+			return
+		}
+
+		upload, err := uploads.Owned(r.Context(), req.URL, userID)
+		if err == media.ErrNotFound {
+			jsonError(w, "url must be one of your uploads", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get upload: %v", err)
+			jsonError(w, "failed to attach media", http.StatusInternalServerError)
+			return
+		}
+		if req.ThumbnailURL != nil {
+			if _, err := uploads.Owned(r.Context(), *req.ThumbnailURL, userID); err != nil {
+				jsonError(w, "thumbnail_url must be one of your uploads", http.StatusBadRequest)
+				return
+			}
+		}
+		mediaType := upload.MediaType()
+		if req.IsCover && mediaType != "photo" {
+			jsonError(w, "only photos can be the cover", http.StatusBadRequest)
+			return
+		}
+
+		var mediaID string
+		err = func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			// Concurrent attaches to the business wait here, so each one
+			// counts the others' media
+			if _, err := tx.Exec(`SELECT 1 FROM businesses WHERE id = $1 FOR NO KEY UPDATE`, businessID); err != nil {
+				return err
+			}
+			err = tx.QueryRow(`
+				INSERT INTO business_media (business_id, media_type, url, thumbnail_url, caption, sort_order, uploaded_by)
+				SELECT $1, $2, $3, $4, $5, COALESCE(MAX(sort_order) + 1, 0), $6
+				FROM business_media WHERE business_id = $1
+				HAVING COUNT(*) < $7
+				RETURNING id
+			`, businessID, mediaType, upload.URL, req.ThumbnailURL, caption, userID, maxBusinessMedia).Scan(&mediaID)
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		}()
+		if err == sql.ErrNoRows {
+			jsonErrorf(w, "a business can have at most %d photos and videos", http.StatusBadRequest, maxBusinessMedia)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to attach media: %v", err)
+			jsonError(w, "failed to attach media", http.StatusInternalServerError)
+			return
+		}
+
+		if req.IsCover {
+			if err := setCover(db, businessID, mediaID); err != nil {
+				log.Printf("Failed to set cover: %v", err)
+				jsonError(w, "failed to set cover", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		respondWithMedia(w, db, businessID, mediaID, http.StatusCreated)
+	}
+}
+
+// UpdateBusinessMedia edits the caption of a photo or video (owner or admin)
+func UpdateBusinessMedia(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		mediaID := chi.URLParam(r, "mediaId")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var req UpdateMediaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		caption, ok := cleanCaption(w, req.Caption)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE business_media SET caption = $1 WHERE id = $2 AND business_id = $3
+		`, caption, mediaID, businessID)
+		if err != nil {
+			log.Printf("Failed to update media: %v", err)
+			jsonError(w, "failed to update media", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, "media not found", http.StatusNotFound)
+			return
+		}
+
+		respondWithMedia(w, db, businessID, mediaID, http.StatusOK)
+	}
+}
+
+// ReorderBusinessMedia sets the gallery order (owner or admin). The request
+// must list every photo and video of the business exactly once.
+func ReorderBusinessMedia(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var req ReorderMediaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		current, err := loadBusinessMedia(db, businessID)
+		if err != nil {
+			log.Printf("Failed to get business media: %v", err)
+			jsonError(w, "failed to reorder media", http.StatusInternalServerError)
+			return
+		}
+		known := map[string]bool{}
+		for _, m := range current {
+			known[m.ID] = true
+		}
+		listed := map[string]bool{}
+		for _, id := range req.MediaIDs {
+			if !known[id] || listed[id] {
+				jsonErrorf(w, "unknown or repeated media id %q", http.StatusBadRequest, id)
+				return
+			}
+			listed[id] = true
+		}
+		if len(listed) != len(known) {
+			jsonError(w, "media_ids must list every photo and video of the business", http.StatusBadRequest)
+			return
+		}
+
+		_, err = db.Exec(`
+			UPDATE business_media SET sort_order = array_position($2::uuid[], id) - 1
+			WHERE business_id = $1
+		`, businessID, pq.Array(req.MediaIDs))
+		if err != nil {
+			log.Printf("Failed to reorder media: %v", err)
+			jsonError(w, "failed to reorder media", http.StatusInternalServerError)
+			return
+		}
+
+		list, err := loadBusinessMedia(db, businessID)
+		if err != nil {
+			log.Printf("Failed to get business media: %v", err)
+			jsonError(w, "failed to get media", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, map[string]interface{}{
+			"media": list,
+			"count": len(list),
+		}, http.StatusOK)
+	}
+}
+
+// SetBusinessCover makes a photo the cover of a business (owner or admin)
+func SetBusinessCover(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		mediaID := chi.URLParam(r, "mediaId")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var mediaType string
+		err := db.QueryRow(`
+			SELECT media_type FROM business_media WHERE id = $1 AND business_id = $2
+		`, mediaID, businessID).Scan(&mediaType)
+		if err == sql.ErrNoRows {
+			jsonError(w, "media not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get media: %v", err)
+			jsonError(w, "failed to set cover", http.StatusInternalServerError)
+			return
+		}
+		if mediaType != "photo" {
+			jsonError(w, "only photos can be the cover", http.StatusBadRequest)
+			return
+		}
+
+		if err := setCover(db, businessID, mediaID); err != nil {
+			log.Printf("Failed to set cover: %v", err)
+			jsonError(w, "failed to set cover", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithMedia(w, db, businessID, mediaID, http.StatusOK)
+	}
+}
+
+// DeleteBusinessMedia removes a photo or video from the gallery (owner or
+// admin). The file itself is removed by the uploads cleanup.
+func DeleteBusinessMedia(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		mediaID := chi.URLParam(r, "mediaId")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		res, err := db.Exec(`DELETE FROM business_media WHERE id = $1 AND business_id = $2`, mediaID, businessID)
+		if err != nil {
+			log.Printf("Failed to delete media: %v", err)
+			jsonError(w, "failed to delete media", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, "media not found", http.StatusNotFound)
+			return
+		}
+
+		jsonResponse(w, map[string]string{"message": "media deleted"}, http.StatusOK)
+	}
+}
+
+// setCover moves the cover flag of a business to one of its photos. The old
+// cover is cleared first so the one-cover index holds at every step.
+func setCover(db *sql.DB, businessID, mediaID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE business_media SET is_cover = FALSE WHERE business_id = $1 AND is_cover
+	`, businessID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE business_media SET is_cover = TRUE WHERE id = $1 AND business_id = $2
+	`, mediaID, businessID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// cleanCaption trims a caption and enforces maxCaptionLength. Empty text
+// becomes nil.
+func cleanCaption(w http.ResponseWriter, caption *string) (*string, bool) {
+	if caption == nil {
+		return nil, true
+	}
+	s := strings.TrimSpace(*caption)
+	if len([]rune(s)) > maxCaptionLength {
+		jsonErrorf(w, "caption must be at most %d characters", http.StatusBadRequest, maxCaptionLength)
+		return nil, false
+	}
+	if s == "" {
+		return nil, true
+	}
+	return &s, true
+}
+
+// respondWithMedia writes a single gallery item
+func respondWithMedia(w http.ResponseWriter, db *sql.DB, businessID, mediaID string, status int) {
+	m, err := scanMedia(db.QueryRow(selectBusinessMedia+` WHERE id = $1 AND business_id = $2`, mediaID, businessID))
+	if err == sql.ErrNoRows {
+		jsonError(w, "media not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get media: %v", err)
+		jsonError(w, "failed to get media", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, m, status)
+}
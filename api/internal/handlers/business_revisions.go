@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Business revisions are written by a trigger on businesses (migration
+// 0018); the API only says who made the changes of a transaction.
+
+// tagRevision attributes the business revisions written in tx to actorID
+// ("" for none) and source: owner, admin, publish or import
+func tagRevision(tx *sql.Tx, actorID, source, note string) error {
+	_, err := tx.Exec(`
+		SELECT set_config('app.actor_id', $1, true),
+			set_config('app.change_source', $2, true),
+			set_config('app.change_note', $3, true)
+	`, actorID, source, note)
+	return err
+}
+
+// BusinessRevisionResp is a change to a business
+type BusinessRevisionResp struct {
+	Revision  int             `json:"revision"`
+	ActorID   *string         `json:"actor_id,omitempty"`
+	ActorName *string         `json:"actor_name,omitempty"`
+	Source    string          `json:"source"` // owner, admin, publish, import, system
+	Note      *string         `json:"note,omitempty"`
+	Changes   json.RawMessage `json:"changes"`            // {"field": {"old": ..., "new": ...}}
+	Snapshot  json.RawMessage `json:"snapshot,omitempty"` // the fields after the change
+	CreatedAt string          `json:"created_at"`
+}
+
+const selectBusinessRevisions = `
+	SELECT r.revision, r.actor_id, u.name, r.source, r.note, r.changes, r.snapshot, r.created_at
+	FROM business_revisions r
+	LEFT JOIN users u ON u.id = r.actor_id`
+
+func scanBusinessRevision(s rowScanner) (*BusinessRevisionResp, error) {
+	var rv BusinessRevisionResp
+	var actorID, actorName, note sql.NullString
+	var changes, snapshot []byte
+	var createdAt time.Time
+	err := s.Scan(&rv.Revision, &actorID, &actorName, &rv.Source, &note, &changes, &snapshot, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	rv.ActorID = nullStringPtr(actorID)
+	rv.ActorName = nullStringPtr(actorName)
+	rv.Note = nullStringPtr(note)
+	rv.Changes = json.RawMessage(changes)
+	rv.Snapshot = json.RawMessage(snapshot)
+	rv.CreatedAt = createdAt.Format(time.RFC3339)
+	return &rv, nil
+}
+
+// ListBusinessRevisions returns the edit history of a business, newest
+// first, to its owner or an admin. ?before=<revision> pages back.
+func ListBusinessRevisions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		where := ` WHERE r.business_id = $1`
+		args := []interface{}{businessID}
+		if v := r.URL.Query().Get("before"); v != "" {
+			before, err := strconv.Atoi(v)
+			if err != nil {
+				jsonError(w, "before must be a revision number", http.StatusBadRequest)
+				return
+			}
+			where += ` AND r.revision < $2`
+			args = append(args, before)
+		}
+
+		rows, err := db.Query(selectBusinessRevisions+where+` ORDER BY r.revision DESC LIMIT 50`, args...)
+		if err != nil {
+			log.Printf("Failed to get business revisions: %v", err)
+			jsonError(w, "failed to get history", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		revisions := []BusinessRevisionResp{}
+		for rows.Next() {
+			rv, err := scanBusinessRevision(rows)
+			if err != nil {
+				log.Printf("Error scanning business revision: %v", err)
+				continue
+			}
+			rv.Snapshot = nil
+			revisions = append(revisions, *rv)
+		}
+		jsonResponse(w, map[string]interface{}{
+			"revisions": revisions,
+			"count":     len(revisions),
+		}, http.StatusOK)
+	}
+}
+
+// GetBusinessRevision returns a revision with the full snapshot, to the
+// business owner or an admin
+func GetBusinessRevision(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		rv, ok := loadBusinessRevision(w, r, db, businessID)
+		if !ok {
+			return
+		}
+		jsonResponse(w, rv, http.StatusOK)
+	}
+}
+
+// RevertBusinessRevision sets the fields of a business back to what they
+// were after a revision. It is an edit like UpdateBusiness: an owner's
+// name, category and location changes wait for an admin. Status and owner
+// aren't reverted; they change through moderation and claims.
+func RevertBusinessRevision(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		status, admin, ok := businessEditor(w, db, businessID, userID)
+		if !ok {
+			return
+		}
+
+		rv, ok := loadBusinessRevision(w, r, db, businessID)
+		if !ok {
+			return
+		}
+		var target UpdateBusinessRequest
+		if err := json.Unmarshal(rv.Snapshot, &target); err != nil {
+			log.Printf("Invalid snapshot of business %s revision %d: %v", businessID, rv.Revision, err)
+			jsonError(w, "failed to revert business", http.StatusInternalServerError)
+			return
+		}
+		current, err := loadBusinessFields(db, businessID)
+		if err != nil {
+			log.Printf("Failed to get business: %v", err)
+			jsonError(w, "failed to revert business", http.StatusInternalServerError)
+			return
+		}
+
+		req := revertEdit(current, target)
+		if req.isEmpty() {
+			jsonResponse(w, map[string]string{"message": "business already matches this revision"}, http.StatusOK)
+			return
+		}
+		editBusiness(w, r, db, businessID, userID, status, admin, req, fmt.Sprintf("revert to revision %d", rv.Revision))
+	}
+}
+
+// loadBusinessRevision reads the {revision} of a business. It writes the
+// error response on failure.
+func loadBusinessRevision(w http.ResponseWriter, r *http.Request, db *sql.DB, businessID string) (*BusinessRevisionResp, bool) {
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil {
+		jsonError(w, "invalid revision", http.StatusBadRequest)
+		return nil, false
+	}
+	rv, err := scanBusinessRevision(db.QueryRow(selectBusinessRevisions+`
+		WHERE r.business_id = $1 AND r.revision = $2
+	`, businessID, revision))
+	if err == sql.ErrNoRows {
+		jsonError(w, "revision not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to get business revision: %v", err)
+		jsonError(w, "failed to get revision", http.StatusInternalServerError)
+		return nil, false
+	}
+	return rv, true
+}
+
+// revertEdit returns the edit that turns current into target. Fields that
+// were null are set to "", which businessUpdateQuery stores as NULL; a
+// category can't be removed, so it is kept.
+func revertEdit(current, target UpdateBusinessRequest) UpdateBusinessRequest {
+	var req UpdateBusinessRequest
+	revert := func(current, target *string) *string {
+		var cur, want string
+		if current != nil {
+			cur = *current
+		}
+		if target != nil {
+			want = *target
+		}
+		if cur == want {
+			return nil
+		}
+		return &want
+	}
+	req.Name = revert(current.Name, target.Name)
+	req.NameAm = revert(current.NameAm, target.NameAm)
+	req.Description = revert(current.Description, target.Description)
+	req.DescriptionAm = revert(current.DescriptionAm, target.DescriptionAm)
+	if target.CategoryID != nil {
+		req.CategoryID = revert(current.CategoryID, target.CategoryID)
+	}
+	req.Phone = revert(current.Phone, target.Phone)
+	req.Email = revert(current.Email, target.Email)
+	req.Website = revert(current.Website, target.Website)
+	if target.Lat != nil && target.Lng != nil && (*target.Lat != *current.Lat || *target.Lng != *current.Lng) {
+		req.Lat, req.Lng = target.Lat, target.Lng
+	}
+	req.Address = revert(current.Address, target.Address)
+	req.AddressAm = revert(current.AddressAm, target.AddressAm)
+	return req
+}
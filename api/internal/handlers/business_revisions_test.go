@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRevertEditClearsNullFields(t *testing.T) {
+	name, phone, website := "Tomoca", "+251 11 111 1111", "https://tomoca.et"
+	current := UpdateBusinessRequest{Name: &name, Phone: &phone, Website: &website}
+	target := UpdateBusinessRequest{Name: &name, Website: &website}
+
+	req := revertEdit(current, target)
+	if req.Name != nil || req.Website != nil {
+		t.Errorf("unchanged fields are part of the edit: %+v", req)
+	}
+	if req.Phone == nil {
+		t.Fatal("phone missing from the edit")
+	}
+
+	query, args := businessUpdateQuery("business-1", req, nil)
+	if !strings.Contains(query, "phone = NULLIF($1, '')") {
+		t.Errorf("query %q doesn't clear phone to NULL", query)
+	}
+	if len(args) != 2 || args[0] != "" || args[1] != "business-1" {
+		t.Errorf("args = %v", args)
+	}
+}
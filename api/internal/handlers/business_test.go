@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSearchRegionClause(t *testing.T) {
+	conn := openTestDB(t)
+
+	for _, q := range []string{
+		`INSERT INTO regions (slug, name, country_code, geom, is_active)
+		VALUES ('test-handlers-open', 'Open', 'ET', ST_Multi(ST_MakeEnvelope(0.10, 0.10, 0.12, 0.12, 4326)), true)`,
+		`INSERT INTO regions (slug, name, country_code, geom, is_active)
+		VALUES ('test-handlers-closed', 'Closed', 'ET', ST_Multi(ST_MakeEnvelope(0.13, 0.13, 0.15, 0.15, 4326)), false)`,
+	} {
+		if _, err := conn.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var openID string
+	if err := conn.QueryRow(`SELECT id FROM regions WHERE slug = 'test-handlers-open'`).Scan(&openID); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{
+		insertTestBusiness(t, conn, "In open region", 0.11, 0.11):   "open",
+		insertTestBusiness(t, conn, "In closed region", 0.14, 0.14): "closed",
+		insertTestBusiness(t, conn, "Outside regions", 0.18, 0.18):  "outside",
+	}
+
+	for _, tc := range []struct {
+		name            string
+		slug, locatedID string
+		want            []string
+	}{
+		{name: "any active region", want: []string{"open"}},
+		{name: "explicit region", slug: "test-handlers-closed", want: []string{"closed"}},
+		{name: "located region", locatedID: openID, want: []string{"open"}},
+		{name: "explicit wins", slug: "test-handlers-closed", locatedID: openID, want: []string{"closed"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var args sqlArgs
+			clause := searchRegionClause(&args, tc.slug, tc.locatedID)
+			area := args.add(testArea)
+			rows, err := conn.Query(`
+				SELECT b.id FROM businesses b
+				WHERE `+clause+` AND ST_Contains(ST_GeomFromText(`+area+`, 4326), b.geom)
+			`, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			var got []string
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, ids[id])
+			}
+			sort.Strings(got)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("got %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// transferTTL is how long the recipient has to accept a transfer
+const transferTTL = 7 * 24 * time.Hour
+
+var errNoPendingTransfer = errors.New("no pending transfer")
+
+// StartTransferRequest is the request body for handing a business to
+// another user, who is identified by phone number or id
+type StartTransferRequest struct {
+	Phone  *string `json:"phone,omitempty"`
+	UserID *string `json:"user_id,omitempty"`
+}
+
+// TransferResp is an ownership transfer
+type TransferResp struct {
+	ID           string  `json:"id"`
+	BusinessID   string  `json:"business_id"`
+	BusinessName string  `json:"business_name"`
+	FromUserID   *string `json:"from_user_id,omitempty"`
+	FromUserName *string `json:"from_user_name,omitempty"`
+	ToUserID     string  `json:"to_user_id"`
+	ToUserName   *string `json:"to_user_name,omitempty"`
+	Status       string  `json:"status"`
+	ExpiresAt    string  `json:"expires_at"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// OwnershipEventResp is an entry of a business's ownership history
+type OwnershipEventResp struct {
+	ID         string  `json:"id"`
+	Action     string  `json:"action"`
+	ActorID    *string `json:"actor_id,omitempty"`
+	ActorName  *string `json:"actor_name,omitempty"`
+	FromUserID *string `json:"from_user_id,omitempty"`
+	ToUserID   *string `json:"to_user_id,omitempty"`
+	ClaimID    *string `json:"claim_id,omitempty"`
+	TransferID *string `json:"transfer_id,omitempty"`
+	Note       *string `json:"note,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+const selectTransfers = `
+	SELECT t.id, t.business_id, b.name, t.from_user_id, fu.name, t.to_user_id, tu.name,
+		t.status, t.expires_at, t.created_at
+	FROM business_ownership_transfers t
+	JOIN businesses b ON b.id = t.business_id
+	LEFT JOIN users fu ON fu.id = t.from_user_id
+	JOIN users tu ON tu.id = t.to_user_id`
+
+func scanTransfer(s rowScanner) (*TransferResp, error) {
+	var t TransferResp
+	var fromUserID, fromUserName, toUserName sql.NullString
+	var expiresAt, createdAt time.Time
+	err := s.Scan(&t.ID, &t.BusinessID, &t.BusinessName, &fromUserID, &fromUserName, &t.ToUserID, &toUserName,
+		&t.Status, &expiresAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if fromUserID.Valid {
+		t.FromUserID = &fromUserID.String
+	}
+	if fromUserName.Valid {
+		t.FromUserName = &fromUserName.String
+	}
+	if toUserName.Valid {
+		t.ToUserName = &toUserName.String
+	}
+	if t.Status == "pending" && time.Now().After(expiresAt) {
+		t.Status = "expired"
+	}
+	t.ExpiresAt = expiresAt.Format(time.RFC3339)
+	t.CreatedAt = createdAt.Format(time.RFC3339)
+	return &t, nil
+}
+
+// StartOwnershipTransfer offers a business to another user (owner or
+// admin). It changes hands once the recipient accepts.
+func StartOwnershipTransfer(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var req StartTransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var toUserID string
+		var err error
+		switch {
+		case req.UserID != nil && uuidRegex.MatchString(*req.UserID):
+			err = db.QueryRow(`SELECT id FROM users WHERE id = $1`, *req.UserID).Scan(&toUserID)
+		case req.Phone != nil && phoneRegex.MatchString(*req.Phone):
+			err = db.QueryRow(`SELECT id FROM users WHERE phone = $1`, normalizePhone(*req.Phone)).Scan(&toUserID)
+		default:
+			jsonError(w, "phone or user_id of the new owner is required", http.StatusBadRequest)
+			return
+		}
+		if err == sql.ErrNoRows {
+			jsonError(w, "new owner not found; they need to sign up first", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to find user: %v", err)
+			jsonError(w, "failed to start transfer", http.StatusInternalServerError)
+			return
+		}
+
+		var ownerID sql.NullString
+		db.QueryRow(`SELECT owner_id FROM businesses WHERE id = $1`, businessID).Scan(&ownerID)
+		if ownerID.Valid && ownerID.String == toUserID {
+			jsonError(w, "user already owns this business", http.StatusBadRequest)
+			return
+		}
+		var fromUserID *string
+		if ownerID.Valid {
+			fromUserID = &ownerID.String
+		}
+
+		db.Exec(`
+			UPDATE business_ownership_transfers SET status = 'expired', resolved_at = NOW()
+			WHERE business_id = $1 AND status = 'pending' AND expires_at < NOW()
+		`, businessID)
+
+		var transferID string
+		err = db.QueryRow(`
+			INSERT INTO business_ownership_transfers (business_id, from_user_id, to_user_id, created_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, businessID, fromUserID, toUserID, userID, time.Now().Add(transferTTL)).Scan(&transferID)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			jsonError(w, "a transfer of this business is already pending; cancel it first", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to start transfer: %v", err)
+			jsonError(w, "failed to start transfer", http.StatusInternalServerError)
+			return
+		}
+
+		logOwnershipEvent(db, ownershipEvent{
+			businessID: businessID, action: "transfer_started", actorID: userID,
+			fromUserID: fromUserID, toUserID: &toUserID, transferID: &transferID,
+		})
+		respondWithTransfer(w, db, transferID, http.StatusCreated)
+	}
+}
+
+// AcceptOwnershipTransfer makes the recipient of the pending transfer the
+// owner. Open claims of the business are rejected.
+func AcceptOwnershipTransfer(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+
+		var transferID string
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			var fromUserID sql.NullString
+			err = tx.QueryRow(`
+				SELECT id, from_user_id FROM business_ownership_transfers
+				WHERE business_id = $1 AND to_user_id = $2 AND status = 'pending' AND expires_at > NOW()
+				FOR UPDATE
+			`, businessID, userID).Scan(&transferID, &fromUserID)
+			if err == sql.ErrNoRows {
+				return errNoPendingTransfer
+			}
+			if err != nil {
+				return err
+			}
+			var from *string
+			if fromUserID.Valid {
+				from = &fromUserID.String
+			}
+
+			if err := tagRevision(tx, userID, "owner", "transfer "+transferID); err != nil {
+				return err
+			}
+			changed, err := changeOwner(tx, businessID, from, userID)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				return errBusinessOwned
+			}
+			if _, err := tx.Exec(`
+				UPDATE business_ownership_transfers SET status = 'accepted', resolved_at = NOW() WHERE id = $1
+			`, transferID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`
+				UPDATE business_claims
+				SET status = 'rejected', review_note = 'business was transferred', resolved_at = NOW(), otp_code = NULL
+				WHERE business_id = $1 AND status = 'pending'
+			`, businessID); err != nil {
+				return err
+			}
+			if err := recordOwnershipEvent(tx, ownershipEvent{
+				businessID: businessID, action: "transfer_accepted", actorID: userID,
+				fromUserID: from, toUserID: &userID, transferID: &transferID,
+			}); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}()
+
+		switch err {
+		case nil:
+			respondWithTransfer(w, db, transferID, http.StatusOK)
+		case errNoPendingTransfer:
+			jsonError(w, "no pending transfer to you for this business", http.StatusNotFound)
+		case errBusinessOwned:
+			// The owner changed since the transfer was offered
+			resolveTransfer(db, transferID, "cancelled", "transfer_cancelled", userID)
+			jsonError(w, "business changed owner since the transfer was offered", http.StatusConflict)
+		default:
+			log.Printf("Failed to accept transfer: %v", err)
+			jsonError(w, "failed to accept transfer", http.StatusInternalServerError)
+		}
+	}
+}
+
+// DeclineOwnershipTransfer turns down the pending transfer to the user
+func DeclineOwnershipTransfer(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var transferID string
+		err := db.QueryRow(`
+			SELECT id FROM business_ownership_transfers
+			WHERE business_id = $1 AND to_user_id = $2 AND status = 'pending'
+		`, chi.URLParam(r, "id"), userID).Scan(&transferID)
+		if err == nil {
+			err = resolveTransfer(db, transferID, "declined", "transfer_declined", userID)
+		}
+		writeTransferResolution(w, err, "transfer declined")
+	}
+}
+
+// CancelOwnershipTransfer withdraws the pending transfer of a business
+// (owner or admin)
+func CancelOwnershipTransfer(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var transferID string
+		err := db.QueryRow(`
+			SELECT id FROM business_ownership_transfers WHERE business_id = $1 AND status = 'pending'
+		`, businessID).Scan(&transferID)
+		if err == nil {
+			err = resolveTransfer(db, transferID, "cancelled", "transfer_cancelled", userID)
+		}
+		writeTransferResolution(w, err, "transfer cancelled")
+	}
+}
+
+// ListMyTransfers returns the pending transfers to and from the user
+func ListMyTransfers(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(selectTransfers+`
+			WHERE (t.to_user_id = $1 OR t.from_user_id = $1)
+			AND t.status = 'pending' AND t.expires_at > NOW()
+			ORDER BY t.created_at DESC
+		`, userID)
+		if err != nil {
+			log.Printf("Failed to get transfers: %v", err)
+			jsonError(w, "failed to get transfers", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		incoming, outgoing := []TransferResp{}, []TransferResp{}
+		for rows.Next() {
+			t, err := scanTransfer(rows)
+			if err != nil {
+				log.Printf("Error scanning transfer: %v", err)
+				continue
+			}
+			if t.ToUserID == userID {
+				incoming = append(incoming, *t)
+			} else {
+				outgoing = append(outgoing, *t)
+			}
+		}
+		jsonResponse(w, map[string]interface{}{
+			"incoming": incoming,
+			"outgoing": outgoing,
+		}, http.StatusOK)
+	}
+}
+
+// GetOwnershipHistory returns the ownership audit trail of a business,
+// newest first (owner or admin)
+func GetOwnershipHistory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT e.id, e.action, e.actor_id, u.name, e.from_user_id, e.to_user_id,
+				e.claim_id, e.transfer_id, e.note, e.created_at
+			FROM business_ownership_events e
+			LEFT JOIN users u ON u.id = e.actor_id
+			WHERE e.business_id = $1
+			ORDER BY e.created_at DESC
+			LIMIT 200
+		`, businessID)
+		if err != nil {
+			log.Printf("Failed to get ownership history: %v", err)
+			jsonError(w, "failed to get ownership history", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		events := []OwnershipEventResp{}
+		for rows.Next() {
+			var e OwnershipEventResp
+			var actorID, actorName, fromUserID, toUserID, claimID, transferID, note sql.NullString
+			var createdAt time.Time
+			if err := rows.Scan(&e.ID, &e.Action, &actorID, &actorName, &fromUserID, &toUserID,
+				&claimID, &transferID, &note, &createdAt); err != nil {
+				log.Printf("Error scanning ownership event: %v", err)
+				continue
+			}
+			e.ActorID = nullStringPtr(actorID)
+			e.ActorName = nullStringPtr(actorName)
+			e.FromUserID = nullStringPtr(fromUserID)
+			e.ToUserID = nullStringPtr(toUserID)
+			e.ClaimID = nullStringPtr(claimID)
+			e.TransferID = nullStringPtr(transferID)
+			e.Note = nullStringPtr(note)
+			e.CreatedAt = createdAt.Format(time.RFC3339)
+			events = append(events, e)
+		}
+		jsonResponse(w, map[string]interface{}{
+			"events": events,
+			"count":  len(events),
+		}, http.StatusOK)
+	}
+}
+
+// resolveTransfer closes a pending transfer without changing the owner
+func resolveTransfer(db *sql.DB, transferID, status, action, actorID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var businessID, toUserID string
+	var fromUserID sql.NullString
+	err = tx.QueryRow(`
+		UPDATE business_ownership_transfers SET status = $2, resolved_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING business_id, from_user_id, to_user_id
+	`, transferID, status).Scan(&businessID, &fromUserID, &toUserID)
+	if err == sql.ErrNoRows {
+		return errNoPendingTransfer
+	}
+	if err != nil {
+		return err
+	}
+	if err := recordOwnershipEvent(tx, ownershipEvent{
+		businessID: businessID, action: action, actorID: actorID,
+		fromUserID: nullStringPtr(fromUserID), toUserID: &toUserID, transferID: &transferID,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeTransferResolution responds to declining or cancelling a transfer
+func writeTransferResolution(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case nil:
+		jsonResponse(w, map[string]string{"message": message}, http.StatusOK)
+	case sql.ErrNoRows, errNoPendingTransfer:
+		jsonError(w, "no pending transfer for this business", http.StatusNotFound)
+	default:
+		log.Printf("Failed to resolve transfer: %v", err)
+		jsonError(w, "failed to update transfer", http.StatusInternalServerError)
+	}
+}
+
+// respondWithTransfer writes a single transfer
+func respondWithTransfer(w http.ResponseWriter, db *sql.DB, transferID string, status int) {
+	t, err := scanTransfer(db.QueryRow(selectTransfers+` WHERE t.id = $1`, transferID))
+	if err != nil {
+		log.Printf("Failed to get transfer: %v", err)
+		jsonError(w, "failed to get transfer", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, t, status)
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// transferRow scans fixed transfer columns, in selectTransfers order
+type transferRow struct {
+	status    string
+	expiresAt time.Time
+}
+
+func (r transferRow) Scan(dest ...interface{}) error {
+	*dest[0].(*string) = "t1"
+	*dest[1].(*string) = "b1"
+	*dest[2].(*string) = "Tomoca"
+	*dest[3].(*sql.NullString) = sql.NullString{String: "u1", Valid: true}
+	*dest[4].(*sql.NullString) = sql.NullString{}
+	*dest[5].(*string) = "u2"
+	*dest[6].(*sql.NullString) = sql.NullString{}
+	*dest[7].(*string) = r.status
+	*dest[8].(*time.Time) = r.expiresAt
+	*dest[9].(*time.Time) = r.expiresAt.Add(-transferTTL)
+	return nil
+}
+
+func TestScanTransferExpiry(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name      string
+		status    string
+		expiresAt time.Time
+		want      string
+	}{
+		{"pending in time", "pending", now.Add(time.Hour), "pending"},
+		{"pending past expiry", "pending", now.Add(-time.Minute), "expired"},
+		{"accepted past expiry", "accepted", now.Add(-time.Minute), "accepted"},
+		{"declined in time", "declined", now.Add(time.Hour), "declined"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, err := scanTransfer(transferRow{tc.status, tc.expiresAt})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tr.Status != tc.want {
+				t.Errorf("status = %s, want %s", tr.Status, tc.want)
+			}
+		})
+	}
+}
+
+func TestOwnershipTransfer(t *testing.T) {
+	conn := openTestDB(t)
+	businessID := insertTestBusiness(t, conn, "Changing hands", 0.15, 0.15)
+	ownerID := insertTestUser(t, conn, "+00000000011")
+	toID := insertTestUser(t, conn, "+00000000012")
+	for _, q := range []string{
+		`UPDATE users SET role = 'business_owner' WHERE id = $2`,
+		`UPDATE businesses SET owner_id = $2 WHERE id = $1`,
+	} {
+		if _, err := conn.Exec(q, businessID, ownerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := serveAs(StartOwnershipTransfer(conn), ownerID, `{"user_id":"`+toID+`"}`, "id", businessID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start: status %d: %s", w.Code, w.Body)
+	}
+	var expiresIn time.Duration
+	err := conn.QueryRow(`
+		SELECT EXTRACT(EPOCH FROM expires_at - NOW())::bigint FROM business_ownership_transfers
+		WHERE business_id = $1 AND status = 'pending'
+	`, businessID).Scan(&expiresIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresIn *= time.Second; expiresIn < transferTTL-time.Minute || expiresIn > transferTTL {
+		t.Errorf("transfer expires in %s, want %s", expiresIn, transferTTL)
+	}
+
+	// An expired offer can't be accepted
+	if _, err := conn.Exec(`
+		UPDATE business_ownership_transfers SET expires_at = NOW() - INTERVAL '1 minute'
+		WHERE business_id = $1 AND status = 'pending'
+	`, businessID); err != nil {
+		t.Fatal(err)
+	}
+	accept := AcceptOwnershipTransfer(conn)
+	if w := serveAs(accept, toID, "", "id", businessID); w.Code != http.StatusNotFound {
+		t.Fatalf("accept expired: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if _, err := conn.Exec(`
+		UPDATE business_ownership_transfers SET expires_at = NOW() + INTERVAL '1 hour'
+		WHERE business_id = $1 AND status = 'pending'
+	`, businessID); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveAs(accept, toID, "", "id", businessID); w.Code != http.StatusOK {
+		t.Fatalf("accept: status %d: %s", w.Code, w.Body)
+	}
+
+	var owner, ownerRole, toRole string
+	err = conn.QueryRow(`
+		SELECT b.owner_id, fu.role, tu.role
+		FROM businesses b, users fu, users tu
+		WHERE b.id = $1 AND fu.id = $2 AND tu.id = $3
+	`, businessID, ownerID, toID).Scan(&owner, &ownerRole, &toRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != toID || ownerRole != "user" || toRole != "business_owner" {
+		t.Errorf("after transfer: owner=%s previous role=%s new role=%s", owner, ownerRole, toRole)
+	}
+}
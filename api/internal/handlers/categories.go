@@ -0,0 +1,578 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"maps/api/internal/categories"
+	"maps/api/internal/search"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errCategoryNotFound = errors.New("category not found")
+	errParentNotFound   = errors.New("parent category not found")
+	errCategoryCycle    = errors.New("category can't be moved under itself")
+	errCategoryInUse    = errors.New("category in use")
+	errReassignNotFound = errors.New("reassign_to category not found")
+)
+
+// CategoryRequest creates a category, or updates one where omitted fields
+// are kept. An empty parent_id moves the category to the top level.
+type CategoryRequest struct {
+	Name      *string `json:"name"`
+	NameAm    *string `json:"name_am"`
+	Icon      *string `json:"icon"`
+	ParentID  *string `json:"parent_id"`
+	SortOrder *int    `json:"sort_order"`
+}
+
+// AdminCategoryResp is a category as admins see it, with its place in the
+// hierarchy and how many businesses use it
+type AdminCategoryResp struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	NameAm     *string `json:"name_am,omitempty"`
+	Icon       *string `json:"icon,omitempty"`
+	ParentID   *string `json:"parent_id,omitempty"`
+	SortOrder  int     `json:"sort_order"`
+	Businesses int     `json:"businesses"`
+}
+
+// CategoryMappingRequest maps an OSM class=type or a PublishPOI type to a
+// category. Source is "osm", a publishing source, or "*" for any publisher.
+type CategoryMappingRequest struct {
+	Source     string `json:"source"`
+	Key        string `json:"key"`
+	CategoryID string `json:"category_id"`
+}
+
+// CategoryMappingResp is a stored category mapping
+type CategoryMappingResp struct {
+	ID           string    `json:"id"`
+	Source       string    `json:"source"`
+	Key          string    `json:"key"`
+	CategoryID   string    `json:"category_id"`
+	CategoryName string    `json:"category_name"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CreateCategory adds a category, optionally under a parent (admin only)
+func CreateCategory(db *sql.DB, index *search.Index) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var req CategoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !cleanCategoryRequest(w, &req) {
+			return
+		}
+		if req.Name == nil {
+			jsonError(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		sortOrder := 0
+		if req.SortOrder != nil {
+			sortOrder = *req.SortOrder
+		}
+		var parentID *string
+		if req.ParentID != nil && *req.ParentID != "" {
+			parentID = req.ParentID
+		}
+
+		var id string
+		err := db.QueryRow(`
+			INSERT INTO categories (name, name_am, icon, parent_id, sort_order)
+			SELECT $1, $2, $3, $4, $5
+			WHERE $4::uuid IS NULL OR EXISTS (SELECT 1 FROM categories WHERE id = $4)
+			RETURNING id
+		`, *req.Name, req.NameAm, req.Icon, parentID, sortOrder).Scan(&id)
+		if err == sql.ErrNoRows {
+			jsonError(w, errParentNotFound.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to create category: %v", err)
+			jsonError(w, "failed to create category", http.StatusInternalServerError)
+			return
+		}
+
+		go index.HandleNotify("")
+		respondWithCategory(w, db, id, http.StatusCreated)
+	}
+}
+
+// UpdateCategory renames, re-icons, reorders or moves a category (admin
+// only). A category can't be moved under itself or one of its children.
+func UpdateCategory(db *sql.DB, index *search.Index) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		categoryID, ok := categoryParam(w, r)
+		if !ok {
+			return
+		}
+		var req CategoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !cleanCategoryRequest(w, &req) {
+			return
+		}
+
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			if req.ParentID != nil && *req.ParentID != "" {
+				// Lock the category and the new parent's ancestry, in id
+				// order, so a concurrent move can't close a cycle between
+				// the check below and the commit
+				_, err := tx.Exec(`
+					WITH RECURSIVE ancestors AS (
+						SELECT id, parent_id FROM categories WHERE id = $2
+						UNION
+						SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+					)
+					SELECT id FROM categories
+					WHERE id = $1 OR id IN (SELECT id FROM ancestors)
+					ORDER BY id
+					FOR UPDATE
+				`, categoryID, *req.ParentID)
+				if err != nil {
+					return err
+				}
+
+				// The new parent must exist outside the category's subtree
+				var exists, inSubtree bool
+				err = tx.QueryRow(`
+					WITH RECURSIVE subtree AS (
+						SELECT id FROM categories WHERE id = $1
+						UNION
+						SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+					)
+					SELECT EXISTS (SELECT 1 FROM categories WHERE id = $2),
+						EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+				`, categoryID, *req.ParentID).Scan(&exists, &inSubtree)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return errParentNotFound
+				}
+				if inSubtree {
+					return errCategoryCycle
+				}
+			}
+
+			res, err := tx.Exec(`
+				UPDATE categories SET
+					name = COALESCE($2, name),
+					name_am = COALESCE($3, name_am),
+					icon = COALESCE($4, icon),
+					sort_order = COALESCE($5, sort_order),
+					parent_id = CASE WHEN $6 THEN NULLIF($7, '')::uuid ELSE parent_id END
+				WHERE id = $1
+			`, categoryID, req.Name, req.NameAm, req.Icon, req.SortOrder, req.ParentID != nil, req.ParentID)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return errCategoryNotFound
+			}
+			return tx.Commit()
+		}()
+		switch err {
+		case nil:
+		case errCategoryNotFound:
+			jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		case errParentNotFound, errCategoryCycle:
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			log.Printf("Failed to update category: %v", err)
+			jsonError(w, "failed to update category", http.StatusInternalServerError)
+			return
+		}
+
+		go index.HandleNotify("")
+		respondWithCategory(w, db, categoryID, http.StatusOK)
+	}
+}
+
+// DeleteCategory removes a category (admin only). Its children move up to
+// its parent. Its businesses and mappings move to ?reassign_to= or, without
+// it, to the parent; a top-level category still in use needs reassign_to.
+func DeleteCategory(db *sql.DB, index *search.Index) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		categoryID, ok := categoryParam(w, r)
+		if !ok {
+			return
+		}
+		reassignTo := strings.ToLower(r.URL.Query().Get("reassign_to"))
+		if reassignTo != "" && !uuidRegex.MatchString(reassignTo) {
+			jsonError(w, "reassign_to must be a category id", http.StatusBadRequest)
+			return
+		}
+		if reassignTo == categoryID {
+			jsonError(w, "a category can't be reassigned to itself", http.StatusBadRequest)
+			return
+		}
+
+		var moved int64
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			var parentID sql.NullString
+			var inUse bool
+			err = tx.QueryRow(`
+				SELECT parent_id,
+					EXISTS (SELECT 1 FROM businesses WHERE category_id = c.id)
+					OR EXISTS (SELECT 1 FROM category_mappings WHERE category_id = c.id)
+				FROM categories c WHERE id = $1
+				FOR UPDATE
+			`, categoryID).Scan(&parentID, &inUse)
+			if err == sql.ErrNoRows {
+				return errCategoryNotFound
+			}
+			if err != nil {
+				return err
+			}
+
+			target := parentID
+			if reassignTo != "" {
+				var exists bool
+				if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)`, reassignTo).Scan(&exists); err != nil {
+					return err
+				}
+				if !exists {
+					return errReassignNotFound
+				}
+				target = sql.NullString{String: reassignTo, Valid: true}
+			}
+			if inUse && !target.Valid {
+				return errCategoryInUse
+			}
+
+			if err := tagRevision(tx, userID, "admin", "category "+categoryID+" deleted"); err != nil {
+				return err
+			}
+			res, err := tx.Exec(`UPDATE businesses SET category_id = $2, updated_at = NOW() WHERE category_id = $1`, categoryID, target)
+			if err != nil {
+				return err
+			}
+			moved, _ = res.RowsAffected()
+
+			steps := []struct {
+				query string
+				args  []interface{}
+			}{
+				{`UPDATE category_mappings SET category_id = $2 WHERE category_id = $1`, []interface{}{categoryID, target}},
+				// Pending change sets proposing the category follow it
+				{`UPDATE business_changes SET
+					changes = CASE WHEN $2::uuid IS NULL THEN changes - 'category_id'
+						ELSE jsonb_set(changes, '{category_id}', to_jsonb($2::text)) END,
+					updated_at = NOW()
+				WHERE status = 'pending' AND changes->>'category_id' = $1::text`, []interface{}{categoryID, target}},
+				{`UPDATE categories SET parent_id = $2 WHERE parent_id = $1`, []interface{}{categoryID, parentID}},
+				{`DELETE FROM categories WHERE id = $1`, []interface{}{categoryID}},
+			}
+			for _, step := range steps {
+				if _, err := tx.Exec(step.query, step.args...); err != nil {
+					return err
+				}
+			}
+			return tx.Commit()
+		}()
+		switch err {
+		case nil:
+		case errCategoryNotFound:
+			jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		case errReassignNotFound:
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		case errCategoryInUse:
+			jsonError(w, "category has businesses or mappings; pass reassign_to", http.StatusConflict)
+			return
+		default:
+			log.Printf("Failed to delete category: %v", err)
+			jsonError(w, "failed to delete category", http.StatusInternalServerError)
+			return
+		}
+
+		go index.HandleNotify("")
+		jsonResponse(w, map[string]interface{}{"message": "category deleted", "businesses_moved": moved}, http.StatusOK)
+	}
+}
+
+// ListCategoryMappings returns the category mappings, optionally of one
+// ?source= (admin only)
+func ListCategoryMappings(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		query := selectCategoryMappings
+		args := []interface{}{}
+		if source := r.URL.Query().Get("source"); source != "" {
+			query += ` WHERE m.source = $1`
+			args = append(args, source)
+		}
+		rows, err := db.Query(query+` ORDER BY m.source, m.key`, args...)
+		if err != nil {
+			log.Printf("Failed to list category mappings: %v", err)
+			jsonError(w, "failed to list category mappings", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		list := []CategoryMappingResp{}
+		for rows.Next() {
+			m, err := scanCategoryMapping(rows)
+			if err != nil {
+				log.Printf("Failed to scan category mapping: %v", err)
+				continue
+			}
+			list = append(list, *m)
+		}
+		jsonResponse(w, list, http.StatusOK)
+	}
+}
+
+// PutCategoryMapping creates or replaces the mapping of a source and key
+// (admin only). Keys are normalized the way the importer and PublishPOI
+// look them up.
+func PutCategoryMapping(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var req CategoryMappingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		source, key, ok := cleanMappingKey(w, req.Source, req.Key)
+		if !ok {
+			return
+		}
+		if !uuidRegex.MatchString(req.CategoryID) {
+			jsonError(w, "category_id must be a category id", http.StatusBadRequest)
+			return
+		}
+
+		var id string
+		err := db.QueryRow(`
+			INSERT INTO category_mappings (source, key, category_id)
+			SELECT $1, $2, id FROM categories WHERE id = $3
+			ON CONFLICT (source, key) DO UPDATE SET category_id = EXCLUDED.category_id
+			RETURNING id
+		`, source, key, req.CategoryID).Scan(&id)
+		if err == sql.ErrNoRows {
+			jsonError(w, errCategoryNotFound.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to save category mapping: %v", err)
+			jsonError(w, "failed to save category mapping", http.StatusInternalServerError)
+			return
+		}
+
+		m, err := scanCategoryMapping(db.QueryRow(selectCategoryMappings+` WHERE m.id = $1`, id))
+		if err != nil {
+			log.Printf("Failed to load category mapping: %v", err)
+			jsonError(w, "failed to load category mapping", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, m, http.StatusOK)
+	}
+}
+
+// DeleteCategoryMapping removes a mapping (admin only)
+func DeleteCategoryMapping(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		mappingID := chi.URLParam(r, "mappingId")
+		if !uuidRegex.MatchString(mappingID) {
+			jsonError(w, "invalid mapping id", http.StatusBadRequest)
+			return
+		}
+		res, err := db.Exec(`DELETE FROM category_mappings WHERE id = $1`, mappingID)
+		if err != nil {
+			log.Printf("Failed to delete category mapping: %v", err)
+			jsonError(w, "failed to delete category mapping", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, "category mapping not found", http.StatusNotFound)
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "category mapping deleted"}, http.StatusOK)
+	}
+}
+
+// categoryParam validates the {id} URL parameter
+func categoryParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := strings.ToLower(chi.URLParam(r, "id"))
+	if !uuidRegex.MatchString(id) {
+		jsonError(w, "invalid category id", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+// cleanCategoryRequest trims the fields and checks them against the column
+// sizes
+func cleanCategoryRequest(w http.ResponseWriter, req *CategoryRequest) bool {
+	for _, f := range []struct {
+		name  string
+		value *string
+		max   int
+	}{{"name", req.Name, 100}, {"name_am", req.NameAm, 100}, {"icon", req.Icon, 50}} {
+		if f.value == nil {
+			continue
+		}
+		*f.value = strings.TrimSpace(*f.value)
+		if len(*f.value) > f.max {
+			jsonErrorf(w, "%s must be at most %d bytes", http.StatusBadRequest, f.name, f.max)
+			return false
+		}
+	}
+	if req.Name != nil && *req.Name == "" {
+		jsonError(w, "name can't be empty", http.StatusBadRequest)
+		return false
+	}
+	if req.ParentID != nil {
+		*req.ParentID = strings.ToLower(strings.TrimSpace(*req.ParentID))
+		if *req.ParentID != "" && !uuidRegex.MatchString(*req.ParentID) {
+			jsonError(w, "parent_id must be a category id", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// cleanMappingKey normalizes a mapping source and key. OSM keys are
+// class=type, where type may be * for the whole class.
+func cleanMappingKey(w http.ResponseWriter, source, key string) (string, string, bool) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if source == "" || len(source) > 50 {
+		jsonError(w, "source is required and must be at most 50 bytes", http.StatusBadRequest)
+		return "", "", false
+	}
+	if source == categories.SourceOSM {
+		class, typ, ok := strings.Cut(key, "=")
+		if !ok || categories.NormalizeKey(class) == "" || categories.NormalizeKey(typ) == "" {
+			jsonError(w, "osm keys must be class=type or class=*", http.StatusBadRequest)
+			return "", "", false
+		}
+		key = categories.OSMKey(class, typ)
+	} else {
+		key = categories.NormalizeKey(key)
+	}
+	if key == "" || len(key) > 100 {
+		jsonError(w, "key is required and must be at most 100 bytes", http.StatusBadRequest)
+		return "", "", false
+	}
+	return source, key, true
+}
+
+const selectCategoryMappings = `
+	SELECT m.id, m.source, m.key, m.category_id, c.name, m.created_at
+	FROM category_mappings m
+	JOIN categories c ON c.id = m.category_id
+`
+
+func scanCategoryMapping(row rowScanner) (*CategoryMappingResp, error) {
+	var m CategoryMappingResp
+	if err := row.Scan(&m.ID, &m.Source, &m.Key, &m.CategoryID, &m.CategoryName, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// respondWithCategory writes the category with its business count
+func respondWithCategory(w http.ResponseWriter, db *sql.DB, id string, status int) {
+	var c AdminCategoryResp
+	var nameAm, icon, parentID sql.NullString
+	err := db.QueryRow(`
+		SELECT c.id, c.name, c.name_am, c.icon, c.parent_id, COALESCE(c.sort_order, 0),
+			(SELECT COUNT(*) FROM businesses WHERE category_id = c.id)
+		FROM categories c WHERE c.id = $1
+	`, id).Scan(&c.ID, &c.Name, &nameAm, &icon, &parentID, &c.SortOrder, &c.Businesses)
+	if err != nil {
+		log.Printf("Failed to load category: %v", err)
+		jsonError(w, "failed to load category", http.StatusInternalServerError)
+		return
+	}
+	c.NameAm, c.Icon, c.ParentID = nullStringPtr(nameAm), nullStringPtr(icon), nullStringPtr(parentID)
+	jsonResponse(w, c, status)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"maps/api/internal/holidays"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// holidayKeyPattern restricts holiday keys to what special hours refer to
+var holidayKeyPattern = regexp.MustCompile(`^[a-z0-9_]{2,50}$`)
+
+// PutHolidayRequest is the request body for announcing a holiday date
+type PutHolidayRequest struct {
+	Name   string  `json:"name"`
+	NameAm *string `json:"name_am,omitempty"`
+}
+
+// ListHolidays returns the public holidays of a year (default: the current
+// year in Addis Ababa)
+func ListHolidays(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		year := time.Now().In(addisTime).Year()
+		if s := r.URL.Query().Get("year"); s != "" {
+			y, err := strconv.Atoi(s)
+			if err != nil || y < 1900 || y > 2200 {
+				jsonError(w, "invalid year", http.StatusBadRequest)
+				return
+			}
+			year = y
+		}
+
+		list, err := holidays.List(r.Context(), db, year)
+		if err != nil {
+			log.Printf("Failed to get holidays: %v", err)
+			jsonError(w, "failed to get holidays", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, map[string]interface{}{
+			"year":     year,
+			"holidays": list,
+			"count":    len(list),
+		}, http.StatusOK)
+	}
+}
+
+// PutHoliday adds or renames a holiday date (admin only). Used for
+// holidays that follow the moon, like eid_al_fitr, once they are announced.
+func PutHoliday(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		key, date, ok := holidayParams(w, r)
+		if !ok {
+			return
+		}
+
+		var req PutHolidayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" {
+			jsonError(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		h := holidays.Holiday{
+			Key:         key,
+			Date:        date,
+			Name:        req.Name,
+			NameAm:      req.NameAm,
+			CountryCode: "ET",
+			Source:      holidays.SourceManual,
+		}
+		if err := holidays.Put(r.Context(), db, h); err != nil {
+			log.Printf("Failed to put holiday: %v", err)
+			jsonError(w, "failed to save holiday", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, h, http.StatusOK)
+	}
+}
+
+// DeleteHoliday removes a holiday date added by an admin (admin only)
+func DeleteHoliday(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		key, date, ok := holidayParams(w, r)
+		if !ok {
+			return
+		}
+
+		err := holidays.Delete(r.Context(), db, key, date)
+		if err == holidays.ErrNotFound {
+			jsonError(w, "holiday not found or not added manually", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to delete holiday: %v", err)
+			jsonError(w, "failed to delete holiday", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "holiday deleted"}, http.StatusOK)
+	}
+}
+
+// holidayParams validates the {key} and {date} URL parameters
+func holidayParams(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	key := chi.URLParam(r, "key")
+	date := chi.URLParam(r, "date")
+	if !holidayKeyPattern.MatchString(key) {
+		jsonError(w, "holiday key must be lowercase letters, digits and underscores", http.StatusBadRequest)
+		return "", "", false
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		jsonError(w, "invalid date, use YYYY-MM-DD", http.StatusBadRequest)
+		return "", "", false
+	}
+	return key, date, true
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"maps/api/internal/categories"
 )
 
 type PublishPOIRequest struct {
@@ -37,21 +39,33 @@ func PublishPOI(db *sql.DB) http.HandlerFunc {
 		// We might need to add 'source' and 'external_id' columns if they don't exist,
 		// but based on SearchBusinesses query, 'source' column exists.
 
-		// We need to map 'Type' to 'category_id'. This is tricky without a lookup.
-		// For now, we'll just insert/update and assume category mapping is handled or nullable.
+		// Map 'Type' to a canonical category; unmapped types keep the
+		// business's current category
+		var categoryID sql.NullString
+		if req.Type != "" {
+			id, ok, err := categories.LookupExternal(r.Context(), db, req.Source, req.Type)
+			if err != nil {
+				log.Printf("Failed to map POI type %q: %v", req.Type, err)
+			} else if ok {
+				categoryID = sql.NullString{String: id, Valid: true}
+			} else {
+				log.Printf("No category mapping for POI type %q from %s", req.Type, req.Source)
+			}
+		}
 
 		query := `
 			INSERT INTO businesses (
 				name, source, external_id, 
-				geom, status, created_at, updated_at
+				geom, category_id, status, created_at, updated_at
 			) VALUES (
 				$1, $2, $3,
-				ST_SetSRID(ST_MakePoint($4, $5), 4326), 'verified', NOW(), NOW()
+				ST_SetSRID(ST_MakePoint($4, $5), 4326), $6, 'verified', NOW(), NOW()
 			)
 			ON CONFLICT (source, external_id) 
 			DO UPDATE SET
 				name = EXCLUDED.name,
 				geom = EXCLUDED.geom,
+				category_id = COALESCE(EXCLUDED.category_id, businesses.category_id),
 				updated_at = NOW();
 		`
 		// Note: We need a unique constraint on (source, external_id) for ON CONFLICT to work.
@@ -59,23 +73,24 @@ func PublishPOI(db *sql.DB) http.HandlerFunc {
 		// For this task, I'll assume the schema supports it or I'll use a simple UPDATE then INSERT check.
 
 		// Let's try the UPSERT assuming constraint exists.
-		_, err := db.Exec(query, req.Name, req.Source, req.ID, req.Lng, req.Lat)
+		_, err := publishExec(db, req.Source, query, req.Name, req.Source, req.ID, req.Lng, req.Lat, categoryID)
 		if err != nil {
 			log.Printf("Failed to publish POI: %v", err)
 			// Fallback: Try Update, if 0 rows, Insert.
-			res, err := db.Exec(`
+			res, err := publishExec(db, req.Source, `
 				UPDATE businesses SET 
-					name = $1, geom = ST_SetSRID(ST_MakePoint($2, $3), 4326), updated_at = NOW()
+					name = $1, geom = ST_SetSRID(ST_MakePoint($2, $3), 4326),
+					category_id = COALESCE($6::uuid, category_id), updated_at = NOW()
 				WHERE source = $4 AND external_id = $5
-			`, req.Name, req.Lng, req.Lat, req.Source, req.ID)
+			`, req.Name, req.Lng, req.Lat, req.Source, req.ID, categoryID)
 
 			if err == nil {
 				rows, _ := res.RowsAffected()
 				if rows == 0 {
-					_, err = db.Exec(`
-						INSERT INTO businesses (name, source, external_id, geom, status)
-						VALUES ($1, $2, $3, ST_SetSRID(ST_MakePoint($4, $5), 4326), 'verified')
-					`, req.Name, req.Source, req.ID, req.Lng, req.Lat)
+					_, err = publishExec(db, req.Source, `
+						INSERT INTO businesses (name, source, external_id, geom, category_id, status)
+						VALUES ($1, $2, $3, ST_SetSRID(ST_MakePoint($4, $5), 4326), $6, 'verified')
+					`, req.Name, req.Source, req.ID, req.Lng, req.Lat, categoryID)
 				}
 			}
 
@@ -89,3 +104,22 @@ func PublishPOI(db *sql.DB) http.HandlerFunc {
 		jsonResponse(w, map[string]string{"status": "published"}, http.StatusOK)
 	}
 }
+
+// publishExec runs a statement of PublishPOI in its own transaction, so the
+// business revision it writes is attributed to the publishing source
+func publishExec(db *sql.DB, source, query string, args ...interface{}) (sql.Result, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := tagRevision(tx, "", "publish", source); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return res, tx.Commit()
+}
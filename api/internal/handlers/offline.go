@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"maps/api/internal/middleware"
+	"maps/api/internal/offline"
+	"maps/api/internal/styles"
+	"maps/api/internal/tiles"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetOfflineEstimate returns the tile count and expected size of an offline
+// package before it is requested.
+//
+//	min_lat, min_lng, max_lat, max_lng   area
+//	min_zoom=0, max_zoom=14              zoom range
+//	tileset=addis, style=didi
+func GetOfflineEstimate(builder *offline.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		minLat, minLng := q.Get("min_lat"), q.Get("min_lng")
+		maxLat, maxLng := q.Get("max_lat"), q.Get("max_lng")
+		if err := middleware.ValidateBoundingBox(minLat, minLng, maxLat, maxLng); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := offline.Request{Tileset: q.Get("tileset"), Style: q.Get("style"), MaxZoom: 14}
+		req.BBox[0], _ = strconv.ParseFloat(minLng, 64)
+		req.BBox[1], _ = strconv.ParseFloat(minLat, 64)
+		req.BBox[2], _ = strconv.ParseFloat(maxLng, 64)
+		req.BBox[3], _ = strconv.ParseFloat(maxLat, 64)
+		for _, p := range []struct {
+			name string
+			dst  *int
+		}{{"min_zoom", &req.MinZoom}, {"max_zoom", &req.MaxZoom}} {
+			if v := q.Get(p.name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					jsonErrorf(w, "invalid %s", http.StatusBadRequest, p.name)
+					return
+				}
+				*p.dst = n
+			}
+		}
+		if !prepareOfflineRequest(w, &req) {
+			return
+		}
+
+		est, err := builder.Estimate(r.Context(), req)
+		if err != nil {
+			writeOfflineError(w, err, nil)
+			return
+		}
+		jsonResponse(w, est, http.StatusOK)
+	}
+}
+
+// CreateOfflinePackage queues an offline package build for the current
+// user. Identical requests return the existing package.
+func CreateOfflinePackage(builder *offline.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req := offline.Request{MaxZoom: 14}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !prepareOfflineRequest(w, &req) {
+			return
+		}
+
+		pkg, est, err := builder.Submit(r.Context(), userID, requestBaseURL(r), req)
+		if err != nil {
+			writeOfflineError(w, err, est)
+			return
+		}
+
+		status := http.StatusAccepted
+		if pkg.Status == offline.StatusReady {
+			status = http.StatusOK
+		}
+		setDownloadURL(r, pkg)
+		jsonResponse(w, map[string]interface{}{
+			"package":  pkg,
+			"estimate": est,
+		}, status)
+	}
+}
+
+// ListOfflinePackages returns the current user's offline packages
+func ListOfflinePackages(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		list, err := offline.List(r.Context(), db, userID)
+		if err != nil {
+			log.Printf("Failed to list offline packages: %v", err)
+			jsonError(w, "failed to list offline packages", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []offline.Package{}
+		}
+		for i := range list {
+			setDownloadURL(r, &list[i])
+		}
+		jsonResponse(w, map[string]interface{}{
+			"packages": list,
+			"count":    len(list),
+		}, http.StatusOK)
+	}
+}
+
+// GetOfflinePackage returns the build status of a package
+func GetOfflinePackage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pkg, ok := loadOfflinePackage(w, r, db)
+		if !ok {
+			return
+		}
+		setDownloadURL(r, pkg)
+		jsonResponse(w, pkg, http.StatusOK)
+	}
+}
+
+// DownloadOfflinePackage serves a built package zip. Range requests are
+// supported so interrupted downloads can resume.
+func DownloadOfflinePackage(db *sql.DB, builder *offline.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pkg, ok := loadOfflinePackage(w, r, db)
+		if !ok {
+			return
+		}
+		if pkg.Status != offline.StatusReady || pkg.Checksum == nil {
+			jsonErrorf(w, "package is %s", http.StatusConflict, pkg.Status)
+			return
+		}
+
+		f, err := os.Open(builder.FilePath(pkg))
+		if err != nil {
+			log.Printf("Failed to open offline package %s: %v", pkg.ID, err)
+			jsonError(w, "package file is missing", http.StatusGone)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="didi-offline-`+pkg.ID+`.zip"`)
+		w.Header().Set("ETag", `"`+*pkg.Checksum+`"`)
+		w.Header().Set("X-Checksum-SHA256", *pkg.Checksum)
+		w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+
+		var modified time.Time
+		if pkg.CompletedAt != nil {
+			modified = *pkg.CompletedAt
+		}
+		http.ServeContent(w, r, "", modified, f)
+	}
+}
+
+// prepareOfflineRequest fills defaults and validates a package request,
+// writing a 400 when it is invalid
+func prepareOfflineRequest(w http.ResponseWriter, req *offline.Request) bool {
+	if req.Tileset == "" {
+		req.Tileset = defaultTileset
+	}
+	if req.Style == "" {
+		req.Style = "didi"
+	}
+	if err := req.Validate(); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// loadOfflinePackage loads the {id} package if the caller owns it or is an
+// admin, writing the error response otherwise
+func loadOfflinePackage(w http.ResponseWriter, r *http.Request, db *sql.DB) (*offline.Package, bool) {
+	userID := getUserIDFromContext(r)
+	if userID == "" {
+		jsonError(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	pkg, err := offline.Get(r.Context(), db, chi.URLParam(r, "id"))
+	if err == offline.ErrNotFound {
+		jsonError(w, "package not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to get offline package: %v", err)
+		jsonError(w, "failed to get package", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !pkg.OwnedBy(userID) && !isAdmin(db, userID) {
+		jsonError(w, "package not found", http.StatusNotFound)
+		return nil, false
+	}
+	return pkg, true
+}
+
+func setDownloadURL(r *http.Request, pkg *offline.Package) {
+	if pkg.Status == offline.StatusReady {
+		pkg.DownloadURL = requestBaseURL(r) + "/api/offline/packages/" + pkg.ID + "/download"
+	}
+}
+
+func writeOfflineError(w http.ResponseWriter, err error, est *offline.Estimate) {
+	switch {
+	case errors.Is(err, tiles.ErrTilesetNotFound):
+		jsonError(w, "tileset not found", http.StatusNotFound)
+	case errors.Is(err, styles.ErrNotFound):
+		jsonError(w, "style not found", http.StatusNotFound)
+	case errors.Is(err, offline.ErrNoZooms):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, offline.ErrTooLarge):
+		jsonResponse(w, map[string]interface{}{
+			"error":    err.Error() + "; choose a smaller area or fewer zooms",
+			"estimate": est,
+		}, http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("Failed to prepare offline package: %v", err)
+		jsonError(w, "failed to prepare offline package", http.StatusInternalServerError)
+	}
+}
@@ -363,6 +363,13 @@ func getUserIDFromContext(r *http.Request) string {
 	return claims.UserID
 }
 
+// isAdmin reports whether the user has the admin role
+func isAdmin(db *sql.DB, userID string) bool {
+	var role string
+	db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	return role == "admin"
+}
+
 // Helper to format errors
 func jsonErrorf(w http.ResponseWriter, format string, status int, args ...interface{}) {
 	jsonError(w, fmt.Sprintf(format, args...), status)
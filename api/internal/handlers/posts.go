@@ -37,10 +37,12 @@ type PostResponseItem struct {
 	ViewCount    int                    `json:"view_count"`
 	LikeCount    int                    `json:"like_count"`
 	Liked        bool                   `json:"liked"`
+	Status       string                 `json:"status"` // processing or failed are only shown to the author
 	CreatedAt    string                 `json:"created_at"`
 }
 
-// CreatePost creates a new post
+// CreatePost creates a new post. Posts of an uploaded video stay
+// "processing" until the video is transcoded, then play its HLS playlist.
 func CreatePost(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := getUserIDFromContext(r)
@@ -65,13 +67,39 @@ func CreatePost(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		status := "active"
+		if req.ContentType == "video" {
+			var uploadStatus string
+			var playlistURL sql.NullString
+			err := db.QueryRow(`
+				SELECT status, playlist_url FROM uploads
+				WHERE (url = $1 OR playlist_url = $1) AND content_type LIKE 'video/%'
+				LIMIT 1
+			`, req.MediaURL).Scan(&uploadStatus, &playlistURL)
+			switch {
+			case err == sql.ErrNoRows:
+				// Not an upload, e.g. a video hosted elsewhere
+			case err != nil:
+				log.Printf("Failed to look up video upload: %v", err)
+				jsonError(w, "failed to create post", http.StatusInternalServerError)
+				return
+			case uploadStatus == "failed":
+				jsonError(w, "video could not be processed", http.StatusBadRequest)
+				return
+			case uploadStatus == "processing":
+				status = "processing"
+			case playlistURL.Valid:
+				req.MediaURL = playlistURL.String
+			}
+		}
+
 		// Build geometry if lat/lng provided
 		var geomSQL string
 		var args []interface{}
 		argNum := 1
 
-		args = append(args, userID, req.ContentType, req.MediaURL, req.ThumbnailURL, req.Caption, req.BusinessID)
-		argNum = 7
+		args = append(args, userID, req.ContentType, req.MediaURL, req.ThumbnailURL, req.Caption, req.BusinessID, status)
+		argNum = 8
 
 		if req.Lat != nil && req.Lng != nil {
 			geomSQL = ", ST_SetSRID(ST_MakePoint($" + strconv.Itoa(argNum) + ", $" + strconv.Itoa(argNum+1) + "), 4326)"
@@ -87,14 +115,14 @@ func CreatePost(db *sql.DB) http.HandlerFunc {
 		args = append(args, expiresAt)
 
 		query := `
-			INSERT INTO posts (user_id, content_type, media_url, thumbnail_url, caption, business_id` +
+			INSERT INTO posts (user_id, content_type, media_url, thumbnail_url, caption, business_id, status` +
 			func() string {
 				if req.Lat != nil && req.Lng != nil {
 					return ", geom"
 				}
 				return ""
 			}() + `, expires_at)
-			VALUES ($1, $2, $3, $4, $5, $6` + geomSQL + `, $` + strconv.Itoa(argNum) + `)
+			VALUES ($1, $2, $3, $4, $5, $6, $7` + geomSQL + `, $` + strconv.Itoa(argNum) + `)
 			RETURNING id`
 
 		var postID string
@@ -107,6 +135,7 @@ func CreatePost(db *sql.DB) http.HandlerFunc {
 
 		jsonResponse(w, map[string]string{
 			"id":      postID,
+			"status":  status,
 			"message": "post created",
 		}, http.StatusCreated)
 	}
@@ -139,7 +168,7 @@ func GetFeed(db *sql.DB) http.HandlerFunc {
 			SELECT 
 				p.id, p.user_id, p.business_id, p.content_type, p.media_url, p.thumbnail_url, p.caption,
 				ST_Y(p.geom) as lat, ST_X(p.geom) as lng,
-				p.view_count, p.like_count, p.created_at,
+				p.view_count, p.like_count, p.status, p.created_at,
 				u.name as user_name, u.photo_url as user_photo,
 				COALESCE((SELECT TRUE FROM post_likes WHERE post_id = p.id AND user_id = $1), FALSE) as liked
 			FROM posts p
@@ -188,7 +217,7 @@ func GetFeed(db *sql.DB) http.HandlerFunc {
 			err := rows.Scan(
 				&p.ID, &postUserID, &businessID, &p.ContentType, &p.MediaURL, &thumbnailURL, &caption,
 				&lat, &lng,
-				&p.ViewCount, &p.LikeCount, &createdAt,
+				&p.ViewCount, &p.LikeCount, &p.Status, &createdAt,
 				&userName, &userPhoto, &p.Liked,
 			)
 			if err != nil {
@@ -239,7 +268,8 @@ func GetFeed(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GetPost returns a single post
+// GetPost returns a single post. Authors also see their posts whose video
+// is processing or failed.
 func GetPost(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		postID := chi.URLParam(r, "id")
@@ -260,16 +290,17 @@ func GetPost(db *sql.DB) http.HandlerFunc {
 			SELECT 
 				p.id, p.user_id, p.business_id, p.content_type, p.media_url, p.thumbnail_url, p.caption,
 				ST_Y(p.geom) as lat, ST_X(p.geom) as lng,
-				p.view_count, p.like_count, p.created_at,
+				p.view_count, p.like_count, p.status, p.created_at,
 				u.name as user_name, u.photo_url as user_photo,
 				COALESCE((SELECT TRUE FROM post_likes WHERE post_id = p.id AND user_id = $2), FALSE) as liked
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
-			WHERE p.id = $1 AND p.status = 'active'
+			WHERE p.id = $1
+			AND (p.status = 'active' OR (p.status IN ('processing', 'failed') AND p.user_id = $2))
 		`, postID, userID).Scan(
 			&p.ID, &postUserID, &businessID, &p.ContentType, &p.MediaURL, &thumbnailURL, &caption,
 			&lat, &lng,
-			&p.ViewCount, &p.LikeCount, &createdAt,
+			&p.ViewCount, &p.LikeCount, &p.Status, &createdAt,
 			&userName, &userPhoto, &p.Liked,
 		)
 
@@ -426,7 +457,8 @@ func DeletePost(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GetUserPosts returns posts by a specific user
+// GetUserPosts returns posts by a specific user, including the ones whose
+// video is processing or failed when they are the caller's
 func GetUserPosts(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		targetUserID := chi.URLParam(r, "userId")
@@ -450,10 +482,11 @@ func GetUserPosts(db *sql.DB) http.HandlerFunc {
 			SELECT 
 				p.id, p.content_type, p.media_url, p.thumbnail_url, p.caption,
 				ST_Y(p.geom) as lat, ST_X(p.geom) as lng,
-				p.view_count, p.like_count, p.created_at,
+				p.view_count, p.like_count, p.status, p.created_at,
 				COALESCE((SELECT TRUE FROM post_likes WHERE post_id = p.id AND user_id = $2), FALSE) as liked
 			FROM posts p
-			WHERE p.user_id = $1 AND p.status = 'active'
+			WHERE p.user_id = $1
+			AND (p.status = 'active' OR (p.status IN ('processing', 'failed') AND p.user_id = $2))
 			ORDER BY p.created_at DESC
 			LIMIT $3
 		`, targetUserID, currentUserID, limit)
@@ -467,7 +500,7 @@ func GetUserPosts(db *sql.DB) http.HandlerFunc {
 
 		var posts []map[string]interface{}
 		for rows.Next() {
-			var id, contentType, mediaURL string
+			var id, contentType, mediaURL, status string
 			var thumbnailURL, caption sql.NullString
 			var lat, lng sql.NullFloat64
 			var viewCount, likeCount int
@@ -476,7 +509,7 @@ func GetUserPosts(db *sql.DB) http.HandlerFunc {
 
 			err := rows.Scan(
 				&id, &contentType, &mediaURL, &thumbnailURL, &caption,
-				&lat, &lng, &viewCount, &likeCount, &createdAt, &liked,
+				&lat, &lng, &viewCount, &likeCount, &status, &createdAt, &liked,
 			)
 			if err != nil {
 				continue
@@ -489,6 +522,7 @@ func GetUserPosts(db *sql.DB) http.HandlerFunc {
 				"view_count":   viewCount,
 				"like_count":   likeCount,
 				"liked":        liked,
+				"status":       status,
 				"created_at":   createdAt.Format(time.RFC3339),
 			}
 			if thumbnailURL.Valid {
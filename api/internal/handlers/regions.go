@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"maps/api/internal/regions"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UpsertRegionRequest is the request body for creating or updating a region
+type UpsertRegionRequest struct {
+	Name        string          `json:"name"`
+	NameAm      *string         `json:"name_am,omitempty"`
+	CountryCode string          `json:"country_code"`
+	Timezone    string          `json:"timezone"`
+	Geometry    json.RawMessage `json:"geometry"` // GeoJSON Polygon or MultiPolygon
+	IsActive    *bool           `json:"is_active,omitempty"`
+	SortOrder   int             `json:"sort_order"`
+}
+
+// GetRegions returns the active service regions
+func GetRegions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := regions.List(r.Context(), db, true)
+		if err != nil {
+			log.Printf("Failed to get regions: %v", err)
+			jsonError(w, "failed to get regions", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []regions.Region{}
+		}
+		jsonResponse(w, list, http.StatusOK)
+	}
+}
+
+// UpsertRegion creates or replaces a region by slug (admin only)
+func UpsertRegion(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		slug := chi.URLParam(r, "slug")
+		if slug == "" {
+			jsonError(w, "region slug required", http.StatusBadRequest)
+			return
+		}
+
+		var req UpsertRegionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" || len(req.CountryCode) != 2 || len(req.Geometry) == 0 {
+			jsonError(w, "name, country_code and geometry are required", http.StatusBadRequest)
+			return
+		}
+		if req.Timezone == "" {
+			req.Timezone = "Africa/Addis_Ababa"
+		}
+		isActive := true
+		if req.IsActive != nil {
+			isActive = *req.IsActive
+		}
+
+		_, err := db.Exec(`
+			INSERT INTO regions (slug, name, name_am, country_code, timezone, geom, is_active, sort_order)
+			VALUES ($1, $2, $3, $4, $5, ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON($6), 4326)), $7, $8)
+			ON CONFLICT (slug) DO UPDATE SET
+				name = EXCLUDED.name,
+				name_am = EXCLUDED.name_am,
+				country_code = EXCLUDED.country_code,
+				timezone = EXCLUDED.timezone,
+				geom = EXCLUDED.geom,
+				is_active = EXCLUDED.is_active,
+				sort_order = EXCLUDED.sort_order
+		`, slug, req.Name, req.NameAm, req.CountryCode, req.Timezone, string(req.Geometry), isActive, req.SortOrder)
+		if err != nil {
+			log.Printf("Failed to upsert region: %v", err)
+			jsonError(w, "failed to save region (geometry must be a GeoJSON Polygon or MultiPolygon)", http.StatusBadRequest)
+			return
+		}
+
+		// Re-home businesses whose containing region may have changed
+		_, err = db.Exec(`
+			UPDATE businesses b SET region_id = (
+				SELECT rg.id FROM regions rg
+				WHERE ST_Contains(rg.geom, b.geom)
+				ORDER BY ST_Area(rg.geom)
+				LIMIT 1
+			)
+			WHERE b.region_id IS NULL
+			OR b.region_id = (SELECT id FROM regions WHERE slug = $1)
+			OR ST_Contains((SELECT geom FROM regions WHERE slug = $1), b.geom)
+		`, slug)
+		if err != nil {
+			log.Printf("Failed to reassign business regions: %v", err)
+		}
+
+		reg, err := regions.BySlug(r.Context(), db, slug)
+		if err != nil {
+			log.Printf("Failed to load region: %v", err)
+			jsonError(w, "failed to load region", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, reg, http.StatusOK)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"maps/api/internal/media"
+)
+
+// Resumable uploads follow the tus 1.0 core protocol with the creation,
+// expiration and termination extensions, so tus clients work unchanged:
+//
+//	POST   /upload/resumable       Upload-Length: <bytes>  -> 201, Location
+//	HEAD   /upload/resumable/{id}                          -> Upload-Offset
+//	PATCH  /upload/resumable/{id}  Upload-Offset: <bytes>  -> 204, Upload-Offset
+//	DELETE /upload/resumable/{id}                          -> 204
+//
+// Once every byte is sent, POST /upload/resumable/{id}/complete processes
+// the file like UploadFile. Uploads live in the database and the storage
+// backend, so each request can go to a different replica. Every chunk is
+// stored as an object, so clients should send chunks of a few megabytes
+// rather than many small ones; the bytes of a chunk that fails halfway are
+// kept.
+const tusVersion = "1.0.0"
+
+// setTusHeaders sets the protocol headers and, for an upload, its state
+func setTusHeaders(w http.ResponseWriter, up *media.ResumableUpload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	if up != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(up.Length, 10))
+		w.Header().Set("Upload-Expires", up.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CreateResumableUpload starts a resumable upload of Upload-Length bytes
+func CreateResumableUpload(resumables *media.Resumables) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		setTusHeaders(w, nil)
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,expiration,termination")
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(resumables.MaxLength(), 10))
+
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length <= 0 {
+			jsonError(w, "Upload-Length header must be a positive number of bytes", http.StatusBadRequest)
+			return
+		}
+
+		up, err := resumables.Create(r.Context(), userID, length)
+		if err == media.ErrTooLarge {
+			jsonErrorf(w, "uploads are limited to %d bytes", http.StatusRequestEntityTooLarge, resumables.MaxLength())
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to create resumable upload: %v", err)
+			jsonError(w, "failed to start upload", http.StatusInternalServerError)
+			return
+		}
+
+		setTusHeaders(w, up)
+		w.Header().Set("Location", r.URL.Path+"/"+up.ID)
+		jsonResponse(w, up, http.StatusCreated)
+	}
+}
+
+// GetResumableUpload reports how many bytes of an upload were received, in
+// Upload-Offset. It answers HEAD as tus does, and GET with a JSON body.
+func GetResumableUpload(resumables *media.Resumables) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		setTusHeaders(w, nil)
+		up, err := resumables.Get(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeResumableError(w, err)
+			return
+		}
+
+		setTusHeaders(w, up)
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		jsonResponse(w, up, http.StatusOK)
+	}
+}
+
+// PatchResumableUpload appends the request body to an upload. Upload-Offset
+// must be the upload's current offset.
+func PatchResumableUpload(resumables *media.Resumables) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		setTusHeaders(w, nil)
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			jsonError(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			jsonError(w, "Upload-Offset header is required", http.StatusBadRequest)
+			return
+		}
+
+		up, err := resumables.Append(r.Context(), userID, chi.URLParam(r, "id"), offset, r.Body)
+		if up != nil {
+			// Also on errors, so the client knows where to resume
+			setTusHeaders(w, up)
+		}
+		if err != nil {
+			writeResumableError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CompleteResumableUpload processes a fully received upload like
+// UploadFile
+func CompleteResumableUpload(resumables *media.Resumables) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		upload, err := resumables.Finish(r.Context(), userID, chi.URLParam(r, "id"))
+		switch err {
+		case nil:
+			jsonResponse(w, upload, http.StatusOK)
+		case media.ErrNotFound, media.ErrIncomplete, media.ErrUploadBusy:
+			writeResumableError(w, err)
+		default:
+			writeUploadError(w, err)
+		}
+	}
+}
+
+// DeleteResumableUpload abandons an upload
+func DeleteResumableUpload(resumables *media.Resumables) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		setTusHeaders(w, nil)
+		if err := resumables.Delete(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+			writeResumableError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeResumableError maps resumable upload errors to responses
+func writeResumableError(w http.ResponseWriter, err error) {
+	switch err {
+	case media.ErrNotFound:
+		// tus clients start a new upload on 404
+		jsonError(w, "upload not found or expired", http.StatusNotFound)
+	case media.ErrOffsetMismatch:
+		jsonError(w, "Upload-Offset doesn't match the upload; HEAD it for the current offset", http.StatusConflict)
+	case media.ErrUploadBusy:
+		jsonError(w, "upload is busy with another request", http.StatusLocked)
+	case media.ErrIncomplete:
+		jsonError(w, "upload incomplete; send the remaining bytes first", http.StatusConflict)
+	default:
+		log.Printf("Resumable upload failed: %v", err)
+		jsonError(w, "upload failed", http.StatusInternalServerError)
+	}
+}
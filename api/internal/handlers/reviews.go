@@ -0,0 +1,577 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxReviewLength caps review comments and owner replies, in characters
+	maxReviewLength = 2000
+	// businessReviewPreview is the number of reviews embedded in GetBusiness
+	businessReviewPreview = 5
+)
+
+// reviewSorts maps the sort parameter to an ORDER BY clause
+var reviewSorts = map[string]string{
+	"newest":  "r.created_at DESC, r.id",
+	"helpful": "r.helpful_count DESC, r.created_at DESC, r.id",
+}
+
+// CreateReviewRequest is the request body for reviewing a business
+type CreateReviewRequest struct {
+	Rating  int     `json:"rating"`
+	Comment *string `json:"comment,omitempty"`
+}
+
+// UpdateReviewRequest is the request body for editing a review
+type UpdateReviewRequest struct {
+	Rating  *int    `json:"rating,omitempty"`
+	Comment *string `json:"comment,omitempty"`
+}
+
+// ReviewReplyRequest is the request body for an owner reply
+type ReviewReplyRequest struct {
+	Reply string `json:"reply"`
+}
+
+// ReviewResp is a review with its author and owner reply
+type ReviewResp struct {
+	ID            string         `json:"id"`
+	BusinessID    string         `json:"business_id"`
+	User          ReviewUserResp `json:"user"`
+	Rating        int            `json:"rating"`
+	Comment       *string        `json:"comment,omitempty"`
+	OwnerReply    *string        `json:"owner_reply,omitempty"`
+	OwnerReplyAt  *string        `json:"owner_reply_at,omitempty"`
+	HelpfulCount  int            `json:"helpful_count"`
+	MarkedHelpful bool           `json:"marked_helpful"` // by the current user
+	Edited        bool           `json:"edited"`
+	CreatedAt     string         `json:"created_at"`
+	UpdatedAt     string         `json:"updated_at"`
+}
+
+// ReviewUserResp is the public profile of a review author
+type ReviewUserResp struct {
+	ID       string  `json:"id"`
+	Name     *string `json:"name,omitempty"`
+	PhotoURL *string `json:"photo_url,omitempty"`
+}
+
+// selectReviews takes the current user id as $1
+const selectReviews = `
+	SELECT r.id, r.business_id, r.user_id, u.name, u.photo_url,
+		r.rating, r.comment, r.owner_reply, r.owner_reply_at, COALESCE(r.helpful_count, 0),
+		EXISTS(SELECT 1 FROM review_helpful_votes v WHERE v.review_id = r.id AND v.user_id = NULLIF($1, '')::uuid),
+		r.created_at, r.updated_at
+	FROM business_reviews r
+	JOIN users u ON u.id = r.user_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReview(s rowScanner) (*ReviewResp, error) {
+	var rv ReviewResp
+	var name, photo, comment, reply sql.NullString
+	var replyAt sql.NullTime
+	var createdAt, updatedAt time.Time
+	err := s.Scan(&rv.ID, &rv.BusinessID, &rv.User.ID, &name, &photo,
+		&rv.Rating, &comment, &reply, &replyAt, &rv.HelpfulCount,
+		&rv.MarkedHelpful, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if name.Valid {
+		rv.User.Name = &name.String
+	}
+	if photo.Valid {
+		rv.User.PhotoURL = &photo.String
+	}
+	if comment.Valid {
+		rv.Comment = &comment.String
+	}
+	if reply.Valid {
+		rv.OwnerReply = &reply.String
+	}
+	if replyAt.Valid {
+		at := replyAt.Time.Format(time.RFC3339)
+		rv.OwnerReplyAt = &at
+	}
+	rv.Edited = updatedAt.Sub(createdAt) > time.Second
+	rv.CreatedAt = createdAt.Format(time.RFC3339)
+	rv.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &rv, nil
+}
+
+// loadReviews returns a page of a business's reviews
+func loadReviews(db *sql.DB, businessID, userID, sort string, limit, offset int) ([]ReviewResp, error) {
+	rows, err := db.Query(selectReviews+`
+		WHERE r.business_id = $2
+		ORDER BY `+reviewSorts[sort]+`
+		LIMIT $3 OFFSET $4
+	`, userID, businessID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []ReviewResp{}
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, *rv)
+	}
+	return reviews, rows.Err()
+}
+
+// loadUserReview returns the user's review of a business, or nil
+func loadUserReview(db *sql.DB, businessID, userID string) (*ReviewResp, error) {
+	rv, err := scanReview(db.QueryRow(selectReviews+`
+		WHERE r.business_id = $2 AND r.user_id = NULLIF($1, '')::uuid
+	`, userID, businessID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rv, err
+}
+
+// ListReviews returns a business's reviews, newest or most helpful first
+func ListReviews(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		businessID := chi.URLParam(r, "id")
+
+		q := r.URL.Query()
+		sort := q.Get("sort")
+		if sort == "" {
+			sort = "newest"
+		}
+		if _, ok := reviewSorts[sort]; !ok {
+			jsonError(w, "sort must be newest or helpful", http.StatusBadRequest)
+			return
+		}
+
+		limit := 20
+		if v := q.Get("limit"); v != "" {
+			limit, _ = strconv.Atoi(v)
+		}
+		if limit <= 0 || limit > 50 {
+			limit = 20
+		}
+		offset := 0
+		if v := q.Get("offset"); v != "" {
+			offset, _ = strconv.Atoi(v)
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		var total int
+		var avgRating float64
+		err := db.QueryRow(`
+			SELECT review_count, avg_rating FROM businesses WHERE id = $1
+		`, businessID).Scan(&total, &avgRating)
+		if err == sql.ErrNoRows {
+			jsonError(w, "business not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get business rating: %v", err)
+			jsonError(w, "failed to get reviews", http.StatusInternalServerError)
+			return
+		}
+
+		reviews, err := loadReviews(db, businessID, userID, sort, limit, offset)
+		if err != nil {
+			log.Printf("Failed to get reviews: %v", err)
+			jsonError(w, "failed to get reviews", http.StatusInternalServerError)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"reviews":    reviews,
+			"count":      len(reviews),
+			"total":      total,
+			"avg_rating": avgRating,
+			"sort":       sort,
+			"offset":     offset,
+			"limit":      limit,
+		}
+		if userID != "" {
+			mine, err := loadUserReview(db, businessID, userID)
+			if err != nil {
+				log.Printf("Failed to get user review: %v", err)
+			} else if mine != nil {
+				resp["my_review"] = mine
+			}
+		}
+		jsonResponse(w, resp, http.StatusOK)
+	}
+}
+
+// CreateReview adds the current user's review of a business. Each user
+// can review a business once; later changes go through UpdateReview.
+func CreateReview(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		businessID := chi.URLParam(r, "id")
+
+		var req CreateReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Rating < 1 || req.Rating > 5 {
+			jsonError(w, "rating must be between 1 and 5", http.StatusBadRequest)
+			return
+		}
+		comment, ok := cleanReviewText(w, req.Comment, "comment")
+		if !ok {
+			return
+		}
+
+		var ownerID sql.NullString
+		var status string
+		err := db.QueryRow(`SELECT owner_id, status FROM businesses WHERE id = $1`, businessID).Scan(&ownerID, &status)
+		if err == sql.ErrNoRows || (err == nil && (status == "rejected" || status == "merged")) {
+			jsonError(w, "business not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get business: %v", err)
+			jsonError(w, "failed to create review", http.StatusInternalServerError)
+			return
+		}
+		if ownerID.Valid && ownerID.String == userID {
+			jsonError(w, "you cannot review your own business", http.StatusForbidden)
+			return
+		}
+
+		var reviewID string
+		err = db.QueryRow(`
+			INSERT INTO business_reviews (business_id, user_id, rating, comment)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, businessID, userID, req.Rating, comment).Scan(&reviewID)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			var existingID string
+			db.QueryRow(`SELECT id FROM business_reviews WHERE business_id = $1 AND user_id = $2`, businessID, userID).Scan(&existingID)
+			jsonResponse(w, map[string]string{
+				"error":     "you have already reviewed this business",
+				"review_id": existingID,
+			}, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to create review: %v", err)
+			jsonError(w, "failed to create review", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithReview(w, db, reviewID, userID, http.StatusCreated)
+	}
+}
+
+// UpdateReview edits the current user's review
+func UpdateReview(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req UpdateReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Rating == nil && req.Comment == nil {
+			jsonError(w, "rating or comment required", http.StatusBadRequest)
+			return
+		}
+		if req.Rating != nil && (*req.Rating < 1 || *req.Rating > 5) {
+			jsonError(w, "rating must be between 1 and 5", http.StatusBadRequest)
+			return
+		}
+		comment, ok := cleanReviewText(w, req.Comment, "comment")
+		if !ok {
+			return
+		}
+
+		// An empty comment clears it; an omitted one leaves it unchanged
+		var reviewID string
+		err := db.QueryRow(`
+			UPDATE business_reviews SET
+				rating = COALESCE($4, rating),
+				comment = CASE WHEN $5 THEN $6 ELSE comment END
+			WHERE id = $1 AND business_id = $2 AND user_id = $3
+			RETURNING id
+		`, chi.URLParam(r, "reviewId"), chi.URLParam(r, "id"), userID,
+			req.Rating, req.Comment != nil, comment).Scan(&reviewID)
+		if err == sql.ErrNoRows {
+			jsonError(w, "review not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to update review: %v", err)
+			jsonError(w, "failed to update review", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithReview(w, db, reviewID, userID, http.StatusOK)
+	}
+}
+
+// DeleteReview removes a review (its author or an admin)
+func DeleteReview(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reviewID, businessID := chi.URLParam(r, "reviewId"), chi.URLParam(r, "id")
+		var authorID string
+		err := db.QueryRow(`
+			SELECT user_id FROM business_reviews WHERE id = $1 AND business_id = $2
+		`, reviewID, businessID).Scan(&authorID)
+		if err == sql.ErrNoRows {
+			jsonError(w, "review not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get review: %v", err)
+			jsonError(w, "failed to delete review", http.StatusInternalServerError)
+			return
+		}
+		if authorID != userID && !isAdmin(db, userID) {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.Exec(`DELETE FROM business_reviews WHERE id = $1`, reviewID); err != nil {
+			log.Printf("Failed to delete review: %v", err)
+			jsonError(w, "failed to delete review", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]string{"message": "review deleted"}, http.StatusOK)
+	}
+}
+
+// ReplyToReview sets the business owner's public reply to a review
+func ReplyToReview(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req ReviewReplyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		reply, ok := cleanReviewText(w, &req.Reply, "reply")
+		if !ok {
+			return
+		}
+		if reply == nil {
+			jsonError(w, "reply required", http.StatusBadRequest)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		var reviewID string
+		err := db.QueryRow(`
+			UPDATE business_reviews SET owner_reply = $3, owner_reply_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND business_id = $2
+			RETURNING id
+		`, chi.URLParam(r, "reviewId"), businessID, *reply).Scan(&reviewID)
+		if err == sql.ErrNoRows {
+			jsonError(w, "review not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to reply to review: %v", err)
+			jsonError(w, "failed to reply to review", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithReview(w, db, reviewID, userID, http.StatusOK)
+	}
+}
+
+// DeleteReviewReply removes the owner reply from a review
+func DeleteReviewReply(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		businessID := chi.URLParam(r, "id")
+		if !canManageBusiness(w, db, businessID, userID) {
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE business_reviews SET owner_reply = NULL, owner_reply_at = NULL
+			WHERE id = $1 AND business_id = $2
+		`, chi.URLParam(r, "reviewId"), businessID)
+		if err != nil {
+			log.Printf("Failed to delete review reply: %v", err)
+			jsonError(w, "failed to delete reply", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, "review not found", http.StatusNotFound)
+			return
+		}
+
+		jsonResponse(w, map[string]string{"message": "reply deleted"}, http.StatusOK)
+	}
+}
+
+// MarkReviewHelpful records the current user's helpful vote on a review
+func MarkReviewHelpful(db *sql.DB) http.HandlerFunc {
+	return setReviewHelpful(db, true)
+}
+
+// UnmarkReviewHelpful removes the current user's helpful vote
+func UnmarkReviewHelpful(db *sql.DB) http.HandlerFunc {
+	return setReviewHelpful(db, false)
+}
+
+func setReviewHelpful(db *sql.DB, helpful bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var reviewID, authorID string
+		err := db.QueryRow(`
+			SELECT id, user_id FROM business_reviews WHERE id = $1 AND business_id = $2
+		`, chi.URLParam(r, "reviewId"), chi.URLParam(r, "id")).Scan(&reviewID, &authorID)
+		if err == sql.ErrNoRows {
+			jsonError(w, "review not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get review: %v", err)
+			jsonError(w, "failed to update vote", http.StatusInternalServerError)
+			return
+		}
+		if authorID == userID {
+			jsonError(w, "you cannot vote on your own review", http.StatusForbidden)
+			return
+		}
+
+		if helpful {
+			_, err = db.Exec(`
+				INSERT INTO review_helpful_votes (review_id, user_id)
+				VALUES ($1, $2)
+				ON CONFLICT DO NOTHING
+			`, reviewID, userID)
+		} else {
+			_, err = db.Exec(`DELETE FROM review_helpful_votes WHERE review_id = $1 AND user_id = $2`, reviewID, userID)
+		}
+		if err != nil {
+			log.Printf("Failed to update helpful vote: %v", err)
+			jsonError(w, "failed to update vote", http.StatusInternalServerError)
+			return
+		}
+
+		// Update helpful count
+		var count int
+		err = db.QueryRow(`
+			UPDATE business_reviews
+			SET helpful_count = (SELECT COUNT(*) FROM review_helpful_votes WHERE review_id = $1)
+			WHERE id = $1
+			RETURNING helpful_count
+		`, reviewID).Scan(&count)
+		if err != nil {
+			log.Printf("Failed to update helpful count: %v", err)
+			jsonError(w, "failed to update vote", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"helpful_count":  count,
+			"marked_helpful": helpful,
+		}, http.StatusOK)
+	}
+}
+
+// canManageBusiness reports whether the user owns the business or is an
+// admin, writing the error response otherwise
+func canManageBusiness(w http.ResponseWriter, db *sql.DB, businessID, userID string) bool {
+	var ownerID sql.NullString
+	err := db.QueryRow(`SELECT owner_id FROM businesses WHERE id = $1`, businessID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "business not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to get business owner: %v", err)
+		jsonError(w, "failed to get business", http.StatusInternalServerError)
+		return false
+	}
+	if (!ownerID.Valid || ownerID.String != userID) && !isAdmin(db, userID) {
+		jsonError(w, "only the business owner can do this", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// cleanReviewText trims a comment or reply and enforces maxReviewLength.
+// Empty text becomes nil.
+func cleanReviewText(w http.ResponseWriter, text *string, field string) (*string, bool) {
+	if text == nil {
+		return nil, true
+	}
+	s := strings.TrimSpace(*text)
+	if len([]rune(s)) > maxReviewLength {
+		jsonErrorf(w, "%s must be at most %d characters", http.StatusBadRequest, field, maxReviewLength)
+		return nil, false
+	}
+	if s == "" {
+		return nil, true
+	}
+	return &s, true
+}
+
+func respondWithReview(w http.ResponseWriter, db *sql.DB, reviewID, userID string, status int) {
+	rv, err := scanReview(db.QueryRow(selectReviews+" WHERE r.id = $2", userID, reviewID))
+	if err != nil {
+		log.Printf("Failed to load review: %v", err)
+		jsonError(w, "failed to load review", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, rv, status)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"maps/api/internal/middleware"
+	"maps/api/internal/staticmap"
+)
+
+const (
+	staticMapMaxMarkers = 50
+	staticMapMaxPoints  = 5000
+)
+
+// GetStaticMap renders a PNG map image.
+//
+//	center=lat,lng     optional if markers or a polyline are given
+//	zoom=15            optional, fitted to the overlays when omitted
+//	size=600x300       CSS pixels
+//	scale=1|2
+//	markers=lat,lng[,color]   repeatable or separated by |
+//	polyline=<encoded>        with polyline_color, polyline_width, precision=5|6
+//	style=didi, tileset=addis
+func GetStaticMap(renderer *staticmap.Renderer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseStaticMapOptions(r)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		img, err := renderer.Render(r.Context(), *opts)
+		if err == staticmap.ErrNoCenter {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to render static map: %v", err)
+			jsonError(w, "failed to render map", http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			jsonError(w, "failed to encode map", http.StatusInternalServerError)
+			return
+		}
+
+		writeAsset(w, r, buf.Bytes(), "image/png")
+	}
+}
+
+func parseStaticMapOptions(r *http.Request) (*staticmap.Options, error) {
+	q := r.URL.Query()
+	opts := &staticmap.Options{
+		Width:   600,
+		Height:  300,
+		Scale:   1,
+		Tileset: q.Get("tileset"),
+		Style:   q.Get("style"),
+	}
+	if opts.Tileset == "" {
+		opts.Tileset = defaultTileset
+	}
+	if opts.Style == "" {
+		opts.Style = "didi"
+	}
+
+	if v := q.Get("center"); v != "" {
+		ll, err := parseLatLng(v)
+		if err != nil {
+			return nil, err
+		}
+		opts.Center = &ll
+	}
+
+	if v := q.Get("zoom"); v != "" {
+		zoom, err := strconv.ParseFloat(v, 64)
+		if err != nil || zoom < 0 || zoom > staticmap.MaxZoom {
+			return nil, fmt.Errorf("zoom must be between 0 and %d", staticmap.MaxZoom)
+		}
+		opts.Zoom = &zoom
+	}
+
+	if v := q.Get("size"); v != "" {
+		var width, height int
+		if _, err := fmt.Sscanf(v, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("size must be WIDTHxHEIGHT")
+		}
+		if width < staticmap.MinSize || height < staticmap.MinSize {
+			return nil, fmt.Errorf("size must be at least %dx%d pixels", staticmap.MinSize, staticmap.MinSize)
+		}
+		opts.Width, opts.Height = width, height
+	}
+
+	if v := q.Get("scale"); v != "" {
+		scale, err := strconv.Atoi(v)
+		if err != nil || scale < 1 || scale > 2 {
+			return nil, fmt.Errorf("scale must be 1 or 2")
+		}
+		opts.Scale = scale
+	}
+	if opts.Width*opts.Scale > staticmap.MaxSize || opts.Height*opts.Scale > staticmap.MaxSize {
+		return nil, fmt.Errorf("size must be at most %dx%d pixels after scaling", staticmap.MaxSize, staticmap.MaxSize)
+	}
+
+	for _, v := range q["markers"] {
+		for _, spec := range strings.Split(v, "|") {
+			if spec = strings.TrimSpace(spec); spec == "" {
+				continue
+			}
+			parts := strings.Split(spec, ",")
+			if len(parts) < 2 || len(parts) > 3 {
+				return nil, fmt.Errorf("markers must be lat,lng[,color]")
+			}
+			ll, err := parseLatLng(parts[0] + "," + parts[1])
+			if err != nil {
+				return nil, err
+			}
+			m := staticmap.Marker{LatLng: ll}
+			if len(parts) == 3 {
+				if m.Color, err = staticmap.ParseColorParam(parts[2]); err != nil {
+					return nil, err
+				}
+			}
+			opts.Markers = append(opts.Markers, m)
+		}
+	}
+	if len(opts.Markers) > staticMapMaxMarkers {
+		return nil, fmt.Errorf("at most %d markers are allowed", staticMapMaxMarkers)
+	}
+
+	if v := q.Get("polyline"); v != "" {
+		precision := 5
+		if q.Get("precision") == "6" {
+			precision = 6
+		}
+		points, err := staticmap.DecodePolyline(v, precision)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) > staticMapMaxPoints {
+			return nil, fmt.Errorf("polyline has more than %d points", staticMapMaxPoints)
+		}
+		path := staticmap.Path{Points: points}
+		if c := q.Get("polyline_color"); c != "" {
+			if path.Color, err = staticmap.ParseColorParam(c); err != nil {
+				return nil, err
+			}
+		}
+		if v := q.Get("polyline_width"); v != "" {
+			width, err := strconv.ParseFloat(v, 64)
+			if err != nil || width <= 0 || width > 20 {
+				return nil, fmt.Errorf("polyline_width must be between 0 and 20")
+			}
+			path.Width = width
+		}
+		opts.Paths = append(opts.Paths, path)
+	}
+
+	return opts, nil
+}
+
+func parseLatLng(v string) (staticmap.LatLng, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return staticmap.LatLng{}, fmt.Errorf("invalid coordinate %q, expected lat,lng", v)
+	}
+	lat, lng := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if err := middleware.ValidateCoordinate(lat, lng); err != nil {
+		return staticmap.LatLng{}, err
+	}
+	latF, _ := strconv.ParseFloat(lat, 64)
+	lngF, _ := strconv.ParseFloat(lng, 64)
+	return staticmap.LatLng{Lat: latF, Lng: lngF}, nil
+}
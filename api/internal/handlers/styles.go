@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"maps/api/internal/styles"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetStyle serves a map style with its tile, glyph and sprite URLs pointed
+// at the host the client used
+func GetStyle(assets *styles.Assets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+
+		data, err := assets.Style(name, requestBaseURL(r))
+		if err == styles.ErrNotFound {
+			jsonError(w, "style not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load style %s: %v", name, err)
+			jsonError(w, "failed to load style", http.StatusInternalServerError)
+			return
+		}
+
+		// The document embeds the request host
+		w.Header().Add("Vary", "Host, X-Forwarded-Host, X-Forwarded-Proto")
+		writeAsset(w, r, data, "application/json")
+	}
+}
+
+// ListStyles returns the available style names and URLs
+func ListStyles(assets *styles.Assets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := []map[string]string{}
+		for _, name := range assets.StyleNames() {
+			list = append(list, map[string]string{
+				"name": name,
+				"url":  requestBaseURL(r) + "/api/styles/" + name + ".json",
+			})
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		jsonResponse(w, map[string]interface{}{
+			"styles": list,
+			"count":  len(list),
+		}, http.StatusOK)
+	}
+}
+
+// GetGlyphs serves /api/fonts/{fontstack}/{range}.pbf, composing the glyphs
+// of every font in the stack
+func GetGlyphs(assets *styles.Assets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fontstack, err := url.PathUnescape(chi.URLParam(r, "fontstack"))
+		if err != nil {
+			jsonError(w, "invalid fontstack", http.StatusBadRequest)
+			return
+		}
+
+		data, err := assets.Glyphs(fontstack, chi.URLParam(r, "range"))
+		if err == styles.ErrNotFound {
+			jsonError(w, "font not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to compose glyphs %s: %v", fontstack, err)
+			jsonError(w, "failed to load font", http.StatusInternalServerError)
+			return
+		}
+
+		writeAsset(w, r, data, "application/x-protobuf")
+	}
+}
+
+// GetSprite serves sprite sheets and their indexes, e.g.
+// /api/sprites/didi.json and /api/sprites/didi@2x.png
+func GetSprite(assets *styles.Assets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file := chi.URLParam(r, "file")
+
+		path, err := assets.SpritePath(file)
+		if err != nil {
+			jsonError(w, "sprite not found", http.StatusNotFound)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			jsonError(w, "failed to load sprite", http.StatusInternalServerError)
+			return
+		}
+
+		contentType := "image/png"
+		if filepath.Ext(file) == ".json" {
+			contentType = "application/json"
+		}
+		writeAsset(w, r, data, contentType)
+	}
+}
+
+// writeAsset writes a static map asset with a content-hash ETag. Requests
+// carrying a version (?v=, as emitted in styles) are cacheable forever.
+func writeAsset(w http.ResponseWriter, r *http.Request, data []byte, contentType string) {
+	sum := sha1.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	if r.URL.Query().Get("v") != "" {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -1,115 +1,245 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
-	"maps/api/internal/config"
 	"maps/api/internal/middleware"
+	"maps/api/internal/tiles"
 
 	"github.com/go-chi/chi/v5"
 )
 
-// GetTile proxies tile requests to mbtileserver
-// mbtileserver URL format: /services/{tileset}/{z}/{x}/{y}.pbf
-func GetTile(cfg *config.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		z := chi.URLParam(r, "z")
-		x := chi.URLParam(r, "x")
-		y := chi.URLParam(r, "y")
+// defaultTileset is served when no tileset is requested
+const defaultTileset = "addis"
 
-		if err := middleware.ValidateTileCoords(z, x, y); err != nil {
-			jsonError(w, err.Error(), http.StatusBadRequest)
-			return
+// GetTile serves a tile from a local tileset chosen with ?tileset=
+func GetTile(store *tiles.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("tileset")
+		if name == "" {
+			name = defaultTileset
 		}
+		serveTile(w, r, store, name, chi.URLParam(r, "z"), chi.URLParam(r, "x"), chi.URLParam(r, "y"))
+	}
+}
 
-		// mbtileserver format: /services/{tileset}/{z}/{x}/{y}.pbf
-		// Default tileset name based on .mbtiles filename
-		tileset := r.URL.Query().Get("tileset")
-		if tileset == "" {
-			tileset = "addis" // default tileset name (from mbtiles filename)
+// GetTilesetTile serves /api/tiles/{tileset}/{z}/{x}/{y} from an MBTiles or
+// PMTiles tileset. A file extension on y is optional and ignored.
+func GetTilesetTile(store *tiles.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		y := chi.URLParam(r, "y")
+		if i := strings.IndexByte(y, '.'); i >= 0 {
+			y = y[:i]
 		}
+		serveTile(w, r, store, chi.URLParam(r, "tileset"), chi.URLParam(r, "z"), chi.URLParam(r, "x"), y)
+	}
+}
 
-		tileURL := fmt.Sprintf("%s/services/%s/tiles/%s/%s/%s.pbf", cfg.TileHost, tileset, z, x, y)
+func serveTile(w http.ResponseWriter, r *http.Request, store *tiles.Store, name, z, x, y string) {
+	if err := middleware.ValidateTileCoords(z, x, y); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	zInt, _ := strconv.Atoi(z)
+	xInt, _ := strconv.Atoi(x)
+	yInt, _ := strconv.Atoi(y)
+
+	tile, meta, err := store.Tile(r.Context(), name, zInt, xInt, yInt)
+	if err == tiles.ErrTilesetNotFound {
+		jsonError(w, "tileset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read tile %s/%s/%s/%s: %v", name, z, x, y, err)
+		jsonError(w, "failed to read tile", http.StatusInternalServerError)
+		return
+	}
 
-		resp, err := http.Get(tileURL)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if len(tile.Data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeTileData(w, r, tile, tiles.ContentType(meta.Format))
+}
+
+// writeTileData writes a tile with its ETag, answering conditional requests
+// with 304. Gzipped tiles are passed through with Content-Encoding: gzip, or
+// decompressed (under a distinct ETag) for clients that don't accept it.
+func writeTileData(w http.ResponseWriter, r *http.Request, tile *tiles.Tile, contentType string) {
+	data, etag := tile.Data, tile.ETag
+
+	gzipped := tiles.IsGzipped(data)
+	identity := gzipped && !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	if identity {
+		etag = strings.TrimSuffix(etag, `"`) + `-identity"`
+	}
+	if gzipped {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if identity {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
 		if err != nil {
-			jsonError(w, "tile service unavailable", http.StatusServiceUnavailable)
+			jsonError(w, "failed to read tile", http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
-
-		// Propagate status code and relevant headers from mbtileserver.
-		// Do NOT force Content-Encoding; mismatched encoding causes
-		// ERR_CONTENT_DECODING_FAILED in browsers.
-		for k, vv := range resp.Header {
-			// Skip hop-by-hop headers
-			if k == "Connection" || k == "Keep-Alive" || k == "Proxy-Authenticate" ||
-				k == "Proxy-Authorization" || k == "Te" || k == "Trailers" ||
-				k == "Transfer-Encoding" || k == "Upgrade" || k == "Content-Encoding" {
-				continue
-			}
-			for _, v := range vv {
-				w.Header().Add(k, v)
-			}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			jsonError(w, "failed to read tile", http.StatusInternalServerError)
+			return
 		}
-		w.Header().Set("Cache-Control", "public, max-age=86400")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
+	} else if gzipped {
+		w.Header().Set("Content-Encoding", "gzip")
 	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
 }
 
-// GetTileJSON returns the TileJSON metadata for a tileset
-func GetTileJSON(cfg *config.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		tileset := r.URL.Query().Get("tileset")
-		if tileset == "" {
-			tileset = "osm"
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison required for GET
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			return true
 		}
+	}
+	return false
+}
 
-		tileJSONURL := fmt.Sprintf("%s/services/%s", cfg.TileHost, tileset)
+// GetPOITile serves business POI vector tiles generated live from PostGIS.
+// Tiles carry a content-hash ETag so clients revalidate cheaply and pick up
+// business changes as soon as the cache is invalidated.
+func GetPOITile(src *tiles.POISource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		z := chi.URLParam(r, "z")
+		x := chi.URLParam(r, "x")
+		y := chi.URLParam(r, "y")
 
-		resp, err := http.Get(tileJSONURL)
-		if err != nil {
-			jsonError(w, "tile service unavailable", http.StatusServiceUnavailable)
+		if err := middleware.ValidateTileCoords(z, x, y); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
+		zInt, _ := strconv.Atoi(z)
+		xInt, _ := strconv.Atoi(x)
+		yInt, _ := strconv.Atoi(y)
+
+		tile, err := src.Tile(r.Context(), zInt, xInt, yInt)
 		if err != nil {
-			jsonError(w, "failed to read tilejson", http.StatusInternalServerError)
+			log.Printf("Failed to render POI tile %s/%s/%s: %v", z, x, y, err)
+			jsonError(w, "failed to render tile", http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.WriteHeader(resp.StatusCode)
-		w.Write(body)
+		w.Header().Set("Cache-Control", "public, max-age=60, must-revalidate")
+
+		if len(tile.Data) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeTileData(w, r, tile, "application/vnd.mapbox-vector-tile")
 	}
 }
 
-// ListTilesets returns available tilesets from mbtileserver
-func ListTilesets(cfg *config.Config) http.HandlerFunc {
+// GetTileJSON returns the TileJSON metadata for a tileset
+func GetTileJSON(store *tiles.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		resp, err := http.Get(fmt.Sprintf("%s/services", cfg.TileHost))
-		if err != nil {
-			jsonError(w, "tile service unavailable", http.StatusServiceUnavailable)
-			return
+		name := r.URL.Query().Get("tileset")
+		if name == "" {
+			name = defaultTileset
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			jsonError(w, "failed to read tilesets", http.StatusInternalServerError)
+		ts, release, ok := store.Get(name)
+		if !ok {
+			jsonError(w, "tileset not found", http.StatusNotFound)
 			return
 		}
+		meta := ts.Metadata()
+		release()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		jsonResponse(w, tiles.TileJSON(meta, name, tileURL(r, name, meta.Format)), http.StatusOK)
+	}
+}
+
+// ListTilesets returns the available tilesets
+func ListTilesets(store *tiles.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := []map[string]interface{}{}
+		for _, name := range store.Names() {
+			ts, release, ok := store.Get(name)
+			if !ok {
+				continue
+			}
+			meta, modified := ts.Metadata(), ts.ModTime()
+			release()
+			list = append(list, map[string]interface{}{
+				"name":     name,
+				"format":   meta.Format,
+				"minzoom":  meta.MinZoom,
+				"maxzoom":  meta.MaxZoom,
+				"modified": modified,
+				"url":      requestBaseURL(r) + "/api/tiles/json?tileset=" + url.QueryEscape(name),
+			})
+		}
 
-		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.WriteHeader(resp.StatusCode)
-		w.Write(body)
+		jsonResponse(w, map[string]interface{}{
+			"tilesets": list,
+			"count":    len(list),
+		}, http.StatusOK)
+	}
+}
+
+// tileURL is the public XYZ template for a tileset
+func tileURL(r *http.Request, name, format string) string {
+	ext := format
+	if ext == "" {
+		ext = "pbf"
+	}
+	return fmt.Sprintf("%s/api/tiles/%s/{z}/{x}/{y}.%s", requestBaseURL(r), url.PathEscape(name), ext)
+}
+
+// requestBaseURL is the scheme and host the client used to reach us,
+// honoring the proxy headers set by Caddy
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host = fwd
 	}
+	return scheme + "://" + host
 }
@@ -1,64 +1,141 @@
 package handlers
 
 import (
-	"fmt"
-	"io"
+	"encoding/json"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
-	"time"
 
-	"maps/api/internal/config"
+	"maps/api/internal/media"
 )
 
-// UploadFile handles file uploads
-func UploadFile(cfg *config.Config) http.HandlerFunc {
+// UploadFile handles image and video uploads. Images are stored as full,
+// medium and thumbnail renditions without metadata. Videos get a poster
+// frame as thumbnail and are transcoded to HLS in the background; their
+// status stays "processing" until then. The returned URLs can be attached
+// to a business, post or profile; uploads left unattached are removed later.
+func UploadFile(uploads *media.Uploads) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse multipart form (10MB max)
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Keep up to 10MB of the form in memory and spill the rest to temp
+		// files; the body is capped at the largest upload plus form overhead
+		r.Body = http.MaxBytesReader(w, r.Body, uploads.MaxLength()+1<<20)
 		r.ParseMultipartForm(10 << 20)
 
-		file, handler, err := r.FormFile("file")
+		file, _, err := r.FormFile("file")
 		if err != nil {
 			jsonError(w, "invalid file", http.StatusBadRequest)
 			return
 		}
 		defer file.Close()
 
-		// Validate file type
-		ext := strings.ToLower(filepath.Ext(handler.Filename))
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" {
-			jsonError(w, "only jpg, png, and webp allowed", http.StatusBadRequest)
+		upload, err := uploads.Save(r.Context(), userID, file)
+		if err != nil {
+			writeUploadError(w, err)
 			return
 		}
 
-		// Create uploads directory if not exists
-		uploadDir := "./uploads"
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			jsonError(w, "failed to create upload directory", http.StatusInternalServerError)
+		jsonResponse(w, upload, http.StatusOK)
+	}
+}
+
+// PresignUploadRequest is the request body for a direct upload
+type PresignUploadRequest struct {
+	ContentType string `json:"content_type"`
+}
+
+// CompleteUploadRequest is the request body for finishing a direct upload
+type CompleteUploadRequest struct {
+	Key string `json:"key"`
+}
+
+// PresignUpload returns a URL the client uploads a file to directly, without
+// going through the API. Finish with CompleteUpload.
+func PresignUpload(uploads *media.Uploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		// Generate unique filename
-		filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), handler.Filename)
-		filepath := filepath.Join(uploadDir, filename)
+		var req PresignUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
 
-		// Save file
-		dst, err := os.Create(filepath)
+		pending, err := uploads.Presign(r.Context(), userID, req.ContentType)
+		if err == media.ErrUnsupportedType {
+			jsonError(w, "content_type must be image/jpeg, image/png, image/webp, video/mp4, video/quicktime or video/webm", http.StatusBadRequest)
+			return
+		}
+		if err == media.ErrVideoDisabled {
+			writeUploadError(w, err)
+			return
+		}
 		if err != nil {
-			jsonError(w, "failed to save file", http.StatusInternalServerError)
+			log.Printf("Failed to presign upload: %v", err)
+			jsonError(w, "failed to start upload", http.StatusInternalServerError)
+			return
+		}
+		// The local backend takes uploads on the API itself
+		if strings.HasPrefix(pending.URL, "/") {
+			pending.URL = requestBaseURL(r) + pending.URL
+		}
+
+		jsonResponse(w, pending, http.StatusOK)
+	}
+}
+
+// CompleteUpload processes a file uploaded to a presigned URL the same way
+// as UploadFile
+func CompleteUpload(uploads *media.Uploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromContext(r)
+		if userID == "" {
+			jsonError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CompleteUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+			jsonError(w, "key is required", http.StatusBadRequest)
 			return
 		}
-		defer dst.Close()
 
-		if _, err := io.Copy(dst, file); err != nil {
-			jsonError(w, "failed to write file", http.StatusInternalServerError)
+		upload, err := uploads.Complete(r.Context(), userID, req.Key)
+		if err != nil {
+			writeUploadError(w, err)
 			return
 		}
 
-		// Return public URL
-		// Assuming /uploads is served statically
-		publicURL := fmt.Sprintf("/uploads/%s", filename)
-		jsonResponse(w, map[string]string{"url": publicURL}, http.StatusOK)
+		jsonResponse(w, upload, http.StatusOK)
+	}
+}
+
+// writeUploadError maps media errors to responses
+func writeUploadError(w http.ResponseWriter, err error) {
+	switch err {
+	case media.ErrNotFound:
+		jsonError(w, "upload not found; PUT the file to the upload URL first", http.StatusNotFound)
+	case media.ErrUnsupportedType:
+		jsonError(w, "only jpg, png, and webp images and mp4, mov, and webm videos allowed", http.StatusBadRequest)
+	case media.ErrTooManyPixels:
+		jsonError(w, "image dimensions too large", http.StatusBadRequest)
+	case media.ErrTooLarge:
+		jsonError(w, "file too large", http.StatusRequestEntityTooLarge)
+	case media.ErrTooLong:
+		jsonError(w, "video too long", http.StatusBadRequest)
+	case media.ErrVideoDisabled:
+		jsonError(w, "video uploads are not available", http.StatusServiceUnavailable)
+	default:
+		log.Printf("Failed to save upload: %v", err)
+		jsonError(w, "failed to save file", http.StatusInternalServerError)
 	}
 }
@@ -0,0 +1,81 @@
+package holidays
+
+import "time"
+
+// jdEpochAmeteMihret is the Julian Day Number of 1 Meskerem 1 in the
+// Ethiopian (Amete Mihret) calendar, minus one year of days
+const jdEpochAmeteMihret = 1723856
+
+// EthiopianDate is a date in the Ethiopian calendar: twelve 30-day months
+// and Pagume with 5 days, or 6 when the year is a leap year
+type EthiopianDate struct {
+	Year, Month, Day int
+}
+
+// IsLeapYear reports whether an Ethiopian year has a 6-day Pagume
+func IsLeapYear(year int) bool {
+	return year%4 == 3
+}
+
+// ToEthiopian converts a Gregorian date to the Ethiopian calendar
+func ToEthiopian(t time.Time) EthiopianDate {
+	jdn := gregorianToJDN(t.Year(), int(t.Month()), t.Day())
+	r := (jdn - jdEpochAmeteMihret) % 1461
+	n := r%365 + 365*(r/1460)
+	return EthiopianDate{
+		Year:  4*((jdn-jdEpochAmeteMihret)/1461) + r/365 - r/1460,
+		Month: n/30 + 1,
+		Day:   n%30 + 1,
+	}
+}
+
+// Gregorian returns the Gregorian date of an Ethiopian date, at midnight UTC
+func (d EthiopianDate) Gregorian() time.Time {
+	jdn := jdEpochAmeteMihret + 365 + 365*(d.Year-1) + d.Year/4 + 30*d.Month + d.Day - 31
+	y, m, day := jdnToGregorian(jdn)
+	return time.Date(y, time.Month(m), day, 0, 0, 0, 0, time.UTC)
+}
+
+func gregorianToJDN(y, m, d int) int {
+	a := (14 - m) / 12
+	y = y + 4800 - a
+	m = m + 12*a - 3
+	return d + (153*m+2)/5 + 365*y + y/4 - y/100 + y/400 - 32045
+}
+
+func jdnToGregorian(jdn int) (int, int, int) {
+	a := jdn + 32044
+	b := (4*a + 3) / 146097
+	c := a - 146097*b/4
+	d := (4*c + 3) / 1461
+	e := c - 1461*d/4
+	m := (5*e + 2) / 153
+	day := e - (153*m+2)/5 + 1
+	month := m + 3 - 12*(m/10)
+	year := 100*b + d - 4800 + m/10
+	return year, month, day
+}
+
+// orthodoxEaster returns Fasika, the Ethiopian Orthodox Easter Sunday, of a
+// Gregorian year. The date is computed on the Julian calendar (Meeus) and
+// shifted by the Julian-Gregorian difference.
+func orthodoxEaster(year int) time.Time {
+	a := year % 4
+	b := year % 7
+	c := year % 19
+	d := (19*c + 15) % 30
+	e := (2*a + 4*b - d + 34) % 7
+	month := (d + e + 114) / 31
+	day := (d+e+114)%31 + 1
+
+	jdn := julianToJDN(year, month, day)
+	y, m, dd := jdnToGregorian(jdn)
+	return time.Date(y, time.Month(m), dd, 0, 0, 0, 0, time.UTC)
+}
+
+func julianToJDN(y, m, d int) int {
+	a := (14 - m) / 12
+	y = y + 4800 - a
+	m = m + 12*a - 3
+	return d + (153*m+2)/5 + 365*y + y/4 - 32083
+}
@@ -0,0 +1,59 @@
+package holidays
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToEthiopian(t *testing.T) {
+	for _, tc := range []struct {
+		date string
+		want EthiopianDate
+	}{
+		// 2015 E.C. is a leap year: Pagume has 6 days and the new year is
+		// on 12 September
+		{"2023-09-11", EthiopianDate{2015, 13, 6}},
+		{"2023-09-12", EthiopianDate{2016, 1, 1}},
+		{"2024-02-29", EthiopianDate{2016, 6, 21}},
+		{"2024-09-10", EthiopianDate{2016, 13, 5}},
+		{"2024-09-11", EthiopianDate{2017, 1, 1}},
+		{"2025-09-11", EthiopianDate{2018, 1, 1}},
+		{"2019-09-12", EthiopianDate{2012, 1, 1}},
+		{"2020-09-11", EthiopianDate{2013, 1, 1}},
+	} {
+		g, err := time.Parse("2006-01-02", tc.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ToEthiopian(g); got != tc.want {
+			t.Errorf("ToEthiopian(%s) = %v, want %v", tc.date, got, tc.want)
+		}
+		if got := tc.want.Gregorian(); !got.Equal(g) {
+			t.Errorf("%v.Gregorian() = %s, want %s", tc.want, got.Format("2006-01-02"), tc.date)
+		}
+	}
+}
+
+func TestIsLeapYear(t *testing.T) {
+	for year, want := range map[int]bool{2011: true, 2012: false, 2015: true, 2016: false, 2019: true} {
+		if got := IsLeapYear(year); got != want {
+			t.Errorf("IsLeapYear(%d) = %v, want %v", year, got, want)
+		}
+	}
+}
+
+func TestOrthodoxEaster(t *testing.T) {
+	for year, want := range map[int]string{
+		2019: "2019-04-28",
+		2021: "2021-05-02",
+		2022: "2022-04-24",
+		2023: "2023-04-16",
+		2024: "2024-05-05",
+		2025: "2025-04-20",
+		2026: "2026-04-12",
+	} {
+		if got := orthodoxEaster(year).Format("2006-01-02"); got != want {
+			t.Errorf("orthodoxEaster(%d) = %s, want %s", year, got, want)
+		}
+	}
+}
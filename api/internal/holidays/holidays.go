@@ -0,0 +1,181 @@
+// Package holidays computes Ethiopian public holidays and keeps their dates
+// in the holiday_dates table, where business special hours refer to them by
+// key. Holidays that follow the moon (Eid al-Fitr, Eid al-Adha, Mawlid) are
+// announced each year and added by admins instead.
+package holidays
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Holiday sources
+const (
+	SourceCalendar = "calendar"
+	SourceManual   = "manual"
+)
+
+// ErrNotFound is returned for unknown holiday dates
+var ErrNotFound = errors.New("holiday not found")
+
+// Holiday is one dated occurrence of a public holiday
+type Holiday struct {
+	Key         string  `json:"key"`
+	Date        string  `json:"date"` // YYYY-MM-DD
+	Name        string  `json:"name"`
+	NameAm      *string `json:"name_am,omitempty"`
+	CountryCode string  `json:"country_code"`
+	Source      string  `json:"source"`
+}
+
+// definition is a calendar holiday and the way to find its dates in a
+// Gregorian year
+type definition struct {
+	key    string
+	name   string
+	nameAm string
+	dates  func(year int) []time.Time
+}
+
+var definitions = []definition{
+	{"genna", "Ethiopian Christmas", "ገና", gregorian(time.January, 7)},
+	{"timkat", "Epiphany", "ጥምቀት", ethiopian(5, 11)},
+	{"adwa", "Adwa Victory Day", "የዓድዋ ድል በዓል", ethiopian(6, 23)},
+	{"siklet", "Good Friday", "ስቅለት", easter(-2)},
+	{"fasika", "Easter", "ፋሲካ", easter(0)},
+	{"labour_day", "International Labour Day", "የዓለም የሠራተኞች ቀን", gregorian(time.May, 1)},
+	{"patriots_victory", "Patriots' Victory Day", "የአርበኞች ቀን", ethiopian(8, 27)},
+	{"derg_downfall", "Downfall of the Derg", "ግንቦት 20", ethiopian(9, 20)},
+	{"enkutatash", "Ethiopian New Year", "እንቁጣጣሽ", ethiopian(1, 1)},
+	{"meskel", "Finding of the True Cross", "መስቀል", ethiopian(1, 17)},
+}
+
+func gregorian(month time.Month, day int) func(int) []time.Time {
+	return func(year int) []time.Time {
+		return []time.Time{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+	}
+}
+
+// ethiopian returns the dates of an Ethiopian month and day that fall in a
+// Gregorian year. The Ethiopian year starts in September, so a Gregorian
+// year overlaps two of them.
+func ethiopian(month, day int) func(int) []time.Time {
+	return func(year int) []time.Time {
+		var dates []time.Time
+		for _, ey := range []int{year - 8, year - 7} {
+			t := EthiopianDate{Year: ey, Month: month, Day: day}.Gregorian()
+			if t.Year() == year {
+				dates = append(dates, t)
+			}
+		}
+		return dates
+	}
+}
+
+func easter(offsetDays int) func(int) []time.Time {
+	return func(year int) []time.Time {
+		return []time.Time{orthodoxEaster(year).AddDate(0, 0, offsetDays)}
+	}
+}
+
+// ForYear returns the calendar holidays of a Gregorian year, ordered by date
+func ForYear(year int) []Holiday {
+	var list []Holiday
+	for _, def := range definitions {
+		for _, t := range def.dates(year) {
+			nameAm := def.nameAm
+			list = append(list, Holiday{
+				Key:         def.key,
+				Date:        t.Format("2006-01-02"),
+				Name:        def.name,
+				NameAm:      &nameAm,
+				CountryCode: "ET",
+				Source:      SourceCalendar,
+			})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Date < list[j].Date })
+	return list
+}
+
+// Sync stores the calendar holidays from last year to two years ahead, so
+// special hours resolve for any date the API evaluates
+func Sync(ctx context.Context, db *sql.DB) error {
+	year := time.Now().Year()
+	for y := year - 1; y <= year+2; y++ {
+		for _, h := range ForYear(y) {
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO holiday_dates (key, date, name, name_am, country_code, source)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (key, date) DO UPDATE SET name = EXCLUDED.name, name_am = EXCLUDED.name_am
+			`, h.Key, h.Date, h.Name, h.NameAm, h.CountryCode, h.Source)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the stored holidays of a Gregorian year, ordered by date
+func List(ctx context.Context, db *sql.DB, year int) ([]Holiday, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT key, date::text, name, name_am, country_code, source
+		FROM holiday_dates
+		WHERE date >= make_date($1, 1, 1) AND date < make_date($1 + 1, 1, 1)
+		ORDER BY date, key
+	`, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Holiday{}
+	for rows.Next() {
+		var h Holiday
+		var nameAm sql.NullString
+		if err := rows.Scan(&h.Key, &h.Date, &h.Name, &nameAm, &h.CountryCode, &h.Source); err != nil {
+			return nil, err
+		}
+		if nameAm.Valid {
+			h.NameAm = &nameAm.String
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// KeyExists reports whether any date is stored for a holiday key
+func KeyExists(ctx context.Context, db *sql.DB, key string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM holiday_dates WHERE key = $1)`, key).Scan(&exists)
+	return exists, err
+}
+
+// Put adds or renames a manually announced holiday date
+func Put(ctx context.Context, db *sql.DB, h Holiday) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO holiday_dates (key, date, name, name_am, country_code, source)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key, date) DO UPDATE SET name = EXCLUDED.name, name_am = EXCLUDED.name_am
+	`, h.Key, h.Date, h.Name, h.NameAm, h.CountryCode, SourceManual)
+	return err
+}
+
+// Delete removes a manually added holiday date. Calendar dates are
+// recomputed at startup and cannot be deleted.
+func Delete(ctx context.Context, db *sql.DB, key, date string) error {
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM holiday_dates WHERE key = $1 AND date = $2 AND source = $3
+	`, key, date, SourceManual)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package holidays
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestForYear(t *testing.T) {
+	for _, tc := range []struct {
+		year int
+		want map[string]string
+	}{
+		// Follows the Ethiopian leap year 2015, so the September holidays
+		// and Timkat of the next year move a day later
+		{2023, map[string]string{
+			"genna":      "2023-01-07",
+			"timkat":     "2023-01-19",
+			"siklet":     "2023-04-14",
+			"fasika":     "2023-04-16",
+			"enkutatash": "2023-09-12",
+			"meskel":     "2023-09-28",
+		}},
+		{2024, map[string]string{
+			"timkat":           "2024-01-20",
+			"adwa":             "2024-03-02",
+			"siklet":           "2024-05-03",
+			"fasika":           "2024-05-05",
+			"patriots_victory": "2024-05-05",
+			"derg_downfall":    "2024-05-28",
+			"enkutatash":       "2024-09-11",
+			"meskel":           "2024-09-27",
+		}},
+		{2025, map[string]string{
+			"fasika":     "2025-04-20",
+			"enkutatash": "2025-09-11",
+			"meskel":     "2025-09-27",
+		}},
+	} {
+		list := ForYear(tc.year)
+		got := map[string]string{}
+		for _, h := range list {
+			if _, dup := got[h.Key]; dup {
+				t.Errorf("%d: %s listed twice", tc.year, h.Key)
+			}
+			got[h.Key] = h.Date
+			if h.Source != SourceCalendar || h.CountryCode != "ET" {
+				t.Errorf("%d: %s is %s/%s", tc.year, h.Key, h.Source, h.CountryCode)
+			}
+		}
+		for key, date := range tc.want {
+			if got[key] != date {
+				t.Errorf("%d: %s = %q, want %s", tc.year, key, got[key], date)
+			}
+		}
+		// Eid al-Fitr, Eid al-Adha and Mawlid follow the moon sighting and
+		// are added by admins through Put
+		for _, key := range []string{"eid_al_fitr", "eid_al_adha", "mawlid"} {
+			if date, ok := got[key]; ok {
+				t.Errorf("%d: %s computed as %s", tc.year, key, date)
+			}
+		}
+		if len(list) != len(definitions) {
+			t.Errorf("%d: %d holidays, want %d", tc.year, len(list), len(definitions))
+		}
+		if !sort.SliceIsSorted(list, func(i, j int) bool { return list[i].Date < list[j].Date }) {
+			t.Errorf("%d: holidays not ordered by date", tc.year)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+const (
+	// maxImagePixels rejects images that would take too much memory to
+	// decode, like decompression bombs
+	maxImagePixels = 50_000_000
+	// jpegQuality is used for every JPEG rendition
+	jpegQuality = 85
+)
+
+// renditionSizes are the longest sides of the stored renditions. Images are
+// never upscaled.
+var renditionSizes = []struct {
+	name string
+	size int
+}{
+	{"full", 2048},
+	{"medium", 1024},
+	{"thumb", 320},
+}
+
+// imageTypes are the content types accepted for images, by sniffing
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// ErrTooManyPixels is returned for images above maxImagePixels
+var ErrTooManyPixels = errors.New("image dimensions too large")
+
+// rendition is an encoded, resized copy of an uploaded image
+type rendition struct {
+	name        string // full, medium, thumb
+	data        []byte
+	contentType string
+	ext         string
+	width       int
+	height      int
+}
+
+// processImage decodes an uploaded image, applies its EXIF orientation and
+// re-encodes it into renditions. Re-encoding drops all metadata, GPS
+// position included. Opaque images become JPEG, others PNG.
+func processImage(data []byte) ([]rendition, error) {
+	if !imageTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrTooManyPixels
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	// Rotating is cheaper after the first downscale; fit only looks at the
+	// longest side, so the order doesn't change the result
+	src = orient(fit(src, renditionSizes[0].size), exifOrientation(data))
+
+	opaque := isOpaque(src)
+	var out []rendition
+	for _, rs := range renditionSizes {
+		src = fit(src, rs.size)
+		r := rendition{name: rs.name, width: src.Bounds().Dx(), height: src.Bounds().Dy()}
+
+		var buf bytes.Buffer
+		if opaque {
+			r.contentType, r.ext = "image/jpeg", ".jpg"
+			err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			r.contentType, r.ext = "image/png", ".png"
+			err = png.Encode(&buf, src)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.data = buf.Bytes()
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// fit scales img down so its longest side is at most size. Each rendition
+// is scaled from the previous, larger one.
+func fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// orient applies an EXIF orientation (1-8) so the pixels are upright
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 { // 5-8 swap width and height
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counterclockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the orientation tag of a JPEG's EXIF block, or 1
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return 1
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + n
+	}
+	return 1
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of a TIFF block
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(t[4:]))
+	if ifd < 8 || ifd+2 > len(t) {
+		return 1
+	}
+	count := int(order.Uint16(t[ifd:]))
+	for k := 0; k < count; k++ {
+		e := ifd + 2 + 12*k
+		if e+12 > len(t) {
+			return 1
+		}
+		if order.Uint16(t[e:]) == 0x0112 {
+			return int(order.Uint16(t[e+8:]))
+		}
+	}
+	return 1
+}
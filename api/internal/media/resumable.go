@@ -0,0 +1,325 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+
+	"maps/api/internal/storage"
+)
+
+const (
+	// resumableTTL is how long an unfinished resumable upload is kept after
+	// its last chunk
+	resumableTTL = 24 * time.Hour
+	// resumableFinishTimeout is how long a replica may take to process a
+	// finished upload before another one can retry it
+	resumableFinishTimeout = time.Hour
+	// partPrefix holds the chunks of resumable uploads. It is under
+	// storage.IncomingPrefix, so they are never served.
+	partPrefix = storage.IncomingPrefix + "parts/"
+)
+
+var (
+	// ErrOffsetMismatch is returned for chunks that don't start where the
+	// upload stopped
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrIncomplete is returned when finishing an upload that is missing
+	// bytes
+	ErrIncomplete = errors.New("upload incomplete")
+	// ErrUploadBusy is returned while another request writes to the upload
+	ErrUploadBusy = errors.New("upload is busy")
+)
+
+// ResumableUpload is an upload sent in chunks. Offset is how many bytes
+// were received.
+type ResumableUpload struct {
+	ID        string    `json:"id"`
+	Offset    int64     `json:"offset"`
+	Length    int64     `json:"length"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Resumables keeps the chunks of unfinished resumable uploads in the
+// storage backend and hands finished ones to Uploads. Offsets and chunk
+// lists are in the database, so a client can send each chunk to a
+// different replica. dir only holds a chunk while it is being received.
+type Resumables struct {
+	db      *sql.DB
+	uploads *Uploads
+	dir     string
+}
+
+// NewResumables creates the resumable upload store, receiving chunks
+// through dir, and starts removing expired uploads
+func NewResumables(db *sql.DB, uploads *Uploads, dir string) (*Resumables, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	rs := &Resumables{db: db, uploads: uploads, dir: dir}
+	go rs.run()
+	return rs, nil
+}
+
+// MaxLength is the largest upload accepted
+func (rs *Resumables) MaxLength() int64 {
+	return rs.uploads.MaxLength()
+}
+
+// Create starts an upload of length bytes
+func (rs *Resumables) Create(ctx context.Context, userID string, length int64) (*ResumableUpload, error) {
+	if length > rs.MaxLength() {
+		return nil, ErrTooLarge
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	up := &ResumableUpload{ID: id, Length: length}
+	err = rs.db.QueryRowContext(ctx, `
+		INSERT INTO resumable_uploads (id, user_id, length, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+		RETURNING expires_at
+	`, up.ID, userID, length, resumableTTL.Seconds()).Scan(&up.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return up, nil
+}
+
+// Get returns an unexpired upload of the user
+func (rs *Resumables) Get(ctx context.Context, userID, id string) (*ResumableUpload, error) {
+	up := &ResumableUpload{ID: id}
+	err := rs.db.QueryRowContext(ctx, `
+		SELECT received, length, expires_at FROM resumable_uploads
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+	`, id, userID).Scan(&up.Offset, &up.Length, &up.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return up, nil
+}
+
+// Append writes a chunk starting at offset and extends the upload's
+// expiry. Bytes received before an error are kept, so the client resumes
+// from the returned offset. Bytes past the upload length are ignored.
+// When another request appended to the upload in the meantime, the chunk
+// is dropped with ErrUploadBusy.
+func (rs *Resumables) Append(ctx context.Context, userID, id string, offset int64, r io.Reader) (*ResumableUpload, error) {
+	up, err := rs.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != up.Offset {
+		return up, ErrOffsetMismatch
+	}
+
+	f, err := os.CreateTemp(rs.dir, id+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	n, err := io.Copy(f, io.LimitReader(r, up.Length-up.Offset))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if n == 0 {
+		return up, err
+	}
+
+	// The client may hang up mid-chunk; keep what arrived
+	ctx = context.WithoutCancel(ctx)
+	part, perr := randomID()
+	if perr != nil {
+		return up, perr
+	}
+	key := partPrefix + id + "-" + part
+	if perr := rs.uploads.putFile(ctx, key, f.Name(), "application/octet-stream"); perr != nil {
+		return up, perr
+	}
+
+	perr = rs.db.QueryRowContext(ctx, `
+		UPDATE resumable_uploads SET received = received + $3, parts = array_append(parts, $4),
+			expires_at = NOW() + make_interval(secs => $5)
+		WHERE id = $1 AND received = $2 AND finishing_at IS NULL
+		RETURNING received, expires_at
+	`, id, up.Offset, n, key, resumableTTL.Seconds()).Scan(&up.Offset, &up.ExpiresAt)
+	if perr != nil {
+		rs.deleteParts(ctx, []string{key})
+		if perr == sql.ErrNoRows {
+			return up, ErrUploadBusy
+		}
+		return up, perr
+	}
+	return up, err
+}
+
+// Finish processes a complete upload like Uploads.Save and removes it.
+// Uploads rejected for their content are removed as well; others are kept
+// so the client can retry.
+func (rs *Resumables) Finish(ctx context.Context, userID, id string) (*Upload, error) {
+	var parts []string
+	err := rs.db.QueryRowContext(ctx, `
+		UPDATE resumable_uploads SET finishing_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW() AND received = length
+		AND (finishing_at IS NULL OR finishing_at < NOW() - make_interval(secs => $3))
+		RETURNING parts
+	`, id, userID, resumableFinishTimeout.Seconds()).Scan(pq.Array(&parts))
+	if err == sql.ErrNoRows {
+		up, err := rs.Get(ctx, userID, id)
+		switch {
+		case err != nil:
+			return nil, err
+		case up.Offset < up.Length:
+			return nil, ErrIncomplete
+		default:
+			// Another request is finishing it
+			return nil, ErrUploadBusy
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &partsReader{ctx: ctx, store: rs.uploads.store, keys: parts}
+	saved, err := rs.uploads.Save(ctx, userID, pr)
+	pr.Close()
+
+	ctx = context.WithoutCancel(ctx)
+	if err != nil && !isContentError(err) {
+		if _, uerr := rs.db.ExecContext(ctx, `UPDATE resumable_uploads SET finishing_at = NULL WHERE id = $1`, id); uerr != nil {
+			log.Printf("Failed to release resumable upload %s: %v", id, uerr)
+		}
+		return nil, err
+	}
+	if _, rerr := rs.remove(ctx, `id = $1`, id); rerr != nil {
+		log.Printf("Failed to delete resumable upload %s: %v", id, rerr)
+	}
+	return saved, err
+}
+
+// Delete abandons an upload
+func (rs *Resumables) Delete(ctx context.Context, userID, id string) error {
+	n, err := rs.remove(ctx, `id = $1 AND user_id = $2 AND expires_at > NOW() AND finishing_at IS NULL`, id, userID)
+	if err != nil || n > 0 {
+		return err
+	}
+	if _, err := rs.Get(ctx, userID, id); err != nil {
+		return err
+	}
+	return ErrUploadBusy
+}
+
+// remove deletes the uploads matching where along with their chunks and
+// returns how many were removed
+func (rs *Resumables) remove(ctx context.Context, where string, args ...interface{}) (int, error) {
+	rows, err := rs.db.QueryContext(ctx, `DELETE FROM resumable_uploads WHERE `+where+` RETURNING parts`, args...)
+	if err != nil {
+		return 0, err
+	}
+	var parts [][]string
+	for rows.Next() {
+		var p []string
+		if err := rows.Scan(pq.Array(&p)); err != nil {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	rows.Close()
+
+	for _, p := range parts {
+		rs.deleteParts(ctx, p)
+	}
+	return len(parts), rows.Err()
+}
+
+func (rs *Resumables) deleteParts(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := rs.uploads.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete resumable upload part %s: %v", key, err)
+		}
+	}
+}
+
+func (rs *Resumables) run() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		n, err := rs.Cleanup(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to clean up resumable uploads: %v", err)
+		} else if n > 0 {
+			log.Printf("Removed %d expired resumable uploads", n)
+		}
+	}
+}
+
+// Cleanup removes expired uploads and returns how many were removed.
+// Uploads being finished are left to the request finishing them.
+func (rs *Resumables) Cleanup(ctx context.Context) (int, error) {
+	return rs.remove(ctx, `expires_at < NOW()
+		AND (finishing_at IS NULL OR finishing_at < NOW() - make_interval(secs => $1))`,
+		resumableFinishTimeout.Seconds())
+}
+
+// partsReader reads the chunks of an upload in order, opening one at a
+// time
+type partsReader struct {
+	ctx   context.Context
+	store storage.Storage
+	keys  []string
+	cur   io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := p.store.Open(p.ctx, p.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.keys = rc, p.keys[1:]
+		}
+		n, err := p.cur.Read(b)
+		if err == io.EOF {
+			p.cur.Close()
+			p.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.cur == nil {
+		return nil
+	}
+	return p.cur.Close()
+}
+
+func randomID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,47 @@
+package media
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"maps/api/internal/storage"
+)
+
+func TestPartsReaderJoinsChunks(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "/uploads/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	var keys []string
+	for i, chunk := range []string{"first ", "second ", "", "third"} {
+		key := partPrefix + "upload-" + string(rune('a'+i))
+		if err := store.Put(ctx, key, strings.NewReader(chunk), int64(len(chunk)), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	pr := &partsReader{ctx: ctx, store: store, keys: keys}
+	defer pr.Close()
+	data, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "first second third" {
+		t.Errorf("read %q", got)
+	}
+}
+
+func TestPartsReaderMissingChunk(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "/uploads/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := &partsReader{ctx: context.Background(), store: store, keys: []string{partPrefix + "gone"}}
+	if _, err := io.ReadAll(pr); err == nil {
+		t.Error("reading a missing chunk succeeded")
+	}
+}
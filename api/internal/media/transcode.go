@@ -0,0 +1,178 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// transcodeRetryInterval is how often stalled transcodes, like those
+	// interrupted by a restart, are looked for
+	transcodeRetryInterval = 5 * time.Minute
+	// transcodeStaleAfter is when a started transcode is assumed dead
+	transcodeStaleAfter = time.Hour
+	// maxTranscodeAttempts is how often a transcode is retried after
+	// storage or database errors
+	maxTranscodeAttempts = 3
+)
+
+// videoObjectKeys are the objects derived from an uploaded video
+type videoObjectKeys struct {
+	poster   string // JPEG poster frame
+	playlist string // HLS playlist
+	stream   string // HLS stream, referenced by the playlist by name
+}
+
+// videoKeys returns the keys of the objects derived from a video key
+func videoKeys(key string) videoObjectKeys {
+	base := strings.TrimSuffix(key, path.Ext(key))
+	return videoObjectKeys{
+		poster:   base + "_poster.jpg",
+		playlist: base + "_hls.m3u8",
+		stream:   base + "_hls.ts",
+	}
+}
+
+// triggerTranscode schedules a transcode pass if one isn't already queued
+func (u *Uploads) triggerTranscode() {
+	select {
+	case u.pending <- struct{}{}:
+	default:
+	}
+}
+
+// runTranscodes transcodes processing videos one at a time
+func (u *Uploads) runTranscodes() {
+	ticker := time.NewTicker(transcodeRetryInterval)
+	defer ticker.Stop()
+	for {
+		for u.transcodeNext() {
+		}
+		u.syncVideoPosts(context.Background())
+		select {
+		case <-u.pending:
+		case <-ticker.C:
+		}
+	}
+}
+
+// transcodeNext claims and transcodes the oldest processing video. It
+// returns false when there was none or the queue can't be read.
+func (u *Uploads) transcodeNext() bool {
+	ctx := context.Background()
+	var key, url string
+	var attempts int
+	err := u.db.QueryRowContext(ctx, `
+		UPDATE uploads SET transcode_started_at = NOW(), transcode_attempts = transcode_attempts + 1
+		WHERE status = 'processing' AND url = (
+			SELECT url FROM uploads
+			WHERE status = 'processing'
+			AND (transcode_started_at IS NULL OR transcode_started_at < NOW() - make_interval(secs => $1))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING filename, url, transcode_attempts
+	`, transcodeStaleAfter.Seconds()).Scan(&key, &url, &attempts)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to claim video transcode: %v", err)
+		return false
+	}
+
+	start := time.Now()
+	playlistURL, err := u.transcode(ctx, key)
+	switch {
+	case err == nil:
+		_, err = u.db.ExecContext(ctx, `
+			UPDATE uploads SET status = 'ready', playlist_url = $2 WHERE url = $1
+		`, url, playlistURL)
+		log.Printf("Transcoded video %s in %s", key, time.Since(start).Round(time.Second))
+	case errors.Is(err, errFFmpeg) || attempts >= maxTranscodeAttempts:
+		log.Printf("Failed to transcode video %s: %v", key, err)
+		_, err = u.db.ExecContext(ctx, `UPDATE uploads SET status = 'failed' WHERE url = $1`, url)
+	default:
+		// Retried once the claim goes stale
+		log.Printf("Failed to transcode video %s, will retry: %v", key, err)
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to update video upload %s: %v", key, err)
+	}
+	u.syncVideoPosts(ctx)
+	return true
+}
+
+// transcode converts a stored video to HLS and returns the playlist URL
+func (u *Uploads) transcode(ctx context.Context, key string) (string, error) {
+	dir, err := os.MkdirTemp("", "transcode-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "source"+path.Ext(key))
+	if err := u.download(ctx, key, src); err != nil {
+		return "", err
+	}
+	keys := videoKeys(key)
+	name := strings.TrimSuffix(path.Base(keys.playlist), ".m3u8")
+	if err := u.video.transcodeHLS(ctx, src, dir, name); err != nil {
+		return "", err
+	}
+	// The stream goes first so the playlist never points at a missing file
+	if err := u.putFile(ctx, keys.stream, filepath.Join(dir, name+".ts"), "video/mp2t"); err != nil {
+		return "", err
+	}
+	if err := u.putFile(ctx, keys.playlist, filepath.Join(dir, name+".m3u8"), "application/vnd.apple.mpegurl"); err != nil {
+		return "", err
+	}
+	return u.store.URL(keys.playlist), nil
+}
+
+// download copies an object to a file
+func (u *Uploads) download(ctx context.Context, key, file string) error {
+	r, err := u.store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// syncVideoPosts finishes processing posts whose video is done: they become
+// active and play the HLS playlist, or fail with their video. It also runs
+// on every pass of the worker, for posts created while their video was
+// finishing.
+func (u *Uploads) syncVideoPosts(ctx context.Context) {
+	_, err := u.db.ExecContext(ctx, `
+		UPDATE posts p SET
+			media_url = CASE WHEN up.status = 'ready' THEN up.playlist_url ELSE p.media_url END,
+			status = CASE WHEN up.status = 'ready' THEN 'active' ELSE 'failed' END
+		FROM uploads up
+		WHERE p.status = 'processing'
+		AND up.url = p.media_url
+		AND up.status IN ('ready', 'failed')
+	`)
+	if err != nil {
+		log.Printf("Failed to update video posts: %v", err)
+	}
+}
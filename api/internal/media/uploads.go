@@ -0,0 +1,543 @@
+// Package media processes uploaded files, stores them in object storage and
+// tracks them in the uploads table, so files that were never attached to a
+// business, post or profile can be cleaned up.
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"maps/api/internal/storage"
+)
+
+const (
+	// cleanupInterval is how often unattached uploads are looked for
+	cleanupInterval = time.Hour
+	// maxUploadBytes caps the size of an uploaded image
+	maxUploadBytes = 20 << 20
+	// presignExpiry is how long a direct-upload URL stays valid
+	presignExpiry = 15 * time.Minute
+)
+
+var (
+	// ErrUnsupportedType is returned for files whose content isn't an
+	// accepted type, whatever their extension
+	ErrUnsupportedType = errors.New("unsupported file type")
+	// ErrTooLarge is returned for images above maxUploadBytes and videos
+	// above VideoOptions.MaxBytes
+	ErrTooLarge = errors.New("file too large")
+	// ErrNotFound is returned for URLs and keys that aren't uploads of the
+	// user
+	ErrNotFound = errors.New("upload not found")
+)
+
+// Upload is a stored file. Images have medium and thumbnail renditions
+// next to the full one at URL. Videos are kept as uploaded at URL with a
+// poster frame as thumbnail, and get an HLS playlist once transcoded.
+type Upload struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	MediumURL    *string   `json:"medium_url,omitempty"`
+	ThumbnailURL *string   `json:"thumbnail_url,omitempty"`
+	PlaylistURL  *string   `json:"playlist_url,omitempty"`
+	ContentType  string    `json:"content_type"`
+	Status       string    `json:"status"` // processing, ready, failed
+	Width        *int      `json:"width,omitempty"`
+	Height       *int      `json:"height,omitempty"`
+	Duration     *float64  `json:"duration_seconds,omitempty"`
+	Size         int64     `json:"size_bytes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// MediaType returns "photo" or "video" for the upload's content type
+func (u *Upload) MediaType() string {
+	if strings.HasPrefix(u.ContentType, "video/") {
+		return "video"
+	}
+	return "photo"
+}
+
+// PendingUpload is a presigned direct upload; finish it with Complete
+type PendingUpload struct {
+	Key string `json:"key"`
+	*storage.Presigned
+}
+
+// Uploads processes uploads and keeps them in a storage backend
+type Uploads struct {
+	db      *sql.DB
+	store   storage.Storage
+	maxAge  time.Duration
+	video   VideoOptions
+	pending chan struct{} // queued transcodes
+}
+
+// NewUploads creates the uploads store and starts removing uploads that are
+// still unattached after maxAge, and transcoding videos. Video uploads are
+// rejected when ffmpeg isn't installed.
+func NewUploads(db *sql.DB, store storage.Storage, maxAge time.Duration, video VideoOptions) *Uploads {
+	if _, err := exec.LookPath(video.FFmpeg); err != nil {
+		log.Printf("ffmpeg not found, video uploads are disabled: %v", err)
+		video.FFmpeg = ""
+	} else if _, err := exec.LookPath(video.FFprobe); err != nil {
+		log.Printf("ffprobe not found, video uploads are disabled: %v", err)
+		video.FFmpeg = ""
+	}
+	u := &Uploads{db: db, store: store, maxAge: maxAge, video: video, pending: make(chan struct{}, 1)}
+	go u.run()
+	if video.FFmpeg != "" {
+		go u.runTranscodes()
+	}
+	return u
+}
+
+// MaxLength is the largest upload accepted
+func (u *Uploads) MaxLength() int64 {
+	if u.video.FFmpeg == "" {
+		return maxUploadBytes
+	}
+	return max(maxUploadBytes, u.video.MaxBytes)
+}
+
+// Save processes and stores a file uploaded by a user. The type is sniffed
+// from the content; the client's filename is ignored. Images are
+// re-encoded without metadata into renditions named after the SHA-256 of
+// the full rendition, so identical uploads share their files. Videos are
+// named after the SHA-256 of the upload and transcoded in the background.
+func (u *Uploads) Save(ctx context.Context, userID string, r io.Reader) (*Upload, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	if contentType := sniffVideo(head); contentType != "" {
+		return u.saveVideo(ctx, userID, br, contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(br, maxUploadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadBytes {
+		return nil, ErrTooLarge
+	}
+
+	renditions, err := processImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(renditions[0].data)
+	hash := hex.EncodeToString(sum[:])
+	fullKey := hash + renditions[0].ext
+	urls := map[string]string{}
+	for _, rd := range renditions {
+		key := renditionKey(fullKey, rd.name)
+		if err := u.putOnce(ctx, key, rd.data, rd.contentType); err != nil {
+			return nil, err
+		}
+		urls[rd.name] = u.store.URL(key)
+	}
+
+	full := renditions[0]
+	medium, thumb := urls["medium"], urls["thumb"]
+	up := &Upload{
+		URL:          urls["full"],
+		MediumURL:    &medium,
+		ThumbnailURL: &thumb,
+		ContentType:  full.contentType,
+		Status:       "ready",
+		Width:        &full.width,
+		Height:       &full.height,
+		Size:         int64(len(full.data)),
+	}
+	// Uploading the same file again restarts its cleanup grace period
+	err = u.db.QueryRowContext(ctx, `
+		INSERT INTO uploads (user_id, filename, url, medium_url, thumbnail_url, content_type, width, height, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, url) DO UPDATE SET created_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at
+	`, userID, fullKey, up.URL, up.MediumURL, up.ThumbnailURL,
+		up.ContentType, up.Width, up.Height, up.Size).Scan(&up.ID, &up.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return up, nil
+}
+
+// saveVideo stores a video as uploaded with a poster frame and queues its
+// transcode. A video another user already uploaded reuses its transcode.
+func (u *Uploads) saveVideo(ctx context.Context, userID string, r io.Reader, contentType string) (*Upload, error) {
+	if u.video.FFmpeg == "" {
+		return nil, ErrVideoDisabled
+	}
+	dir, err := os.MkdirTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "source"+videoTypes[contentType])
+	f, err := os.Create(src)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, u.video.MaxBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n > u.video.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	info, err := u.video.probeVideo(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	if info.duration > u.video.MaxDuration {
+		return nil, ErrTooLong
+	}
+	poster := filepath.Join(dir, "poster.jpg")
+	if err := u.video.extractPoster(ctx, src, poster, info.duration); err != nil {
+		log.Printf("Failed to extract poster frame: %v", err)
+		return nil, ErrUnsupportedType
+	}
+
+	key := hex.EncodeToString(h.Sum(nil)) + videoTypes[contentType]
+	keys := videoKeys(key)
+	if err := u.putFileOnce(ctx, key, src, contentType); err != nil {
+		return nil, err
+	}
+	if err := u.putFileOnce(ctx, keys.poster, poster, "image/jpeg"); err != nil {
+		return nil, err
+	}
+
+	thumb := u.store.URL(keys.poster)
+	duration := info.duration.Seconds()
+	up := &Upload{
+		URL:          u.store.URL(key),
+		ThumbnailURL: &thumb,
+		ContentType:  contentType,
+		Width:        &info.width,
+		Height:       &info.height,
+		Duration:     &duration,
+		Size:         n,
+	}
+	var playlistURL sql.NullString
+	err = u.db.QueryRowContext(ctx, `
+		INSERT INTO uploads (user_id, filename, url, thumbnail_url, content_type, width, height,
+			duration_seconds, size_bytes, status, playlist_url)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE(done.status, 'processing'), done.playlist_url
+		FROM (SELECT 1) one
+		LEFT JOIN LATERAL (
+			SELECT status, playlist_url FROM uploads
+			WHERE url = $3 AND status = 'ready'
+			LIMIT 1
+		) done ON TRUE
+		ON CONFLICT (user_id, url) DO UPDATE SET created_at = CURRENT_TIMESTAMP
+		RETURNING id, status, playlist_url, created_at
+	`, userID, key, up.URL, up.ThumbnailURL, up.ContentType, up.Width, up.Height,
+		duration, up.Size).Scan(&up.ID, &up.Status, &playlistURL, &up.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if playlistURL.Valid {
+		up.PlaylistURL = &playlistURL.String
+	}
+	if up.Status == "processing" {
+		u.triggerTranscode()
+	}
+	return up, nil
+}
+
+// renditionKey returns the key of a rendition from the full rendition key
+func renditionKey(fullKey, name string) string {
+	if name == "full" {
+		return fullKey
+	}
+	ext := path.Ext(fullKey)
+	return strings.TrimSuffix(fullKey, ext) + "_" + name + ext
+}
+
+// objectKeys returns the keys of every object of an upload
+func objectKeys(key, contentType string) []string {
+	if _, isVideo := videoTypes[contentType]; isVideo {
+		keys := videoKeys(key)
+		return []string{key, keys.poster, keys.playlist, keys.stream}
+	}
+	var keys []string
+	for _, rs := range renditionSizes {
+		keys = append(keys, renditionKey(key, rs.name))
+	}
+	return keys
+}
+
+// putOnce stores a content-addressed object unless it already exists
+func (u *Uploads) putOnce(ctx context.Context, key string, data []byte, contentType string) error {
+	exists, err := u.store.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	return u.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// putFileOnce is putOnce for a file
+func (u *Uploads) putFileOnce(ctx context.Context, key, file, contentType string) error {
+	exists, err := u.store.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	return u.putFile(ctx, key, file, contentType)
+}
+
+// putFile stores a file as an object
+func (u *Uploads) putFile(ctx context.Context, key, file, contentType string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return u.store.Put(ctx, key, f, fi.Size(), contentType)
+}
+
+// Presign starts a direct upload: the client PUTs the file to the returned
+// URL, then calls Complete with the key
+func (u *Uploads) Presign(ctx context.Context, userID, contentType string) (*PendingUpload, error) {
+	if _, isVideo := videoTypes[contentType]; isVideo {
+		if u.video.FFmpeg == "" {
+			return nil, ErrVideoDisabled
+		}
+	} else if !imageTypes[contentType] {
+		return nil, ErrUnsupportedType
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	key := storage.IncomingPrefix + userID + "/" + hex.EncodeToString(b[:])
+	presigned, err := u.store.PresignPut(key, contentType, presignExpiry)
+	if err != nil {
+		return nil, err
+	}
+	_, err = u.db.ExecContext(ctx, `
+		INSERT INTO pending_uploads (key, user_id, content_type, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, key, userID, contentType, presigned.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &PendingUpload{Key: key, Presigned: presigned}, nil
+}
+
+// Complete processes a direct upload like Save and removes the raw object
+func (u *Uploads) Complete(ctx context.Context, userID, key string) (*Upload, error) {
+	var exists bool
+	err := u.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM pending_uploads WHERE key = $1 AND user_id = $2)
+	`, key, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	r, err := u.store.Open(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	up, err := u.Save(ctx, userID, r)
+	r.Close()
+	if err != nil && !isContentError(err) {
+		// Keep the raw object so the client can retry
+		return nil, err
+	}
+
+	u.removePending(ctx, key)
+	return up, err
+}
+
+// isContentError reports whether Save rejected a file for its content,
+// which retrying won't change
+func isContentError(err error) bool {
+	return err == ErrUnsupportedType || err == ErrTooManyPixels || err == ErrTooLarge || err == ErrTooLong
+}
+
+// removePending deletes a raw direct upload and its pending row
+func (u *Uploads) removePending(ctx context.Context, key string) {
+	if err := u.store.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete raw upload %s: %v", key, err)
+		return
+	}
+	u.db.ExecContext(ctx, `DELETE FROM pending_uploads WHERE key = $1`, key)
+}
+
+// Owned returns the upload with the given URL, of any rendition, if userID
+// uploaded it
+func (u *Uploads) Owned(ctx context.Context, url, userID string) (*Upload, error) {
+	var up Upload
+	var mediumURL, thumbnailURL, playlistURL sql.NullString
+	var width, height sql.NullInt64
+	var duration sql.NullFloat64
+	err := u.db.QueryRowContext(ctx, `
+		SELECT id, url, medium_url, thumbnail_url, playlist_url, content_type, status,
+			width, height, duration_seconds, size_bytes, created_at
+		FROM uploads
+		WHERE user_id = $2 AND (url = $1 OR medium_url = $1 OR thumbnail_url = $1 OR playlist_url = $1)
+		LIMIT 1
+	`, url, userID).Scan(&up.ID, &up.URL, &mediumURL, &thumbnailURL, &playlistURL, &up.ContentType, &up.Status,
+		&width, &height, &duration, &up.Size, &up.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mediumURL.Valid {
+		up.MediumURL = &mediumURL.String
+	}
+	if thumbnailURL.Valid {
+		up.ThumbnailURL = &thumbnailURL.String
+	}
+	if playlistURL.Valid {
+		up.PlaylistURL = &playlistURL.String
+	}
+	if duration.Valid {
+		up.Duration = &duration.Float64
+	}
+	if width.Valid && height.Valid {
+		w, h := int(width.Int64), int(height.Int64)
+		up.Width, up.Height = &w, &h
+	}
+	return &up, nil
+}
+
+func (u *Uploads) run() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		n, err := u.Cleanup(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to clean up uploads: %v", err)
+		} else if n > 0 {
+			log.Printf("Removed %d unattached uploads", n)
+		}
+	}
+}
+
+// Cleanup removes uploads older than maxAge that no business media, post,
+// claim or profile photo refers to, and expired direct uploads that were never
+// completed. It returns how many uploads were removed. Objects are kept
+// while another upload row still shares them.
+func (u *Uploads) Cleanup(ctx context.Context) (int, error) {
+	const batchSize = 500
+	total := 0
+
+	for {
+		rows, err := u.db.QueryContext(ctx, `
+			SELECT up.id, up.filename, up.url, up.content_type
+			FROM uploads up
+			WHERE up.created_at < NOW() - make_interval(secs => $1)
+			AND NOT EXISTS (
+				SELECT 1 FROM business_media m
+				WHERE m.url IN (up.url, up.medium_url, up.thumbnail_url, up.playlist_url)
+				OR m.thumbnail_url IN (up.url, up.medium_url, up.thumbnail_url)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM posts p
+				WHERE p.media_url IN (up.url, up.medium_url, up.thumbnail_url, up.playlist_url)
+				OR p.thumbnail_url IN (up.url, up.medium_url, up.thumbnail_url)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM business_claims c
+				WHERE c.evidence_urls && ARRAY[up.url, up.medium_url, up.thumbnail_url]
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM users usr
+				WHERE usr.photo_url IN (up.url, up.medium_url, up.thumbnail_url)
+			)
+			LIMIT $2
+		`, u.maxAge.Seconds(), batchSize)
+		if err != nil {
+			return total, err
+		}
+
+		type orphan struct{ id, key, url, contentType string }
+		var batch []orphan
+		for rows.Next() {
+			var o orphan
+			if err := rows.Scan(&o.id, &o.key, &o.url, &o.contentType); err != nil {
+				continue
+			}
+			batch = append(batch, o)
+		}
+		rows.Close()
+
+		for _, o := range batch {
+			if _, err := u.db.ExecContext(ctx, `DELETE FROM uploads WHERE id = $1`, o.id); err != nil {
+				return total, err
+			}
+			total++
+
+			var shared bool
+			if err := u.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM uploads WHERE url = $1)`, o.url).Scan(&shared); err != nil {
+				return total, err
+			}
+			if shared {
+				continue
+			}
+			for _, key := range objectKeys(o.key, o.contentType) {
+				if err := u.store.Delete(ctx, key); err != nil {
+					return total, err
+				}
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	rows, err := u.db.QueryContext(ctx, `
+		SELECT key FROM pending_uploads WHERE expires_at < NOW() - INTERVAL '1 hour'
+	`)
+	if err != nil {
+		return total, err
+	}
+	var expired []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err == nil {
+			expired = append(expired, key)
+		}
+	}
+	rows.Close()
+	for _, key := range expired {
+		u.removePending(ctx, key)
+	}
+	return total, nil
+}
@@ -0,0 +1,200 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// posterSize is the longest side of video poster frames
+	posterSize = 640
+	// videoSize is the longest side of transcoded videos
+	videoSize = 1280
+	// hlsSegmentSeconds is the target HLS segment duration
+	hlsSegmentSeconds = 4
+	// transcodeTimeout bounds a single ffmpeg run
+	transcodeTimeout = 30 * time.Minute
+)
+
+var (
+	// ErrTooLong is returned for videos above the configured duration
+	ErrTooLong = errors.New("video too long")
+	// ErrVideoDisabled is returned for video uploads when ffmpeg isn't
+	// available
+	ErrVideoDisabled = errors.New("video uploads are not available")
+	// errFFmpeg wraps ffmpeg failures, which retrying won't fix
+	errFFmpeg = errors.New("ffmpeg failed")
+)
+
+// VideoOptions configures video uploads
+type VideoOptions struct {
+	FFmpeg      string // ffmpeg binary; video uploads are disabled if missing
+	FFprobe     string // ffprobe binary
+	MaxBytes    int64
+	MaxDuration time.Duration
+}
+
+// videoTypes are the accepted video content types and their extensions
+var videoTypes = map[string]string{
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+}
+
+// imageBrands are ISO base media brands of image formats (HEIF, AVIF),
+// which share the ftyp box with MP4
+var imageBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"mif1": true, "msf1": true, "avif": true, "avis": true,
+}
+
+// sniffVideo returns the content type of a video from its first bytes, or
+// "" when it isn't an accepted video
+func sniffVideo(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch brand := string(head[8:12]); {
+		case imageBrands[brand]:
+			return ""
+		case brand == "qt  ":
+			return "video/quicktime"
+		default:
+			return "video/mp4"
+		}
+	}
+	// EBML header, shared by WebM and Matroska; ffmpeg reads both
+	if bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		return "video/webm"
+	}
+	return ""
+}
+
+// videoInfo is what ffprobe reports about a video
+type videoInfo struct {
+	width, height int
+	duration      time.Duration
+}
+
+// probeVideo reads the dimensions and duration of a video file. Dimensions
+// are as displayed, after the rotation phones record portrait videos with.
+func (o VideoOptions) probeVideo(ctx context.Context, file string) (*videoInfo, error) {
+	out, err := exec.CommandContext(ctx, o.FFprobe,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "format=duration:stream=width,height:stream_side_data=rotation:stream_tags=rotate",
+		"-print_format", "json",
+		file,
+	).Output()
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			Width        int `json:"width"`
+			Height       int `json:"height"`
+			SideDataList []struct {
+				Rotation float64 `json:"rotation"`
+			} `json:"side_data_list"`
+			Tags struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil || len(probe.Streams) == 0 {
+		return nil, ErrUnsupportedType
+	}
+	secs, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || secs <= 0 {
+		return nil, ErrUnsupportedType
+	}
+
+	s := probe.Streams[0]
+	info := &videoInfo{width: s.Width, height: s.Height, duration: time.Duration(secs * float64(time.Second))}
+	rotation, _ := strconv.ParseFloat(s.Tags.Rotate, 64)
+	for _, sd := range s.SideDataList {
+		if sd.Rotation != 0 {
+			rotation = sd.Rotation
+		}
+	}
+	if int(rotation)%180 != 0 {
+		info.width, info.height = info.height, info.width
+	}
+	if info.width <= 0 || info.height <= 0 {
+		return nil, ErrUnsupportedType
+	}
+	return info, nil
+}
+
+// scaleFilter fits a video within size on its longest side, keeping even
+// dimensions as H.264 needs; videos are never upscaled
+func scaleFilter(size int) string {
+	return fmt.Sprintf(
+		"scale='if(gte(iw,ih),min(%[1]d,iw),-2)':'if(gte(iw,ih),-2,min(%[1]d,ih))',scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		size)
+}
+
+// extractPoster writes a JPEG frame from early in the video, past any
+// fade-in
+func (o VideoOptions) extractPoster(ctx context.Context, src, dst string, duration time.Duration) error {
+	at := min(time.Second, duration/2)
+	return o.ffmpeg(ctx,
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", src,
+		"-frames:v", "1",
+		"-vf", scaleFilter(posterSize),
+		"-map_metadata", "-1",
+		"-q:v", "4",
+		"-f", "image2",
+		dst,
+	)
+}
+
+// transcodeHLS transcodes a video to H.264/AAC HLS in dir. The stream is a
+// single file addressed by byte ranges, so a video is always two objects:
+// name.m3u8 and name.ts.
+func (o VideoOptions) transcodeHLS(ctx context.Context, src, dir, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, transcodeTimeout)
+	defer cancel()
+	return o.ffmpeg(ctx,
+		"-i", src,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-map_metadata", "-1",
+		"-vf", scaleFilter(videoSize),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-profile:v", "high", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k", "-ac", "2",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "single_file",
+		"-hls_segment_filename", filepath.Join(dir, name+".ts"),
+		filepath.Join(dir, name+".m3u8"),
+	)
+}
+
+// ffmpeg runs ffmpeg, overwriting outputs, and returns its error output
+// on failure
+func (o VideoOptions) ffmpeg(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, o.FFmpeg, append([]string{"-nostdin", "-v", "error", "-y"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 500 {
+			msg = msg[len(msg)-500:]
+		}
+		return fmt.Errorf("%w: %v: %s", errFFmpeg, err, msg)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+// Timeout cancels requests after d like chi's Timeout, except for paths
+// under longPrefixes. Those move large files, such as video uploads on a
+// slow mobile link, so they get no context deadline and their connection
+// read and write deadlines are pushed back by long instead. A prefix
+// containing "*" is a path.Match pattern for the whole path, for routes
+// with an ID in the middle.
+func Timeout(d, long time.Duration, longPrefixes ...string) func(http.Handler) http.Handler {
+	timeout := middleware.Timeout(d)
+	return func(next http.Handler) http.Handler {
+		limited := timeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range longPrefixes {
+				if matchesPrefix(r.URL.Path, prefix) {
+					extendDeadlines(w, r, long)
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+func matchesPrefix(p, prefix string) bool {
+	if strings.Contains(prefix, "*") {
+		ok, _ := path.Match(prefix, p)
+		return ok
+	}
+	return strings.HasPrefix(p, prefix)
+}
+
+func extendDeadlines(w http.ResponseWriter, r *http.Request, d time.Duration) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(d)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		log.Warn().Err(err).Str("path", r.URL.Path).Msg("failed to extend read deadline")
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		log.Warn().Err(err).Str("path", r.URL.Path).Msg("failed to extend write deadline")
+	}
+}
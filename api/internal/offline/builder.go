@@ -0,0 +1,714 @@
+package offline
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"maps/api/internal/styles"
+	"maps/api/internal/tiles"
+
+	_ "modernc.org/sqlite"
+)
+
+// buildTimeout bounds a single package build
+const buildTimeout = 30 * time.Minute
+
+// sweepInterval is how often finished packages older than maxAge are removed
+const sweepInterval = time.Hour
+
+// glyphRanges are packaged for every fontstack in the style: Basic Latin and
+// Latin-1, plus the Ethiopic block (U+1200-U+139F) for Amharic labels
+var glyphRanges = []string{"0-255", "4608-4863", "4864-5119"}
+
+// Package file names
+const (
+	fileManifest = "manifest.json"
+	fileTiles    = "tiles.mbtiles"
+	filePOIs     = "pois.geojson"
+	fileStyle    = "style.json"
+)
+
+// Builder estimates, queues and builds offline packages. Finished packages
+// are written to dir as <id>.zip.
+type Builder struct {
+	db       *sql.DB
+	store    *tiles.Store
+	assets   *styles.Assets
+	dir      string
+	maxTiles int
+	maxAge   time.Duration
+	pending  chan struct{}
+}
+
+// NewBuilder creates a builder and starts its background worker. Builds
+// interrupted by a restart are queued again, and ready or failed packages
+// are deleted with their zips maxAge after they finished.
+func NewBuilder(db *sql.DB, store *tiles.Store, assets *styles.Assets, dir string, maxTiles int, maxAge time.Duration) *Builder {
+	b := &Builder{
+		db:       db,
+		store:    store,
+		assets:   assets,
+		dir:      dir,
+		maxTiles: maxTiles,
+		maxAge:   maxAge,
+		pending:  make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create offline packages dir %s: %v", dir, err)
+	}
+	if _, err := db.Exec(`UPDATE offline_packages SET status = 'pending' WHERE status = 'building'`); err != nil {
+		log.Printf("Failed to requeue offline packages: %v", err)
+	}
+	go b.run()
+	b.Trigger()
+	return b
+}
+
+// Trigger wakes the worker if it isn't already scheduled
+func (b *Builder) Trigger() {
+	select {
+	case b.pending <- struct{}{}:
+	default:
+	}
+}
+
+// FilePath returns where a package's zip is stored
+func (b *Builder) FilePath(p *Package) string {
+	return filepath.Join(b.dir, p.ID+".zip")
+}
+
+// Estimate computes the tile count and expected size of a package without
+// building it. Tile sizes are sampled from the tileset at every zoom.
+func (b *Builder) Estimate(ctx context.Context, req Request) (*Estimate, error) {
+	ts, release, ok := b.store.Get(req.Tileset)
+	if !ok {
+		return nil, tiles.ErrTilesetNotFound
+	}
+	defer release()
+	minZ, maxZ, err := zoomRange(req, ts.Metadata())
+	if err != nil {
+		return nil, err
+	}
+
+	est := &Estimate{Tileset: req.Tileset, MinZoom: minZ, MaxZoom: maxZ}
+	for _, tr := range tileRanges(req.BBox, minZ, maxZ) {
+		est.TileCount += tr.count()
+	}
+	// Sampling a huge request would only be thrown away
+	if est.TileCount <= b.maxTiles {
+		for _, tr := range tileRanges(req.BBox, minZ, maxZ) {
+			n, err := sampleTileBytes(ctx, ts, tr)
+			if err != nil {
+				return nil, err
+			}
+			est.TileBytes += n
+		}
+	}
+
+	err = b.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM businesses
+		WHERE geom && ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		AND status IN ('verified', 'closed')
+	`, req.BBox[0], req.BBox[1], req.BBox[2], req.BBox[3]).Scan(&est.POICount)
+	if err != nil {
+		return nil, err
+	}
+	est.POIBytes = int64(est.POICount) * poiBytesEstimate
+
+	files, _, err := b.assetFiles(req.Style, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		est.AssetBytes += int64(len(f.data))
+	}
+
+	est.TotalBytes = est.TileBytes + est.POIBytes + est.AssetBytes
+	return est, nil
+}
+
+// sampleTileBytes estimates the stored size of a tile range from up to
+// estimateSamples tiles spread across it. Missing tiles count as empty.
+func sampleTileBytes(ctx context.Context, ts tiles.Tileset, tr tileRange) (int64, error) {
+	n := tr.count()
+	samples := estimateSamples
+	if n < samples {
+		samples = n
+	}
+	width := tr.maxX - tr.minX + 1
+
+	var total int64
+	for i := 0; i < samples; i++ {
+		idx := i * n / samples
+		data, err := ts.Tile(ctx, tr.z, tr.minX+idx%width, tr.minY+idx/width)
+		if err != nil {
+			return 0, err
+		}
+		total += int64(len(data))
+	}
+	return total * int64(n) / int64(samples), nil
+}
+
+// Submit queues a package for the user, or returns their existing package
+// for the same area, zooms and tileset build. The estimate is returned even
+// when the request is rejected as too large.
+func (b *Builder) Submit(ctx context.Context, userID, baseURL string, req Request) (*Package, *Estimate, error) {
+	est, err := b.Estimate(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if est.TileCount > b.maxTiles {
+		return nil, est, fmt.Errorf("%w: %d tiles, the limit is %d", ErrTooLarge, est.TileCount, b.maxTiles)
+	}
+
+	ts, release, ok := b.store.Get(req.Tileset)
+	if !ok {
+		return nil, nil, tiles.ErrTilesetNotFound
+	}
+	version := tiles.Version(ts)
+	release()
+
+	existing, err := scanPackage(b.db.QueryRowContext(ctx, selectPackage+`
+		WHERE user_id = $1 AND status <> 'failed'
+		AND tileset = $2 AND tileset_version = $3 AND style = $4 AND base_url = $5
+		AND min_lng = $6 AND min_lat = $7 AND max_lng = $8 AND max_lat = $9
+		AND min_zoom = $10 AND max_zoom = $11
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, req.Tileset, version, req.Style, baseURL,
+		req.BBox[0], req.BBox[1], req.BBox[2], req.BBox[3], est.MinZoom, est.MaxZoom))
+	if err == nil {
+		return existing, est, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+
+	var id string
+	err = b.db.QueryRowContext(ctx, `
+		INSERT INTO offline_packages (user_id, tileset, tileset_version, style, base_url,
+			min_lng, min_lat, max_lng, max_lat, min_zoom, max_zoom, tile_count, estimated_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`, userID, req.Tileset, version, req.Style, baseURL,
+		req.BBox[0], req.BBox[1], req.BBox[2], req.BBox[3], est.MinZoom, est.MaxZoom,
+		est.TileCount, est.TotalBytes).Scan(&id)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.Trigger()
+
+	p, err := Get(ctx, b.db, id)
+	return p, est, err
+}
+
+// run builds queued packages and sweeps expired ones. Both happen on this
+// goroutine so a package is never removed while it is being built.
+func (b *Builder) run() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.pending:
+			for b.buildNext() {
+			}
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			n, err := b.Sweep(ctx)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to sweep offline packages: %v", err)
+			} else if n > 0 {
+				log.Printf("Removed %d expired offline packages", n)
+			}
+		}
+	}
+}
+
+// Sweep deletes ready and failed packages that finished more than maxAge
+// ago, along with their zips, and returns how many were removed. Clients
+// asking for the same area again get a fresh build.
+func (b *Builder) Sweep(ctx context.Context) (int, error) {
+	rows, err := b.db.QueryContext(ctx, `
+		DELETE FROM offline_packages
+		WHERE status IN ('ready', 'failed')
+		AND COALESCE(completed_at, updated_at) < NOW() - make_interval(secs => $1)
+		RETURNING id
+	`, b.maxAge.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var p Package
+		if err := rows.Scan(&p.ID); err != nil {
+			return n, err
+		}
+		n++
+		if err := os.Remove(b.FilePath(&p)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove offline package %s: %v", p.ID, err)
+		}
+	}
+	return n, rows.Err()
+}
+
+// buildNext claims and builds the oldest pending package. It reports
+// whether there may be more work.
+func (b *Builder) buildNext() bool {
+	var id string
+	err := b.db.QueryRow(`
+		UPDATE offline_packages SET status = 'building', error = NULL
+		WHERE id = (
+			SELECT id FROM offline_packages
+			WHERE status = 'pending'
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to claim offline package: %v", err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+	defer cancel()
+
+	start := time.Now()
+	p, err := Get(ctx, b.db, id)
+	if err == nil {
+		err = b.build(ctx, p)
+	}
+	if err != nil {
+		log.Printf("Failed to build offline package %s: %v", id, err)
+		if _, err := b.db.Exec(`UPDATE offline_packages SET status = 'failed', error = $2 WHERE id = $1`, id, err.Error()); err != nil {
+			log.Printf("Failed to mark offline package %s failed: %v", id, err)
+		}
+		return true
+	}
+	log.Printf("Built offline package %s in %s", id, time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+// manifest describes the contents of a package. Clients point the style
+// sources listed in Sources at the packaged tiles and load glyphs and
+// sprites from the package paths.
+type manifest struct {
+	ID             string            `json:"id"`
+	Tileset        string            `json:"tileset"`
+	TilesetVersion string            `json:"tileset_version"`
+	Style          string            `json:"style"`
+	BBox           [4]float64        `json:"bbox"`
+	MinZoom        int               `json:"min_zoom"`
+	MaxZoom        int               `json:"max_zoom"`
+	TileCount      int               `json:"tile_count"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Tiles          string            `json:"tiles"`
+	POIs           string            `json:"pois"`
+	StyleFile      string            `json:"style_file"`
+	Sources        map[string]string `json:"sources"` // style source -> packaged file
+	Glyphs         string            `json:"glyphs,omitempty"`
+	Sprite         string            `json:"sprite,omitempty"`
+	Files          []manifestFile    `json:"files"`
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// packageFile is an in-memory file of a package
+type packageFile struct {
+	path string
+	data []byte
+}
+
+func (b *Builder) build(ctx context.Context, p *Package) error {
+	ts, release, ok := b.store.Get(p.Tileset)
+	if !ok {
+		return tiles.ErrTilesetNotFound
+	}
+	defer release()
+	version := tiles.Version(ts)
+
+	tmp, err := os.MkdirTemp(b.dir, p.ID+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	tilesPath := filepath.Join(tmp, fileTiles)
+	count, err := writeMBTiles(ctx, ts, tilesPath, p)
+	if err != nil {
+		return fmt.Errorf("tiles: %w", err)
+	}
+
+	pois, err := b.poiGeoJSON(ctx, p.BBox)
+	if err != nil {
+		return fmt.Errorf("pois: %w", err)
+	}
+
+	assets, sources, err := b.assetFiles(p.Style, p.baseURL)
+	if err != nil {
+		return fmt.Errorf("style: %w", err)
+	}
+	files := append([]packageFile{{path: filePOIs, data: pois}}, assets...)
+
+	m := manifest{
+		ID:             p.ID,
+		Tileset:        p.Tileset,
+		TilesetVersion: version,
+		Style:          p.Style,
+		BBox:           p.BBox,
+		MinZoom:        p.MinZoom,
+		MaxZoom:        p.MaxZoom,
+		TileCount:      count,
+		CreatedAt:      time.Now().UTC(),
+		Tiles:          fileTiles,
+		POIs:           filePOIs,
+		StyleFile:      fileStyle,
+		Sources:        make(map[string]string),
+	}
+	for _, name := range sources {
+		m.Sources[name] = fileTiles
+	}
+
+	tilesSize, tilesSum, err := hashFile(tilesPath)
+	if err != nil {
+		return err
+	}
+	m.Files = append(m.Files, manifestFile{Path: fileTiles, Size: tilesSize, SHA256: tilesSum})
+	for _, f := range files {
+		sum := sha256.Sum256(f.data)
+		m.Files = append(m.Files, manifestFile{Path: f.path, Size: int64(len(f.data)), SHA256: hex.EncodeToString(sum[:])})
+		switch {
+		case strings.HasPrefix(f.path, "fonts/"):
+			m.Glyphs = "fonts/{fontstack}/{range}.pbf"
+		case strings.HasPrefix(f.path, "sprites/"):
+			m.Sprite = "sprites/" + p.Style
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append([]packageFile{{path: fileManifest, data: manifestJSON}}, files...)
+
+	size, checksum, err := writeZip(b.FilePath(p), tilesPath, files)
+	if err != nil {
+		return fmt.Errorf("zip: %w", err)
+	}
+
+	_, err = b.db.ExecContext(ctx, `
+		UPDATE offline_packages
+		SET status = 'ready', tileset_version = $2, tile_count = $3, size_bytes = $4,
+			checksum = $5, error = NULL, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, p.ID, version, count, size, checksum)
+	return err
+}
+
+// writeMBTiles copies the package's tile ranges from ts into a new MBTiles
+// file and returns the number of tiles written. Tiles are copied as stored,
+// so vector tiles stay gzip compressed.
+func writeMBTiles(ctx context.Context, ts tiles.Tileset, path string, p *Package) (int, error) {
+	out, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	_, err = out.Exec(`
+		CREATE TABLE metadata (name TEXT, value TEXT);
+		CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+		CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	meta := ts.Metadata()
+	rows := [][2]string{
+		{"name", p.Tileset + " offline"},
+		{"format", meta.Format},
+		{"type", "baselayer"},
+		{"version", tiles.Version(ts)},
+		{"minzoom", strconv.Itoa(p.MinZoom)},
+		{"maxzoom", strconv.Itoa(p.MaxZoom)},
+		{"bounds", joinFloats(p.BBox[:])},
+		{"center", joinFloats([]float64{(p.BBox[0] + p.BBox[2]) / 2, (p.BBox[1] + p.BBox[3]) / 2, float64(p.MaxZoom)})},
+	}
+	if meta.Attribution != "" {
+		rows = append(rows, [2]string{"attribution", meta.Attribution})
+	}
+	if meta.Description != "" {
+		rows = append(rows, [2]string{"description", meta.Description})
+	}
+	if len(meta.VectorLayers) > 0 {
+		doc, _ := json.Marshal(map[string]json.RawMessage{"vector_layers": meta.VectorLayers})
+		rows = append(rows, [2]string{"json", string(doc)})
+	}
+	for _, row := range rows {
+		if _, err := out.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", row[0], row[1]); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := out.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count := 0
+	for _, tr := range tileRanges(p.BBox, p.MinZoom, p.MaxZoom) {
+		for x := tr.minX; x <= tr.maxX; x++ {
+			for y := tr.minY; y <= tr.maxY; y++ {
+				data, err := ts.Tile(ctx, tr.z, x, y)
+				if err != nil {
+					return 0, err
+				}
+				if data == nil {
+					continue
+				}
+				// MBTiles stores rows in TMS order
+				row := (1 << uint(tr.z)) - 1 - y
+				if _, err := stmt.Exec(tr.z, x, row, data); err != nil {
+					return 0, err
+				}
+				count++
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func joinFloats(vals []float64) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// poiGeoJSON returns the public businesses in bbox as a FeatureCollection
+func (b *Builder) poiGeoJSON(ctx context.Context, bbox [4]float64) ([]byte, error) {
+	var doc []byte
+	err := b.db.QueryRowContext(ctx, `
+		SELECT json_build_object(
+			'type', 'FeatureCollection',
+			'features', COALESCE(json_agg(json_build_object(
+				'type', 'Feature',
+				'id', b.id,
+				'geometry', ST_AsGeoJSON(b.geom, 6)::json,
+				'properties', json_build_object(
+					'name', b.name,
+					'name_am', b.name_am,
+					'category_id', b.category_id,
+					'category', c.name,
+					'category_am', c.name_am,
+					'icon', c.icon,
+					'phone', b.phone,
+					'website', b.website,
+					'address', b.address,
+					'address_am', b.address_am,
+					'status', b.status,
+					'avg_rating', b.avg_rating,
+					'review_count', b.review_count
+				)
+			) ORDER BY b.id), '[]'::json)
+		)::text
+		FROM businesses b
+		LEFT JOIN categories c ON c.id = b.category_id
+		WHERE b.geom && ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		AND b.status IN ('verified', 'closed')
+	`, bbox[0], bbox[1], bbox[2], bbox[3]).Scan(&doc)
+	return doc, err
+}
+
+// assetFiles returns the style document with the glyph ranges and sprite
+// sheets it uses, plus the names of the style sources served from the base
+// tileset
+func (b *Builder) assetFiles(style, baseURL string) ([]packageFile, []string, error) {
+	raw, err := b.assets.Style(style, baseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := []packageFile{{path: fileStyle, data: raw}}
+
+	var doc struct {
+		Sources map[string]struct {
+			Type  string   `json:"type"`
+			URL   string   `json:"url"`
+			Tiles []string `json:"tiles"`
+		} `json:"sources"`
+		Layers []struct {
+			Layout struct {
+				TextFont []interface{} `json:"text-font"`
+			} `json:"layout"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	var sources []string
+	for name, src := range doc.Sources {
+		if src.Type != "vector" {
+			continue
+		}
+		for _, u := range append(src.Tiles, src.URL) {
+			// Live POI tiles are replaced by the packaged GeoJSON
+			if strings.Contains(u, "/api/tiles/") && !strings.Contains(u, "/api/tiles/pois/") {
+				sources = append(sources, name)
+				break
+			}
+		}
+	}
+	sort.Strings(sources)
+
+	stacks := make(map[string]bool)
+	for _, l := range doc.Layers {
+		var fonts []string
+		for _, f := range l.Layout.TextFont {
+			if s, ok := f.(string); ok {
+				fonts = append(fonts, s)
+			}
+		}
+		// Only literal font arrays; expressions are left to the client
+		if len(fonts) > 0 && len(fonts) == len(l.Layout.TextFont) {
+			stacks[strings.Join(fonts, ",")] = true
+		}
+	}
+	fontstacks := make([]string, 0, len(stacks))
+	for s := range stacks {
+		fontstacks = append(fontstacks, s)
+	}
+	sort.Strings(fontstacks)
+
+	for _, fontstack := range fontstacks {
+		for _, rng := range glyphRanges {
+			data, err := b.assets.Glyphs(fontstack, rng)
+			if err != nil {
+				continue
+			}
+			files = append(files, packageFile{path: "fonts/" + fontstack + "/" + rng + ".pbf", data: data})
+		}
+	}
+
+	for _, suffix := range []string{".json", ".png", "@2x.json", "@2x.png"} {
+		path, err := b.assets.SpritePath(style + suffix)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, packageFile{path: "sprites/" + style + suffix, data: data})
+	}
+	return files, sources, nil
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeZip writes the package zip to path via a temporary file and returns
+// its size and sha256. The MBTiles file is stored uncompressed since its
+// tiles already are.
+func writeZip(path, tilesPath string, files []packageFile) (int64, string, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp)
+
+	h := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(f, h))
+
+	now := time.Now()
+	for _, pf := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: pf.path, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			f.Close()
+			return 0, "", err
+		}
+		if _, err := w.Write(pf.data); err != nil {
+			f.Close()
+			return 0, "", err
+		}
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: fileTiles, Method: zip.Store, Modified: now})
+	if err == nil {
+		var src *os.File
+		if src, err = os.Open(tilesPath); err == nil {
+			_, err = io.Copy(w, src)
+			src.Close()
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, "", err
+	}
+	return info.Size(), hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,232 @@
+// Package offline builds downloadable map packages for the mobile app: a
+// tile subset of a base tileset for a bounding box and zoom range, the
+// businesses in that area as GeoJSON, and the style with its glyphs and
+// sprites. Packages are built by a background worker from the
+// offline_packages table.
+package offline
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"maps/api/internal/tiles"
+)
+
+const (
+	// maxZoom is the deepest zoom a package may contain; clients overzoom
+	// past the tileset's own max zoom anyway
+	maxZoom = 16
+	// estimateSamples is the number of tiles read per zoom level to
+	// estimate the average tile size
+	estimateSamples = 16
+	// poiBytesEstimate is the approximate size of one business feature in
+	// the packaged GeoJSON
+	poiBytesEstimate = 400
+	// mercatorMaxLat is the latitude limit of Web Mercator tiles
+	mercatorMaxLat = 85.05112878
+)
+
+// Package statuses
+const (
+	StatusPending  = "pending"
+	StatusBuilding = "building"
+	StatusReady    = "ready"
+	StatusFailed   = "failed"
+)
+
+var (
+	// ErrTooLarge is returned when a request covers more tiles than allowed
+	ErrTooLarge = errors.New("offline package too large")
+	// ErrNotFound is returned for unknown package ids
+	ErrNotFound = errors.New("offline package not found")
+	// ErrNoZooms is returned when the requested zooms miss the tileset
+	ErrNoZooms = errors.New("zoom range is outside the tileset")
+)
+
+// Request describes the area and zooms of an offline package
+type Request struct {
+	BBox    [4]float64 `json:"bbox"` // minLng, minLat, maxLng, maxLat
+	MinZoom int        `json:"min_zoom"`
+	MaxZoom int        `json:"max_zoom"`
+	Tileset string     `json:"tileset"`
+	Style   string     `json:"style"`
+}
+
+// Validate checks the bounding box and zoom range
+func (req *Request) Validate() error {
+	minLng, minLat, maxLng, maxLat := req.BBox[0], req.BBox[1], req.BBox[2], req.BBox[3]
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 {
+		return fmt.Errorf("bbox must be within -180,-90,180,90")
+	}
+	if minLng >= maxLng || minLat >= maxLat {
+		return fmt.Errorf("bbox must be minLng,minLat,maxLng,maxLat with min < max")
+	}
+	if req.MinZoom < 0 || req.MaxZoom > maxZoom || req.MinZoom > req.MaxZoom {
+		return fmt.Errorf("zoom range must be within 0-%d with min_zoom <= max_zoom", maxZoom)
+	}
+	return nil
+}
+
+// Estimate is the expected size of a package, computed before it is built
+type Estimate struct {
+	Tileset    string `json:"tileset"`
+	MinZoom    int    `json:"min_zoom"` // after clamping to the tileset
+	MaxZoom    int    `json:"max_zoom"`
+	TileCount  int    `json:"tile_count"`
+	TileBytes  int64  `json:"tile_bytes"`
+	POICount   int    `json:"poi_count"`
+	POIBytes   int64  `json:"poi_bytes"`
+	AssetBytes int64  `json:"asset_bytes"` // style, glyphs and sprites
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+// Package is a queued or built offline package
+type Package struct {
+	ID             string     `json:"id"`
+	Status         string     `json:"status"`
+	Tileset        string     `json:"tileset"`
+	TilesetVersion string     `json:"tileset_version"`
+	Style          string     `json:"style"`
+	BBox           [4]float64 `json:"bbox"`
+	MinZoom        int        `json:"min_zoom"`
+	MaxZoom        int        `json:"max_zoom"`
+	TileCount      int        `json:"tile_count"`
+	EstimatedBytes int64      `json:"estimated_bytes"`
+	SizeBytes      *int64     `json:"size_bytes,omitempty"`
+	Checksum       *string    `json:"checksum,omitempty"` // sha256 of the zip, hex
+	Error          *string    `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	DownloadURL    string     `json:"download_url,omitempty"`
+
+	userID  sql.NullString
+	baseURL string
+}
+
+const selectPackage = `
+	SELECT id, status, tileset, tileset_version, style, base_url, user_id,
+		min_lng, min_lat, max_lng, max_lat, min_zoom, max_zoom,
+		tile_count, estimated_bytes, size_bytes, checksum, error, created_at, completed_at
+	FROM offline_packages`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPackage(s scanner) (*Package, error) {
+	var p Package
+	var size sql.NullInt64
+	var checksum, errMsg sql.NullString
+	var completed sql.NullTime
+	err := s.Scan(&p.ID, &p.Status, &p.Tileset, &p.TilesetVersion, &p.Style, &p.baseURL, &p.userID,
+		&p.BBox[0], &p.BBox[1], &p.BBox[2], &p.BBox[3], &p.MinZoom, &p.MaxZoom,
+		&p.TileCount, &p.EstimatedBytes, &size, &checksum, &errMsg, &p.CreatedAt, &completed)
+	if err != nil {
+		return nil, err
+	}
+	if size.Valid {
+		p.SizeBytes = &size.Int64
+	}
+	if checksum.Valid {
+		p.Checksum = &checksum.String
+	}
+	if errMsg.Valid {
+		p.Error = &errMsg.String
+	}
+	if completed.Valid {
+		p.CompletedAt = &completed.Time
+	}
+	return &p, nil
+}
+
+// OwnedBy reports whether the package was requested by userID
+func (p *Package) OwnedBy(userID string) bool {
+	return p.userID.Valid && p.userID.String == userID
+}
+
+// Get returns a package by id
+func Get(ctx context.Context, db *sql.DB, id string) (*Package, error) {
+	p, err := scanPackage(db.QueryRowContext(ctx, selectPackage+" WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+// List returns a user's packages, newest first
+func List(ctx context.Context, db *sql.DB, userID string) ([]Package, error) {
+	rows, err := db.QueryContext(ctx, selectPackage+" WHERE user_id = $1 ORDER BY created_at DESC LIMIT 50", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Package
+	for rows.Next() {
+		p, err := scanPackage(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+// tileRange is the inclusive XYZ tile range covering a bbox at zoom z
+type tileRange struct {
+	z, minX, minY, maxX, maxY int
+}
+
+func (t tileRange) count() int {
+	return (t.maxX - t.minX + 1) * (t.maxY - t.minY + 1)
+}
+
+func tileRanges(bbox [4]float64, minZoom, maxZoom int) []tileRange {
+	var out []tileRange
+	for z := minZoom; z <= maxZoom; z++ {
+		minX, maxY := lngLatToTile(bbox[0], bbox[1], z)
+		maxX, minY := lngLatToTile(bbox[2], bbox[3], z)
+		out = append(out, tileRange{z: z, minX: minX, minY: minY, maxX: maxX, maxY: maxY})
+	}
+	return out
+}
+
+func lngLatToTile(lng, lat float64, z int) (int, int) {
+	n := float64(int(1) << uint(z))
+	lat = math.Max(-mercatorMaxLat, math.Min(mercatorMaxLat, lat))
+	rad := lat * math.Pi / 180
+
+	x := int(math.Floor((lng + 180) / 360 * n))
+	y := int(math.Floor((1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n))
+	last := int(n) - 1
+	return clampInt(x, 0, last), clampInt(y, 0, last)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// zoomRange clamps the requested zooms to what the tileset contains
+func zoomRange(req Request, meta tiles.Metadata) (int, int, error) {
+	minZ, maxZ := req.MinZoom, req.MaxZoom
+	if minZ < meta.MinZoom {
+		minZ = meta.MinZoom
+	}
+	if maxZ > meta.MaxZoom {
+		maxZ = meta.MaxZoom
+	}
+	if minZ > maxZ {
+		return 0, 0, fmt.Errorf("%w: %s has zooms %d-%d", ErrNoZooms, req.Tileset, meta.MinZoom, meta.MaxZoom)
+	}
+	return minZ, maxZ, nil
+}
@@ -0,0 +1,91 @@
+// Package regions looks up the service regions (cities/areas we operate in)
+// stored in the regions table.
+package regions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrOutsideRegions is returned when a point is not inside any active region
+var ErrOutsideRegions = errors.New("location is outside our service regions")
+
+// Region is a service region
+type Region struct {
+	ID          string     `json:"id"`
+	Slug        string     `json:"slug"`
+	Name        string     `json:"name"`
+	NameAm      *string    `json:"name_am,omitempty"`
+	CountryCode string     `json:"country_code"`
+	Timezone    string     `json:"timezone"`
+	BBox        [4]float64 `json:"bbox"` // minLng, minLat, maxLng, maxLat
+	IsActive    bool       `json:"is_active"`
+}
+
+const selectRegion = `
+	SELECT id, slug, name, name_am, country_code, timezone,
+		ST_XMin(geom), ST_YMin(geom), ST_XMax(geom), ST_YMax(geom), is_active
+	FROM regions`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRegion(s scanner) (*Region, error) {
+	var reg Region
+	var nameAm sql.NullString
+	err := s.Scan(&reg.ID, &reg.Slug, &reg.Name, &nameAm, &reg.CountryCode, &reg.Timezone,
+		&reg.BBox[0], &reg.BBox[1], &reg.BBox[2], &reg.BBox[3], &reg.IsActive)
+	if err != nil {
+		return nil, err
+	}
+	if nameAm.Valid {
+		reg.NameAm = &nameAm.String
+	}
+	return &reg, nil
+}
+
+// Locate returns the smallest active region containing the point
+func Locate(ctx context.Context, db *sql.DB, lat, lng float64) (*Region, error) {
+	row := db.QueryRowContext(ctx, selectRegion+`
+		WHERE is_active AND ST_Contains(geom, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+		ORDER BY ST_Area(geom)
+		LIMIT 1
+	`, lng, lat)
+	reg, err := scanRegion(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrOutsideRegions
+	}
+	return reg, err
+}
+
+// BySlug returns a region by its slug, active or not
+func BySlug(ctx context.Context, db *sql.DB, slug string) (*Region, error) {
+	return scanRegion(db.QueryRowContext(ctx, selectRegion+" WHERE slug = $1", slug))
+}
+
+// List returns regions ordered for display
+func List(ctx context.Context, db *sql.DB, activeOnly bool) ([]Region, error) {
+	query := selectRegion
+	if activeOnly {
+		query += " WHERE is_active"
+	}
+	query += " ORDER BY sort_order, name"
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Region
+	for rows.Next() {
+		reg, err := scanRegion(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *reg)
+	}
+	return list, rows.Err()
+}
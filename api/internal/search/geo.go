@@ -0,0 +1,24 @@
+package search
+
+import "math"
+
+const earthRadiusMeters = 6371000.0
+
+// DistanceMeters returns the great-circle distance between two points
+func DistanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLng := (lng2 - lng1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// ProximityBoost decays from 1 at the user's position towards 0, halving
+// roughly every halfLife meters
+func ProximityBoost(distance, halfLife float64) float64 {
+	if halfLife <= 0 {
+		return 0
+	}
+	return math.Exp(-distance * math.Ln2 / halfLife)
+}
@@ -0,0 +1,254 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"maps/api/internal/db"
+	"maps/api/internal/translit"
+)
+
+// Document kinds held by the index
+const (
+	KindBusiness = "business"
+	KindCategory = "category"
+)
+
+// Doc is an indexed autocomplete target
+type Doc struct {
+	ID         string
+	Kind       string
+	Name       string
+	NameAm     string
+	CategoryID string
+	Category   string
+	Icon       string
+	Lat        float64
+	Lng        float64
+	Rating     float64
+
+	keys []string
+}
+
+// Index is an in-memory prefix index over business and category names.
+// Load builds it from scratch; Refresh patches a single business in place.
+type Index struct {
+	db *sql.DB
+
+	mu   sync.RWMutex
+	trie *Trie
+	docs map[string]*Doc // kind:id -> doc
+}
+
+// NewIndex creates an empty index backed by db
+func NewIndex(db *sql.DB) *Index {
+	return &Index{
+		db:   db,
+		trie: NewTrie(),
+		docs: make(map[string]*Doc),
+	}
+}
+
+// Load rebuilds the whole index from the database
+func (idx *Index) Load(ctx context.Context) error {
+	start := time.Now()
+	trie := NewTrie()
+	docs := make(map[string]*Doc)
+
+	rows, err := idx.db.QueryContext(ctx, `
+		SELECT id, name, COALESCE(name_am, ''), COALESCE(icon, '')
+		FROM categories
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		d := &Doc{Kind: KindCategory}
+		if err := rows.Scan(&d.ID, &d.Name, &d.NameAm, &d.Icon); err != nil {
+			continue
+		}
+		addDoc(trie, docs, d)
+	}
+	rows.Close()
+
+	rows, err = idx.db.QueryContext(ctx, businessDocQuery+" WHERE b.status = 'verified'")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d, err := scanBusinessDoc(rows)
+		if err != nil {
+			continue
+		}
+		addDoc(trie, docs, d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	idx.trie = trie
+	idx.docs = docs
+	idx.mu.Unlock()
+
+	log.Printf("Search index loaded: %d documents in %s", len(docs), time.Since(start))
+	return nil
+}
+
+// Refresh re-reads a single business and updates or removes its entry
+func (idx *Index) Refresh(ctx context.Context, businessID string) error {
+	rows, err := idx.db.QueryContext(ctx, businessDocQuery+" WHERE b.id = $1 AND b.status = 'verified'", businessID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var doc *Doc
+	if rows.Next() {
+		doc, err = scanBusinessDoc(rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if old, ok := idx.docs[KindBusiness+":"+businessID]; ok {
+		for _, k := range old.keys {
+			idx.trie.Remove(k, KindBusiness+":"+businessID)
+		}
+		delete(idx.docs, KindBusiness+":"+businessID)
+	}
+	if doc != nil {
+		addDoc(idx.trie, idx.docs, doc)
+	}
+	return nil
+}
+
+// HandleNotify is a db.Notifier callback. An empty payload means
+// notifications may have been lost, so the whole index is rebuilt.
+func (idx *Index) HandleNotify(payload string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var err error
+	if payload == "" {
+		err = idx.Load(ctx)
+	} else {
+		var change db.BusinessChange
+		if change, err = db.ParseBusinessChange(payload); err == nil {
+			err = idx.Refresh(ctx, change.ID)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to refresh search index: %v", err)
+	}
+}
+
+// Match is a prefix lookup result
+type Match struct {
+	Doc *Doc
+	// Coverage is the share of the matched key covered by the query (0..1]
+	Coverage float64
+}
+
+// Lookup returns up to limit documents with a key starting with query
+func (idx *Index) Lookup(query string, limit int) []Match {
+	q := Normalize(query)
+	if q == "" {
+		return nil
+	}
+	qLen := len([]rune(q))
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var matches []Match
+	for _, pm := range idx.trie.Prefix(q, limit) {
+		doc, ok := idx.docs[pm.ID]
+		if !ok {
+			continue
+		}
+		matches = append(matches, Match{Doc: doc, Coverage: float64(qLen) / float64(pm.KeyLen)})
+	}
+	return matches
+}
+
+// Len returns the number of indexed documents
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+const businessDocQuery = `
+	SELECT b.id, b.name, COALESCE(b.name_am, ''),
+		COALESCE(c.id::text, ''), COALESCE(c.name, ''), COALESCE(c.icon, ''),
+		ST_Y(b.geom), ST_X(b.geom), COALESCE(b.avg_rating, 0)
+	FROM businesses b
+	LEFT JOIN categories c ON b.category_id = c.id`
+
+func scanBusinessDoc(rows *sql.Rows) (*Doc, error) {
+	d := &Doc{Kind: KindBusiness}
+	err := rows.Scan(&d.ID, &d.Name, &d.NameAm, &d.CategoryID, &d.Category, &d.Icon, &d.Lat, &d.Lng, &d.Rating)
+	return d, err
+}
+
+func addDoc(trie *Trie, docs map[string]*Doc, d *Doc) {
+	key := d.Kind + ":" + d.ID
+	d.keys = indexKeys(d.Name, d.NameAm)
+	for _, k := range d.keys {
+		trie.Insert(k, key)
+	}
+	docs[key] = d
+}
+
+// indexKeys returns the normalized full names plus every word-start suffix,
+// so "cof" finds "Tomoca Coffee" and "tomoca c" still narrows to it.
+func indexKeys(names ...string) []string {
+	seen := make(map[string]struct{})
+	var keys []string
+	for _, name := range names {
+		n := Normalize(name)
+		if n == "" {
+			continue
+		}
+		words := strings.Split(n, " ")
+		for i := range words {
+			k := strings.Join(words[i:], " ")
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Normalize folds s to its script-independent Latin form, turns punctuation
+// into spaces and collapses runs of whitespace, producing the form used for
+// both keys and queries.
+func Normalize(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range translit.Fold(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SearchKey builds the businesses.search_key value: the normalized name and
+// Amharic name, so a Latin query can match a Ge'ez name and vice versa.
+func SearchKey(name, nameAm string) string {
+	key := Normalize(name)
+	if am := Normalize(nameAm); am != "" && am != key {
+		key = strings.TrimSpace(key + " " + am)
+	}
+	return key
+}
+
+// KeySyncer fills businesses.search_key for rows whose key was cleared by
+// the reset trigger. Notifications are coalesced so bursts cost one pass.
+type KeySyncer struct {
+	db      *sql.DB
+	pending chan struct{}
+}
+
+// NewKeySyncer creates a syncer and starts its background worker
+func NewKeySyncer(db *sql.DB) *KeySyncer {
+	s := &KeySyncer{db: db, pending: make(chan struct{}, 1)}
+	go s.run()
+	s.Trigger()
+	return s
+}
+
+// Trigger schedules a sync pass if one isn't already queued
+func (s *KeySyncer) Trigger() {
+	select {
+	case s.pending <- struct{}{}:
+	default:
+	}
+}
+
+// HandleNotify is a db.Notifier callback
+func (s *KeySyncer) HandleNotify(string) {
+	s.Trigger()
+}
+
+func (s *KeySyncer) run() {
+	for range s.pending {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		n, err := s.Sync(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to sync search keys: %v", err)
+		} else if n > 0 {
+			log.Printf("Synced %d search keys", n)
+		}
+	}
+}
+
+// Sync computes missing search keys in batches and returns how many rows
+// were updated. Each batch is written with one statement; a row renamed
+// since it was read keeps its NULL key for the next pass.
+func (s *KeySyncer) Sync(ctx context.Context) (int, error) {
+	const batchSize = 1000
+	total := 0
+
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id, name, COALESCE(name_am, '')
+			FROM businesses
+			WHERE search_key IS NULL
+			LIMIT $1
+		`, batchSize)
+		if err != nil {
+			return total, err
+		}
+
+		var ids, names, namesAm, keys []string
+		for rows.Next() {
+			var id, name, nameAm string
+			if err := rows.Scan(&id, &name, &nameAm); err != nil {
+				continue
+			}
+			ids = append(ids, id)
+			names = append(names, name)
+			namesAm = append(namesAm, nameAm)
+			keys = append(keys, SearchKey(name, nameAm))
+		}
+		rows.Close()
+
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE businesses b SET search_key = k.key
+			FROM unnest($1::uuid[], $2::text[], $3::text[], $4::text[]) AS k(id, name, name_am, key)
+			WHERE b.id = k.id AND b.search_key IS NULL
+			AND b.name = k.name AND COALESCE(b.name_am, '') = k.name_am
+		`, pq.Array(ids), pq.Array(names), pq.Array(namesAm), pq.Array(keys))
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += int(n)
+
+		if len(ids) < batchSize || n == 0 {
+			return total, nil
+		}
+	}
+}
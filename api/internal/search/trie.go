@@ -0,0 +1,114 @@
+package search
+
+// Trie is a rune-keyed prefix tree mapping normalized keys to document ids.
+// It is not safe for concurrent use; Index guards it with a lock.
+type Trie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	ids      map[string]struct{}
+}
+
+// NewTrie creates an empty trie
+func NewTrie() *Trie {
+	return &Trie{root: &trieNode{}}
+}
+
+// Insert associates id with key
+func (t *Trie) Insert(key, id string) {
+	if key == "" {
+		return
+	}
+	n := t.root
+	for _, r := range key {
+		if n.children == nil {
+			n.children = make(map[rune]*trieNode)
+		}
+		child, ok := n.children[r]
+		if !ok {
+			child = &trieNode{}
+			n.children[r] = child
+		}
+		n = child
+	}
+	if n.ids == nil {
+		n.ids = make(map[string]struct{})
+	}
+	n.ids[id] = struct{}{}
+}
+
+// Remove drops the association between key and id, pruning empty branches
+func (t *Trie) Remove(key, id string) {
+	if key == "" {
+		return
+	}
+	path := []*trieNode{t.root}
+	runes := []rune(key)
+	n := t.root
+	for _, r := range runes {
+		child, ok := n.children[r]
+		if !ok {
+			return
+		}
+		n = child
+		path = append(path, n)
+	}
+	delete(n.ids, id)
+
+	for i := len(runes) - 1; i >= 0; i-- {
+		node := path[i+1]
+		if len(node.ids) > 0 || len(node.children) > 0 {
+			break
+		}
+		delete(path[i].children, runes[i])
+	}
+}
+
+// PrefixMatch is a document id found under a prefix, with the length of the
+// full key it was indexed under (shorter keys are closer matches)
+type PrefixMatch struct {
+	ID     string
+	KeyLen int
+}
+
+// Prefix returns up to limit ids whose key starts with prefix, visiting
+// shorter keys first so exact and near-exact matches win the budget.
+func (t *Trie) Prefix(prefix string, limit int) []PrefixMatch {
+	n := t.root
+	depth := 0
+	for _, r := range prefix {
+		child, ok := n.children[r]
+		if !ok {
+			return nil
+		}
+		n = child
+		depth++
+	}
+
+	var matches []PrefixMatch
+	seen := make(map[string]struct{})
+	level := []*trieNode{n}
+	for len(level) > 0 && len(matches) < limit {
+		var next []*trieNode
+		for _, node := range level {
+			for id := range node.ids {
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				seen[id] = struct{}{}
+				matches = append(matches, PrefixMatch{ID: id, KeyLen: depth})
+				if len(matches) >= limit {
+					return matches
+				}
+			}
+			for _, child := range node.children {
+				next = append(next, child)
+			}
+		}
+		level = next
+		depth++
+	}
+	return matches
+}
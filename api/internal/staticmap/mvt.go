@@ -0,0 +1,332 @@
+package staticmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Minimal Mapbox Vector Tile decoder, see
+// https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+
+// MVT geometry types
+const (
+	geomPoint      = 1
+	geomLineString = 2
+	geomPolygon    = 3
+)
+
+var errBadTile = errors.New("malformed vector tile")
+
+type point struct{ X, Y float64 }
+
+// feature is a decoded MVT feature. Parts are points, lines or polygon
+// rings in tile coordinates (0..extent).
+type feature struct {
+	Type  int
+	Props map[string]interface{}
+	Parts [][]point
+}
+
+type layer struct {
+	Name     string
+	Extent   float64
+	Features []feature
+}
+
+// pbReader walks protobuf fields
+type pbReader struct {
+	b []byte
+}
+
+func (r *pbReader) next() (num, wire uint64, ok bool) {
+	if len(r.b) == 0 {
+		return 0, 0, false
+	}
+	key, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.b = nil
+		return 0, 0, false
+	}
+	r.b = r.b[n:]
+	return key >> 3, key & 7, true
+}
+
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errBadTile
+	}
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *pbReader) bytes() ([]byte, error) {
+	l, err := r.varint()
+	if err != nil || uint64(len(r.b)) < l {
+		return nil, errBadTile
+	}
+	out := r.b[:l]
+	r.b = r.b[l:]
+	return out, nil
+}
+
+func (r *pbReader) skip(wire uint64) error {
+	switch wire {
+	case 0:
+		_, err := r.varint()
+		return err
+	case 1:
+		if len(r.b) < 8 {
+			return errBadTile
+		}
+		r.b = r.b[8:]
+	case 2:
+		_, err := r.bytes()
+		return err
+	case 5:
+		if len(r.b) < 4 {
+			return errBadTile
+		}
+		r.b = r.b[4:]
+	default:
+		return errBadTile
+	}
+	return nil
+}
+
+func packedVarints(b []byte) ([]uint64, error) {
+	var out []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errBadTile
+		}
+		out = append(out, v)
+		b = b[n:]
+	}
+	return out, nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// decodeTile decodes the layers of an uncompressed vector tile. If want is
+// not nil, only the named layers are decoded.
+func decodeTile(data []byte, want map[string]bool) ([]layer, error) {
+	var layers []layer
+	r := &pbReader{b: data}
+	for {
+		num, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		if num != 3 || wire != 2 {
+			if err := r.skip(wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		raw, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		l, err := decodeLayer(raw, want)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			layers = append(layers, *l)
+		}
+	}
+	return layers, nil
+}
+
+type rawFeature struct {
+	typ  int
+	tags []uint64
+	geom []uint64
+}
+
+func decodeLayer(data []byte, want map[string]bool) (*layer, error) {
+	l := &layer{Extent: 4096}
+	var keys []string
+	var values []interface{}
+	var raws []rawFeature
+
+	r := &pbReader{b: data}
+	for {
+		num, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		var err error
+		switch {
+		case num == 1 && wire == 2:
+			var b []byte
+			if b, err = r.bytes(); err == nil {
+				l.Name = string(b)
+				if want != nil && !want[l.Name] {
+					return nil, nil
+				}
+			}
+		case num == 2 && wire == 2:
+			var b []byte
+			if b, err = r.bytes(); err == nil {
+				var f rawFeature
+				if f, err = decodeFeature(b); err == nil {
+					raws = append(raws, f)
+				}
+			}
+		case num == 3 && wire == 2:
+			var b []byte
+			if b, err = r.bytes(); err == nil {
+				keys = append(keys, string(b))
+			}
+		case num == 4 && wire == 2:
+			var b []byte
+			if b, err = r.bytes(); err == nil {
+				var v interface{}
+				if v, err = decodeValue(b); err == nil {
+					values = append(values, v)
+				}
+			}
+		case num == 5 && wire == 0:
+			var v uint64
+			if v, err = r.varint(); err == nil && v > 0 {
+				l.Extent = float64(v)
+			}
+		default:
+			err = r.skip(wire)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rf := range raws {
+		f := feature{Type: rf.typ, Props: make(map[string]interface{}, len(rf.tags)/2)}
+		for i := 0; i+1 < len(rf.tags); i += 2 {
+			k, v := rf.tags[i], rf.tags[i+1]
+			if k < uint64(len(keys)) && v < uint64(len(values)) {
+				f.Props[keys[k]] = values[v]
+			}
+		}
+		f.Parts = decodeGeometry(rf.geom)
+		l.Features = append(l.Features, f)
+	}
+	return l, nil
+}
+
+func decodeFeature(data []byte) (rawFeature, error) {
+	var f rawFeature
+	r := &pbReader{b: data}
+	for {
+		num, wire, ok := r.next()
+		if !ok {
+			return f, nil
+		}
+		var err error
+		switch {
+		case num == 2 && wire == 2:
+			var b []byte
+			if b, err = r.bytes(); err == nil {
+				f.tags, err = packedVarints(b)
+			}
+		case num == 3 && wire == 0:
+			var v uint64
+			v, err = r.varint()
+			f.typ = int(v)
+		case num == 4 && wire == 2:
+			var b []byte
+			if b, err = r.bytes(); err == nil {
+				f.geom, err = packedVarints(b)
+			}
+		default:
+			err = r.skip(wire)
+		}
+		if err != nil {
+			return f, err
+		}
+	}
+}
+
+func decodeValue(data []byte) (interface{}, error) {
+	r := &pbReader{b: data}
+	var v interface{}
+	for {
+		num, wire, ok := r.next()
+		if !ok {
+			return v, nil
+		}
+		switch {
+		case num == 1 && wire == 2:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			v = string(b)
+		case num == 2 && wire == 5:
+			if len(r.b) < 4 {
+				return nil, errBadTile
+			}
+			v = float64(math.Float32frombits(binary.LittleEndian.Uint32(r.b)))
+			r.b = r.b[4:]
+		case num == 3 && wire == 1:
+			if len(r.b) < 8 {
+				return nil, errBadTile
+			}
+			v = math.Float64frombits(binary.LittleEndian.Uint64(r.b))
+			r.b = r.b[8:]
+		case (num == 4 || num == 5 || num == 6 || num == 7) && wire == 0:
+			u, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			switch num {
+			case 4:
+				v = float64(int64(u))
+			case 5:
+				v = float64(u)
+			case 6:
+				v = float64(zigzag(u))
+			case 7:
+				v = u != 0
+			}
+		default:
+			if err := r.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// decodeGeometry runs the MoveTo/LineTo/ClosePath command stream
+func decodeGeometry(cmds []uint64) [][]point {
+	var parts [][]point
+	var x, y int64
+	for i := 0; i < len(cmds); {
+		id, count := cmds[i]&7, int(cmds[i]>>3)
+		i++
+		switch id {
+		case 1, 2: // MoveTo, LineTo
+			for c := 0; c < count && i+1 < len(cmds); c++ {
+				x += zigzag(cmds[i])
+				y += zigzag(cmds[i+1])
+				i += 2
+				if id == 1 || len(parts) == 0 {
+					parts = append(parts, nil)
+				}
+				parts[len(parts)-1] = append(parts[len(parts)-1], point{float64(x), float64(y)})
+			}
+		case 7: // ClosePath
+			if n := len(parts); n > 0 && len(parts[n-1]) > 0 {
+				parts[n-1] = append(parts[n-1], parts[n-1][0])
+			}
+		default:
+			return parts
+		}
+	}
+	return parts
+}
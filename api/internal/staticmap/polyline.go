@@ -0,0 +1,53 @@
+package staticmap
+
+import (
+	"errors"
+	"math"
+)
+
+// LatLng is a WGS84 coordinate
+type LatLng struct {
+	Lat, Lng float64
+}
+
+var errBadPolyline = errors.New("invalid encoded polyline")
+
+// DecodePolyline decodes a Google encoded polyline. precision is 5 for
+// Google/OSRM and 6 for Valhalla.
+func DecodePolyline(s string, precision int) ([]LatLng, error) {
+	factor := math.Pow(10, float64(precision))
+
+	var points []LatLng
+	var lat, lng int64
+	for i := 0; i < len(s); {
+		var deltas [2]int64
+		for k := range deltas {
+			var result int64
+			var shift uint
+			for {
+				if i >= len(s) || shift > 60 {
+					return nil, errBadPolyline
+				}
+				b := int64(s[i]) - 63
+				i++
+				if b < 0 {
+					return nil, errBadPolyline
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[k] = ^(result >> 1)
+			} else {
+				deltas[k] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, LatLng{Lat: float64(lat) / factor, Lng: float64(lng) / factor})
+	}
+	return points, nil
+}
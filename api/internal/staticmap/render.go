@@ -0,0 +1,437 @@
+// Package staticmap renders PNG map images from our vector tiles, styled
+// with a simplified reading of the MapLibre style served to clients.
+package staticmap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"math"
+
+	"golang.org/x/image/vector"
+
+	"maps/api/internal/styles"
+	"maps/api/internal/tiles"
+)
+
+const (
+	// MaxSize is the largest output dimension in pixels, after scaling
+	MaxSize = 2048
+	// MinSize is the smallest output dimension in CSS pixels
+	MinSize = 16
+	// MaxZoom is the highest zoom accepted
+	MaxZoom = 20
+	// fitMaxZoom caps the zoom chosen to fit markers and paths
+	fitMaxZoom = 17
+	// fitPadding keeps fitted overlays away from the image edge (CSS px)
+	fitPadding = 40
+	// maxTiles bounds the tiles decoded for one image
+	maxTiles = 100
+)
+
+var (
+	defaultMarkerColor = color.NRGBA{0xe5, 0x39, 0x35, 0xff}
+	defaultPathColor   = color.NRGBA{0x1e, 0x88, 0xe5, 0xff}
+	white              = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// ErrNoCenter is returned when neither a center nor overlays are given
+var ErrNoCenter = errors.New("center is required when there are no markers or path")
+
+// Marker is a pin drawn on the map
+type Marker struct {
+	LatLng
+	Color color.NRGBA
+}
+
+// Path is a line drawn on the map
+type Path struct {
+	Points []LatLng
+	Color  color.NRGBA
+	Width  float64 // CSS px
+}
+
+// Options describe a static map. Without a center (or zoom) the map is
+// fitted to its markers and paths.
+type Options struct {
+	Center  *LatLng
+	Zoom    *float64
+	Width   int // CSS px
+	Height  int // CSS px
+	Scale   int // 1 or 2
+	Tileset string
+	Style   string
+	Markers []Marker
+	Paths   []Path
+}
+
+// Renderer draws static maps from a tile store and a style
+type Renderer struct {
+	tiles  *tiles.Store
+	assets *styles.Assets
+}
+
+// NewRenderer creates a renderer
+func NewRenderer(store *tiles.Store, assets *styles.Assets) *Renderer {
+	return &Renderer{tiles: store, assets: assets}
+}
+
+// Render draws the map described by opts
+func (r *Renderer) Render(ctx context.Context, opts Options) (*image.RGBA, error) {
+	if opts.Scale < 1 {
+		opts.Scale = 1
+	}
+	scale := float64(opts.Scale)
+	w, h := opts.Width*opts.Scale, opts.Height*opts.Scale
+	if opts.Width < MinSize || opts.Height < MinSize {
+		return nil, fmt.Errorf("size must be at least %dx%d pixels", MinSize, MinSize)
+	}
+	if w > MaxSize || h > MaxSize {
+		return nil, fmt.Errorf("size must be at most %dx%d pixels after scaling", MaxSize, MaxSize)
+	}
+
+	center, zoom, err := fit(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := r.assets.Style(opts.Style, "")
+	if err != nil {
+		return nil, fmt.Errorf("style %s: %w", opts.Style, err)
+	}
+	style, err := parseStyle(raw)
+	if err != nil {
+		return nil, fmt.Errorf("style %s: %w", opts.Style, err)
+	}
+
+	world := 256 * scale * math.Pow(2, zoom)
+	cx, cy := project(center, world)
+	v := viewport{ox: cx - float64(w)/2, oy: cy - float64(h)/2, world: world}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(style.Background), image.Point{}, draw.Src)
+
+	loaded := r.loadTiles(ctx, opts.Tileset, style, v, zoom, w, h)
+
+	z := vector.NewRasterizer(w, h)
+	for _, sl := range style.Layers {
+		if zoom < sl.MinZoom || zoom >= sl.MaxZoom {
+			continue
+		}
+		z.Reset(w, h)
+		drawn := false
+
+		var halfWidth float64
+		if sl.Type == "line" {
+			halfWidth = math.Max(evalNumber(sl.Width, zoom, 1)*scale/2, 0.5)
+		}
+
+		for _, t := range loaded {
+			for li := range t.layers {
+				l := &t.layers[li]
+				if l.Name != sl.SourceLayer {
+					continue
+				}
+				for fi := range l.Features {
+					f := &l.Features[fi]
+					if !matchFilter(sl.Filter, f) {
+						continue
+					}
+					switch {
+					case sl.Type == "fill" && f.Type == geomPolygon:
+						for _, ring := range f.Parts {
+							fillRing(z, t.toPixels(ring, l.Extent))
+						}
+						drawn = true
+					case sl.Type == "line" && (f.Type == geomLineString || f.Type == geomPolygon):
+						for _, line := range f.Parts {
+							strokeLine(z, t.toPixels(line, l.Extent), halfWidth)
+						}
+						drawn = true
+					}
+				}
+			}
+		}
+
+		if drawn {
+			c := sl.Color
+			c.A = uint8(float64(c.A) * clamp(evalNumber(sl.Opacity, zoom, 1), 0, 1))
+			z.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{})
+		}
+	}
+
+	for _, p := range opts.Paths {
+		pts := make([]point, len(p.Points))
+		for i, ll := range p.Points {
+			pts[i] = v.pixel(ll)
+		}
+		width := p.Width
+		if width <= 0 {
+			width = 4
+		}
+		stroke := p.Color
+		if stroke.A == 0 {
+			stroke = defaultPathColor
+		}
+		// White casing keeps routes readable over roads of any color
+		for _, pass := range []struct {
+			c color.NRGBA
+			w float64
+		}{{white, width + 3}, {stroke, width}} {
+			z.Reset(w, h)
+			strokeLine(z, pts, pass.w*scale/2)
+			z.Draw(img, img.Bounds(), image.NewUniform(pass.c), image.Point{})
+		}
+	}
+
+	for _, m := range opts.Markers {
+		fill := m.Color
+		if fill.A == 0 {
+			fill = defaultMarkerColor
+		}
+		c := v.pixel(m.LatLng)
+		// Shadow, white ring, colored dot, white center
+		for _, pass := range []struct {
+			c     color.NRGBA
+			r, dy float64
+		}{{color.NRGBA{0, 0, 0, 0x40}, 10, 1}, {white, 9, 0}, {fill, 7, 0}, {white, 2.5, 0}} {
+			z.Reset(w, h)
+			circle(z, point{c.X, c.Y + pass.dy*scale}, pass.r*scale)
+			z.Draw(img, img.Bounds(), image.NewUniform(pass.c), image.Point{})
+		}
+	}
+
+	return img, nil
+}
+
+// viewport maps world pixels at the render zoom to image pixels
+type viewport struct {
+	ox, oy, world float64
+}
+
+func (v viewport) pixel(ll LatLng) point {
+	x, y := project(ll, v.world)
+	return point{x - v.ox, y - v.oy}
+}
+
+// project converts a coordinate to Web Mercator pixels in a world of the
+// given size
+func project(ll LatLng, world float64) (float64, float64) {
+	lat := clamp(ll.Lat, -85.05112878, 85.05112878) * math.Pi / 180
+	x := (ll.Lng + 180) / 360 * world
+	y := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * world
+	return x, y
+}
+
+// loadedTile is a decoded tile positioned in image pixels
+type loadedTile struct {
+	layers   []layer
+	ox, oy   float64 // image position of the tile's top-left corner
+	tileSize float64
+}
+
+func (t *loadedTile) toPixels(pts []point, extent float64) []point {
+	out := make([]point, len(pts))
+	k := t.tileSize / extent
+	for i, p := range pts {
+		out[i] = point{t.ox + p.X*k, t.oy + p.Y*k}
+	}
+	return out
+}
+
+// loadTiles fetches and decodes the tiles covering the viewport, overzooming
+// past the tileset's max zoom. A missing tileset leaves the map blank.
+func (r *Renderer) loadTiles(ctx context.Context, name string, style *renderStyle, v viewport, zoom float64, w, h int) []loadedTile {
+	ts, release, ok := r.tiles.Get(name)
+	if !ok {
+		log.Printf("Static map: tileset %s not found", name)
+		return nil
+	}
+	meta := ts.Metadata()
+	release()
+
+	tz := int(math.Floor(zoom))
+	if tz > meta.MaxZoom {
+		tz = meta.MaxZoom
+	}
+	if tz < meta.MinZoom {
+		tz = meta.MinZoom
+	}
+
+	want := make(map[string]bool)
+	for _, l := range style.Layers {
+		want[l.SourceLayer] = true
+	}
+
+	n := 1 << uint(tz)
+	tileSize := v.world / float64(n)
+	minX, maxX := int(math.Floor(v.ox/tileSize)), int(math.Floor((v.ox+float64(w))/tileSize))
+	minY, maxY := int(math.Floor(v.oy/tileSize)), int(math.Floor((v.oy+float64(h))/tileSize))
+
+	// Far below the tileset's min zoom the viewport would need too many tiles
+	if (maxX-minX+1)*(maxY-minY+1) > maxTiles {
+		log.Printf("Static map: zoom %.1f too low for tileset %s", zoom, name)
+		return nil
+	}
+
+	var loaded []loadedTile
+	for ty := minY; ty <= maxY; ty++ {
+		if ty < 0 || ty >= n {
+			continue
+		}
+		for tx := minX; tx <= maxX; tx++ {
+			wx := ((tx % n) + n) % n
+
+			tile, _, err := r.tiles.Tile(ctx, name, tz, wx, ty)
+			if err != nil {
+				log.Printf("Static map: tile %s/%d/%d/%d: %v", name, tz, wx, ty, err)
+				continue
+			}
+			if len(tile.Data) == 0 {
+				continue
+			}
+
+			data := tile.Data
+			if tiles.IsGzipped(data) {
+				zr, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					continue
+				}
+				data, err = io.ReadAll(zr)
+				zr.Close()
+				if err != nil {
+					continue
+				}
+			}
+
+			layers, err := decodeTile(data, want)
+			if err != nil {
+				log.Printf("Static map: decode tile %s/%d/%d/%d: %v", name, tz, wx, ty, err)
+				continue
+			}
+			loaded = append(loaded, loadedTile{
+				layers:   layers,
+				ox:       float64(tx)*tileSize - v.ox,
+				oy:       float64(ty)*tileSize - v.oy,
+				tileSize: tileSize,
+			})
+		}
+	}
+	return loaded
+}
+
+// fit resolves the center and zoom, fitting markers and paths when either
+// is missing
+func fit(opts Options) (LatLng, float64, error) {
+	var pts []LatLng
+	for _, m := range opts.Markers {
+		pts = append(pts, m.LatLng)
+	}
+	for _, p := range opts.Paths {
+		pts = append(pts, p.Points...)
+	}
+
+	if opts.Center != nil && opts.Zoom != nil {
+		return *opts.Center, *opts.Zoom, nil
+	}
+	if len(pts) == 0 {
+		if opts.Center == nil {
+			return LatLng{}, 0, ErrNoCenter
+		}
+		return *opts.Center, 15, nil
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range pts {
+		x, y := project(p, 1)
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	center := LatLng{}
+	if opts.Center != nil {
+		center = *opts.Center
+	} else {
+		// Unproject the middle of the bounds
+		mx, my := (minX+maxX)/2, (minY+maxY)/2
+		center.Lng = mx*360 - 180
+		center.Lat = math.Atan(math.Sinh(math.Pi*(1-2*my))) * 180 / math.Pi
+	}
+
+	if opts.Zoom != nil {
+		return center, *opts.Zoom, nil
+	}
+
+	// Thumbnails get proportionally less padding, and at least a pixel
+	// to fit into
+	pad := math.Min(fitPadding, float64(min(opts.Width, opts.Height))/8)
+	availW := math.Max(float64(opts.Width)-2*pad, 1)
+	availH := math.Max(float64(opts.Height)-2*pad, 1)
+	zoom := float64(fitMaxZoom)
+	if spanX, spanY := maxX-minX, maxY-minY; spanX > 0 || spanY > 0 {
+		zx, zy := math.Inf(1), math.Inf(1)
+		if spanX > 0 {
+			zx = math.Log2(availW / (256 * spanX))
+		}
+		if spanY > 0 {
+			zy = math.Log2(availH / (256 * spanY))
+		}
+		zoom = math.Floor(math.Min(math.Min(zx, zy), fitMaxZoom))
+	}
+	return center, clamp(zoom, 0, MaxZoom), nil
+}
+
+func fillRing(z *vector.Rasterizer, pts []point) {
+	if len(pts) < 3 {
+		return
+	}
+	z.MoveTo(float32(pts[0].X), float32(pts[0].Y))
+	for _, p := range pts[1:] {
+		z.LineTo(float32(p.X), float32(p.Y))
+	}
+	z.ClosePath()
+}
+
+// strokeLine outlines a polyline with round joins and caps. Every piece is
+// wound the same way so overlaps don't cancel out.
+func strokeLine(z *vector.Rasterizer, pts []point, hw float64) {
+	for i := 0; i+1 < len(pts); i++ {
+		a, b := pts[i], pts[i+1]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			continue
+		}
+		nx, ny := -dy/l*hw, dx/l*hw
+		z.MoveTo(float32(a.X+nx), float32(a.Y+ny))
+		z.LineTo(float32(b.X+nx), float32(b.Y+ny))
+		z.LineTo(float32(b.X-nx), float32(b.Y-ny))
+		z.LineTo(float32(a.X-nx), float32(a.Y-ny))
+		z.ClosePath()
+	}
+	if hw < 1 {
+		return
+	}
+	for _, p := range pts {
+		circle(z, p, hw)
+	}
+}
+
+// circle adds a disc, wound to match strokeLine's quads
+func circle(z *vector.Rasterizer, c point, r float64) {
+	const segments = 16
+	z.MoveTo(float32(c.X+r), float32(c.Y))
+	for i := 1; i < segments; i++ {
+		a := -2 * math.Pi * float64(i) / segments
+		z.LineTo(float32(c.X+r*math.Cos(a)), float32(c.Y+r*math.Sin(a)))
+	}
+	z.ClosePath()
+}
@@ -0,0 +1,19 @@
+package staticmap
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitSmallImages(t *testing.T) {
+	markers := []Marker{{LatLng: LatLng{9.0, 38.7}}, {LatLng: LatLng{9.05, 38.8}}}
+	for _, size := range [][2]int{{MinSize, MinSize}, {64, 64}, {80, 80}, {100, 50}, {600, 300}} {
+		_, zoom, err := fit(Options{Width: size[0], Height: size[1], Markers: markers})
+		if err != nil {
+			t.Fatalf("%dx%d: %v", size[0], size[1], err)
+		}
+		if math.IsNaN(zoom) || math.IsInf(zoom, 0) || zoom < 0 || zoom > fitMaxZoom {
+			t.Errorf("%dx%d: zoom = %v", size[0], size[1], zoom)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package staticmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// renderStyle is the subset of a MapLibre style the renderer understands:
+// background, fill and line layers with constant or zoom-interpolated paint
+// values and legacy or simple expression filters. Symbol layers are skipped.
+type renderStyle struct {
+	Background color.NRGBA
+	Layers     []styleLayer
+}
+
+type styleLayer struct {
+	ID          string
+	Type        string // fill, line
+	SourceLayer string
+	Filter      interface{}
+	MinZoom     float64
+	MaxZoom     float64
+	Color       color.NRGBA
+	Opacity     interface{}
+	Width       interface{}
+}
+
+func parseStyle(raw []byte) (*renderStyle, error) {
+	var doc struct {
+		Layers []struct {
+			ID          string                 `json:"id"`
+			Type        string                 `json:"type"`
+			SourceLayer string                 `json:"source-layer"`
+			Filter      interface{}            `json:"filter"`
+			MinZoom     *float64               `json:"minzoom"`
+			MaxZoom     *float64               `json:"maxzoom"`
+			Paint       map[string]interface{} `json:"paint"`
+			Layout      map[string]interface{} `json:"layout"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	s := &renderStyle{Background: color.NRGBA{0xf5, 0xf5, 0xf5, 0xff}}
+	for _, l := range doc.Layers {
+		if v, ok := l.Layout["visibility"].(string); ok && v == "none" {
+			continue
+		}
+
+		sl := styleLayer{ID: l.ID, Type: l.Type, SourceLayer: l.SourceLayer, Filter: l.Filter, MaxZoom: 24}
+		if l.MinZoom != nil {
+			sl.MinZoom = *l.MinZoom
+		}
+		if l.MaxZoom != nil {
+			sl.MaxZoom = *l.MaxZoom
+		}
+
+		switch l.Type {
+		case "background":
+			if c, ok := parseColor(l.Paint["background-color"]); ok {
+				s.Background = c
+			}
+			continue
+		case "fill":
+			c, ok := parseColor(l.Paint["fill-color"])
+			if !ok {
+				c = color.NRGBA{0, 0, 0, 0xff}
+			}
+			sl.Color = c
+			sl.Opacity = l.Paint["fill-opacity"]
+		case "line":
+			c, ok := parseColor(l.Paint["line-color"])
+			if !ok {
+				c = color.NRGBA{0, 0, 0, 0xff}
+			}
+			sl.Color = c
+			sl.Opacity = l.Paint["line-opacity"]
+			sl.Width = l.Paint["line-width"]
+		default:
+			continue
+		}
+		s.Layers = append(s.Layers, sl)
+	}
+	return s, nil
+}
+
+// evalNumber evaluates a number paint property at zoom: a constant, legacy
+// {"base", "stops"} function or ["interpolate", ..., ["zoom"], ...]
+func evalNumber(v interface{}, zoom, def float64) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case map[string]interface{}:
+		base := 1.0
+		if b, ok := t["base"].(float64); ok {
+			base = b
+		}
+		stops, _ := t["stops"].([]interface{})
+		var zs, vs []float64
+		for _, s := range stops {
+			pair, ok := s.([]interface{})
+			if !ok || len(pair) != 2 {
+				continue
+			}
+			z, ok1 := pair[0].(float64)
+			val, ok2 := pair[1].(float64)
+			if ok1 && ok2 {
+				zs = append(zs, z)
+				vs = append(vs, val)
+			}
+		}
+		return interpolate(zs, vs, base, zoom, def)
+	case []interface{}:
+		if len(t) < 5 || t[0] != "interpolate" {
+			return def
+		}
+		base := 1.0
+		if kind, ok := t[1].([]interface{}); ok && len(kind) == 2 && kind[0] == "exponential" {
+			if b, ok := kind[1].(float64); ok {
+				base = b
+			}
+		}
+		var zs, vs []float64
+		for i := 3; i+1 < len(t); i += 2 {
+			z, ok1 := t[i].(float64)
+			val, ok2 := t[i+1].(float64)
+			if ok1 && ok2 {
+				zs = append(zs, z)
+				vs = append(vs, val)
+			}
+		}
+		return interpolate(zs, vs, base, zoom, def)
+	}
+	return def
+}
+
+func interpolate(zs, vs []float64, base, zoom, def float64) float64 {
+	if len(zs) == 0 {
+		return def
+	}
+	if zoom <= zs[0] {
+		return vs[0]
+	}
+	for i := 1; i < len(zs); i++ {
+		if zoom <= zs[i] {
+			span := zs[i] - zs[i-1]
+			var t float64
+			if base == 1 {
+				t = (zoom - zs[i-1]) / span
+			} else {
+				t = (math.Pow(base, zoom-zs[i-1]) - 1) / (math.Pow(base, span) - 1)
+			}
+			return vs[i-1] + t*(vs[i]-vs[i-1])
+		}
+	}
+	return vs[len(vs)-1]
+}
+
+// matchFilter evaluates legacy filters (["==", "class", "park"]) and the
+// simple expression forms (["==", ["get", "class"], "park"]). Unsupported
+// filters match everything.
+func matchFilter(f interface{}, feat *feature) bool {
+	expr, ok := f.([]interface{})
+	if !ok || len(expr) == 0 {
+		return true
+	}
+	op, _ := expr[0].(string)
+
+	switch op {
+	case "all", "any", "none":
+		for _, sub := range expr[1:] {
+			m := matchFilter(sub, feat)
+			switch {
+			case op == "all" && !m:
+				return false
+			case op == "any" && m:
+				return true
+			case op == "none" && m:
+				return false
+			}
+		}
+		return op != "any"
+	case "!":
+		if len(expr) == 2 {
+			return !matchFilter(expr[1], feat)
+		}
+	case "has", "!has":
+		if len(expr) == 2 {
+			_, has := featureValue(expr[1], feat)
+			return has == (op == "has")
+		}
+	case "in", "!in":
+		if len(expr) >= 2 {
+			v, _ := featureValue(expr[1], feat)
+			candidates := expr[2:]
+			// Expression form: ["in", ["get", "k"], ["literal", [...]]]
+			if len(candidates) == 1 {
+				if lit, ok := candidates[0].([]interface{}); ok && len(lit) == 2 && lit[0] == "literal" {
+					candidates, _ = lit[1].([]interface{})
+				}
+			}
+			found := false
+			for _, c := range candidates {
+				if equalValues(v, c) {
+					found = true
+					break
+				}
+			}
+			return found == (op == "in")
+		}
+	case "==", "!=", "<", "<=", ">", ">=":
+		if len(expr) == 3 {
+			v, _ := featureValue(expr[1], feat)
+			return compare(op, v, expr[2])
+		}
+	}
+	return true
+}
+
+// featureValue resolves a filter operand: a property name, "$type", or a
+// ["get", name] / ["geometry-type"] expression
+func featureValue(key interface{}, feat *feature) (interface{}, bool) {
+	name, ok := key.(string)
+	if e, isExpr := key.([]interface{}); isExpr && len(e) > 0 {
+		switch e[0] {
+		case "get":
+			if len(e) == 2 {
+				name, ok = e[1].(string)
+			}
+		case "geometry-type":
+			name, ok = "$type", true
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	if name == "$type" {
+		switch feat.Type {
+		case geomPoint:
+			return "Point", true
+		case geomLineString:
+			return "LineString", true
+		case geomPolygon:
+			return "Polygon", true
+		}
+		return nil, false
+	}
+	v, ok := feat.Props[name]
+	return v, ok
+}
+
+func equalValues(a, b interface{}) bool {
+	if af, ok := a.(float64); ok {
+		bf, ok := b.(float64)
+		return ok && af == bf
+	}
+	return a == b
+}
+
+func compare(op string, a, b interface{}) bool {
+	switch op {
+	case "==":
+		return equalValues(a, b)
+	case "!=":
+		return !equalValues(a, b)
+	}
+	af, ok1 := a.(float64)
+	bf, ok2 := b.(float64)
+	if !ok1 || !ok2 {
+		as, ok1 := a.(string)
+		bs, ok2 := b.(string)
+		if !ok1 || !ok2 {
+			return false
+		}
+		af, bf = float64(strings.Compare(as, bs)), 0
+	}
+	switch op {
+	case "<":
+		return af < bf
+	case "<=":
+		return af <= bf
+	case ">":
+		return af > bf
+	case ">=":
+		return af >= bf
+	}
+	return false
+}
+
+// parseColor parses #rgb, #rrggbb, #rrggbbaa, rgb(), rgba(), hsl() and hsla()
+func parseColor(v interface{}) (color.NRGBA, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	s = strings.TrimSpace(strings.ToLower(s))
+
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) == 6 {
+			hex += "ff"
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 8 || err != nil {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBA{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+	}
+
+	open, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if open < 0 || end < open {
+		return color.NRGBA{}, false
+	}
+	fn := s[:open]
+	args := strings.Split(s[open+1:end], ",")
+	if len(args) < 3 {
+		return color.NRGBA{}, false
+	}
+	var nums [4]float64
+	nums[3] = 1
+	for i := 0; i < len(args) && i < 4; i++ {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(args[i]), "%"), 64)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		nums[i] = f
+	}
+	alpha := uint8(math.Round(clamp(nums[3], 0, 1) * 255))
+
+	switch fn {
+	case "rgb", "rgba":
+		return color.NRGBA{uint8(clamp(nums[0], 0, 255)), uint8(clamp(nums[1], 0, 255)), uint8(clamp(nums[2], 0, 255)), alpha}, true
+	case "hsl", "hsla":
+		r, g, b := hslToRGB(nums[0], nums[1]/100, nums[2]/100)
+		return color.NRGBA{r, g, b, alpha}, true
+	}
+	return color.NRGBA{}, false
+}
+
+func hslToRGB(h, s, l float64) (uint8, uint8, uint8) {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 360
+	hue := func(p, q, t float64) float64 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 0.5:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+	if s == 0 {
+		v := uint8(math.Round(l * 255))
+		return v, v, v
+	}
+	q := l * (1 + s)
+	if l >= 0.5 {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	return uint8(math.Round(hue(p, q, h+1.0/3) * 255)),
+		uint8(math.Round(hue(p, q, h) * 255)),
+		uint8(math.Round(hue(p, q, h-1.0/3) * 255))
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// namedColors are accepted for marker and path colors in query strings
+var namedColors = map[string]string{
+	"red":    "#e53935",
+	"blue":   "#1e88e5",
+	"green":  "#43a047",
+	"orange": "#fb8c00",
+	"purple": "#8e24aa",
+	"black":  "#212121",
+	"white":  "#ffffff",
+	"gray":   "#757575",
+}
+
+// ParseColorParam parses a query string color: a name, hex with or without
+// "#", or 0xRRGGBB
+func ParseColorParam(s string) (color.NRGBA, error) {
+	if hex, ok := namedColors[strings.ToLower(s)]; ok {
+		s = hex
+	}
+	s = strings.TrimPrefix(s, "0x")
+	if !strings.HasPrefix(s, "#") && !strings.Contains(s, "(") {
+		s = "#" + s
+	}
+	c, ok := parseColor(s)
+	if !ok {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return c, nil
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLocalPutBytes caps objects uploaded through presigned local URLs
+const maxLocalPutBytes = 512 << 20
+
+// Local stores objects as files under a directory. It serves them under
+// its URL prefix and accepts presigned uploads there, signed with HMAC.
+type Local struct {
+	dir    string
+	prefix string // URL path objects are served under, with slashes
+	secret []byte
+	files  http.Handler
+}
+
+// NewLocal creates a local store in dir, served under prefix
+func NewLocal(dir, prefix string, secret []byte) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{
+		dir:    dir,
+		prefix: prefix,
+		secret: secret,
+		files:  http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.FileServer(publicFS{http.Dir(dir)})),
+	}, nil
+}
+
+// publicFS is what a local store serves: stored objects only, without
+// directory listings, raw uploads under IncomingPrefix or the temporary
+// files of Put
+type publicFS struct {
+	fs http.FileSystem
+}
+
+func (p publicFS) Open(name string) (http.File, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if strings.HasPrefix(clean+"/", IncomingPrefix) || strings.HasPrefix(path.Base(clean), ".") {
+		return nil, fs.ErrNotExist
+	}
+	f, err := p.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if st.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	k, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(k)), nil
+}
+
+// Put writes the object to a temporary file and renames it into place, so
+// readers never see a partial object
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Exists(ctx context.Context, key string) (bool, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.prefix + key
+}
+
+// PresignPut returns a PUT URL on the API itself, see ServeHTTP
+func (l *Local) PresignPut(key, contentType string, expires time.Duration) (*Presigned, error) {
+	if _, err := cleanKey(key); err != nil {
+		return nil, err
+	}
+	exp := time.Now().Add(expires).Truncate(time.Second)
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(exp.Unix(), 10))
+	q.Set("signature", l.sign(key, exp.Unix()))
+	return &Presigned{
+		URL:       l.URL(key) + "?" + q.Encode(),
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: exp,
+	}, nil
+}
+
+func (l *Local) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte("PUT\n" + key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves objects under the URL prefix and stores presigned PUTs
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		l.files.ServeHTTP(w, r)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, l.prefix)
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	sig, _ := hex.DecodeString(r.URL.Query().Get("signature"))
+	want, _ := hex.DecodeString(l.sign(key, expires))
+	if err != nil || !hmac.Equal(sig, want) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "upload URL expired", http.StatusForbidden)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxLocalPutBytes)
+	if err := l.Put(r.Context(), key, body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+		http.Error(w, "failed to store object", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
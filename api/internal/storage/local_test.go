@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalServesObjectsOnly(t *testing.T) {
+	l, err := NewLocal(t.TempDir(), "/uploads/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"images/ab/cd.jpg", IncomingPrefix + "user-1/raw"} {
+		if err := l.Put(context.Background(), key, strings.NewReader("data"), 4, "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/uploads/images/ab/cd.jpg", http.StatusOK},
+		{"/uploads/", http.StatusNotFound},
+		{"/uploads/images/", http.StatusNotFound},
+		{"/uploads/images/ab", http.StatusNotFound},
+		{"/uploads/incoming/", http.StatusNotFound},
+		{"/uploads/incoming/user-1/", http.StatusNotFound},
+		{"/uploads/incoming/user-1/raw", http.StatusNotFound},
+		{"/uploads/images/../incoming/user-1/raw", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("GET %s = %d, want %d", tc.path, w.Code, tc.want)
+		}
+		if tc.want != http.StatusOK && strings.Contains(w.Body.String(), "cd.jpg") {
+			t.Errorf("GET %s lists the directory", tc.path)
+		}
+	}
+}
+
+func TestLocalPresignedPutIntoIncoming(t *testing.T) {
+	l, err := NewLocal(t.TempDir(), "/uploads/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := IncomingPrefix + "user-1/raw"
+	p, err := l.PresignPut(key, "image/jpeg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest(http.MethodPut, p.URL, strings.NewReader("data")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d: %s", w.Code, w.Body.String())
+	}
+	if ok, _ := l.Exists(context.Background(), key); !ok {
+		t.Fatal("presigned upload was not stored")
+	}
+
+	w = httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, l.URL(key), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET of a raw upload = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// unsignedPayload lets object bodies stream without hashing them first
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	// maxPresignExpiry is the longest validity SigV4 allows
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// S3Options configures an S3-compatible bucket
+type S3Options struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicURL is where objects are downloaded from, like a CDN in front
+	// of the bucket. Defaults to the bucket URL; objects must be readable
+	// there.
+	PublicURL string
+	// PathStyle addresses the bucket as endpoint/bucket instead of
+	// bucket.endpoint; MinIO needs it
+	PathStyle bool
+}
+
+// S3 stores objects in an S3-compatible bucket, signing requests with AWS
+// Signature Version 4
+type S3 struct {
+	opts   S3Options
+	base   *url.URL // bucket URL
+	client *http.Client
+}
+
+// NewS3 creates an S3 store
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" || opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, fmt.Errorf("s3 storage needs an endpoint, bucket and credentials")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	base, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", opts.Endpoint)
+	}
+	if opts.PathStyle {
+		base.Path += "/" + opts.Bucket
+	} else {
+		base.Host = opts.Bucket + "." + base.Host
+	}
+	if opts.PublicURL == "" {
+		opts.PublicURL = base.String()
+	}
+	opts.PublicURL = strings.TrimSuffix(opts.PublicURL, "/")
+	return &S3{opts: opts, base: base, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+// objectURL returns the URL of a key, with each path segment escaped the
+// way SigV4 canonicalizes it
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	k, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u := *s.base
+	u.Path += "/" + k
+	u.RawPath = escapePath(u.Path)
+	return &u, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, r, size, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, "")
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	return s.opts.PublicURL + "/" + escapePath(key)
+}
+
+// PresignPut returns a query-signed PUT URL. Content-Type is part of the
+// signature, so the client must send exactly the returned header.
+func (s *S3) PresignPut(key, contentType string, expires time.Duration) (*Presigned, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	if expires > maxPresignExpiry {
+		expires = maxPresignExpiry
+	}
+
+	now := time.Now().UTC()
+	headers := http.Header{}
+	headers.Set("Host", u.Host)
+	if contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+	signed := signedHeaderNames(headers)
+
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.opts.AccessKey+"/"+s.scope(now))
+	q.Set("X-Amz-Date", now.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", strings.Join(signed, ";"))
+	u.RawQuery = canonicalQuery(q)
+
+	sig := s.signature(now, http.MethodPut, u, headers, signed, unsignedPayload)
+	u.RawQuery += "&X-Amz-Signature=" + sig
+
+	p := &Presigned{
+		URL:       u.String(),
+		Method:    http.MethodPut,
+		Headers:   map[string]string{},
+		ExpiresAt: now.Add(expires),
+	}
+	if contentType != "" {
+		p.Headers["Content-Type"] = contentType
+	}
+	return p, nil
+}
+
+// do sends a header-signed request for an object. Non-2xx responses become
+// errors, 404 becomes ErrNotFound.
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signRequest(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// signRequest adds the SigV4 Authorization header
+func (s *S3) signRequest(req *http.Request, now time.Time) {
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	signed := signedHeaderNames(req.Header)
+	sig := s.signature(now, req.Method, req.URL, req.Header, signed, unsignedPayload)
+	req.Header.Del("Host") // net/http sends req.Host
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKey, s.scope(now), strings.Join(signed, ";"), sig))
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.opts.Region + "/s3/aws4_request"
+}
+
+// signature computes the SigV4 signature of a request
+func (s *S3) signature(now time.Time, method string, u *url.URL, headers http.Header, signed []string, payloadHash string) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers.Get(name)) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(u.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signedHeaderNames returns the lowercase names of the headers to sign
+func signedHeaderNames(h http.Header) []string {
+	var names []string
+	for name := range h {
+		n := strings.ToLower(name)
+		if n == "host" || n == "content-type" || strings.HasPrefix(n, "x-amz-") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canonicalQuery sorts and escapes query parameters per SigV4
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string{}, q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEscape(k)+"="+uriEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath escapes every segment of a slash-separated path
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = uriEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// uriEscape escapes everything but the RFC 3986 unreserved characters
+func uriEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+// Package storage stores uploaded objects on the local filesystem or in an
+// S3-compatible bucket (AWS S3, MinIO...). Both backends can hand out
+// presigned URLs so clients upload directly, without going through the API.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"maps/api/internal/config"
+)
+
+// ErrNotFound is returned for missing objects
+var ErrNotFound = errors.New("object not found")
+
+// IncomingPrefix holds raw direct uploads until they are processed. They
+// still carry their original metadata, so they are never served.
+const IncomingPrefix = "incoming/"
+
+// Storage is an object store addressed by slash-separated keys
+type Storage interface {
+	// Put stores an object, replacing any existing one. size may be -1
+	// when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open reads an object
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists reports whether an object is stored
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// URL returns where clients download an object. It is relative to the
+	// API for the local backend.
+	URL(key string) string
+	// PresignPut returns a URL the client can upload one object to until
+	// it expires
+	PresignPut(key, contentType string, expires time.Duration) (*Presigned, error)
+}
+
+// Presigned is a direct-upload URL. The client sends the object as the
+// body of Method to URL with Headers set.
+type Presigned struct {
+	URL       string            `json:"upload_url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// New creates the storage backend selected by cfg.Storage.Backend
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "", "local":
+		return NewLocal(cfg.UploadsDir, "/uploads/", []byte(cfg.JWTSecret))
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  cfg.Storage.S3Endpoint,
+			Region:    cfg.Storage.S3Region,
+			Bucket:    cfg.Storage.S3Bucket,
+			AccessKey: cfg.Storage.S3AccessKey,
+			SecretKey: cfg.Storage.S3SecretKey,
+			PublicURL: cfg.Storage.S3PublicURL,
+			PathStyle: cfg.Storage.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// cleanKey rejects keys that are empty or escape the store
+func cleanKey(key string) (string, error) {
+	k := path.Clean("/" + key)[1:]
+	if k == "" || k != key || strings.HasPrefix(k, ".") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return k, nil
+}
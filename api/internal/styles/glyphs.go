@@ -0,0 +1,150 @@
+package styles
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// Glyph PBFs follow the MapLibre/Mapbox glyphs.proto:
+//
+//	message glyphs    { repeated fontstack stacks = 1; }
+//	message fontstack { required string name = 1; required string range = 2; repeated glyph glyphs = 3; }
+//	message glyph     { required uint32 id = 1; ... }
+//
+// Only the fields needed to merge stacks are decoded; glyph messages are
+// copied through as raw bytes.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed glyph pbf")
+
+// pbField is one decoded protobuf field
+type pbField struct {
+	num   uint64
+	wire  uint64
+	value uint64 // varint value
+	data  []byte // length-delimited payload
+}
+
+// readFields decodes the top level fields of a protobuf message
+func readFields(b []byte) ([]pbField, error) {
+	var fields []pbField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errMalformed
+		}
+		b = b[n:]
+
+		f := pbField{num: key >> 3, wire: key & 7}
+		switch f.wire {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errMalformed
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errMalformed
+			}
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errMalformed
+			}
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errMalformed
+			}
+			b = b[4:]
+		default:
+			return nil, errMalformed
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// parseGlyphs returns the raw glyph messages of a glyph PBF keyed by codepoint
+func parseGlyphs(pbf []byte) (map[uint64][]byte, error) {
+	glyphs := make(map[uint64][]byte)
+
+	top, err := readFields(pbf)
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range top {
+		if stack.num != 1 || stack.wire != wireBytes {
+			continue
+		}
+		fields, err := readFields(stack.data)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range fields {
+			if g.num != 3 || g.wire != wireBytes {
+				continue
+			}
+			gf, err := readFields(g.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range gf {
+				if f.num == 1 && f.wire == wireVarint {
+					if _, dup := glyphs[f.value]; !dup {
+						glyphs[f.value] = g.data
+					}
+					break
+				}
+			}
+		}
+	}
+	return glyphs, nil
+}
+
+// composeGlyphs merges glyph PBFs in priority order: each codepoint comes
+// from the first font that has it
+func composeGlyphs(name, rng string, fonts [][]byte) ([]byte, error) {
+	merged := make(map[uint64][]byte)
+	for _, pbf := range fonts {
+		glyphs, err := parseGlyphs(pbf)
+		if err != nil {
+			return nil, err
+		}
+		for id, g := range glyphs {
+			if _, ok := merged[id]; !ok {
+				merged[id] = g
+			}
+		}
+	}
+
+	ids := make([]uint64, 0, len(merged))
+	for id := range merged {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var stack []byte
+	stack = appendBytesField(stack, 1, []byte(name))
+	stack = appendBytesField(stack, 2, []byte(rng))
+	for _, id := range ids {
+		stack = appendBytesField(stack, 3, merged[id])
+	}
+	return appendBytesField(nil, 1, stack), nil
+}
+
+func appendBytesField(b []byte, num uint64, data []byte) []byte {
+	b = binary.AppendUvarint(b, num<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,277 @@
+// Package styles serves the map style documents, sprites and glyph PBFs the
+// web and mobile clients need, so a complete style loads from one origin.
+package styles
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown styles, sprites and fonts
+var ErrNotFound = errors.New("not found")
+
+var (
+	nameRegex   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	spriteRegex = regexp.MustCompile(`^([A-Za-z0-9_-]+)(@2x)?\.(json|png)$`)
+	rangeRegex  = regexp.MustCompile(`^(\d+)-(\d+)$`)
+)
+
+// versionTTL is how long a computed directory version is reused
+const versionTTL = time.Minute
+
+// glyphCacheSize bounds the number of composed glyph ranges kept in memory
+const glyphCacheSize = 512
+
+// Assets reads styles (<name>.json), sprites (<name>[@2x].json/.png) and
+// fonts (<fontstack>/<start>-<end>.pbf) from their directories
+type Assets struct {
+	StylesDir    string
+	SpritesDir   string
+	FontsDir     string
+	FallbackFont string // appended to every fontstack when present
+
+	mu       sync.Mutex
+	versions map[string]dirVersion
+	glyphs   map[string][]byte
+}
+
+type dirVersion struct {
+	version string
+	at      time.Time
+}
+
+// NewAssets creates an asset reader
+func NewAssets(stylesDir, spritesDir, fontsDir, fallbackFont string) *Assets {
+	return &Assets{
+		StylesDir:    stylesDir,
+		SpritesDir:   spritesDir,
+		FontsDir:     fontsDir,
+		FallbackFont: fallbackFont,
+		versions:     make(map[string]dirVersion),
+		glyphs:       make(map[string][]byte),
+	}
+}
+
+// Style loads a style and points its API URLs (tiles, TileJSON, glyphs,
+// sprite) at baseURL, adding asset versions so clients can cache them
+func (a *Assets) Style(name, baseURL string) ([]byte, error) {
+	if !nameRegex.MatchString(name) {
+		return nil, ErrNotFound
+	}
+	raw, err := os.ReadFile(filepath.Join(a.StylesDir, name+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var style map[string]interface{}
+	if err := json.Unmarshal(raw, &style); err != nil {
+		return nil, fmt.Errorf("style %s: %w", name, err)
+	}
+
+	if sources, ok := style["sources"].(map[string]interface{}); ok {
+		for _, s := range sources {
+			src, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if u, ok := src["url"].(string); ok {
+				src["url"] = rebase(u, baseURL)
+			}
+			if list, ok := src["tiles"].([]interface{}); ok {
+				for i, t := range list {
+					if u, ok := t.(string); ok {
+						list[i] = rebase(u, baseURL)
+					}
+				}
+			}
+		}
+	}
+
+	if v := a.fontsVersion(); v != "" {
+		style["glyphs"] = baseURL + "/api/fonts/{fontstack}/{range}.pbf?v=" + v
+	} else if u, ok := style["glyphs"].(string); ok {
+		style["glyphs"] = rebase(u, baseURL)
+	}
+
+	if v := a.SpriteVersion(name); v != "" {
+		style["sprite"] = baseURL + "/api/sprites/" + name + "?v=" + v
+	} else if u, ok := style["sprite"].(string); ok {
+		style["sprite"] = rebase(u, baseURL)
+	}
+
+	return json.Marshal(style)
+}
+
+// StyleNames lists the available styles
+func (a *Assets) StyleNames() []string {
+	paths, _ := filepath.Glob(filepath.Join(a.StylesDir, "*.json"))
+	var names []string
+	for _, p := range paths {
+		if name := strings.TrimSuffix(filepath.Base(p), ".json"); nameRegex.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rebase moves /api/ URLs onto baseURL, leaving third-party URLs alone.
+// Placeholders such as {z} are kept unescaped.
+func rebase(raw, baseURL string) string {
+	path := raw
+	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return raw
+		}
+		path = strings.TrimPrefix(raw, u.Scheme+"://"+u.Host)
+	}
+	if !strings.HasPrefix(path, "/api/") {
+		return raw
+	}
+	return baseURL + path
+}
+
+// SpritePath returns the file for a sprite request like "didi@2x.png"
+func (a *Assets) SpritePath(file string) (string, error) {
+	if !spriteRegex.MatchString(file) {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(a.SpritesDir, file)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// SpriteVersion returns a version for a sprite sheet, or "" if it doesn't exist
+func (a *Assets) SpriteVersion(name string) string {
+	if !nameRegex.MatchString(name) {
+		return ""
+	}
+	return a.version("sprite:"+name, func() []string {
+		paths, _ := filepath.Glob(filepath.Join(a.SpritesDir, name+"*"))
+		var out []string
+		for _, p := range paths {
+			if m := spriteRegex.FindStringSubmatch(filepath.Base(p)); m != nil && m[1] == name {
+				out = append(out, p)
+			}
+		}
+		return out
+	})
+}
+
+// Glyphs returns the glyph PBF for a comma separated fontstack and a range
+// like "0-255". Each codepoint comes from the first listed font that has it,
+// then from FallbackFont. Fonts that aren't installed are skipped.
+func (a *Assets) Glyphs(fontstack, rng string) ([]byte, error) {
+	m := rangeRegex.FindStringSubmatch(rng)
+	if m == nil {
+		return nil, ErrNotFound
+	}
+	start, _ := strconv.Atoi(m[1])
+	end, _ := strconv.Atoi(m[2])
+	if start%256 != 0 || end != start+255 || end > 65535 {
+		return nil, ErrNotFound
+	}
+
+	key := a.fontsVersion() + "/" + fontstack + "/" + rng
+	a.mu.Lock()
+	if pbf, ok := a.glyphs[key]; ok {
+		a.mu.Unlock()
+		return pbf, nil
+	}
+	a.mu.Unlock()
+
+	fonts := strings.Split(fontstack, ",")
+	if a.FallbackFont != "" {
+		fonts = append(fonts, a.FallbackFont)
+	}
+
+	var data [][]byte
+	seen := make(map[string]bool)
+	for _, font := range fonts {
+		font = strings.TrimSpace(font)
+		if font == "" || seen[font] || strings.ContainsAny(font, `/\`) || strings.HasPrefix(font, ".") {
+			continue
+		}
+		seen[font] = true
+
+		pbf, err := os.ReadFile(filepath.Join(a.FontsDir, font, rng+".pbf"))
+		if err != nil {
+			continue
+		}
+		data = append(data, pbf)
+	}
+	if len(data) == 0 {
+		return nil, ErrNotFound
+	}
+
+	pbf, err := composeGlyphs(fontstack, rng, data)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	if len(a.glyphs) >= glyphCacheSize {
+		a.glyphs = make(map[string][]byte)
+	}
+	a.glyphs[key] = pbf
+	a.mu.Unlock()
+	return pbf, nil
+}
+
+// fontsVersion returns a version for the installed fonts, or "" if none
+func (a *Assets) fontsVersion() string {
+	return a.version("fonts", func() []string {
+		paths, _ := filepath.Glob(filepath.Join(a.FontsDir, "*", "*.pbf"))
+		return paths
+	})
+}
+
+// version hashes the names, sizes and modification times of files,
+// caching the result for versionTTL
+func (a *Assets) version(key string, files func() []string) string {
+	a.mu.Lock()
+	if v, ok := a.versions[key]; ok && time.Since(v.at) < versionTTL {
+		a.mu.Unlock()
+		return v.version
+	}
+	a.mu.Unlock()
+
+	paths := files()
+	sort.Strings(paths)
+
+	var version string
+	if len(paths) > 0 {
+		h := sha1.New()
+		for _, p := range paths {
+			info, err := os.Stat(p)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(h, "%s:%d:%d\n", p, info.Size(), info.ModTime().UnixNano())
+		}
+		version = hex.EncodeToString(h.Sum(nil))[:12]
+	}
+
+	a.mu.Lock()
+	a.versions[key] = dirVersion{version: version, at: time.Now()}
+	a.mu.Unlock()
+	return version
+}
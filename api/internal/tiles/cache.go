@@ -0,0 +1,282 @@
+package tiles
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// diskTrimRatio is how full the disk cache is left after trimming, so a
+// trim isn't needed again after the next few writes
+const diskTrimRatio = 0.9
+
+// Cache keeps recently served tiles in an in-memory LRU, optionally backed by
+// a disk cache. Keys include the tileset version so a rebuilt tileset never
+// serves stale tiles; PurgeTileset reclaims the old version's space. The
+// disk cache is trimmed to maxDiskBytes by removing the least recently
+// used files, going by their modification time.
+type Cache struct {
+	maxBytes     int64
+	dir          string // disk cache root, "" to disable
+	maxDiskBytes int64
+	diskBytes    atomic.Int64 // approximate, corrected by each trim
+	trim         chan struct{}
+
+	mu    sync.Mutex
+	bytes int64
+	lru   *list.List               // front = most recently used
+	items map[string]*list.Element // key -> *cacheItem
+}
+
+type cacheItem struct {
+	key     string
+	tileset string
+	version string
+	tile    *Tile
+}
+
+// NewCache creates a cache holding up to maxBytes of tile data in memory.
+// If dir is not empty, up to maxDiskBytes of tiles are also written below
+// it.
+func NewCache(maxBytes int64, dir string, maxDiskBytes int64) *Cache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Tile disk cache disabled: %v", err)
+			dir = ""
+		}
+	}
+	c := &Cache{
+		maxBytes:     maxBytes,
+		dir:          dir,
+		maxDiskBytes: maxDiskBytes,
+		trim:         make(chan struct{}, 1),
+		lru:          list.New(),
+		items:        make(map[string]*list.Element),
+	}
+	if dir != "" {
+		go c.runTrim()
+		c.trim <- struct{}{} // count what is already on disk
+	}
+	return c
+}
+
+// Tile is an encoded tile as stored, possibly gzip compressed
+type Tile struct {
+	Data []byte
+	ETag string // quoted, content hash; empty for missing tiles
+}
+
+// NewTile wraps tile data with its content-hash ETag
+func NewTile(data []byte) *Tile {
+	t := &Tile{Data: data}
+	if len(data) > 0 {
+		sum := sha1.Sum(data)
+		t.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	return t
+}
+
+func cacheKey(tileset, version string, z, x, y int) string {
+	return fmt.Sprintf("%s/%s/%d/%d/%d", tileset, version, z, x, y)
+}
+
+// Get returns a cached tile, checking memory then disk
+func (c *Cache) Get(tileset, version string, z, x, y int) (*Tile, bool) {
+	key := cacheKey(tileset, version, z, x, y)
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.lru.MoveToFront(el)
+		t := el.Value.(*cacheItem).tile
+		c.mu.Unlock()
+		return t, true
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil, false
+	}
+	path := filepath.Join(c.dir, filepath.FromSlash(key))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	// Trimming goes by modification time
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	t := NewTile(data)
+	c.addMemory(key, tileset, version, t)
+	return t, true
+}
+
+// Put stores a tile. Missing tiles (empty Data) are cached too.
+func (c *Cache) Put(tileset, version string, z, x, y int, t *Tile) {
+	key := cacheKey(tileset, version, z, x, y)
+	c.addMemory(key, tileset, version, t)
+
+	if c.dir == "" {
+		return
+	}
+	path := filepath.Join(c.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Tile disk cache write failed: %v", err)
+		return
+	}
+	// A unique temp file per write, so concurrent writes of a tile never
+	// publish each other's partial data
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		log.Printf("Tile disk cache write failed: %v", err)
+		return
+	}
+	_, err = f.Write(t.Data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		log.Printf("Tile disk cache write failed: %v", err)
+		return
+	}
+
+	if c.diskBytes.Add(int64(len(t.Data))) > c.maxDiskBytes {
+		select {
+		case c.trim <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Cache) runTrim() {
+	for range c.trim {
+		if err := c.trimDisk(); err != nil {
+			log.Printf("Failed to trim tile disk cache: %v", err)
+		}
+	}
+}
+
+// trimDisk removes the least recently used files until the disk cache is
+// below diskTrimRatio of maxDiskBytes, and recounts its size
+func (c *Cache) trimDisk() error {
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	var total int64
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Purged while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cachedFile{path, fi.Size(), fi.ModTime()})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if total > c.maxDiskBytes {
+		sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+		target := int64(float64(c.maxDiskBytes) * diskTrimRatio)
+		removed := 0
+		for _, f := range files {
+			if total <= target {
+				break
+			}
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				continue
+			}
+			total -= f.size
+			removed++
+		}
+		log.Printf("Trimmed tile disk cache: removed %d files, %d MB left", removed, total>>20)
+	}
+	c.diskBytes.Store(total)
+	return nil
+}
+
+func (c *Cache) addMemory(key, tileset, version string, t *Tile) {
+	size := int64(len(t.Data) + len(key))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheItem{key: key, tileset: tileset, version: version, tile: t})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	item := el.Value.(*cacheItem)
+	c.lru.Remove(el)
+	delete(c.items, item.key)
+	c.bytes -= int64(len(item.tile.Data) + len(item.key))
+}
+
+// PurgeTileset drops every cached tile of tileset whose version differs
+// from keep. Pass keep = "" to drop the tileset entirely.
+func (c *Cache) PurgeTileset(tileset, keep string) {
+	c.mu.Lock()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if item := el.Value.(*cacheItem); item.tileset == tileset && item.version != keep {
+			c.removeElement(el)
+		}
+		el = next
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return
+	}
+	versions, err := os.ReadDir(filepath.Join(c.dir, tileset))
+	if err != nil {
+		return
+	}
+	for _, v := range versions {
+		if v.Name() != keep && !strings.HasPrefix(v.Name(), ".") {
+			if err := os.RemoveAll(filepath.Join(c.dir, tileset, v.Name())); err != nil {
+				log.Printf("Failed to purge tile cache %s/%s: %v", tileset, v.Name(), err)
+			}
+		}
+	}
+}
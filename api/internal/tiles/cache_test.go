@@ -0,0 +1,72 @@
+package tiles
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheConcurrentDiskWrites(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(0, dir, 1<<30) // no memory cache, so Get reads the disk
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Put("addis", "v1", 14, 1, 2, NewTile(bytes.Repeat([]byte{byte(i)}, 64<<10)))
+		}(i)
+	}
+	wg.Wait()
+
+	tile, ok := c.Get("addis", "v1", 14, 1, 2)
+	if !ok {
+		t.Fatal("tile not cached on disk")
+	}
+	if len(tile.Data) != 64<<10 || !bytes.Equal(tile.Data, bytes.Repeat(tile.Data[:1], 64<<10)) {
+		t.Fatal("cached tile mixes concurrent writes")
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "addis", "v1", "14", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files left next to the tile, want only the tile", len(entries))
+	}
+}
+
+func TestCacheTrimsDisk(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(0, dir, 10<<10)
+
+	data := make([]byte, 1<<10)
+	old := time.Now().Add(-time.Hour)
+	for x := 0; x < 20; x++ {
+		c.Put("addis", "v1", 14, x, 0, NewTile(data))
+		// The first tiles were used longest ago
+		if x < 10 {
+			path := filepath.Join(dir, "addis", "v1", "14", strconv.Itoa(x), "0")
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := c.trimDisk(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.diskBytes.Load(); n > 10<<10 {
+		t.Errorf("disk cache holds %d bytes, want at most %d", n, 10<<10)
+	}
+	if _, ok := c.Get("addis", "v1", 14, 0, 0); ok {
+		t.Error("least recently used tile survived the trim")
+	}
+	if _, ok := c.Get("addis", "v1", 14, 19, 0); !ok {
+		t.Error("most recently used tile was trimmed")
+	}
+}
@@ -0,0 +1,182 @@
+package tiles
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Metadata describes a tileset, read from the MBTiles metadata table
+type Metadata struct {
+	Name         string
+	Description  string
+	Attribution  string
+	Format       string // pbf, png, jpg, webp
+	MinZoom      int
+	MaxZoom      int
+	Bounds       []float64       // minLng, minLat, maxLng, maxLat
+	Center       []float64       // lng, lat, zoom
+	VectorLayers json.RawMessage // from the "json" metadata row
+}
+
+// MBTiles is a read-only MBTiles (SQLite) tileset
+type MBTiles struct {
+	Path string
+
+	db      *sql.DB
+	info    os.FileInfo
+	meta    Metadata
+	modTime time.Time
+}
+
+// OpenMBTiles opens an .mbtiles file and reads its metadata
+func OpenMBTiles(path string) (*MBTiles, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MBTiles{Path: path, db: db, info: info, modTime: info.ModTime()}
+	if err := m.readMetadata(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *MBTiles) readMetadata() error {
+	rows, err := m.db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	meta := Metadata{MinZoom: 0, MaxZoom: 14}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		switch name {
+		case "name":
+			meta.Name = value
+		case "description":
+			meta.Description = value
+		case "attribution":
+			meta.Attribution = value
+		case "format":
+			meta.Format = strings.ToLower(value)
+		case "minzoom":
+			meta.MinZoom, _ = strconv.Atoi(value)
+		case "maxzoom":
+			meta.MaxZoom, _ = strconv.Atoi(value)
+		case "bounds":
+			meta.Bounds = parseFloats(value)
+		case "center":
+			meta.Center = parseFloats(value)
+		case "json":
+			var doc struct {
+				VectorLayers json.RawMessage `json:"vector_layers"`
+			}
+			if json.Unmarshal([]byte(value), &doc) == nil {
+				meta.VectorLayers = doc.VectorLayers
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if meta.Format == "" {
+		meta.Format = "pbf"
+	}
+	m.meta = meta
+	return nil
+}
+
+// Tile returns the raw tile data at z/x/y (XYZ scheme) or nil if missing.
+// Vector tiles are usually gzip compressed; see IsGzipped.
+func (m *MBTiles) Tile(ctx context.Context, z, x, y int) ([]byte, error) {
+	// MBTiles stores rows in TMS order
+	row := (1 << uint(z)) - 1 - y
+
+	var data []byte
+	err := m.db.QueryRowContext(ctx,
+		"SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		z, x, row).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Metadata returns the tileset description
+func (m *MBTiles) Metadata() Metadata { return m.meta }
+
+// ModTime returns when the file was written
+func (m *MBTiles) ModTime() time.Time { return m.modTime }
+
+// Close releases the underlying database
+func (m *MBTiles) Close() error {
+	return m.db.Close()
+}
+
+func (m *MBTiles) source() string { return m.Path }
+
+func (m *MBTiles) changed() bool {
+	return fileChanged(m.Path, m.info)
+}
+
+// fileChanged reports whether the file at path is no longer the one opened,
+// e.g. after update-osm.sh moved a freshly built tileset into place
+func fileChanged(path string, opened os.FileInfo) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(info, opened) || !info.ModTime().Equal(opened.ModTime()) || info.Size() != opened.Size()
+}
+
+// IsGzipped reports whether data starts with the gzip magic number
+func IsGzipped(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0x1f, 0x8b})
+}
+
+// ContentType returns the MIME type for a tile format
+func ContentType(format string) string {
+	switch format {
+	case "png":
+		return "image/png"
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "webp":
+		return "image/webp"
+	default:
+		return "application/x-protobuf"
+	}
+}
+
+func parseFloats(s string) []float64 {
+	var out []float64
+	for _, part := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,371 @@
+package tiles
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PMTiles v3 constants, see https://github.com/protomaps/PMTiles/blob/main/spec/v3/spec.md
+const (
+	pmHeaderLen      = 127
+	pmMaxDepth       = 3 // root + leaf levels we follow before giving up
+	pmLeafCacheLimit = 64
+
+	pmCompressionUnknown = 0
+	pmCompressionNone    = 1
+	pmCompressionGzip    = 2
+)
+
+var pmTileTypes = map[byte]string{1: "pbf", 2: "png", 3: "jpg", 4: "webp", 5: "avif"}
+
+// pmHeader is the fixed-size PMTiles v3 header
+type pmHeader struct {
+	rootOffset, rootLength         uint64
+	metadataOffset, metadataLength uint64
+	leafOffset, leafLength         uint64
+	dataOffset, dataLength         uint64
+	internalCompression            byte
+	tileCompression                byte
+	tileType                       byte
+	minZoom, maxZoom               byte
+	minLon, minLat, maxLon, maxLat int32 // e7
+	centerZoom                     byte
+	centerLon, centerLat           int32 // e7
+}
+
+// pmEntry is a directory entry. RunLength 0 points at a leaf directory.
+type pmEntry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint32
+	RunLength uint32
+}
+
+// PMTiles is a read-only PMTiles v3 archive
+type PMTiles struct {
+	Path string
+
+	file    *os.File
+	info    os.FileInfo
+	header  pmHeader
+	meta    Metadata
+	root    []pmEntry
+	leafMu  sync.Mutex
+	leaves  map[uint64][]pmEntry // by leaf offset
+	modTime time.Time
+}
+
+// OpenPMTiles opens a .pmtiles archive, reading its header, root directory
+// and metadata
+func OpenPMTiles(path string) (*PMTiles, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	p := &PMTiles{Path: path, file: f, info: info, modTime: info.ModTime(), leaves: make(map[uint64][]pmEntry)}
+	if err := p.init(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p *PMTiles) init() error {
+	buf := make([]byte, pmHeaderLen)
+	if _, err := p.file.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	h, err := parsePMHeader(buf)
+	if err != nil {
+		return err
+	}
+	p.header = h
+
+	// Tiles are passed to clients as stored, so only encodings every
+	// client understands are accepted
+	if h.tileCompression != pmCompressionNone && h.tileCompression != pmCompressionGzip &&
+		h.tileCompression != pmCompressionUnknown {
+		return fmt.Errorf("unsupported tile compression %d", h.tileCompression)
+	}
+
+	if p.root, err = p.readDirectory(h.rootOffset, h.rootLength); err != nil {
+		return fmt.Errorf("root directory: %w", err)
+	}
+
+	meta := Metadata{
+		Format:  pmTileTypes[h.tileType],
+		MinZoom: int(h.minZoom),
+		MaxZoom: int(h.maxZoom),
+		Bounds: []float64{
+			float64(h.minLon) / 1e7, float64(h.minLat) / 1e7,
+			float64(h.maxLon) / 1e7, float64(h.maxLat) / 1e7,
+		},
+		Center: []float64{float64(h.centerLon) / 1e7, float64(h.centerLat) / 1e7, float64(h.centerZoom)},
+	}
+	if meta.Format == "" {
+		meta.Format = "pbf"
+	}
+
+	if h.metadataLength > 0 {
+		raw, err := p.readSection(h.metadataOffset, h.metadataLength, h.internalCompression)
+		if err != nil {
+			return fmt.Errorf("metadata: %w", err)
+		}
+		var doc struct {
+			Name         string          `json:"name"`
+			Description  string          `json:"description"`
+			Attribution  string          `json:"attribution"`
+			VectorLayers json.RawMessage `json:"vector_layers"`
+		}
+		if json.Unmarshal(raw, &doc) == nil {
+			meta.Name = doc.Name
+			meta.Description = doc.Description
+			meta.Attribution = doc.Attribution
+			meta.VectorLayers = doc.VectorLayers
+		}
+	}
+	p.meta = meta
+	return nil
+}
+
+func parsePMHeader(b []byte) (pmHeader, error) {
+	var h pmHeader
+	if len(b) < pmHeaderLen || string(b[0:7]) != "PMTiles" {
+		return h, errors.New("not a PMTiles archive")
+	}
+	if b[7] != 3 {
+		return h, fmt.Errorf("unsupported PMTiles version %d", b[7])
+	}
+
+	le := binary.LittleEndian
+	h.rootOffset = le.Uint64(b[8:])
+	h.rootLength = le.Uint64(b[16:])
+	h.metadataOffset = le.Uint64(b[24:])
+	h.metadataLength = le.Uint64(b[32:])
+	h.leafOffset = le.Uint64(b[40:])
+	h.leafLength = le.Uint64(b[48:])
+	h.dataOffset = le.Uint64(b[56:])
+	h.dataLength = le.Uint64(b[64:])
+	// 72-95: addressed tile/entry/content counts, 96: clustered flag
+	h.internalCompression = b[97]
+	h.tileCompression = b[98]
+	h.tileType = b[99]
+	h.minZoom = b[100]
+	h.maxZoom = b[101]
+	h.minLon = int32(le.Uint32(b[102:]))
+	h.minLat = int32(le.Uint32(b[106:]))
+	h.maxLon = int32(le.Uint32(b[110:]))
+	h.maxLat = int32(le.Uint32(b[114:]))
+	h.centerZoom = b[118]
+	h.centerLon = int32(le.Uint32(b[119:]))
+	h.centerLat = int32(le.Uint32(b[123:]))
+	return h, nil
+}
+
+// readSection reads and decompresses a byte range of the archive
+func (p *PMTiles) readSection(offset, length uint64, compression byte) ([]byte, error) {
+	buf := make([]byte, length)
+	if _, err := p.file.ReadAt(buf, int64(offset)); err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case pmCompressionNone, pmCompressionUnknown:
+		return buf, nil
+	case pmCompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported internal compression %d", compression)
+	}
+}
+
+func (p *PMTiles) readDirectory(offset, length uint64) ([]pmEntry, error) {
+	raw, err := p.readSection(offset, length, p.header.internalCompression)
+	if err != nil {
+		return nil, err
+	}
+	return parseDirectory(raw)
+}
+
+// parseDirectory decodes a serialized directory: the entry count followed by
+// columns of delta-encoded tile IDs, run lengths, lengths and offsets, all
+// as uvarints. An offset of 0 means "directly after the previous entry".
+func parseDirectory(raw []byte) ([]pmEntry, error) {
+	r := bufio.NewReader(bytes.NewReader(raw))
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]pmEntry, n)
+
+	var lastID uint64
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		lastID += v
+		entries[i].TileID = lastID
+	}
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].RunLength = uint32(v)
+	}
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Length = uint32(v)
+	}
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if v == 0 && i > 0 {
+			entries[i].Offset = entries[i-1].Offset + uint64(entries[i-1].Length)
+		} else {
+			entries[i].Offset = v - 1
+		}
+	}
+	return entries, nil
+}
+
+// findEntry returns the entry covering id: the last entry with TileID <= id,
+// provided its run reaches id (leaf pointers always match)
+func findEntry(entries []pmEntry, id uint64) (pmEntry, bool) {
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].TileID > id }) - 1
+	if i < 0 {
+		return pmEntry{}, false
+	}
+	e := entries[i]
+	if e.RunLength == 0 || id < e.TileID+uint64(e.RunLength) {
+		return e, true
+	}
+	return pmEntry{}, false
+}
+
+// Tile returns the raw tile data at z/x/y or nil if missing
+func (p *PMTiles) Tile(ctx context.Context, z, x, y int) ([]byte, error) {
+	if z < int(p.header.minZoom) || z > int(p.header.maxZoom) {
+		return nil, nil
+	}
+	id := ZXYToTileID(uint8(z), uint32(x), uint32(y))
+
+	dir := p.root
+	for depth := 0; depth <= pmMaxDepth; depth++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		e, ok := findEntry(dir, id)
+		if !ok {
+			return nil, nil
+		}
+		if e.RunLength > 0 {
+			data := make([]byte, e.Length)
+			if _, err := p.file.ReadAt(data, int64(p.header.dataOffset+e.Offset)); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+
+		leaf, err := p.leaf(e.Offset, uint64(e.Length))
+		if err != nil {
+			return nil, err
+		}
+		dir = leaf
+	}
+	return nil, errors.New("pmtiles: directory too deep")
+}
+
+// leaf returns a leaf directory, caching recently used ones
+func (p *PMTiles) leaf(offset, length uint64) ([]pmEntry, error) {
+	p.leafMu.Lock()
+	entries, ok := p.leaves[offset]
+	p.leafMu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	entries, err := p.readDirectory(p.header.leafOffset+offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	p.leafMu.Lock()
+	if len(p.leaves) >= pmLeafCacheLimit {
+		p.leaves = make(map[uint64][]pmEntry)
+	}
+	p.leaves[offset] = entries
+	p.leafMu.Unlock()
+	return entries, nil
+}
+
+// Metadata returns the tileset description
+func (p *PMTiles) Metadata() Metadata { return p.meta }
+
+// ModTime returns when the archive was written
+func (p *PMTiles) ModTime() time.Time { return p.modTime }
+
+// Close releases the file
+func (p *PMTiles) Close() error {
+	return p.file.Close()
+}
+
+func (p *PMTiles) source() string { return p.Path }
+
+func (p *PMTiles) changed() bool {
+	return fileChanged(p.Path, p.info)
+}
+
+// ZXYToTileID converts tile coordinates to a PMTiles tile ID: the number
+// of tiles in all lower zooms plus the position along the Hilbert curve
+func ZXYToTileID(z uint8, x, y uint32) uint64 {
+	acc := (uint64(1)<<(2*uint64(z)) - 1) / 3
+	for s := uint32(1) << z >> 1; s > 0; s >>= 1 {
+		var rx, ry uint32
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		acc += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return acc
+}
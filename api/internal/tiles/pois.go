@@ -0,0 +1,217 @@
+// Package tiles serves map tiles: live POI tiles generated from PostGIS and
+// prebuilt tilesets.
+package tiles
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"maps/api/internal/db"
+)
+
+// POILayer is the MVT layer name for business POIs
+const POILayer = "pois"
+
+const (
+	// poiCacheSize bounds the number of cached POI tiles
+	poiCacheSize = 4096
+	// poiMaxZoom is the highest zoom tiles are served at
+	poiMaxZoom = 22
+	// poiBuffer is the tile buffer of render, as a share of the tile size
+	poiBuffer = 64.0 / 4096
+
+	// poiEvictDelay batches the business changes of a burst, such as an
+	// import, into one eviction
+	poiEvictDelay = time.Second
+	// poiEvictMax is how many changes are evicted one by one; a larger
+	// burst drops the whole cache
+	poiEvictMax = 1000
+)
+
+// poiZoomRule decides which businesses appear at a zoom level. Low zooms
+// only show well-rated, well-reviewed places so tiles stay small.
+type poiZoomRule struct {
+	minZoom    int
+	minRating  float64
+	minReviews int
+	limit      int // per tile
+}
+
+// poiZoomRules is ordered by descending minZoom
+var poiZoomRules = []poiZoomRule{
+	{minZoom: 15, limit: 2000},
+	{minZoom: 13, limit: 200},
+	{minZoom: 10, minRating: 4, minReviews: 5, limit: 50},
+}
+
+// POIMinZoom is the lowest zoom with any POIs
+var POIMinZoom = poiZoomRules[len(poiZoomRules)-1].minZoom
+
+// POISource generates business POI tiles with ST_AsMVT and caches them
+// until a business in them changes
+type POISource struct {
+	db *sql.DB
+
+	mu         sync.Mutex
+	cache      map[tileKey]*Tile
+	generation uint64
+
+	// Changes waiting for the next eviction
+	pending  []db.BusinessChange
+	evictAll bool
+	timer    *time.Timer
+}
+
+type tileKey struct {
+	z, x, y int
+}
+
+// NewPOISource creates a POI tile source
+func NewPOISource(conn *sql.DB) *POISource {
+	return &POISource{db: conn, cache: make(map[tileKey]*Tile)}
+}
+
+// Tile returns the POI tile at z/x/y. An empty tile has no Data.
+func (s *POISource) Tile(ctx context.Context, z, x, y int) (*Tile, error) {
+	key := tileKey{z, x, y}
+
+	s.mu.Lock()
+	if t, ok := s.cache[key]; ok {
+		s.mu.Unlock()
+		return t, nil
+	}
+	gen := s.generation
+	s.mu.Unlock()
+
+	data, err := s.render(ctx, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTile(data)
+
+	s.mu.Lock()
+	// Don't cache a tile rendered before the latest eviction
+	if gen == s.generation {
+		if len(s.cache) >= poiCacheSize {
+			s.cache = make(map[tileKey]*Tile)
+		}
+		s.cache[key] = t
+	}
+	s.mu.Unlock()
+
+	return t, nil
+}
+
+// HandleNotify evicts the cached tiles around a changed business, at its
+// old and new location. Registered on db.BusinessChangesChannel; changes
+// are batched for poiEvictDelay, and an empty payload drops every tile.
+func (s *POISource) HandleNotify(payload string) {
+	change, err := db.ParseBusinessChange(payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if payload == "" || err != nil || len(s.pending) >= poiEvictMax {
+		s.evictAll = true
+		s.pending = nil
+	} else if !s.evictAll {
+		s.pending = append(s.pending, change)
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(poiEvictDelay, s.evict)
+	}
+}
+
+func (s *POISource) evict() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	if s.evictAll {
+		s.cache = make(map[tileKey]*Tile)
+	} else {
+		for _, c := range s.pending {
+			for _, p := range []*[2]float64{c.Old, c.New} {
+				if p != nil {
+					s.evictPoint(p[0], p[1])
+				}
+			}
+		}
+	}
+	s.pending = nil
+	s.evictAll = false
+	s.timer = nil
+}
+
+// evictPoint drops the tiles showing lng/lat at every zoom with POIs,
+// including neighbors whose buffer reaches it. Callers hold s.mu.
+func (s *POISource) evictPoint(lng, lat float64) {
+	if len(s.cache) == 0 {
+		return
+	}
+	lat = math.Max(-85.0511, math.Min(85.0511, lat))
+	sinLat := math.Sin(lat * math.Pi / 180)
+	fx := (lng + 180) / 360
+	fy := 0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)
+
+	for z := POIMinZoom; z <= poiMaxZoom; z++ {
+		n := float64(int(1) << z)
+		for x := int(math.Floor(fx*n - poiBuffer)); x <= int(math.Floor(fx*n+poiBuffer)); x++ {
+			for y := int(math.Floor(fy*n - poiBuffer)); y <= int(math.Floor(fy*n+poiBuffer)); y++ {
+				delete(s.cache, tileKey{z, x, y})
+			}
+		}
+	}
+}
+
+func (s *POISource) render(ctx context.Context, z, x, y int) ([]byte, error) {
+	var rule *poiZoomRule
+	for i := range poiZoomRules {
+		if z >= poiZoomRules[i].minZoom {
+			rule = &poiZoomRules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil, nil
+	}
+
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		WITH bounds AS (
+			SELECT ST_TileEnvelope($1, $2, $3) AS env
+		),
+		mvtgeom AS (
+			SELECT
+				ST_AsMVTGeom(ST_Transform(b.geom, 3857), bounds.env, 4096, 64, true) AS geom,
+				b.id::text AS id,
+				b.name,
+				b.name_am,
+				b.category_id::text AS category_id,
+				c.name AS category,
+				c.icon,
+				COALESCE(b.avg_rating, 0)::float8 AS rating,
+				COALESCE(b.review_count, 0) AS review_count,
+				b.status
+			FROM businesses b
+			CROSS JOIN bounds
+			LEFT JOIN categories c ON b.category_id = c.id
+			WHERE b.geom && ST_Transform(
+				ST_Expand(bounds.env, (ST_XMax(bounds.env) - ST_XMin(bounds.env)) * 64 / 4096), 4326)
+			AND b.status IN ('verified', 'closed')
+			AND COALESCE(b.avg_rating, 0) >= $4
+			AND COALESCE(b.review_count, 0) >= $5
+			ORDER BY b.avg_rating DESC NULLS LAST, b.review_count DESC, b.view_count DESC
+			LIMIT $6
+		)
+		SELECT ST_AsMVT(mvtgeom.*, '`+POILayer+`', 4096, 'geom') FROM mvtgeom
+	`, z, x, y, rule.minRating, rule.minReviews, rule.limit).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
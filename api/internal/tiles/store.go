@@ -0,0 +1,283 @@
+package tiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reloadInterval is how often the tiles directory is checked for changes
+const reloadInterval = 10 * time.Second
+
+// ErrTilesetNotFound is returned for unknown tileset names
+var ErrTilesetNotFound = errors.New("tileset not found")
+
+// Tileset is a read-only source of prebuilt tiles
+type Tileset interface {
+	// Tile returns the stored tile at z/x/y (XYZ scheme) or nil if missing
+	Tile(ctx context.Context, z, x, y int) ([]byte, error)
+	Metadata() Metadata
+	ModTime() time.Time
+	Close() error
+
+	// source returns the path the tileset was opened from
+	source() string
+	// changed reports whether the file was replaced since it was opened
+	changed() bool
+}
+
+// openers maps file extensions to tileset readers. When a name exists in
+// both formats, PMTiles wins since it is the format we are moving to.
+var openers = []struct {
+	ext  string
+	open func(path string) (Tileset, error)
+}{
+	{".pmtiles", func(path string) (Tileset, error) { return OpenPMTiles(path) }},
+	{".mbtiles", func(path string) (Tileset, error) { return OpenMBTiles(path) }},
+}
+
+// sharedTileset counts the readers of a tileset. The store holds one
+// reference while the tileset is current; the file is closed when the last
+// reference is released, so a replaced tileset stays open for as long as
+// an offline build or request still reads it.
+type sharedTileset struct {
+	Tileset
+	refs atomic.Int64
+}
+
+func newSharedTileset(ts Tileset) *sharedTileset {
+	o := &sharedTileset{Tileset: ts}
+	o.refs.Store(1)
+	return o
+}
+
+func (o *sharedTileset) release() {
+	if o.refs.Add(-1) == 0 {
+		if err := o.Close(); err != nil {
+			log.Printf("Failed to close tileset %s: %v", o.source(), err)
+		}
+	}
+}
+
+// Store holds the tilesets found in a directory, keyed by file name without
+// extension ("addis.mbtiles" is served as "addis"). MBTiles and PMTiles can
+// sit side by side. Files that are added, removed or replaced on disk are
+// picked up without a restart.
+type Store struct {
+	dir   string
+	cache *Cache // optional
+
+	mu       sync.RWMutex
+	tilesets map[string]*sharedTileset
+	done     chan struct{}
+}
+
+// NewStore opens every tileset in dir and starts watching it. Tiles are
+// cached in cache when it is not nil.
+func NewStore(dir string, cache *Cache) *Store {
+	s := &Store{
+		dir:      dir,
+		cache:    cache,
+		tilesets: make(map[string]*sharedTileset),
+		done:     make(chan struct{}),
+	}
+	s.reload()
+	go s.watch()
+	return s
+}
+
+// Get returns a tileset by name. The caller must call release once done
+// reading; until then the tileset stays open even if it is replaced.
+func (s *Store) Get(name string) (ts Tileset, release func(), ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.tilesets[name]
+	if !ok {
+		return nil, nil, false
+	}
+	o.refs.Add(1)
+	return o.Tileset, o.release, true
+}
+
+// Tile returns the tile at z/x/y of a tileset, through the cache, along with
+// the tileset metadata. A missing tile has no Data.
+func (s *Store) Tile(ctx context.Context, name string, z, x, y int) (*Tile, Metadata, error) {
+	ts, release, ok := s.Get(name)
+	if !ok {
+		return nil, Metadata{}, ErrTilesetNotFound
+	}
+	defer release()
+	meta := ts.Metadata()
+
+	version := Version(ts)
+	if s.cache != nil {
+		if t, ok := s.cache.Get(name, version, z, x, y); ok {
+			return t, meta, nil
+		}
+	}
+
+	data, err := ts.Tile(ctx, z, x, y)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	t := NewTile(data)
+	if s.cache != nil {
+		s.cache.Put(name, version, z, x, y, t)
+	}
+	return t, meta, nil
+}
+
+// Version identifies a build of a tileset; it changes whenever the file is
+// replaced
+func Version(ts Tileset) string {
+	return strconv.FormatInt(ts.ModTime().UnixNano(), 36)
+}
+
+// Names returns the available tileset names in sorted order
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.tilesets))
+	for name := range s.tilesets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops watching and closes every tileset once its readers are done
+func (s *Store) Close() {
+	close(s.done)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, o := range s.tilesets {
+		delete(s.tilesets, name)
+		o.release()
+	}
+}
+
+func (s *Store) watch() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.reload()
+		}
+	}
+}
+
+// reload syncs the open tilesets with the directory contents
+func (s *Store) reload() {
+	paths := make(map[string]string) // name -> path
+	for i := len(openers) - 1; i >= 0; i-- {
+		matches, err := filepath.Glob(filepath.Join(s.dir, "*"+openers[i].ext))
+		if err != nil {
+			log.Printf("Failed to scan tiles dir %s: %v", s.dir, err)
+			return
+		}
+		for _, path := range matches {
+			paths[strings.TrimSuffix(filepath.Base(path), openers[i].ext)] = path
+		}
+	}
+
+	for name, path := range paths {
+		s.mu.RLock()
+		current, ok := s.tilesets[name]
+		s.mu.RUnlock()
+		if ok && !current.changed() && current.source() == path {
+			continue
+		}
+
+		ts, err := openTileset(path)
+		if err != nil {
+			// Possibly still being written; retry on the next tick
+			log.Printf("Failed to open tileset %s: %v", path, err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.tilesets[name] = newSharedTileset(ts)
+		s.mu.Unlock()
+
+		if s.cache != nil {
+			s.cache.PurgeTileset(name, Version(ts))
+		}
+
+		meta := ts.Metadata()
+		if ok {
+			log.Printf("Reloaded tileset %s from %s", name, filepath.Base(path))
+			current.release()
+		} else {
+			log.Printf("Loaded tileset %s from %s (%s, z%d-%d)", name, filepath.Base(path), meta.Format, meta.MinZoom, meta.MaxZoom)
+		}
+	}
+
+	s.mu.Lock()
+	for name, o := range s.tilesets {
+		if _, ok := paths[name]; !ok {
+			delete(s.tilesets, name)
+			if s.cache != nil {
+				s.cache.PurgeTileset(name, "")
+			}
+			log.Printf("Removed tileset %s", name)
+			o.release()
+		}
+	}
+	s.mu.Unlock()
+}
+
+func openTileset(path string) (Tileset, error) {
+	for _, o := range openers {
+		if strings.HasSuffix(path, o.ext) {
+			return o.open(path)
+		}
+	}
+	return nil, fmt.Errorf("unknown tileset format: %s", path)
+}
+
+// TileJSON builds a TileJSON 3.0 document for a tileset served at tileURL
+func TileJSON(meta Metadata, name, tileURL string) map[string]interface{} {
+	doc := map[string]interface{}{
+		"tilejson": "3.0.0",
+		"name":     name,
+		"scheme":   "xyz",
+		"format":   meta.Format,
+		"minzoom":  meta.MinZoom,
+		"maxzoom":  meta.MaxZoom,
+		"tiles":    []string{tileURL},
+	}
+	if meta.Name != "" {
+		doc["name"] = meta.Name
+	}
+	if meta.Description != "" {
+		doc["description"] = meta.Description
+	}
+	if meta.Attribution != "" {
+		doc["attribution"] = meta.Attribution
+	}
+	if len(meta.Bounds) == 4 {
+		doc["bounds"] = meta.Bounds
+	}
+	if len(meta.Center) >= 2 {
+		doc["center"] = meta.Center
+	}
+	if len(meta.VectorLayers) > 0 {
+		doc["vector_layers"] = meta.VectorLayers
+	}
+	return doc
+}
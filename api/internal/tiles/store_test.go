@@ -0,0 +1,43 @@
+package tiles
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeTileset struct {
+	closed bool
+}
+
+func (f *fakeTileset) Tile(context.Context, int, int, int) ([]byte, error) { return nil, nil }
+func (f *fakeTileset) Metadata() Metadata                                  { return Metadata{} }
+func (f *fakeTileset) ModTime() time.Time                                  { return time.Time{} }
+func (f *fakeTileset) Close() error                                        { f.closed = true; return nil }
+func (f *fakeTileset) source() string                                      { return "fake.mbtiles" }
+func (f *fakeTileset) changed() bool                                       { return false }
+
+func TestReplacedTilesetStaysOpenForReaders(t *testing.T) {
+	old := &fakeTileset{}
+	s := &Store{tilesets: map[string]*sharedTileset{"addis": newSharedTileset(old)}}
+
+	ts, release, ok := s.Get("addis")
+	if !ok || ts != old {
+		t.Fatal("tileset not found")
+	}
+
+	// What reload does when the file is replaced
+	s.mu.Lock()
+	current := s.tilesets["addis"]
+	s.tilesets["addis"] = newSharedTileset(&fakeTileset{})
+	s.mu.Unlock()
+	current.release()
+
+	if old.closed {
+		t.Fatal("replaced tileset closed while a reader still holds it")
+	}
+	release()
+	if !old.closed {
+		t.Fatal("replaced tileset not closed after its last reader")
+	}
+}
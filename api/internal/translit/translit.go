@@ -0,0 +1,216 @@
+// Package translit converts between Ge'ez (Ethiopic) script and a simple
+// ASCII Latin romanization, and folds spelling variants so that "buna",
+// "bunna" and "ቡና" all normalize to the same key.
+package translit
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	ethiopicStart = 0x1200
+	ethiopicEnd   = 0x137F
+)
+
+// consonants holds the Latin consonant for each 8-glyph row of the Ethiopic
+// block, indexed by (codepoint-0x1200)/8. An empty string marks the glottal
+// rows (አ, ዐ) which carry only a vowel. Labialized rows end in "w".
+var consonants = []string{
+	"h", "l", "h", "m", "s", "r", "s", "sh", // 1200-123F
+	"q", "qw", "q", "qw", "b", "v", "t", "ch", // 1240-127F
+	"h", "hw", "n", "ny", "", "k", "kw", "kh", // 1280-12BF
+	"khw", "w", "", "z", "zh", "y", "d", "d", // 12C0-12FF
+	"j", "g", "gw", "g", "t", "ch", "p", "ts", // 1300-133F
+	"ts", "f", "p", // 1340-1357
+}
+
+// vowels are the romanized vowel orders: ä, u, i, a, e, ə, o, wa.
+// The 6th order is usually silent or an epenthetic "i" and is dropped.
+var vowels = [8]string{"e", "u", "i", "a", "e", "", "o", "wa"}
+
+// labializedVowels apply to rows whose consonant already ends in "w"
+// (ቈ ቊ ቋ ቌ ቍ): orders 0,2,3,4,5 are used, the rest are unassigned.
+var labializedVowels = [8]string{"e", "", "i", "a", "e", "", "", ""}
+
+// glottalVowels replace the vowel table for the vowel-only rows (አ, ዐ),
+// where the 6th order is conventionally written "i" (እንጀራ -> injera).
+var glottalVowels = [8]string{"a", "u", "i", "a", "e", "i", "o", "wa"}
+
+// ToLatin romanizes every Ethiopic syllable in s and leaves other runes
+// untouched. Ethiopic word separators become spaces.
+func ToLatin(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '፡' || r == '።' || r == '፣' || r == '፤' || r == '፥' || r == '፦' || r == '፧' || r == '፨':
+			b.WriteByte(' ')
+		case r >= 0x1369 && r <= 0x1371: // Ethiopic digits ፩-፱
+			b.WriteRune('1' + (r - 0x1369))
+		case r >= ethiopicStart && r < ethiopicStart+rune(len(consonants))*8:
+			b.WriteString(syllable(r))
+		case r >= 0x1358 && r <= ethiopicEnd:
+			// Rare ligatures (ፘ ፙ ፚ) and numerals above nine: drop
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func syllable(r rune) string {
+	off := int(r - ethiopicStart)
+	cons := consonants[off/8]
+	order := off % 8
+
+	switch {
+	case cons == "":
+		return glottalVowels[order]
+	case strings.HasSuffix(cons, "w"):
+		if cons == "w" {
+			return cons + vowels[order]
+		}
+		return cons + labializedVowels[order]
+	case order == 0 && cons == "h":
+		// ሀ ሐ ኀ are pronounced "ha" in Amharic
+		return "ha"
+	}
+	return cons + vowels[order]
+}
+
+// latinOnsets are the consonant spellings recognized by ToGeez, longest
+// first so "sh" wins over "s".
+var latinOnsets = []struct {
+	latin string
+	row   rune
+}{
+	{"khw", 0x12C0}, {"sh", 0x1238}, {"ch", 0x1278}, {"ny", 0x1298}, {"gn", 0x1298},
+	{"zh", 0x12E0}, {"ts", 0x1338}, {"kh", 0x12B8}, {"qw", 0x1248}, {"kw", 0x12B0},
+	{"gw", 0x1310}, {"hw", 0x1288}, {"ph", 0x1348},
+	{"h", 0x1200}, {"l", 0x1208}, {"m", 0x1218}, {"r", 0x1228}, {"s", 0x1230},
+	{"q", 0x1240}, {"b", 0x1260}, {"v", 0x1268}, {"t", 0x1270}, {"n", 0x1290},
+	{"k", 0x12A8}, {"w", 0x12C8}, {"z", 0x12D8}, {"y", 0x12E8}, {"d", 0x12F0},
+	{"j", 0x1300}, {"g", 0x1308}, {"p", 0x1350}, {"f", 0x1348}, {"c", 0x12A8},
+	{"x", 0x12A8},
+}
+
+// latinVowels map a romanized vowel to its order. "e" is taken as the
+// 1st order (ä), the more frequent reading in shop and place names.
+var latinVowels = []struct {
+	latin string
+	order rune
+}{
+	{"wa", 7}, {"ie", 4}, {"ee", 4}, {"aa", 3}, {"e", 0}, {"u", 1}, {"i", 2}, {"a", 3}, {"o", 6},
+}
+
+// ToGeez converts romanized Amharic back to Ge'ez script. The mapping is
+// necessarily lossy (ሰ/ሠ, ሀ/ሐ/ኀ and ä/e are indistinguishable in Latin),
+// so it yields the most common spelling rather than the original.
+func ToGeez(s string) string {
+	lower := []rune(strings.ToLower(s))
+	var b strings.Builder
+
+	for i := 0; i < len(lower); {
+		r := lower[i]
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			b.WriteRune(r)
+			i++
+			continue
+		}
+
+		rest := string(lower[i:])
+		if row, n, ok := matchOnset(rest); ok {
+			i += n
+			// Collapse geminates: Amharic doesn't mark them in writing
+			for i < len(lower) && strings.HasPrefix(string(lower[i:]), rest[:n]) && !isVowel(lower[i]) {
+				i += n
+			}
+			order, vn := matchVowel(string(lower[i:]))
+			i += vn
+			if vn == 0 {
+				order = 5
+			}
+			b.WriteRune(row + order)
+			continue
+		}
+
+		// Vowel-initial syllable: carried by አ
+		order, vn := matchVowel(rest)
+		if vn == 0 {
+			b.WriteRune(r)
+			i++
+			continue
+		}
+		switch order {
+		case 0:
+			order = 4 // a bare "e" is ኤ
+		case 3:
+			order = 0 // a bare "a" is conventionally አ rather than ኣ
+		}
+		b.WriteRune(0x12A0 + order)
+		i += vn
+	}
+	return b.String()
+}
+
+func matchOnset(s string) (rune, int, bool) {
+	for _, o := range latinOnsets {
+		if strings.HasPrefix(s, o.latin) {
+			return o.row, len(o.latin), true
+		}
+	}
+	return 0, 0, false
+}
+
+func matchVowel(s string) (rune, int) {
+	for _, v := range latinVowels {
+		if strings.HasPrefix(s, v.latin) {
+			return v.order, len(v.latin)
+		}
+	}
+	return 0, 0
+}
+
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aeiou", r)
+}
+
+// HasGeez reports whether s contains any Ethiopic syllable
+func HasGeez(s string) bool {
+	for _, r := range s {
+		if r >= ethiopicStart && r <= ethiopicEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// Fold produces the script-independent search key for s: it romanizes
+// Ge'ez, lowercases, strips apostrophes used for ejectives, and folds the
+// common spelling variants (e/a, c/k, doubled consonants and vowels).
+func Fold(s string) string {
+	latin := []rune(strings.ToLower(ToLatin(s)))
+
+	var b strings.Builder
+	var prev rune
+	for i, r := range latin {
+		switch r {
+		case '\'', '`', '’':
+			continue
+		case 'e':
+			r = 'a'
+		case 'c':
+			// "tomoca" and "tomoka" are the same place; keep "ch"
+			if i+1 >= len(latin) || latin[i+1] != 'h' {
+				r = 'k'
+			}
+		}
+		// ss -> s, dd -> d, aa -> a (after e/a folding, "ea" -> "a" too)
+		if r == prev && unicode.IsLetter(r) {
+			continue
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package translit
+
+import "testing"
+
+func TestToLatin(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"ቡና", "buna"},
+		{"ሻይ", "shay"},
+		{"እንጀራ", "injera"},
+		{"አዲስ አበባ", "adis abeba"},
+		{"ቆንጆ", "qonjo"},
+		{"መርካቶ", "merkato"},
+		{"ቶሞካ ቡና", "tomoka buna"},
+		{"Tomoca ቡና", "Tomoca buna"},
+		{"Bole 24", "Bole 24"},
+	} {
+		if got := ToLatin(tc.in); got != tc.want {
+			t.Errorf("ToLatin(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestToGeez(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"buna", "ቡና"},
+		{"bunna", "ቡና"}, // geminates aren't written
+		{"Buna", "ቡና"},
+		{"shay", "ሻይ"},
+		{"adis abeba", "አዲስ አበባ"},
+		{"addis", "አዲስ"},
+		{"merkato", "መርካቶ"},
+		{"tomoca", "ቶሞካ"},
+		{"Tomoca ቡና", "ቶሞካ ቡና"},
+		{"24", "24"},
+	} {
+		if got := ToGeez(tc.in); got != tc.want {
+			t.Errorf("ToGeez(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, s := range []string{"ቡና", "ሻይ", "አዲስ አበባ", "ቆንጆ", "መርካቶ", "ቶሞካ", "ሰላም", "ኮካ"} {
+		if got := ToGeez(ToLatin(s)); got != s {
+			t.Errorf("ToGeez(ToLatin(%q)) = %q", s, got)
+		}
+	}
+	// Lossy spellings still fold to the same key
+	for _, s := range []string{"ጤና", "እንጀራ", "ጣና ሆቴል"} {
+		if got := ToGeez(ToLatin(s)); Fold(got) != Fold(s) {
+			t.Errorf("ToGeez(ToLatin(%q)) = %q folds to %q, want %q", s, got, Fold(got), Fold(s))
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"buna", "buna"},
+		{"Bunna", "buna"},  // ss/s: doubled consonants
+		{"Bunnaa", "buna"}, // doubled vowels
+		{"ቡና", "buna"},
+		{"selam", "salam"}, // e/a
+		{"ሰላም", "salam"},
+		{"Addis Abeba", "adis ababa"},
+		{"አዲስ አበባ", "adis ababa"},
+		{"Tomoca", "tomoka"}, // c/k
+		{"chai", "chai"},     // but not in "ch"
+		{"t'ena", "tana"},    // ejective apostrophes
+		{"Tomoca ቡና", "tomoka buna"},
+	} {
+		if got := Fold(tc.in); got != tc.want {
+			t.Errorf("Fold(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFoldMatchesAcrossScripts(t *testing.T) {
+	for _, tc := range []struct{ latin, geez string }{
+		{"buna", "ቡና"},
+		{"bunna", "ቡና"},
+		{"addis ababa", "አዲስ አበባ"},
+		{"merkato", "መርካቶ"},
+		{"mercato", "መርካቶ"},
+		{"tomoca", "ቶሞካ"},
+		{"selam", "ሰላም"},
+		{"salam", "ሰላም"},
+		{"tena", "ጤና"},
+		{"injera", "እንጀራ"},
+		{"tomoca buna", "Tomoca ቡና"},
+	} {
+		if Fold(tc.latin) != Fold(tc.geez) {
+			t.Errorf("Fold(%q) = %q, Fold(%q) = %q", tc.latin, Fold(tc.latin), tc.geez, Fold(tc.geez))
+		}
+		if got := Fold(ToGeez(tc.latin)); got != Fold(tc.latin) {
+			t.Errorf("Fold(ToGeez(%q)) = %q, want %q", tc.latin, got, Fold(tc.latin))
+		}
+	}
+}